@@ -0,0 +1,254 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "strings"
+
+// minAltSimilarity is the minimum similarity for two different alternatives
+// to be considered the same, modified, alternative.
+const minAltSimilarity = 0.5
+
+// altChange describes how an alternative of a choice expression differs
+// between the lhs and rhs rules.  Indices are 1 based, with 0 meaning that
+// the alternative is not present.
+type altChange struct {
+	kind     changeKind
+	li, ri   int
+	lhs, rhs string
+	moved    bool
+}
+
+// alternatives splits expr into the alternatives of its top level choice.
+func alternatives(toks []string) []string {
+	var alts []string
+	var b strings.Builder
+	depth := 0
+	for _, tok := range toks {
+		switch tok {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case "/":
+			if depth == 0 {
+				alts = append(alts, strings.TrimSpace(b.String()))
+				b.Reset()
+
+				continue
+			}
+		}
+		b.WriteString(tok)
+	}
+	alts = append(alts, strings.TrimSpace(b.String()))
+
+	return alts
+}
+
+// similarity returns a measure of the similarity of two expressions in the
+// range [0, 1], ignoring white space.  Expressions are compared both token by
+// token and byte by byte, so that a renamed reference or a changed literal is
+// still similar to the original.
+func similarity(a, b string) float64 {
+	atoks := significant(tokenize(a))
+	btoks := significant(tokenize(b))
+	s1 := ratio(atoks, btoks)
+	s2 := ratio([]byte(strings.Join(atoks, " ")), []byte(strings.Join(btoks, " ")))
+	if s2 > s1 {
+		return s2
+	}
+
+	return s1
+}
+
+// maxRatioLen is the maximum total length of the sequences whose ratio is
+// computed from their longest common subsequence.
+const maxRatioLen = 1000
+
+// ratio returns twice the length of the longest common subsequence of a and
+// b, divided by the total length.  For longer sequences than maxRatioLen it
+// returns the estimate of bigramRatio.
+func ratio[T comparable](a, b []T) float64 {
+	if len(a)+len(b) == 0 {
+		return 1
+	}
+	if len(a)+len(b) > maxRatioLen {
+		return bigramRatio(a, b)
+	}
+	n := 0
+	for _, e := range myers(a, b) {
+		if e.op == opEqual {
+			n++
+		}
+	}
+
+	return 2 * float64(n) / float64(len(a)+len(b))
+}
+
+// bigramRatio returns twice the number of bigrams, or of elements when a
+// sequence is shorter than 2, common to a and b, divided by their total
+// number, in linear time and space.
+func bigramRatio[T comparable](a, b []T) float64 {
+	if len(a) < 2 || len(b) < 2 {
+		count := make(map[T]int)
+		for _, e := range a {
+			count[e]++
+		}
+		n := 0
+		for _, e := range b {
+			if count[e] > 0 {
+				count[e]--
+				n++
+			}
+		}
+
+		return 2 * float64(n) / float64(len(a)+len(b))
+	}
+	count := make(map[[2]T]int)
+	for i := 1; i < len(a); i++ {
+		count[[2]T{a[i-1], a[i]}]++
+	}
+	n := 0
+	for i := 1; i < len(b); i++ {
+		if k := [2]T{b[i-1], b[i]}; count[k] > 0 {
+			count[k]--
+			n++
+		}
+	}
+
+	return 2 * float64(n) / float64(len(a)+len(b)-2)
+}
+
+// significant returns toks without white space.
+func significant(toks []string) []string {
+	list := make([]string, 0, len(toks))
+	for _, tok := range toks {
+		if !isSpaceToken(tok) {
+			list = append(list, tok)
+		}
+	}
+
+	return list
+}
+
+// diffAlternatives matches the alternatives of the lhs and rhs choice
+// expressions, first by equality and then by similarity, returning the
+// changed alternatives in rhs order followed by the removed ones.  It returns
+// nil when neither expression is a choice.
+func diffAlternatives(ltoks, rtoks []string) []altChange {
+	lalts := alternatives(ltoks)
+	ralts := alternatives(rtoks)
+	if len(lalts) == 1 && len(ralts) == 1 {
+		return nil
+	}
+
+	// Match identical alternatives.
+	lmatch := make([]int, len(lalts)) // rhs index + 1
+	rmatch := make([]int, len(ralts)) // lhs index + 1
+	for j, ralt := range ralts {
+		for i, lalt := range lalts {
+			if lmatch[i] == 0 && lalt == ralt {
+				lmatch[i] = j + 1
+				rmatch[j] = i + 1
+
+				break
+			}
+		}
+	}
+
+	// Greedily match the most similar remaining alternatives, computing
+	// the similarity of each pair once.
+	sim := make([][]float64, len(ralts))
+	for j, ralt := range ralts {
+		if rmatch[j] != 0 {
+			continue
+		}
+		sim[j] = make([]float64, len(lalts))
+		for i, lalt := range lalts {
+			if lmatch[i] == 0 {
+				sim[j][i] = similarity(lalt, ralt)
+			}
+		}
+	}
+	for {
+		best, bi, bj := minAltSimilarity, -1, -1
+		for j := range ralts {
+			if rmatch[j] != 0 {
+				continue
+			}
+			for i := range lalts {
+				if lmatch[i] != 0 {
+					continue
+				}
+				if s := sim[j][i]; s >= best && (bi < 0 || s > best) {
+					best, bi, bj = s, i, j
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		lmatch[bi] = bj + 1
+		rmatch[bj] = bi + 1
+	}
+
+	// An alternative has moved when its order relative to the other matched
+	// alternatives changed.
+	var lorder, rorder []int
+	for i, j := range lmatch {
+		if j != 0 {
+			lorder = append(lorder, i)
+		}
+	}
+	for _, i := range rmatch {
+		if i != 0 {
+			rorder = append(rorder, i-1)
+		}
+	}
+	inplace := make(map[int]bool)
+	for _, e := range myers(lorder, rorder) {
+		if e.op == opEqual {
+			inplace[lorder[e.i]] = true
+		}
+	}
+
+	var changes []altChange
+	for j, ralt := range ralts {
+		i := rmatch[j] - 1
+		if i < 0 {
+			changes = append(changes, altChange{
+				kind: ruleAdded,
+				ri:   j + 1,
+				rhs:  ralt,
+			})
+
+			continue
+		}
+		c := altChange{
+			kind:  ruleEqual,
+			li:    i + 1,
+			ri:    j + 1,
+			lhs:   lalts[i],
+			rhs:   ralt,
+			moved: !inplace[i],
+		}
+		if lalts[i] != ralt {
+			c.kind = ruleModified
+		}
+		if c.kind != ruleEqual || c.moved {
+			changes = append(changes, c)
+		}
+	}
+	for i, lalt := range lalts {
+		if lmatch[i] == 0 {
+			changes = append(changes, altChange{
+				kind: ruleRemoved,
+				li:   i + 1,
+				lhs:  lalt,
+			})
+		}
+	}
+
+	return changes
+}
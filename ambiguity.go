@@ -0,0 +1,239 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// cfgDirective marks a rule converted by hand from a CFG dialect, checked as
+// the rules read by a dialect plugin.
+const cfgDirective = "pegcmp:cfg"
+
+// Limits of the sampling of the strings matched by the alternatives.
+const (
+	ambiguitySamples  = 32  // strings sampled from each alternative
+	ambiguityExamples = 3   // example strings reported for an overlap
+	ambiguityDepth    = 8   // nested rule references of a sample
+	ambiguityLen      = 64  // length of a sample
+	ambiguitySteps    = 1e4 // evaluated expressions matching a sample
+)
+
+// cfgAmbiguityAnalyzer reports, in the rules imported from a CFG dialect,
+// the alternatives of a choice that overlap: in a CFG both derive the same
+// strings, while the ordered choice of a PEG silently picks the first.  The
+// example strings are found by sampling the strings matched by each
+// alternative or, failing that, by their common required prefix.
+var cfgAmbiguityAnalyzer = &analyzer{
+	name: "cfg-ambiguity",
+	run:  runCFGAmbiguity,
+}
+
+func runCFGAmbiguity(s *syntax) []finding {
+	var list []finding
+	p := newProps(s)
+	smp := &sampler{s: s, lengths: newLengths(s), rand: rand.New(rand.NewSource(1))}
+	for i := range s.rules {
+		rule := &s.rules[i]
+		root, ok := s.nodes[rule.Name]
+		if !ok || dialectPlugin(rule.Pos.Filename) == nil && !rule.hasDirective(cfgDirective) {
+			continue
+		}
+		walk(root, func(n node) {
+			ch, ok := n.(*choiceNode)
+			if !ok {
+				return
+			}
+			where := ""
+			if n != root {
+				pos, end := ch.span()
+				where = fmt.Sprintf("in (%s), ", rule.Expr[pos:end])
+			}
+			samples := make([][]string, len(ch.alts))
+			for j, alt := range ch.alts {
+				samples[j] = smp.samples(alt)
+			}
+			for j, alt := range ch.alts {
+				for k := 0; k < j; k++ {
+					if shadowedBy(p, ch.alts[k:j], alt) == 0 {
+						continue // reported by choice-order
+					}
+					desc := smp.overlap(p, ch.alts[k], alt, samples[k], samples[j])
+					if desc == "" {
+						continue
+					}
+					list = append(list, finding{
+						severity: severityWarning,
+						rule:     rule,
+						msg: fmt.Sprintf("%salternatives %d %s and %d %s overlap, %s; the ordered choice picks alternative %d",
+							where, k+1, text(rule, ch.alts[k]), j+1, text(rule, alt), desc, k+1),
+					})
+				}
+			}
+		})
+	}
+
+	return list
+}
+
+// sampler generates strings matched by the expressions of a grammar, with
+// random derivations.
+type sampler struct {
+	s       *syntax
+	lengths *lengths
+	rand    *rand.Rand
+}
+
+// samples returns distinct strings matched by n.
+func (smp *sampler) samples(n node) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for i := 0; i < ambiguitySamples; i++ {
+		var b strings.Builder
+		if !smp.gen(&b, n, 0) || seen[b.String()] {
+			continue
+		}
+		seen[b.String()] = true
+		if end, ok := matchNode(smp.s, n, b.String()); ok && end == b.Len() {
+			list = append(list, b.String())
+		}
+	}
+
+	return list
+}
+
+// gen writes to b a string probably matched by n, reporting whether one was
+// generated.  Past the maximum depth, the alternatives and repetitions with
+// the shortest match are chosen, so that the derivation ends.
+func (smp *sampler) gen(b *strings.Builder, n node, depth int) bool {
+	if b.Len() > ambiguityLen {
+		return false
+	}
+	switch n := n.(type) {
+	case *choiceNode:
+		alt := n.alts[smp.rand.Intn(len(n.alts))]
+		if depth >= ambiguityDepth {
+			for _, a := range n.alts {
+				if smp.lengths.minLen(a) < smp.lengths.minLen(alt) {
+					alt = a
+				}
+			}
+		}
+
+		return smp.gen(b, alt, depth)
+	case *seqNode:
+		for _, item := range n.items {
+			if !smp.gen(b, item, depth) {
+				return false
+			}
+		}
+
+		return true
+	case *repeatNode:
+		lo, hi := n.bounds()
+		count := lo
+		if depth < ambiguityDepth {
+			extra := 3
+			if hi >= 0 {
+				extra = min(extra, hi-lo+1)
+			}
+			count += smp.rand.Intn(extra)
+		}
+		for i := 0; i < count; i++ {
+			if !smp.gen(b, n.expr, depth) {
+				return false
+			}
+		}
+
+		return true
+	case *recoveryNode:
+		return smp.gen(b, n.expr, depth)
+	case *refNode:
+		body, ok := smp.s.nodes[n.name]
+		if !ok || depth > 2*ambiguityDepth {
+			return false
+		}
+
+		return smp.gen(b, body, depth+1)
+	case *litNode:
+		b.WriteString(n.value)
+
+		return true
+	case *classNode:
+		if len(n.set) == 0 {
+			return false
+		}
+		r := n.set[smp.rand.Intn(len(n.set))]
+		lo := r.lo
+		if lo < ' ' && r.hi >= ' ' {
+			lo = ' ' // prefer a printable character
+		}
+		b.WriteRune(lo + rune(smp.rand.Intn(int(min(r.hi-lo, 25))+1)))
+
+		return true
+	case *anyNode:
+		b.WriteByte('x')
+
+		return true
+	case *throwNode:
+		return false
+	}
+
+	// Predicates and state blocks match the empty string; the samples
+	// violating a predicate are discarded by matching them.
+	return true
+}
+
+// overlap returns the description of the overlap of the alternatives first
+// and second, with the example strings matched by both, or an empty string.
+func (smp *sampler) overlap(p *props, first, second node, fsamples, ssamples []string) string {
+	var both, prefixes []string
+	seen := make(map[string]bool)
+	for _, w := range append(ssamples, fsamples...) {
+		if seen[w] || len(both) == ambiguityExamples {
+			continue
+		}
+		seen[w] = true
+		fend, fok := matchNode(smp.s, first, w)
+		send, sok := matchNode(smp.s, second, w)
+		switch {
+		case fok && sok && fend == len(w) && send == len(w):
+			both = append(both, strconv.Quote(w))
+		case fok && sok && fend > 0 && fend < send && len(prefixes) < ambiguityExamples:
+			prefixes = append(prefixes, fmt.Sprintf("%q of %q", w[:fend], w[:send]))
+		}
+	}
+	switch {
+	case len(both) > 0:
+		return "both match " + strings.Join(both, ", ")
+	case len(prefixes) > 0:
+		return "the first matches the prefix " + strings.Join(prefixes, ", ")
+	}
+	if prefix := commonPrefix(p.startsWith(first), p.startsWith(second)); prefix != "" {
+		return fmt.Sprintf("both start with %q", prefix)
+	}
+
+	return ""
+}
+
+// matchNode matches n with input from the start, returning the end of the
+// match.  A match over budget fails.
+func matchNode(s *syntax, n node, input string) (end int, ok bool) {
+	m := newMachine(s, input, newProfile())
+	m.maxSteps = ambiguitySteps
+	defer func() {
+		if v := recover(); v != nil {
+			if v != errStepLimit {
+				panic(v)
+			}
+			end, ok = 0, false
+		}
+	}()
+
+	return m.match(n, 0)
+}
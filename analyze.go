@@ -0,0 +1,199 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// severity is the severity of a finding.
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarning
+	severityError
+)
+
+var severityNames = [...]string{
+	severityInfo:    "info",
+	severityWarning: "warning",
+	severityError:   "error",
+}
+
+func (s severity) String() string {
+	return severityNames[s]
+}
+
+// finding is a problem, or a suggestion, reported by an analyzer for a rule.
+type finding struct {
+	analyzer string
+	severity severity
+	rule     *Rule
+	msg      string
+}
+
+// analyzer is a static analysis of a grammar.  The analyzer name of the
+// returned findings is set by analyze.
+type analyzer struct {
+	name string
+	run  func(s *syntax) []finding
+}
+
+// analyzers are the static analyses run by lint and compare.
+var analyzers = []*analyzer{
+	choiceOrderAnalyzer,
+	backtrackAnalyzer,
+	leftRecursionAnalyzer,
+	wellFormedAnalyzer,
+	leftFactorAnalyzer,
+	cfgAmbiguityAnalyzer,
+	budgetAnalyzer,
+}
+
+// analyze runs all the analyzers on s, returning the findings in rule order
+// and, for the same rule, in analyzer order.
+func analyze(s *syntax) []finding {
+	var list []finding
+	for _, a := range analyzers {
+		for _, f := range a.run(s) {
+			f.analyzer = a.name
+			list = append(list, f)
+		}
+	}
+
+	// Sort by the index of the rule, since the offsets of rules from
+	// included files are not comparable.
+	index := make(map[*Rule]int)
+	for i := range s.rules {
+		index[&s.rules[i]] = i
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return index[list[i].rule] < index[list[j].rule]
+	})
+
+	return list
+}
+
+// newFindings returns the rhs findings that are not reported for the same
+// rule in lhs.
+func newFindings(lfindings, rfindings []finding) []finding {
+	type key struct {
+		analyzer, name, msg string
+	}
+	seen := make(map[key]bool)
+	for _, f := range lfindings {
+		seen[key{f.analyzer, f.rule.Name, f.msg}] = true
+	}
+
+	var list []finding
+	for _, f := range rfindings {
+		if !seen[key{f.analyzer, f.rule.Name, f.msg}] {
+			list = append(list, f)
+		}
+	}
+
+	return list
+}
+
+// grammarIssues returns the problems that make the grammar at path invalid,
+// as error findings: the duplicate rules that do not match, the references
+// to undefined rules and, with leftRecursion, the left recursive rules.
+func grammarIssues(path string, grammar []Rule, leftRecursion bool) []finding {
+	var list []finding
+	for _, err := range splitErrors(validate(path, grammar)) {
+		var derr *DuplicateRuleError
+		if errors.As(err, &derr) {
+			list = append(list, finding{
+				analyzer: "duplicate",
+				severity: severityError,
+				rule:     &Rule{Name: derr.Name, Pos: derr.Pos, Expr: derr.Expr},
+				msg:      fmt.Sprintf("duplicate rule does not match the definition at %s", derr.PrevPos),
+			})
+		}
+	}
+
+	s := newSyntax(grammar)
+	seen := make(map[string]bool)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		n, ok := s.nodes[rule.Name]
+		if !ok || seen[rule.Name] {
+			continue
+		}
+		seen[rule.Name] = true
+		for _, name := range refs(n) {
+			if _, ok := s.nodes[name]; ok {
+				continue
+			}
+			if _, ok := s.errs[name]; ok {
+				continue
+			}
+			list = append(list, finding{
+				analyzer: "undefined",
+				severity: severityError,
+				rule:     rule,
+				msg:      fmt.Sprintf("reference to undefined rule %q", name),
+			})
+		}
+	}
+
+	if leftRecursion {
+		for _, f := range runLeftRecursion(s) {
+			f.analyzer = leftRecursionAnalyzer.name
+			f.severity = severityError
+			list = append(list, f)
+		}
+	}
+
+	return list
+}
+
+// writeFindings writes each finding in the file:line:col: format.
+func writeFindings(w io.Writer, findings []finding) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s: %s: rule %q: %s (%s)\n",
+			f.rule.Pos, f.severity, f.rule.Name, f.msg, f.analyzer)
+	}
+}
+
+// runLint runs the analyzers on each grammar.
+func runLint(args []string) {
+	if len(args) == 0 {
+		flag.Usage()
+
+		os.Exit(2)
+	}
+
+	if *policyFlag != "" {
+		pol, err := readPolicy(cliFS, cliFS.name(*policyFlag))
+		if err != nil {
+			fatal(err)
+		}
+		sizeBudget = sizeBudget.or(pol.budget)
+	}
+
+	status := 0
+	for _, path := range args {
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		if grammar, err = resolveDuplicates(path, grammar, *duplicatesFlag); err != nil {
+			fatal(err)
+		}
+		findings := analyze(newSyntax(grammar))
+		writeFindings(os.Stdout, findings)
+		if len(findings) > 0 {
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
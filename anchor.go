@@ -0,0 +1,80 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// offsetPos returns the position of the byte offset off in the grammar file
+// of rule, with off in the text of rule.
+func offsetPos(rule *Rule, off int) Pos {
+	p := rule.Pos
+	text := rule.Text[:off-rule.Pos.Offset]
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		p.Line += strings.Count(text, "\n")
+		p.Col = 1 + utf8.RuneCountInString(text[i+1:])
+	} else {
+		p.Col += utf8.RuneCountInString(text)
+	}
+	p.Offset = off
+
+	return p
+}
+
+// anchor is the location of a changed part of a rule.
+type anchor struct {
+	pos  Pos
+	text string // the changed part, on a single line
+}
+
+// ruleAnchors returns the locations of the changed parts of rule, with the
+// ranges returned by sourceRanges.
+func ruleAnchors(rule *Rule, ranges []byteRange) []anchor {
+	var list []anchor
+	for _, r := range ranges {
+		src := rule.Text[r.pos-rule.Pos.Offset : r.end-rule.Pos.Offset]
+		list = append(list, anchor{offsetPos(rule, r.pos), joinTokens(styleTokens(src))})
+	}
+
+	return list
+}
+
+// writeAnchors writes the locations of the changed parts of the lhs and rhs
+// rules of a change after the expressions written with prefix.
+func writeAnchors(w io.Writer, prefix string, list []anchor) {
+	for _, a := range list {
+		fmt.Fprintf(w, "%s %s: %s\n", prefix, textPos(a.pos), colorText(a.text))
+	}
+}
+
+// textPos returns p in the file:line:col format as written in the text
+// outputs: with -hyperlinks, as an OSC 8 hyperlink to the grammar file, when
+// the file exists.
+func textPos(p Pos) string {
+	if !*hyperlinksFlag {
+		return p.String()
+	}
+	path, err := filepath.Abs(p.Filename)
+	if err != nil {
+		return p.String()
+	}
+	if _, err := os.Stat(path); err != nil {
+		return p.String()
+	}
+	host, _ := os.Hostname()
+	u := url.URL{Scheme: "file", Host: host, Path: filepath.ToSlash(path)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path // Windows drive letter
+	}
+
+	return "\x1b]8;;" + u.String() + "\x1b\\" + p.String() + "\x1b]8;;\x1b\\"
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveFS is the file system of a zip or tar archive, that reports names
+// as path/name.
+type archiveFS struct {
+	fs.FS
+	path string // operating system path of the archive
+}
+
+func (a *archiveFS) displayName(name string) string {
+	if name == "." {
+		return a.path
+	}
+
+	return a.path + "/" + name
+}
+
+// isArchive reports whether p is the path of a supported archive.
+func isArchive(p string) bool {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openPath returns the file system and the name of the file or directory at
+// the operating system path p.  The root of an archive is its directory.
+func openPath(p string) (fs.FS, string, error) {
+	if !isArchive(p) {
+		return cliFS, cliFS.name(p), nil
+	}
+
+	var fsys fs.FS
+	var err error
+	if strings.HasSuffix(p, ".zip") {
+		fsys, err = openZip(p)
+	} else {
+		fsys, err = openTar(p)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &archiveFS{fsys, displayName(cliFS, cliFS.name(p))}, ".", nil
+}
+
+func openZip(p string) (fs.FS, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// openTar reads the regular files of the tar archive at p, optionally gzip
+// compressed, in memory.
+func openTar(p string) (fs.FS, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(p, ".tar") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+
+	fsys := make(memFS)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if hdr.Typeflag != tar.TypeReg || !fs.ValidPath(name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		fsys[name] = &memFile{data: data, modTime: hdr.ModTime}
+	}
+
+	return fsys, nil
+}
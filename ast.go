@@ -0,0 +1,577 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// node is a node of the abstract syntax tree of a rule expression.
+type node interface {
+	// span returns the byte offsets of the node in the rule expression.
+	span() (pos, end int)
+}
+
+// nodeSpan implements the span method of node.
+type nodeSpan struct {
+	pos, end int
+}
+
+func (s nodeSpan) span() (int, int) {
+	return s.pos, s.end
+}
+
+// Expression nodes.
+type (
+	// choiceNode is an ordered choice e1 / e2 / ...
+	choiceNode struct {
+		nodeSpan
+		alts []node
+	}
+
+	// seqNode is a sequence e1 e2 ...
+	seqNode struct {
+		nodeSpan
+		items []node
+	}
+
+	// predNode is an and (&e) or not (!e) syntactic predicate.
+	predNode struct {
+		nodeSpan
+		op   byte
+		expr node
+	}
+
+	// repeatNode is an optional (e?), zero or more (e*), one or more (e+)
+	// or bounded (e{min,max}) repetition.  Bounds equivalent to the other
+	// operators are parsed as the operator.
+	repeatNode struct {
+		nodeSpan
+		op     byte
+		expr   node
+		lo, hi int // bounds of e{lo,hi}, with hi -1 when unbounded
+	}
+
+	// recoveryNode is a recovery expression e //{label, ...} r, matching r
+	// when e fails with one of the labels.
+	recoveryNode struct {
+		nodeSpan
+		expr    node
+		labels  []string
+		recover node
+	}
+
+	// throwNode is a labeled failure %{label}.
+	throwNode struct {
+		nodeSpan
+		label string
+	}
+
+	// stateNode is a state change block #{code}, that matches the empty
+	// string.  The code is kept with its white space collapsed.
+	stateNode struct {
+		nodeSpan
+		code string
+	}
+
+	// refNode is a reference to a rule.
+	refNode struct {
+		nodeSpan
+		name string
+	}
+
+	// litNode is a literal, with its unescaped value.
+	litNode struct {
+		nodeSpan
+		text  string
+		value string
+	}
+
+	// classNode is a character class, with its set of code points.
+	classNode struct {
+		nodeSpan
+		text string
+		set  runeSet
+	}
+
+	// anyNode matches any character.
+	anyNode struct {
+		nodeSpan
+	}
+)
+
+// exprParser parses a rule expression.
+type exprParser struct {
+	expr string
+	toks []string
+	offs []int // byte offset of each token
+	i    int
+}
+
+// parseExpr parses the rule expression expr.
+func parseExpr(expr string) (node, error) {
+	p := &exprParser{expr: expr}
+	off := 0
+	for _, tok := range tokenize(expr) {
+		if !isSpaceToken(tok) && !isCommentToken(tok) {
+			p.toks = append(p.toks, tok)
+			p.offs = append(p.offs, off)
+		}
+		off += len(tok)
+	}
+
+	n, err := p.parseRecovery()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.toks) {
+		return nil, p.errorf("unexpected %s", p.toks[p.i])
+	}
+
+	return n, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+
+	return ""
+}
+
+// pos returns the byte offset of the current token.
+func (p *exprParser) pos() int {
+	if p.i < len(p.offs) {
+		return p.offs[p.i]
+	}
+
+	return len(p.expr)
+}
+
+// end returns the byte offset after the previous token.
+func (p *exprParser) end() int {
+	if p.i == 0 {
+		return 0
+	}
+
+	return p.offs[p.i-1] + len(p.toks[p.i-1])
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", p.pos(), fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) parseRecovery() (node, error) {
+	pos := p.pos()
+	n, err := p.parseChoice()
+	if err != nil {
+		return nil, err
+	}
+	for isRecovery(p.peek()) {
+		labels, ok := parseLabels(p.peek()[3 : len(p.peek())-1])
+		if !ok {
+			return nil, p.errorf("invalid recovery labels %s", p.peek())
+		}
+		p.i++
+		r, err := p.parseChoice()
+		if err != nil {
+			return nil, err
+		}
+		n = &recoveryNode{nodeSpan{pos, p.end()}, n, labels, r}
+	}
+
+	return n, nil
+}
+
+// isRecovery reports whether tok is the //{label, ...} operator of a
+// recovery expression.
+func isRecovery(tok string) bool {
+	return strings.HasPrefix(tok, "//{") && strings.HasSuffix(tok, "}")
+}
+
+// parseLabels parses a comma separated list of failure labels.
+func parseLabels(s string) ([]string, bool) {
+	var labels []string
+	for _, label := range strings.Split(s, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" || !isIdent(label) {
+			return nil, false
+		}
+		labels = append(labels, label)
+	}
+
+	return labels, true
+}
+
+func (p *exprParser) parseChoice() (node, error) {
+	pos := p.pos()
+	var alts []node
+	for {
+		n, err := p.parseSeq()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, n)
+		if p.peek() != "/" {
+			break
+		}
+		p.i++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+
+	return &choiceNode{nodeSpan{pos, p.end()}, alts}, nil
+}
+
+func (p *exprParser) parseSeq() (node, error) {
+	pos := p.pos()
+	var items []node
+	for {
+		if tok := p.peek(); tok == "" || tok == "/" || tok == ")" || isRecovery(tok) {
+			if len(items) == 1 {
+				return items[0], nil
+			}
+
+			return &seqNode{nodeSpan{pos, p.end()}, items}, nil
+		}
+		n, err := p.parsePrefix()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, n)
+	}
+}
+
+func (p *exprParser) parsePrefix() (node, error) {
+	pos := p.pos()
+	if tok := p.peek(); tok == "&" || tok == "!" {
+		p.i++
+		n, err := p.parseSuffix()
+		if err != nil {
+			return nil, err
+		}
+
+		return &predNode{nodeSpan{pos, p.end()}, tok[0], n}, nil
+	}
+
+	return p.parseSuffix()
+}
+
+func (p *exprParser) parseSuffix() (node, error) {
+	pos := p.pos()
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok == "?" || tok == "*" || tok == "+" {
+		p.i++
+		n = &repeatNode{nodeSpan: nodeSpan{pos, p.end()}, op: tok[0], expr: n}
+	} else if tok != "" && tok[0] == '{' {
+		lo, hi, ok := parseBound(tok)
+		if !ok {
+			return nil, p.errorf("invalid repetition bound %s", tok)
+		}
+		p.i++
+		span := nodeSpan{pos, p.end()}
+		switch {
+		case lo == 0 && hi == 1:
+			n = &repeatNode{nodeSpan: span, op: '?', expr: n}
+		case lo == 0 && hi < 0:
+			n = &repeatNode{nodeSpan: span, op: '*', expr: n}
+		case lo == 1 && hi < 0:
+			n = &repeatNode{nodeSpan: span, op: '+', expr: n}
+		case lo == 1 && hi == 1:
+			// e{1} is e.
+		default:
+			n = &repeatNode{nodeSpan: span, op: '{', expr: n, lo: lo, hi: hi}
+		}
+	}
+
+	return n, nil
+}
+
+// parseBound parses a repetition bound {n}, {min,}, {,max} or {min,max}.
+// The result is false when the bound is invalid or max is less than min.
+func parseBound(tok string) (lo, hi int, ok bool) {
+	if len(tok) < 2 || tok[len(tok)-1] != '}' {
+		return 0, 0, false
+	}
+	atoi := func(s string, empty int) (int, bool) {
+		if s == "" {
+			return empty, true
+		}
+		for i := 0; i < len(s); i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return 0, false
+			}
+		}
+		v, err := strconv.Atoi(s)
+
+		return v, err == nil
+	}
+	body := tok[1 : len(tok)-1]
+	if body == "" {
+		return 0, 0, false
+	}
+	min, max, comma := strings.Cut(body, ",")
+	if lo, ok = atoi(min, 0); !ok {
+		return 0, 0, false
+	}
+	if !comma {
+		return lo, lo, true
+	}
+	if hi, ok = atoi(max, -1); !ok || hi >= 0 && hi < lo {
+		return 0, 0, false
+	}
+
+	return lo, hi, true
+}
+
+// bounds returns the minimum and maximum number of repetitions of n, with
+// max -1 when unbounded.
+func (n *repeatNode) bounds() (min, max int) {
+	switch n.op {
+	case '?':
+		return 0, 1
+	case '*':
+		return 0, -1
+	case '+':
+		return 1, -1
+	}
+
+	return n.lo, n.hi
+}
+
+// boundString returns the canonical form of the bounds of a repetition.
+func boundString(min, max int) string {
+	switch {
+	case min == max:
+		return fmt.Sprintf("{%d}", min)
+	case max < 0:
+		return fmt.Sprintf("{%d,}", min)
+	}
+
+	return fmt.Sprintf("{%d,%d}", min, max)
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	pos := p.pos()
+	tok := p.peek()
+	if tok == "" {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	p.i++
+	span := nodeSpan{pos, p.end()}
+
+	switch c := tok[0]; {
+	case tok == "(":
+		n, err := p.parseRecovery()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, p.errorf("missing )")
+		}
+		p.i++
+
+		return n, nil
+	case tok == ".":
+		return &anyNode{span}, nil
+	case strings.HasPrefix(tok, "#{"):
+		if !strings.HasSuffix(tok, "}") {
+			return nil, p.errorf("unterminated state block %s", tok)
+		}
+
+		return &stateNode{span, codeString(tok[2 : len(tok)-1])}, nil
+	case strings.HasPrefix(tok, "%{"):
+		label := strings.TrimSpace(strings.TrimSuffix(tok[2:], "}"))
+		if !strings.HasSuffix(tok, "}") || label == "" || !isIdent(label) {
+			return nil, p.errorf("invalid failure label %s", tok)
+		}
+
+		return &throwNode{span, label}, nil
+	case identLen(tok) > 0:
+		return &refNode{span, tok}, nil
+	case c == '\'' || c == '"':
+		if len(tok) < 2 || tok[len(tok)-1] != c {
+			return nil, p.errorf("unterminated literal %s", tok)
+		}
+
+		return &litNode{span, tok, unquote(tok[1 : len(tok)-1])}, nil
+	case c == '[':
+		set, err := parseClass(tok)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+
+		return &classNode{span, tok, set}, nil
+	}
+
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// unquote returns the value of the escaped literal content s.
+func unquote(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		r, n := parseChar(s)
+		b.WriteRune(r)
+		s = s[n:]
+	}
+
+	return b.String()
+}
+
+// syntax is a grammar with the abstract syntax tree of each rule expression.
+type syntax struct {
+	rules []Rule
+	nodes map[string]node // by rule name, for the first definition
+	errs  map[string]error
+	memo  map[string]bool // rules with the memo directive
+}
+
+// newSyntax parses the expressions of the rules in grammar.  Rules with an
+// invalid expression are recorded in errs.
+func newSyntax(grammar []Rule) *syntax {
+	s := &syntax{
+		rules: grammar,
+		nodes: make(map[string]node),
+		errs:  make(map[string]error),
+		memo:  make(map[string]bool),
+	}
+	for _, rule := range grammar {
+		if _, ok := s.nodes[rule.Name]; ok {
+			continue
+		}
+		if rule.hasDirective("memo") {
+			s.memo[rule.Name] = true
+		}
+		n, err := parseExpr(rule.Expr)
+		if err != nil {
+			s.errs[rule.Name] = err
+
+			continue
+		}
+		s.nodes[rule.Name] = n
+	}
+
+	return s
+}
+
+// hasDirective reports whether one of the comments before the rule is the
+// specified directive.
+func (r *Rule) hasDirective(name string) bool {
+	for _, comment := range r.Comments {
+		if comment == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// codeString returns the code of a block with the runs of white space
+// collapsed to a single space.
+func codeString(code string) string {
+	return strings.Join(strings.Fields(code), " ")
+}
+
+// walk calls fn for n and each of its descendants, in depth first order.
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			walk(alt, fn)
+		}
+	case *seqNode:
+		for _, item := range n.items {
+			walk(item, fn)
+		}
+	case *predNode:
+		walk(n.expr, fn)
+	case *repeatNode:
+		walk(n.expr, fn)
+	case *recoveryNode:
+		walk(n.expr, fn)
+		walk(n.recover, fn)
+	}
+}
+
+// exprString returns n in a canonical form, with a single space between the
+// items of a sequence and around the / of a choice, and with parentheses
+// only where needed.
+func exprString(n node) string {
+	switch n := n.(type) {
+	case *choiceNode:
+		list := make([]string, len(n.alts))
+		for i, alt := range n.alts {
+			list[i] = exprString(alt)
+			if _, ok := alt.(*recoveryNode); ok {
+				list[i] = "(" + list[i] + ")"
+			}
+		}
+
+		return strings.Join(list, " / ")
+	case *seqNode:
+		if len(n.items) == 0 {
+			return "()"
+		}
+		list := make([]string, len(n.items))
+		for i, item := range n.items {
+			list[i] = groupString(item, false)
+		}
+
+		return strings.Join(list, " ")
+	case *predNode:
+		return string(n.op) + groupString(n.expr, true)
+	case *repeatNode:
+		if n.op == '{' {
+			return groupString(n.expr, true) + boundString(n.lo, n.hi)
+		}
+
+		return groupString(n.expr, true) + string(n.op)
+	case *recoveryNode:
+		r := exprString(n.recover)
+		if _, ok := n.recover.(*recoveryNode); ok {
+			r = "(" + r + ")"
+		}
+
+		return exprString(n.expr) + " //{" + strings.Join(n.labels, ", ") + "} " + r
+	case *throwNode:
+		return "%{" + n.label + "}"
+	case *stateNode:
+		return "#{" + n.code + "}"
+	case *refNode:
+		return n.name
+	case *litNode:
+		return n.text
+	case *classNode:
+		return n.text
+	case *anyNode:
+		return "."
+	}
+
+	return ""
+}
+
+// groupString returns n as exprString, in parentheses when n is a choice or a
+// recovery expression or, when unary is true, a sequence or a prefixed
+// expression.
+func groupString(n node, unary bool) string {
+	switch n.(type) {
+	case *choiceNode, *recoveryNode:
+		return "(" + exprString(n) + ")"
+	case *seqNode, *predNode:
+		if unary {
+			return "(" + exprString(n) + ")"
+		}
+	}
+
+	return exprString(n)
+}
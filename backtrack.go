@@ -0,0 +1,125 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// backtrackAnalyzer reports expressions prone to exponential behavior in PEG
+// implementations without memoization: nested unbounded repetitions over
+// overlapping input and alternatives that parse again the same rule after
+// backtracking.
+var backtrackAnalyzer = &analyzer{
+	name: "backtrack",
+	run:  runBacktrack,
+}
+
+func runBacktrack(s *syntax) []finding {
+	var list []finding
+	p := newProps(s)
+	graph := newRefGraph(s)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		root, ok := s.nodes[rule.Name]
+		if !ok {
+			continue
+		}
+		report := func(sev severity, format string, args ...interface{}) {
+			list = append(list, finding{
+				severity: sev,
+				rule:     rule,
+				msg:      fmt.Sprintf(format, args...),
+			})
+		}
+		recursive := graph.reaches(rule.Name, rule.Name)
+
+		walk(root, func(n node) {
+			switch n := n.(type) {
+			case *repeatNode:
+				if _, max := n.bounds(); max >= 0 {
+					return
+				}
+				if p.nullable(n.expr) {
+					// Reported by the well-formedness analyzer.
+					return
+				}
+				outer := p.first(n.expr)
+				walk(n.expr, func(m node) {
+					inner, ok := m.(*repeatNode)
+					if !ok {
+						return
+					}
+					if _, max := inner.bounds(); max >= 0 {
+						return
+					}
+					if overlaps(outer, p.first(inner.expr)) {
+						report(severityWarning, "nested unbounded repetition %s inside %s over overlapping input",
+							text(rule, inner), text(rule, n))
+					}
+				})
+			case *choiceNode:
+				// Group the alternatives by the rule referenced first.
+				var names []string
+				groups := make(map[string][]int)
+				for j, alt := range n.alts {
+					ref, ok := leading(alt).(*refNode)
+					if !ok {
+						continue
+					}
+					if _, ok := groups[ref.name]; !ok {
+						names = append(names, ref.name)
+					}
+					groups[ref.name] = append(groups[ref.name], j+1)
+				}
+				for _, name := range names {
+					if len(groups[name]) < 2 {
+						continue
+					}
+					sev := severityInfo
+					if recursive {
+						sev = severityWarning
+					}
+					report(sev, "alternatives %s start with %s, parsed again on backtracking; consider left factoring",
+						joinInts(groups[name]), name)
+				}
+			}
+		})
+	}
+
+	return list
+}
+
+// overlaps reports whether the sets a and b have a code point in common.
+func overlaps(a, b runeSet) bool {
+	return !a.equal(a.minus(b))
+}
+
+// joinInts returns the list of integers in English, as in "1, 2 and 3".
+func joinInts(list []int) string {
+	var b strings.Builder
+	for i, v := range list {
+		switch {
+		case i == 0:
+		case i == len(list)-1:
+			b.WriteString(" and ")
+		default:
+			b.WriteString(", ")
+		}
+		fmt.Fprint(&b, v)
+	}
+
+	return b.String()
+}
+
+// leading returns the first item of n, when n is a non empty sequence, or n.
+func leading(n node) node {
+	if seq, ok := n.(*seqNode); ok && len(seq.items) > 0 {
+		return seq.items[0]
+	}
+
+	return n
+}
@@ -0,0 +1,255 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"time"
+)
+
+const benchUsage = `Usage: pegcmp bench [-corpus path] [-start rule] path [new-path]`
+
+// benchSide is a grammar benchmarked by runBench.
+type benchSide struct {
+	path string
+	data []byte
+	syn  *syntax
+}
+
+// benchTime is the minimum duration of the timed runs of a benchmark.
+const benchTime = time.Second
+
+// benchResult is the result of a benchmark.
+type benchResult struct {
+	n          int           // number of iterations
+	t          time.Duration // total time
+	bytes      int64         // bytes processed in one iteration
+	allocs     uint64        // total number of allocations
+	allocBytes uint64        // total number of bytes allocated
+}
+
+func (r benchResult) NsPerOp() int64 {
+	return r.t.Nanoseconds() / int64(r.n)
+}
+
+func (r benchResult) AllocsPerOp() int64 {
+	return int64(r.allocs) / int64(r.n)
+}
+
+func (r benchResult) AllocedBytesPerOp() int64 {
+	return int64(r.allocBytes) / int64(r.n)
+}
+
+// String returns the iterations, time and throughput, as go test -bench.
+func (r benchResult) String() string {
+	s := fmt.Sprintf("%8d\t%10d ns/op", r.n, r.NsPerOp())
+	if r.bytes > 0 && r.t > 0 {
+		s += fmt.Sprintf("\t%7.2f MB/s", float64(r.bytes)*float64(r.n)/1e6/r.t.Seconds())
+	}
+
+	return s
+}
+
+// MemString returns the allocations, as go test -bench -benchmem.
+func (r benchResult) MemString() string {
+	return fmt.Sprintf("%8d B/op\t%8d allocs/op", r.AllocedBytesPerOp(), r.AllocsPerOp())
+}
+
+// benchmark measures fn, processing size bytes, by running it an increasing
+// number of times until a run takes at least benchTime.  It stops at the
+// first error returned by fn.
+func benchmark(size int64, fn func() error) (benchResult, error) {
+	n := 1
+	for {
+		r, err := timeRuns(n, fn)
+		if err != nil {
+			return r, err
+		}
+		if r.t >= benchTime || n >= 1e9 {
+			r.bytes = size
+
+			return r, nil
+		}
+		// Predict the iterations for benchTime, with a margin, growing
+		// them at most a hundredfold.
+		next := n * 100
+		if ns := r.t.Nanoseconds(); ns > 0 {
+			next = int(min(int64(next), int64(benchTime)*int64(n)*6/5/ns))
+		}
+		n = max(next, n+1)
+	}
+}
+
+// timeRuns runs fn n times, measuring the time and the allocations.
+func timeRuns(n int, fn func() error) (benchResult, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := fn(); err != nil {
+			return benchResult{}, err
+		}
+	}
+	t := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	return benchResult{
+		n:          n,
+		t:          t,
+		allocs:     after.Mallocs - before.Mallocs,
+		allocBytes: after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+// benchParse measures the parsing of the grammar file, including the
+// construction of the syntax trees.
+func benchParse(side *benchSide) (benchResult, error) {
+	return benchmark(int64(len(side.data)), func() error {
+		grammar, err := parseFile(side.path, side.data)
+		if err != nil {
+			return err
+		}
+		newSyntax(grammar)
+
+		return nil
+	})
+}
+
+// benchCorpus measures the matching of all the inputs with the grammar, by
+// the interpreter.
+func benchCorpus(side *benchSide, inputs []string, opts *corpusOptions) (benchResult, error) {
+	start := startRule(side.syn.rules, opts.start)
+	size := 0
+	for _, input := range inputs {
+		size += len(input)
+	}
+
+	return benchmark(int64(size), func() error {
+		for _, input := range inputs {
+			newCorpusMachine(side.syn, input, newProfile(), opts).run(start)
+		}
+
+		return nil
+	})
+}
+
+// readInputs returns the content of the inputs in the corpus at the
+// operating system path p.
+func readInputs(p string) ([]string, error) {
+	fsys, root, err := openPath(p)
+	if err != nil {
+		return nil, err
+	}
+	files, err := corpusFiles(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []string
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, displayError(fsys, err)
+		}
+		for _, in := range corpusInputs(name, data) {
+			inputs = append(inputs, in.input)
+		}
+	}
+
+	return inputs, nil
+}
+
+// delta returns the relative change from old to new as a percentage.
+func delta(old, new int64) string {
+	if old == 0 {
+		return "~"
+	}
+
+	return fmt.Sprintf("%+.2f%%", 100*float64(new-old)/float64(old))
+}
+
+// writeBench writes the result of the named benchmark in the format of go
+// test -bench.
+func writeBench(name string, r benchResult) {
+	fmt.Printf("%-24s\t%s\t%s\n", name, r.String(), r.MemString())
+}
+
+// runBench measures the performance of parsing a grammar file and, with
+// -corpus, of matching the corpus inputs with it.  With two grammars, both
+// are measured and the change from the first to the second is reported.
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	corpus := flags.String("corpus", "", "measure the matching of the inputs in the specified file, directory or archive")
+	start := flags.String("start", "", "start rule (default the first rule)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, benchUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	args = parseInterspersed(flags, args)
+	if len(args) != 1 && len(args) != 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	var sides []*benchSide
+	for _, path := range args {
+		data, err := readFile(cliFS, cliFS.name(path))
+		if err != nil {
+			fatal(err)
+		}
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		sides = append(sides, &benchSide{path, data, newSyntax(grammar)})
+	}
+	var inputs []string
+	if *corpus != "" {
+		var err error
+		if inputs, err = readInputs(*corpus); err != nil {
+			fatal(err)
+		}
+	}
+	opts := &corpusOptions{
+		start:  *start,
+		memo:   *memoFlag,
+		strict: *noLeftRecursionFlag,
+	}
+
+	run := func(name string, bench func(side *benchSide) (benchResult, error)) {
+		var results []benchResult
+		for i, side := range sides {
+			r, err := bench(side)
+			if err != nil {
+				fatal(err)
+			}
+			label := name
+			if len(sides) == 2 {
+				label += [...]string{"/lhs", "/rhs"}[i]
+			}
+			writeBench(label, r)
+			results = append(results, r)
+		}
+		if len(results) == 2 {
+			l, r := results[0], results[1]
+			fmt.Printf("~ %s: %s ns/op, %s B/op, %s allocs/op\n", name,
+				delta(l.NsPerOp(), r.NsPerOp()),
+				delta(l.AllocedBytesPerOp(), r.AllocedBytesPerOp()),
+				delta(l.AllocsPerOp(), r.AllocsPerOp()))
+		}
+	}
+	run("parse", benchParse)
+	if inputs != nil {
+		run("corpus", func(side *benchSide) (benchResult, error) {
+			return benchCorpus(side, inputs, opts)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// blameChanges returns, for each added or modified rule in changes, the most
+// recent git commit that changed the lines of the rhs rule.  Rules in files
+// that are not tracked by git are reported and skipped.
+func blameChanges(changes []change) map[*Rule]*gitCommit {
+	blame := make(map[*Rule]*gitCommit)
+	files := make(map[string][]*gitCommit)
+	for _, c := range changes {
+		if c.kind != ruleAdded && c.kind != ruleModified {
+			continue
+		}
+		rule := c.rhs
+		name := rule.Pos.Filename
+		lines, ok := files[name]
+		if !ok {
+			var err error
+			if lines, err = gitBlame(filepath.FromSlash(name)); err != nil {
+				slog.Warn("cannot blame file", "path", name, "err", err)
+			}
+			files[name] = lines
+		}
+
+		last := rule.Pos.Line + strings.Count(strip(rule.Text), "\n")
+		for i := rule.Pos.Line; i <= last && i < len(lines); i++ {
+			if commit := blame[rule]; commit == nil || lines[i].date.After(commit.date) {
+				blame[rule] = lines[i]
+			}
+		}
+	}
+
+	return blame
+}
+
+// blameString returns the description of the commit that last changed a
+// rule.
+func blameString(c *gitCommit) string {
+	if strings.Trim(c.hash, "0") == "" {
+		return "not committed yet"
+	}
+
+	return fmt.Sprintf("%s %s %s: %s", c.short(), c.date.Format("2006-01-02"), c.author, c.subject)
+}
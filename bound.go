@@ -0,0 +1,125 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// repetitionBounds returns the bounds of the repetition operator tok, with
+// max -1 when unbounded.  The result is false when tok is not a repetition
+// operator.
+func repetitionBounds(tok string) (min, max int, ok bool) {
+	switch tok {
+	case "?":
+		return 0, 1, true
+	case "*":
+		return 0, -1, true
+	case "+":
+		return 1, -1, true
+	}
+	if tok[0] != '{' {
+		return 0, 0, false
+	}
+
+	return parseBound(tok)
+}
+
+// normalizeBounds replaces the repetition bounds in toks with their
+// canonical form, so that e{1,} and e+ compare equal.
+func normalizeBounds(toks []string) []string {
+	var list []string
+	for i, tok := range toks {
+		if tok[0] != '{' {
+			continue
+		}
+		min, max, ok := parseBound(tok)
+		if !ok {
+			continue
+		}
+		switch {
+		case min == 0 && max == 1:
+			tok = "?"
+		case min == 0 && max < 0:
+			tok = "*"
+		case min == 1 && max < 0:
+			tok = "+"
+		default:
+			tok = boundString(min, max)
+		}
+		if tok != toks[i] {
+			if list == nil {
+				list = append([]string(nil), toks...)
+			}
+			list[i] = tok
+		}
+	}
+	if list == nil {
+		return toks
+	}
+
+	return list
+}
+
+// boundChange describes a repetition whose bounds changed, and nothing else.
+type boundChange struct {
+	lhs, rhs string
+}
+
+// relation returns how the rhs bounds relate to the lhs bounds: wider,
+// narrower or different.
+func (b boundChange) relation() string {
+	lmin, lmax, _ := repetitionBounds(b.lhs)
+	rmin, rmax, _ := repetitionBounds(b.rhs)
+	// contains reports whether the bounds min, max include lo, hi.
+	contains := func(min, max, lo, hi int) bool {
+		return min <= lo && (max < 0 || hi >= 0 && hi <= max)
+	}
+	switch {
+	case contains(rmin, rmax, lmin, lmax):
+		return "wider"
+	case contains(lmin, lmax, rmin, rmax):
+		return "narrower"
+	}
+
+	return "different"
+}
+
+// diffBounds returns the repetition operators replaced in the token edit
+// script of c by another repetition operator, pairing them in order.
+func diffBounds(c change) []boundChange {
+	var changes []boundChange
+	var ldel, rins []string
+	other := false
+	flush := func() {
+		if !other && len(ldel) == 1 && len(rins) == 1 {
+			changes = append(changes, boundChange{ldel[0], rins[0]})
+		}
+		ldel, rins = ldel[:0], rins[:0]
+		other = false
+	}
+
+	for _, e := range c.edits {
+		switch e.op {
+		case opEqual:
+			if !isSpaceToken(c.ltoks[e.i]) {
+				flush()
+			}
+		case opDelete:
+			tok := c.ltoks[e.i]
+			if _, _, ok := repetitionBounds(tok); ok {
+				ldel = append(ldel, tok)
+			} else if !isSpaceToken(tok) {
+				other = true
+			}
+		case opInsert:
+			tok := c.rtoks[e.j]
+			if _, _, ok := repetitionBounds(tok); ok {
+				rins = append(rins, tok)
+			} else if !isSpaceToken(tok) {
+				other = true
+			}
+		}
+	}
+	flush()
+
+	return changes
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ruleBudget are the limits on the size of the expression of a rule, to keep
+// the grammars reviewable.  A limit of 0 is not checked.
+type ruleBudget struct {
+	alternatives int // alternatives of a choice
+	tokens       int // tokens, excluding white space and comments
+	lines        int // lines of the expression
+}
+
+// sizeBudget is the budget checked by the budget analyzer, set from the
+// command line and the policy.
+var sizeBudget ruleBudget
+
+// budgetKeys are the keys of the budget table of the policy, with the
+// address of the limit.
+func (b *ruleBudget) keys() map[string]*int {
+	return map[string]*int{
+		"alternatives": &b.alternatives,
+		"tokens":       &b.tokens,
+		"lines":        &b.lines,
+	}
+}
+
+// or returns b with the limits not set replaced by the limits of other.
+func (b ruleBudget) or(other ruleBudget) ruleBudget {
+	keys := other.keys()
+	for k, p := range b.keys() {
+		if *p == 0 {
+			*p = *keys[k]
+		}
+	}
+
+	return b
+}
+
+func (b ruleBudget) String() string {
+	return fmt.Sprintf("alternatives=%d,tokens=%d,lines=%d", b.alternatives, b.tokens, b.lines)
+}
+
+// budgetAnalyzer reports the rules exceeding the size budget.  The messages
+// depend only on the limits, so that compare reports a rule only when it
+// crosses the budget in rhs.
+var budgetAnalyzer = &analyzer{
+	name: "budget",
+	run:  runBudget,
+}
+
+func runBudget(s *syntax) []finding {
+	b := sizeBudget
+	if b == (ruleBudget{}) {
+		return nil
+	}
+	var list []finding
+	seen := make(map[string]bool)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		root, ok := s.nodes[rule.Name]
+		if !ok || seen[rule.Name] {
+			continue
+		}
+		seen[rule.Name] = true
+		report := func(format string, args ...interface{}) {
+			list = append(list, finding{
+				severity: severityWarning,
+				rule:     rule,
+				msg:      fmt.Sprintf(format, args...),
+			})
+		}
+
+		alts := 0
+		walk(root, func(n node) {
+			if c, ok := n.(*choiceNode); ok {
+				alts = max(alts, len(c.alts))
+			}
+		})
+		if b.alternatives > 0 && alts > b.alternatives {
+			report("choice exceeds the budget of %d alternatives", b.alternatives)
+		}
+		if b.tokens > 0 && countTokens(rule.Expr) > b.tokens {
+			report("expression exceeds the budget of %d tokens", b.tokens)
+		}
+		if b.lines > 0 && strings.Count(strings.TrimSpace(rule.Expr), "\n")+1 > b.lines {
+			report("expression exceeds the budget of %d lines", b.lines)
+		}
+	}
+
+	return list
+}
+
+// countTokens returns the number of tokens of expr, excluding white space and
+// comments.
+func countTokens(expr string) int {
+	n := 0
+	for _, tok := range tokenize(expr) {
+		comment := tok[0] == '#' && !strings.HasPrefix(tok, "#{")
+		if !isSpace(tok[0]) && !comment {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxCacheEntries and maxCacheBytes are the maximum number and total size
+// of the results kept in memory by a result cache; the oldest result is
+// evicted first.
+const (
+	maxCacheEntries = 1024
+	maxCacheBytes   = 64 << 20
+)
+
+// resultCache is a cache of the results of completed comparisons, keyed by
+// cacheKey.  The results are kept in memory and, when dir is not empty,
+// persisted in dir, so that they are reused by later runs.  It is safe for
+// concurrent use; a nil cache caches nothing.
+type resultCache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string][]byte
+	order   []string // keys in insertion order
+	size    int      // total size of the entries
+	hits    int
+	misses  int
+}
+
+// newResultCache returns a result cache persisted in dir, if not empty.
+func newResultCache(dir string) *resultCache {
+	return &resultCache{dir: dir, entries: make(map[string][]byte)}
+}
+
+// resultCacheDir returns the directory of the persisted comparison results,
+// or an empty string if the user has no cache directory.
+func resultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "pegcmp", "results")
+}
+
+// get returns the result cached for key.
+func (c *resultCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.entries[key]; ok {
+		c.hits++
+
+		return data, true
+	}
+	if c.dir != "" {
+		if data, err := os.ReadFile(filepath.Join(c.dir, key)); err == nil {
+			c.hits++
+			c.add(key, data)
+
+			return data, true
+		}
+	}
+	c.misses++
+
+	return nil, false
+}
+
+// put caches the result data for key.
+func (c *resultCache) put(key string, data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.add(key, data)
+	}
+	if c.dir != "" {
+		// A result that cannot be stored is computed again by the next
+		// run.
+		os.MkdirAll(c.dir, 0o755)
+		os.WriteFile(filepath.Join(c.dir, key), data, 0o644)
+	}
+}
+
+// add adds the result to the entries in memory, evicting the oldest ones
+// when full.  A result larger than maxCacheBytes is not kept in memory.
+func (c *resultCache) add(key string, data []byte) {
+	if len(data) > maxCacheBytes {
+		return
+	}
+	for len(c.order) == maxCacheEntries || c.size+len(data) > maxCacheBytes {
+		c.size -= len(c.entries[c.order[0]])
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[key] = data
+	c.order = append(c.order, key)
+	c.size += len(data)
+}
+
+// writeStats writes the number of hits and misses and of the results in
+// memory.
+func (c *resultCache) writeStats(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ratio := 0.0
+	if n := c.hits + c.misses; n > 0 {
+		ratio = 100 * float64(c.hits) / float64(n)
+	}
+	fmt.Fprintf(w, "~ cache: %d hits, %d misses (%.1f%% hit rate), %d entries\n",
+		c.hits, c.misses, ratio, len(c.entries))
+}
+
+// cacheKey returns the key of the comparison of lgrammar and rgrammar with
+// opts, the hex encoded SHA-256 digest of the grammars, of the options and
+// of the extra values the result depends on, such as the output format.  A
+// change of any option changes the key, so that the results cached with
+// other options are never used.  The version of pegcmp is part of the key,
+// so that an upgraded binary does not use the results of the previous one.
+func cacheKey(lgrammar, rgrammar []Rule, opts *options, extra ...string) string {
+	h := sha256.New()
+	info := readBuildInfo()
+	fmt.Fprintf(h, "pegcmp %s %s %t\n", info.version, info.revision, info.modified)
+	for _, grammar := range [...][]Rule{lgrammar, rgrammar} {
+		// The positions and comments are part of the result.
+		for _, rule := range grammar {
+			fmt.Fprintf(h, "%s <- %s\x00%s (%d)\x00%q\n", rule.Name, rule.Expr, rule.Pos, rule.Pos.Offset, rule.Comments)
+		}
+		fmt.Fprintln(h)
+	}
+	pattern := ""
+	if opts.publicPattern != nil {
+		pattern = opts.publicPattern.String()
+	}
+	fmt.Fprintf(h, "%q %q %q %t %q %t %t %t %t %t %d %q %t %t %t %t %t %t %g %d\n", opts.normalize, opts.normalizer, pattern,
+		opts.publicOnly, opts.ruleCompareCmd, opts.strict, opts.sections, opts.terminals, opts.keywords,
+		opts.precedence, opts.context, opts.matchNames, opts.pairByStructure, opts.ruleTests, opts.properties, opts.lengths,
+		opts.recursion, opts.depth, opts.depthRatio, opts.maxDepth)
+
+	// The plugin checks and the size budget are part of the findings, and
+	// the print style of the written expressions.
+	for _, p := range plugins {
+		fmt.Fprintf(h, "plugin %q\n", p.command)
+	}
+	fmt.Fprintf(h, "budget %s\n", sizeBudget)
+	fmt.Fprintf(h, "style %s %t %t\n", printStyle, colorOutput, *markChangesFlag)
+	fmt.Fprintf(h, "anchors %t %t\n", *anchorsFlag, *hyperlinksFlag)
+	for _, s := range extra {
+		fmt.Fprintf(h, "%q\n", s)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
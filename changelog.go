@@ -0,0 +1,169 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const changelogUsage = `Usage: pegcmp changelog [-format text|markdown] old-path new-path`
+
+// changelog is the list of the rule changes between two grammars, by
+// category.
+type changelog struct {
+	added, removed, modified []change
+}
+
+// newChangelog returns the changelog from lgrammar to rgrammar, comparing
+// the rules in canonical form so that formatting changes are ignored.
+func newChangelog(lgrammar, rgrammar []Rule, opts *options) *changelog {
+	log := new(changelog)
+	for _, c := range compare(normalizeRules(lgrammar), normalizeRules(rgrammar), opts) {
+		switch c.kind {
+		case ruleAdded:
+			log.added = append(log.added, c)
+		case ruleRemoved:
+			log.removed = append(log.removed, c)
+		case ruleModified:
+			log.modified = append(log.modified, c)
+		}
+	}
+
+	return log
+}
+
+// changeSummary returns a one line summary of the modified rule of c, quoting
+// expressions with quote.
+func changeSummary(c change, quote func(string) string) string {
+	var parts []string
+	for _, a := range c.alts {
+		switch a.kind {
+		case ruleAdded:
+			parts = append(parts, fmt.Sprintf("alternative %d added: %s", a.ri, quote(a.rhs)))
+		case ruleRemoved:
+			parts = append(parts, fmt.Sprintf("alternative %d removed: %s", a.li, quote(a.lhs)))
+		case ruleModified:
+			parts = append(parts, fmt.Sprintf("alternative %d changed from %s to %s", a.ri, quote(a.lhs), quote(a.rhs)))
+		case ruleEqual:
+			parts = append(parts, fmt.Sprintf("alternative %s moved from %d to %d", quote(a.rhs), a.li, a.ri))
+		}
+	}
+	for _, cl := range c.classes {
+		switch cl.relation() {
+		case "superset":
+			parts = append(parts, fmt.Sprintf("class %s adds %s", quote(cl.rhs), cl.added))
+		case "subset":
+			parts = append(parts, fmt.Sprintf("class %s removes %s", quote(cl.rhs), cl.removed))
+		case "overlap":
+			parts = append(parts, fmt.Sprintf("class %s adds %s, removes %s", quote(cl.rhs), cl.added, cl.removed))
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("changed from %s to %s", quote(c.lhs.Expr), quote(c.rhs.Expr))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// writeChangelog writes the changelog as text.
+func writeChangelog(w io.Writer, log *changelog) {
+	quote := func(s string) string {
+		return s
+	}
+	section := func(title string, list []change, line func(change) string) {
+		if len(list) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s:\n", title)
+		for _, c := range list {
+			fmt.Fprintf(w, "  %s\n", line(c))
+		}
+	}
+	section("Added rules", log.added, func(c change) string {
+		return c.rhs.Name + " <- " + c.rhs.Expr
+	})
+	section("Removed rules", log.removed, func(c change) string {
+		return c.lhs.Name + " <- " + c.lhs.Expr
+	})
+	section("Modified rules", log.modified, func(c change) string {
+		return c.rhs.Name + ": " + changeSummary(c, quote)
+	})
+}
+
+// writeChangelogMarkdown writes the changelog as Markdown release notes.
+func writeChangelogMarkdown(w io.Writer, log *changelog) {
+	quote := func(s string) string {
+		return "`" + s + "`"
+	}
+	first := true
+	section := func(title string, list []change, line func(change) string) {
+		if len(list) == 0 {
+			return
+		}
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		fmt.Fprintf(w, "### %s\n\n", title)
+		for _, c := range list {
+			fmt.Fprintf(w, "- %s\n", line(c))
+		}
+	}
+	section("Added rules", log.added, func(c change) string {
+		return quote(c.rhs.Name) + ": " + quote(c.rhs.Expr)
+	})
+	section("Removed rules", log.removed, func(c change) string {
+		return quote(c.lhs.Name) + ": " + quote(c.lhs.Expr)
+	})
+	section("Modified rules", log.modified, func(c change) string {
+		return quote(c.rhs.Name) + ": " + changeSummary(c, quote)
+	})
+}
+
+// runChangelog writes the rules added, removed and modified from the old to
+// the new grammar.
+func runChangelog(args []string) {
+	flags := flag.NewFlagSet("changelog", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text or markdown")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, changelogUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	write := writeChangelog
+	switch *format {
+	case "text":
+	case "markdown":
+		write = writeChangelogMarkdown
+	default:
+		fatalf("unknown changelog format %q", *format)
+	}
+	opts := compareOptions()
+	lgrammar, err := parse(flags.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar, err := parse(flags.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	write(w, newChangelog(lgrammar, rgrammar, opts))
+	if err := w.Flush(); err != nil {
+		fatal(err)
+	}
+}
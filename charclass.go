@@ -0,0 +1,322 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// runeRange is an inclusive range of code points.
+type runeRange struct {
+	lo, hi rune
+}
+
+// runeSet is a set of code points, as a sorted list of disjoint and non
+// adjacent ranges.
+type runeSet []runeRange
+
+// maxSetRanges is the maximum number of ranges printed for a set.
+const maxSetRanges = 10
+
+// normalize sorts and merges the ranges of s.
+func (s runeSet) normalize() runeSet {
+	sort.Slice(s, func(i, j int) bool {
+		return s[i].lo < s[j].lo
+	})
+
+	var list runeSet
+	for _, r := range s {
+		if n := len(list); n > 0 && r.lo <= list[n-1].hi+1 {
+			if r.hi > list[n-1].hi {
+				list[n-1].hi = r.hi
+			}
+
+			continue
+		}
+		list = append(list, r)
+	}
+
+	return list
+}
+
+// minus returns the code points in s that are not in t.
+func (s runeSet) minus(t runeSet) runeSet {
+	var list runeSet
+	for _, r := range s {
+		lo := r.lo
+		for _, x := range t {
+			if x.hi < lo || x.lo > r.hi {
+				continue
+			}
+			if x.lo > lo {
+				list = append(list, runeRange{lo, x.lo - 1})
+			}
+			lo = x.hi + 1
+		}
+		if lo <= r.hi {
+			list = append(list, runeRange{lo, r.hi})
+		}
+	}
+
+	return list
+}
+
+// contains reports whether r is in s.
+func (s runeSet) contains(r rune) bool {
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].hi >= r
+	})
+
+	return i < len(s) && s[i].lo <= r
+}
+
+// equal reports whether s and t contain the same code points.
+func (s runeSet) equal(t runeSet) bool {
+	if len(s) != len(t) {
+		return false
+	}
+	for i := range s {
+		if s[i] != t[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns s in PEG character class syntax, without the brackets,
+// truncated after maxSetRanges ranges.
+func (s runeSet) String() string {
+	var parts []string
+	for i, r := range s {
+		if i == maxSetRanges {
+			parts = append(parts, fmt.Sprintf("... (%d more)", len(s)-i))
+
+			break
+		}
+		if r.lo == r.hi {
+			parts = append(parts, quoteRune(r.lo))
+		} else {
+			parts = append(parts, quoteRune(r.lo)+"-"+quoteRune(r.hi))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// quoteRune returns r as a single quoted PEG literal.
+func quoteRune(r rune) string {
+	switch r {
+	case '\n':
+		return `'\n'`
+	case '\r':
+		return `'\r'`
+	case '\t':
+		return `'\t'`
+	case '\'':
+		return `'\''`
+	case '\\':
+		return `'\\'`
+	}
+	if unicode.IsPrint(r) {
+		return "'" + string(r) + "'"
+	}
+
+	return fmt.Sprintf("U+%04X", r)
+}
+
+// parseClass returns the set of code points matched by the character class
+// tok, including the brackets.  Unicode categories and scripts are specified
+// as \pL or \p{Greek}.
+func parseClass(tok string) (runeSet, error) {
+	if len(tok) < 2 || tok[0] != '[' || tok[len(tok)-1] != ']' {
+		return nil, fmt.Errorf("invalid character class %s", tok)
+	}
+	s := tok[1 : len(tok)-1]
+
+	var set runeSet
+	for len(s) > 0 {
+		if strings.HasPrefix(s, `\p`) {
+			table, n, err := parseCategory(s)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, tableSet(table)...)
+			s = s[n:]
+
+			continue
+		}
+
+		lo, n := parseChar(s)
+		s = s[n:]
+		hi := lo
+		if len(s) > 1 && s[0] == '-' {
+			hi, n = parseChar(s[1:])
+			s = s[1+n:]
+			if hi < lo {
+				return nil, fmt.Errorf("invalid range in character class %s", tok)
+			}
+		}
+		set = append(set, runeRange{lo, hi})
+	}
+
+	return set.normalize(), nil
+}
+
+// parseCategory parses the Unicode category or script at the start of s,
+// returning its table and length.
+func parseCategory(s string) (*unicode.RangeTable, int, error) {
+	var name string
+	n := 3
+	if strings.HasPrefix(s, `\p{`) {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unterminated Unicode class %s", s)
+		}
+		name = s[3:end]
+		n = end + 1
+	} else if len(s) >= 3 {
+		name = s[2:3]
+	}
+
+	if table, ok := unicode.Categories[name]; ok {
+		return table, n, nil
+	}
+	if table, ok := unicode.Scripts[name]; ok {
+		return table, n, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown Unicode class %q", name)
+}
+
+// tableSet converts a Unicode range table to a set.
+func tableSet(table *unicode.RangeTable) runeSet {
+	var set runeSet
+	for _, r := range table.R16 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			if r.Stride == 1 {
+				set = append(set, runeRange{c, rune(r.Hi)})
+
+				break
+			}
+			set = append(set, runeRange{c, c})
+		}
+	}
+	for _, r := range table.R32 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			if r.Stride == 1 {
+				set = append(set, runeRange{c, rune(r.Hi)})
+
+				break
+			}
+			set = append(set, runeRange{c, c})
+		}
+	}
+
+	return set
+}
+
+// parseChar parses the possibly escaped character at the start of s,
+// returning its value and length.
+func parseChar(s string) (rune, int) {
+	if s[0] != '\\' || len(s) == 1 {
+		r, n := utf8.DecodeRuneInString(s)
+
+		return r, n
+	}
+
+	switch c := s[1]; c {
+	case 'n':
+		return '\n', 2
+	case 'r':
+		return '\r', 2
+	case 't':
+		return '\t', 2
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		// Up to three octal digits, with the first in the range [0-2].
+		n := 2
+		for n < len(s) && n < 4 && s[n] >= '0' && s[n] <= '7' {
+			n++
+		}
+		if n == 4 && s[1] > '2' {
+			n = 3
+		}
+		v, _ := strconv.ParseUint(s[1:n], 8, 32)
+
+		return rune(v), n
+	}
+	r, n := utf8.DecodeRuneInString(s[1:])
+
+	return r, 1 + n
+}
+
+// classChange describes how a character class differs between the lhs and
+// rhs expressions.
+type classChange struct {
+	lhs, rhs       string
+	added, removed runeSet
+}
+
+// relation returns the relation between the rhs and the lhs classes.
+func (c classChange) relation() string {
+	switch {
+	case len(c.added) == 0 && len(c.removed) == 0:
+		return "equal"
+	case len(c.removed) == 0:
+		return "superset"
+	case len(c.added) == 0:
+		return "subset"
+	}
+
+	return "overlap"
+}
+
+// diffClasses compares the character classes replaced in the token edit
+// script of c, pairing them in order.
+func diffClasses(c change) []classChange {
+	var changes []classChange
+	var ldel, rins []string
+	flush := func() {
+		for k := 0; k < len(ldel) && k < len(rins); k++ {
+			lset, err1 := parseClass(ldel[k])
+			rset, err2 := parseClass(rins[k])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			changes = append(changes, classChange{
+				lhs:     ldel[k],
+				rhs:     rins[k],
+				added:   rset.minus(lset),
+				removed: lset.minus(rset),
+			})
+		}
+		ldel, rins = ldel[:0], rins[:0]
+	}
+
+	for _, e := range c.edits {
+		switch e.op {
+		case opEqual:
+			if !isSpaceToken(c.ltoks[e.i]) {
+				flush()
+			}
+		case opDelete:
+			if tok := c.ltoks[e.i]; tok[0] == '[' {
+				ldel = append(ldel, tok)
+			}
+		case opInsert:
+			if tok := c.rtoks[e.j]; tok[0] == '[' {
+				rins = append(rins, tok)
+			}
+		}
+	}
+	flush()
+
+	return changes
+}
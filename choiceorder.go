@@ -0,0 +1,86 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// choiceOrderAnalyzer reports alternatives of an ordered choice that are
+// never tried, since a previous alternative always matches a prefix of their
+// input, suggesting to move them first.
+var choiceOrderAnalyzer = &analyzer{
+	name: "choice-order",
+	run:  runChoiceOrder,
+}
+
+func runChoiceOrder(s *syntax) []finding {
+	var list []finding
+	p := newProps(s)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		root, ok := s.nodes[rule.Name]
+		if !ok {
+			continue
+		}
+		walk(root, func(n node) {
+			ch, ok := n.(*choiceNode)
+			if !ok {
+				return
+			}
+			where := ""
+			if n != root {
+				pos, end := ch.span()
+				where = fmt.Sprintf("in (%s), ", rule.Expr[pos:end])
+			}
+			for j, alt := range ch.alts {
+				k := shadowedBy(p, ch.alts[:j], alt)
+				if k < 0 {
+					continue
+				}
+				msg := fmt.Sprintf("%salternative %d %s is never tried, since alternative %d %s matches first; try it before",
+					where, j+1, text(rule, alt), k+1, text(rule, ch.alts[k]))
+				if text(rule, alt) == text(rule, ch.alts[k]) {
+					msg = fmt.Sprintf("%salternative %d %s duplicates alternative %d",
+						where, j+1, text(rule, alt), k+1)
+				}
+				list = append(list, finding{
+					severity: severityWarning,
+					rule:     rule,
+					msg:      msg,
+				})
+			}
+		})
+	}
+
+	return list
+}
+
+// shadowedBy returns the index of the first alternative in prev that always
+// succeeds when alt would succeed, or -1.
+func shadowedBy(p *props, prev []node, alt node) int {
+	for k, n := range prev {
+		if prefix, ok := p.mustPrefix(n); ok {
+			if strings.HasPrefix(p.startsWith(alt), prefix) {
+				return k
+			}
+		}
+		if set, ok := p.mustFirst(n); ok && !p.nullable(alt) {
+			if first := p.first(alt); len(first) > 0 && len(first.minus(set)) == 0 {
+				return k
+			}
+		}
+	}
+
+	return -1
+}
+
+// text returns the source text of n in rule.
+func text(rule *Rule, n node) string {
+	pos, end := n.span()
+
+	return rule.Expr[pos:end]
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// command is a subcommand, invoked with the remaining arguments.
+type command struct {
+	name     string
+	synopsis string // arguments, after the name
+	summary  string // one line description
+	doc      string // long description, for help and man
+	run      func(args []string)
+}
+
+// compareSynopses are the synopses of the comparison of two grammars, the
+// default command.
+var compareSynopses = []string{
+	"[flags] lhs-path rhs-path",
+	"[flags] [-j n] lhs-dir rhs-dir",
+	"[flags] -manifest lhs-list -manifest rhs-list",
+	"[flags] -module module@version:path rhs-path",
+	"[flags] -digest-only path...",
+	"[flags] -git-difftool path old-file old-hex old-mode new-file new-hex new-mode",
+}
+
+const compareDoc = `Compares the rules of the lhs and rhs grammars, reporting the rules added,
+removed and modified in rhs, the analysis findings introduced by rhs and the
+rules affected by each modified rule.  With two directories, the grammars with
+the same path relative to each directory are compared.  The exit status is 1
+when a change violates the policy.`
+
+// commandList are the subcommands, in usage order.  It is initialized by
+// init, since help lists the commands.
+var commandList []*command
+
+// commands are the subcommands by name.
+var commands = make(map[string]*command)
+
+func init() {
+	commandList = []*command{
+		{"analyze", "path...", "list the computed properties of each rule",
+			"Writes the minimum and maximum match length of each rule and whether it is\nnullable, matches only the empty string, is finite, recursive or token-like,\nfollowed by the recursion groups: the mutually recursive rules.",
+			runAnalyze},
+		{"bench", "[-corpus path] [-start rule] path [new-path]", "measure the performance of a grammar",
+			"Measures the performance of parsing a grammar file and, with -corpus, of\nmatching the corpus inputs with it.  With two grammars, both are measured\nand the change from the first to the second is reported.",
+			runBench},
+		{"changelog", "[-format text|markdown] old-path new-path", "write the changes between two grammars",
+			"Writes the rules added, removed and modified from the old to the new grammar.",
+			runChangelog},
+		{"completion", "bash|zsh|fish", "write a shell completion script",
+			"Writes the completion script for a shell, completing the flags, the commands\nand the rule names of -start from the grammar files on the command line.",
+			runCompletion},
+		{"diagram", "[-diff] [-o dir] path...", "write railroad diagrams",
+			"Writes an SVG railroad diagram for each rule of a grammar or, with -diff,\nfor each rule that differs between two grammars, side by side.",
+			runDiagram},
+		{"expr", "[lhs-expr rhs-expr]", "compare two expressions",
+			"Compares two expressions, passed as arguments or as the lines of stdin.\nThe exit status is 1 when they differ, for use in shell assertions.  Unless\n-normalize is specified, the comments and the spacing are ignored, as with\n-normalize=" + exprNormalize + ".",
+			runExpr},
+		{"extract", "[-w] path rule:index[.index...] new-rule", "move an expression into a new rule",
+			"Moves the selected expression of a rule into a new rule, replacing it with\na reference to the new rule.",
+			runExtract},
+		{"find", "-expr expr | -regexp regexp path...", "find the rules containing an expression",
+			"Lists the rules whose expression contains the queried expression or\nmatches the queried regular expression.  The exit status is 1 when no rule\nis found.",
+			runFind},
+		{"fingerprint", "-self-test | path...", "write the stable fingerprint of each rule",
+			"Writes the fingerprint of each rule, stable across releases, for the\nsystems storing them.  With -self-test, checks the fingerprints of the test\nvectors, with exit status 1 when one differs.",
+			runFingerprint},
+		{"graph", "[-format dot|graphml|json] path [new-path]", "write the rule reference graph",
+			"Writes the rule reference graph of a grammar or, with two grammars, the\ndifference between their graphs, with each rule and reference marked as\nadded, removed, modified or equal, in the DOT, GraphML or JSON adjacency\nformat.",
+			runGraph},
+		{"help", "[topic]", "show the help of a command or topic",
+			"Writes the help of a command, or of the compare, flags, directives or\nformats topics.",
+			runHelp},
+		{"history", "[-since revision] [-markdown] path", "write the changes of a grammar in each commit",
+			"Writes the rules added, removed and modified in each git commit that changed\na grammar file.",
+			runHistory},
+		{"hook", "[-staged] [-deny categories]", "check the changed grammars in a pre-commit hook",
+			"Compares the changed .peg files in the git working tree, or in the index\nwith -staged, against HEAD.  The policy is read from pegcmp.toml, unless\n-deny is specified.  The exit status is 1 when a change is denied.",
+			runHook},
+		{"lint", "path...", "run the analyzers on each grammar",
+			"Runs the static analyzers on each grammar, writing the findings.  The rule\nsize budget is set by -max-alternatives, -max-tokens and -max-lines, or by\nthe budget table of the -policy file.  The exit status is 1 when there are\nfindings.",
+			runLint},
+		{"man", "", "write the manual page",
+			"Writes the manual page, in roff format.",
+			runMan},
+		{"monitor", "[-config path] [-once]", "check pairs of grammars periodically for drift",
+			"Periodically compares the pairs of grammars of the configuration file, local\npaths, URLs or git:rev:path files, storing the results and posting the new\ndifferences to the webhook.  With -once, checks the pairs once, with exit\nstatus 1 when a check fails or finds new differences.",
+			runMonitor},
+		{"parse", "[-format sexp|json] [-start rule] path input-path", "write the parse tree of an input",
+			"Matches an input with a grammar, writing the parse tree.  The exit status\nis 1 when the grammar does not accept the whole input.",
+			runParse},
+		{"refactor", "left-factor|left-recursion [-w] path...", "apply a transform to each grammar",
+			"Applies a transform to each grammar file, writing the result to stdout or,\nwith -w, to the file.",
+			runRefactor},
+		{"rule", "lhs-path:rule rhs-path:rule", "compare a rule of each grammar",
+			"Compares a single rule of each grammar, possibly with different names.",
+			runRule},
+		{"self-update", "[-check] [-force]", "update the binary to the latest release",
+			"Replaces the running binary with the binary of the latest GitHub release for\nthe platform, when newer, after verifying its SHA-256 checksum.  The\nchecksums come from the same release, so they only detect a corrupted\ndownload.  A development build is only replaced with -force.  With -check,\nonly reports whether an update is available.",
+			runSelfUpdate},
+		{"semver", "old-path new-path", "write the required semantic version increment",
+			"Writes the semantic version increment required by the changes from the old\nto the new grammar to stdout, and the changes that require it to stderr.",
+			runSemver},
+		{"serve", "[-addr address] [-grpc] [-max-request-size bytes]", "serve the comparison engine",
+			"Serves the comparison engine over HTTP, with the JSON representation of the\nmessages or, with -grpc, also with the gRPC protocol over HTTP/2 without\nTLS, and with the counters of the comparisons, the differences, the parse\nerrors and the cache in the Prometheus format at /metrics.",
+			runServe},
+		{"snapshot", "save|diff|list [-dir path] [-label label] path", "manage snapshots of a grammar",
+			"Saves the normalized rules of a grammar as a labeled snapshot, compares the\ngrammar against a snapshot or lists the snapshots.",
+			runSnapshot},
+		{"sort", "[-order topological|alphabetical] [-check | -w] path...", "sort the rule definitions",
+			"Checks or rewrites the order of the rule definitions in each grammar file,\npreserving the comments and the formatting of each rule.",
+			runSort},
+		{"test", "path...", "run the tests annotated on the rules",
+			"Runs the # test accept: and # test reject: annotations of the rules.  The\nexit status is 1 when a test fails.",
+			runRuleTests},
+		{"union", "[-o path] [-prefer lhs|rhs] lhs-path rhs-path", "merge the rules of two grammars",
+			"Writes a grammar with the rules of both grammars.  The exit status is 1\nwhen there are unresolved conflicts.",
+			runUnion},
+		{"version", "", "write the version and build metadata",
+			"Writes the version, the commit and the Go version of the binary, the\nsupported grammar dialects, including the ones of the plugins, and the\nversions of the formats, for bug reports.",
+			runVersion},
+	}
+	for _, c := range commandList {
+		commands[c.name] = c
+	}
+}
+
+// usage returns the usage message, with the synopses of the comparison and
+// of the commands.
+func usage() string {
+	var b strings.Builder
+	prefix := "Usage: "
+	line := func(synopsis string) {
+		fmt.Fprintf(&b, "%spegcmp %s\n", prefix, strings.TrimSpace(synopsis))
+		prefix = "       "
+	}
+	for _, s := range compareSynopses {
+		line(s)
+	}
+	for _, c := range commandList {
+		line("[flags] " + c.name + " " + c.synopsis)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// directives are the comments before a rule changing how it is handled.
+var directives = []struct {
+	name, doc string
+}{
+	{expectDiffDirective, "the change of the rule is expected and not reported"},
+	{includeDirective + ` "path" Rule...`, "include the rules of another grammar"},
+	{lexicalDirective, "classify the rule as lexical"},
+	{syntacticDirective, "classify the rule as syntactic"},
+	{publicDirective, "the rule is part of the public interface of the grammar"},
+	{cfgDirective, "check the rule as converted from a CFG dialect"},
+	{"memo", "memoize the rule when matching a corpus"},
+	{`test accept: "input"`, "test that the rule accepts the input"},
+	{`test reject: "input"`, "test that the rule rejects the input"},
+}
+
+const helpUsage = `Usage: pegcmp help [command | compare | flags | directives | formats]`
+
+// runHelp writes the help of a command or topic, or the usage with the
+// summary of the commands.
+func runHelp(args []string) {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, helpUsage)
+
+		os.Exit(2)
+	}
+	w := os.Stdout
+	if len(args) == 0 {
+		fmt.Fprintln(w, usage())
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Commands:")
+		for _, c := range commandList {
+			fmt.Fprintf(w, "  %-12s%s\n", c.name, c.summary)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, `Run "pegcmp help topic" for more about a command, compare, flags, directives or formats.`)
+
+		return
+	}
+
+	switch topic := args[0]; topic {
+	case "flags":
+		flag.CommandLine.SetOutput(w)
+		flag.PrintDefaults()
+	case "directives":
+		for _, d := range directives {
+			fmt.Fprintf(w, "  # %s\n    \t%s\n", d.name, d.doc)
+		}
+	case "formats":
+		for _, name := range formatNames() {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	case "compare":
+		for _, s := range compareSynopses {
+			fmt.Fprintf(w, "pegcmp %s\n", s)
+		}
+		fmt.Fprintf(w, "\n%s\n", compareDoc)
+	default:
+		c, ok := commands[topic]
+		if !ok {
+			fatalf("unknown help topic %q", topic)
+		}
+		fmt.Fprintf(w, "pegcmp %s\n\n%s\n", strings.TrimSpace(c.name+" "+c.synopsis), c.doc)
+	}
+}
+
+// formatNames returns the names of the report formats, sorted.
+func formatNames() []string {
+	var list []string
+	for name := range formatters {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// runMan writes the manual page.
+func runMan(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: pegcmp man")
+
+		os.Exit(2)
+	}
+	writeMan(os.Stdout, time.Now())
+}
+
+// writeMan writes the manual page in roff format, dated date.
+func writeMan(w io.Writer, date time.Time) {
+	fmt.Fprintf(w, ".TH PEGCMP 1 %q pegcmp\n", date.Format("2006-01-02"))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `pegcmp \- compare PEG grammars`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	for _, s := range compareSynopses {
+		fmt.Fprintf(w, ".B pegcmp\n%s\n.br\n", roffEscape(s))
+	}
+	for _, c := range commandList {
+		fmt.Fprintf(w, ".B pegcmp\n%s\n.br\n", roffEscape(strings.TrimSpace("[flags] "+c.name+" "+c.synopsis)))
+	}
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, roffEscape(compareDoc))
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, c := range commandList {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", c.name, roffEscape(c.doc))
+	}
+	fmt.Fprintln(w, ".SH OPTIONS")
+	flag.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		if name != "" {
+			fmt.Fprintf(w, ".TP\n.BI \\-%s \" \" %s\n", roffEscape(f.Name), roffEscape(name))
+		} else {
+			fmt.Fprintf(w, ".TP\n.B \\-%s\n", roffEscape(f.Name))
+		}
+		fmt.Fprintln(w, roffEscape(usage))
+	})
+	fmt.Fprintln(w, ".SH DIRECTIVES")
+	for _, d := range directives {
+		fmt.Fprintf(w, ".TP\n.B # %s\n%s\n", roffEscape(d.name), roffEscape(d.doc))
+	}
+	fmt.Fprintln(w, ".SH FORMATS")
+	fmt.Fprintln(w, roffEscape(strings.Join(formatNames(), ", ")))
+}
+
+// roffEscape escapes s as roff text: the backslashes, the hyphens and the
+// control characters at the start of the lines.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,279 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"iter"
+	"regexp"
+	"slices"
+)
+
+// options control how the rules are compared.
+type options struct {
+	// Unicode normalization form applied to literals and character classes
+	// before comparison: NFC, NFD or none.
+	normalize string
+
+	// Names of the public rules, in addition to the rules with the public
+	// directive, or nil.
+	publicPattern *regexp.Regexp
+
+	// publicOnly restricts the report to the public rules and the rules
+	// reachable from them.
+	publicOnly bool
+
+	// normalizer is applied to both grammars before comparison.
+	normalizer Normalizer
+
+	// ruleCompareCmd, when not empty, is the external command that decides
+	// whether two rules with different expressions are equal.
+	ruleCompareCmd string
+
+	// strict reports the left recursive lhs rules as reference grammar
+	// issues, since they fail on the corpus as in strict PEG.
+	strict bool
+
+	// sections divides the report in lexical and syntactic rules.
+	sections bool
+
+	// terminals reports the terminals used by only one grammar.
+	terminals bool
+
+	// keywords reports the probable keywords used by only one grammar.
+	keywords bool
+
+	// precedence reports the differences in the operator precedence
+	// implied by the rule references.
+	precedence bool
+
+	// context is the number of unchanged rules reported before and after
+	// each changed rule, or -1 for the default of the format.
+	context int
+
+	// matchNames is how the rule names and the references to them are
+	// matched: exact, fold or style.
+	matchNames string
+
+	// ruleTests runs the tests annotated on the rules with both grammars.
+	ruleTests bool
+
+	// properties reports the rules whose computed properties changed.
+	properties bool
+
+	// lengths reports the rules whose match length bounds changed.
+	lengths bool
+
+	// recursion reports the changes of the recursion groups.
+	recursion bool
+
+	// depth reports the rules whose depth grew by at least depthRatio
+	// times or beyond maxDepth, when not 0.
+	depth      bool
+	depthRatio float64
+	maxDepth   int
+
+	// pairByStructure pairs the rules not matched by name by their
+	// structure.
+	pairByStructure bool
+
+	// The rhs name key paired with each lhs name key by structure, set
+	// while comparing.
+	pairs map[string]string
+}
+
+// changeKind describes how a rule differs between the lhs and rhs grammars.
+type changeKind int
+
+const (
+	ruleEqual changeKind = iota
+	ruleModified
+	ruleAdded   // the rule is only defined in rhs
+	ruleRemoved // the rule is only defined in lhs
+)
+
+// change is the result of comparing a rule in the lhs and rhs grammars.
+type change struct {
+	kind     changeKind
+	lhs, rhs *Rule
+
+	// moved is true when the rule is defined in both grammars, but at a
+	// different position in the rule sequence.
+	moved bool
+
+	// copyOf is the lhs rule with the same expression as an added rule.
+	copyOf *Rule
+
+	// Token level edit script between the lhs and rhs expressions.
+	ltoks, rtoks []string
+	edits        []edit
+
+	// Changed alternatives, when either expression is a choice.
+	alts []altChange
+
+	// Changed character classes.
+	classes []classChange
+
+	// Changed literals that are canonically equivalent.
+	literals []literalChange
+
+	// Repetitions that only changed their bounds.
+	bounds []boundChange
+}
+
+// compare compares the lhs and rhs grammars, returning the changes in rhs
+// order, with the rules removed from lhs at the position they were removed.
+func compare(lgrammar, rgrammar []Rule, opts *options) []change {
+	return slices.Collect(compareSeq(lgrammar, rgrammar, opts))
+}
+
+// compareSeq returns an iterator over the changes of compare, computed as
+// they are yielded, so that the first changes of large grammars can be
+// reported before the comparison is done.  Only the alignment of the rule
+// names is computed in advance.
+func compareSeq(lgrammar, rgrammar []Rule, opts *options) iter.Seq[change] {
+	return func(yield func(change) bool) {
+		compareRules(lgrammar, rgrammar, opts, yield)
+	}
+}
+
+// Diff is the difference of a rule between two grammars.
+type Diff struct {
+	// Status is the status of the rule in rhs: added, removed, modified
+	// or, for a moved rule, equal.
+	Status string
+
+	// Moved reports whether the rule is defined in both grammars, but at a
+	// different position in the rule sequence.
+	Moved bool
+
+	// LHS and RHS are the definitions of the rule, nil when the rule is
+	// not defined in the grammar.
+	LHS, RHS *Rule
+}
+
+// Compare returns an iterator over the differences of the rhs rules from the
+// lhs rules, in rhs order, with the rules removed from lhs at the position
+// they were removed.  The rules are read when the iteration starts, and each
+// difference is computed when it is yielded.  The rules that did not change
+// are not yielded.
+func Compare(lhs, rhs iter.Seq[Rule]) iter.Seq[Diff] {
+	return func(yield func(Diff) bool) {
+		lgrammar, rgrammar := slices.Collect(lhs), slices.Collect(rhs)
+		for c := range compareSeq(lgrammar, rgrammar, &options{normalize: "none"}) {
+			if c.kind == ruleEqual && !c.moved {
+				continue
+			}
+			if !yield(Diff{Status: statusNames[c.kind], Moved: c.moved, LHS: c.lhs, RHS: c.rhs}) {
+				return
+			}
+		}
+	}
+}
+
+// compareRules calls yield with each change of compare, until it returns
+// false.
+func compareRules(lgrammar, rgrammar []Rule, opts *options, yield func(change) bool) {
+	// Use the lhs grammar as reference, assuming that it is a valid PEG
+	// grammar.
+	lrules := make(map[string]*Rule)
+	lexprs := make(map[string]*Rule)
+	lnames := make([]string, len(lgrammar))
+	for i := range lgrammar {
+		lrule := &lgrammar[i]
+		lrules[opts.name(lrule.Name)] = lrule
+		if _, ok := lexprs[lrule.Expr]; !ok {
+			lexprs[lrule.Expr] = lrule
+		}
+		lnames[i] = opts.name(lrule.Name)
+	}
+	rrules := make(map[string]bool)
+	rnames := make([]string, len(rgrammar))
+	for i, rrule := range rgrammar {
+		rrules[opts.name(rrule.Name)] = true
+		rnames[i] = opts.name(rrule.Name)
+	}
+	if opts.pairByStructure {
+		if pairs := pairByStructure(lgrammar, rgrammar, lnames, rnames, opts); len(pairs) > 0 {
+			popts := *opts
+			popts.pairs = pairs
+			opts = &popts
+			for i, name := range lnames {
+				if p, ok := pairs[name]; ok {
+					lnames[i] = p
+					lrules[p] = &lgrammar[i]
+				}
+			}
+		}
+	}
+
+	// Align the rule sequences by name.  A rule matched by name, but not
+	// part of the longest common subsequence, has been moved.
+	for _, e := range myers(lnames, rnames) {
+		var c change
+		switch e.op {
+		case opEqual:
+			c = diffRule(&lgrammar[e.i], &rgrammar[e.j], opts)
+		case opDelete:
+			if rrules[lnames[e.i]] {
+				continue
+			}
+			c = change{
+				kind: ruleRemoved,
+				lhs:  &lgrammar[e.i],
+			}
+		case opInsert:
+			rrule := &rgrammar[e.j]
+			if lrule, ok := lrules[opts.name(rrule.Name)]; ok {
+				c = diffRule(lrule, rrule, opts)
+				c.moved = true
+			} else {
+				c = change{
+					kind:   ruleAdded,
+					rhs:    rrule,
+					copyOf: lexprs[rrule.Expr],
+				}
+			}
+		}
+		if !yield(c) {
+			return
+		}
+	}
+}
+
+// diffRule compares the expressions of two rules with the same name.
+func diffRule(lrule, rrule *Rule, opts *options) change {
+	c := change{
+		kind:  ruleEqual,
+		lhs:   lrule,
+		rhs:   rrule,
+		ltoks: normalizeCode(normalizeBounds(normalizeTokens(tokenize(lrule.Expr), opts.normalize))),
+		rtoks: normalizeCode(normalizeBounds(normalizeTokens(tokenize(rrule.Expr), opts.normalize))),
+	}
+
+	// Rule expressions are compared token by token, including white space.
+	if opts.matchNames != "" && opts.matchNames != "exact" || opts.pairs != nil {
+		c.edits = myers(renameIdents(c.ltoks, opts.lhsName), renameIdents(c.rtoks, opts.name))
+	} else {
+		c.edits = myers(c.ltoks, c.rtoks)
+	}
+	for _, e := range c.edits {
+		if e.op != opEqual {
+			c.kind = ruleModified
+
+			break
+		}
+	}
+	if c.kind == ruleModified && opts.ruleCompareCmd != "" && externalEqual(opts.ruleCompareCmd, lrule, rrule) {
+		c.kind = ruleEqual
+	}
+	if c.kind == ruleModified {
+		c.alts = diffAlternatives(c.ltoks, c.rtoks)
+		c.classes = diffClasses(c)
+		c.literals = diffLiterals(c)
+		c.bounds = diffBounds(c)
+	}
+
+	return c
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const completionUsage = `Usage: pegcmp completion bash|zsh|fish
+       pegcmp completion rules arg...`
+
+// The completion scripts, with the placeholders for the flags, the commands
+// and the formats.  The rule names of the -start flag are completed by
+// running pegcmp completion rules with the words on the command line.
+const (
+	bashCompletion = `# bash completion for pegcmp, generated by pegcmp completion bash.
+_pegcmp() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	case $prev in
+	-start|--start)
+		COMPREPLY=($(compgen -W "$(pegcmp completion rules "${COMP_WORDS[@]:1}" 2>/dev/null)" -- "$cur"))
+		return;;
+	-format|--format)
+		COMPREPLY=($(compgen -W "@FORMATS@" -- "$cur"))
+		return;;
+	esac
+	case $cur in
+	-*)
+		COMPREPLY=($(compgen -W "@FLAGS@" -- "$cur"))
+		return;;
+	esac
+	COMPREPLY=($(compgen -f -- "$cur"))
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY+=($(compgen -W "@COMMANDS@" -- "$cur"))
+	fi
+}
+complete -o filenames -F _pegcmp pegcmp
+`
+
+	zshCompletion = `#compdef pegcmp
+# zsh completion for pegcmp, generated by pegcmp completion zsh.
+_pegcmp() {
+	case ${words[CURRENT-1]} in
+	(-start|--start)
+		compadd -- ${(f)"$(pegcmp completion rules ${words[2,-1]} 2>/dev/null)"}
+		return;;
+	(-format|--format)
+		compadd -- @FORMATS@
+		return;;
+	esac
+	if [[ ${words[CURRENT]} == -* ]]; then
+		compadd -- @FLAGS@
+		return
+	fi
+	if (( CURRENT == 2 )); then
+		compadd -- @COMMANDS@
+	fi
+	_files
+}
+compdef _pegcmp pegcmp
+`
+
+	fishCompletion = `# fish completion for pegcmp, generated by pegcmp completion fish.
+function __pegcmp_rules
+	pegcmp completion rules (commandline -opc) 2>/dev/null
+end
+complete -c pegcmp -n __fish_use_subcommand -a '@COMMANDS@'
+complete -c pegcmp -o start -x -a '(__pegcmp_rules)'
+complete -c pegcmp -o format -x -a '@FORMATS@'
+`
+)
+
+// runCompletion writes the completion script for a shell, or the names of the
+// rules defined in the .peg grammar files among the arguments.
+func runCompletion(args []string) {
+	flags := flag.NewFlagSet("completion", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, completionUsage)
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	switch shell := flags.Arg(0); shell {
+	case "bash", "zsh", "fish":
+		writeCompletion(os.Stdout, shell)
+	case "rules":
+		writeRuleNames(os.Stdout, flags.Args()[1:])
+	default:
+		fatalf("unknown shell %q", shell)
+	}
+}
+
+// writeCompletion writes the completion script for shell.
+func writeCompletion(w io.Writer, shell string) {
+	var flagNames []string
+	var fishFlags strings.Builder
+	flag.VisitAll(func(f *flag.Flag) {
+		flagNames = append(flagNames, "-"+f.Name)
+		arg := " -r"
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			arg = ""
+		}
+		desc := strings.ReplaceAll(f.Usage, `\`, `\\`)
+		desc = strings.ReplaceAll(desc, "'", `\'`)
+		fmt.Fprintf(&fishFlags, "complete -c pegcmp -o %s%s -d '%s'\n", f.Name, arg, desc)
+	})
+	var commandNames []string
+	for name := range commands {
+		commandNames = append(commandNames, name)
+	}
+	sort.Strings(commandNames)
+
+	script := map[string]string{
+		"bash": bashCompletion,
+		"zsh":  zshCompletion,
+		"fish": fishCompletion,
+	}[shell]
+	script = strings.NewReplacer(
+		"@FLAGS@", strings.Join(flagNames, " "),
+		"@COMMANDS@", strings.Join(commandNames, " "),
+		"@FORMATS@", strings.Join(formatNames(), " "),
+	).Replace(script)
+	io.WriteString(w, script)
+	if shell == "fish" {
+		io.WriteString(w, fishFlags.String())
+	}
+}
+
+// writeRuleNames writes the names of the rules defined in the .peg files
+// among args, one per line.  The syntax errors are ignored, since the
+// grammar may be incomplete while editing.
+func writeRuleNames(w io.Writer, args []string) {
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		if filepath.Ext(arg) != ".peg" || isDir(arg) {
+			continue
+		}
+		grammar, _, err := parseContinue(arg)
+		if err != nil {
+			continue
+		}
+		for _, rule := range grammar {
+			if !seen[rule.Name] {
+				seen[rule.Name] = true
+				fmt.Fprintln(w, rule.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+// minCostDelta is the minimum increase of the cost of a rule to be reported
+// as a regression.
+const minCostDelta = 10
+
+// minDepthDelta is the minimum increase of the maximum recursion depth of a
+// rule to be reported as a regression.
+const minDepthDelta = 5
+
+// outcome is the result of matching an input.
+type outcome struct {
+	ok   bool
+	end  int
+	size int
+}
+
+// accepted reports whether the whole input was matched.
+func (o outcome) accepted() bool {
+	return o.ok && o.end == o.size
+}
+
+func (o outcome) String() string {
+	switch {
+	case o.accepted():
+		return "accepts"
+	case o.ok:
+		return fmt.Sprintf("rejects, matching %d of %d bytes", o.end, o.size)
+	}
+
+	return "rejects"
+}
+
+// inputDiff is an input where the lhs and rhs grammars disagree.
+type inputDiff struct {
+	path     string
+	lhs, rhs outcome
+
+	// Minimal input where the grammars still disagree, when shrunk.
+	minimal *shrunkInput
+}
+
+// overBudget is an input where the run of a grammar exceeded its budget.  A
+// nil error means the grammar completed the run.
+type overBudget struct {
+	path     string
+	lhs, rhs error
+}
+
+// costRegression is a rule whose cost on the corpus increased significantly
+// in rhs.
+type costRegression struct {
+	name     string
+	lhs, rhs ruleStats
+}
+
+// cost returns the cost of a rule, as the number of invocations and failed
+// alternatives.
+func (s ruleStats) cost() int {
+	return s.calls + s.backtracks
+}
+
+// corpusResult is the result of running the lhs and rhs grammars on each
+// input of a corpus.
+type corpusResult struct {
+	inputs       int
+	diffs        []inputDiff
+	overBudget   []overBudget
+	lprof, rprof *profile
+	regressions  []costRegression
+
+	// Inputs where the error position of the rhs grammar regressed.
+	errors []errorRegression
+}
+
+// corpusFiles returns the regular files in the file or directory named root
+// in fsys, in lexical order.
+func corpusFiles(fsys fs.FS, root string) ([]string, error) {
+	var list []string
+	err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return displayError(fsys, err)
+		}
+		if d.Type().IsRegular() {
+			list = append(list, path)
+		}
+
+		return nil
+	})
+
+	return list, err
+}
+
+// corpusOptions control the comparison on a corpus.
+type corpusOptions struct {
+	start     string  // start rule, or empty for the first rule
+	costRatio float64 // minimum ratio of a reported cost increase
+	memo      bool    // memoize all the rules
+	strict    bool    // fail left recursive invocations
+	progress  bool    // report the progress on a terminal
+	shrink    bool    // shrink the inputs where the grammars disagree
+
+	// Budget of each run, unlimited when zero.
+	timeout  time.Duration
+	maxSteps int
+
+	// ctx, when not nil, cancels the runs and the corpus comparison.
+	ctx context.Context
+}
+
+// startRule returns the rule named start, or the first rule in grammar when
+// start is empty.
+func startRule(grammar []Rule, start string) string {
+	if start == "" && len(grammar) > 0 {
+		return grammar[0].Name
+	}
+
+	return start
+}
+
+// runCorpus matches each input in the corpus named root in fsys with the lhs
+// and rhs grammars, reporting the inputs where they disagree and the rules
+// whose cost grew significantly.  Each test case of a tree-sitter corpus file
+// is a separate input.  The comparison stops with the error of opts.ctx when
+// it is done.
+func runCorpus(fsys fs.FS, root string, lsyn, rsyn *syntax, opts *corpusOptions) (*corpusResult, error) {
+	files, err := corpusFiles(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("running corpus", "path", displayName(fsys, root), "inputs", len(files))
+	lstart := startRule(lsyn.rules, opts.start)
+	rstart := startRule(rsyn.rules, opts.start)
+	ratio := opts.costRatio
+
+	res := &corpusResult{
+		lprof: newProfile(),
+		rprof: newProfile(),
+	}
+	prog := newProgress(opts.progress, "corpus", len(files))
+	defer prog.clear()
+	for _, name := range files {
+		data, err := readFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range corpusInputs(displayName(fsys, name), data) {
+			res.matchInput(in.name, in.input, lsyn, rsyn, lstart, rstart, opts)
+		}
+		prog.step()
+		if opts.ctx != nil && opts.ctx.Err() != nil {
+			return nil, opts.ctx.Err()
+		}
+	}
+
+	for _, name := range res.rprof.names() {
+		lstats, ok := res.lprof.rules[name]
+		if !ok {
+			continue
+		}
+		rstats := res.rprof.rules[name]
+		lcost, rcost := lstats.cost(), rstats.cost()
+		costly := float64(rcost) > ratio*float64(lcost) && rcost-lcost >= minCostDelta
+		deep := float64(rstats.maxDepth) > ratio*float64(lstats.maxDepth) && rstats.maxDepth-lstats.maxDepth >= minDepthDelta
+		if costly || deep {
+			res.regressions = append(res.regressions, costRegression{name, *lstats, *rstats})
+		}
+	}
+
+	return res, nil
+}
+
+// matchInput matches input, named file, with the lhs and rhs grammars,
+// recording the result in res.
+func (res *corpusResult) matchInput(file, input string, lsyn, rsyn *syntax, lstart, rstart string, opts *corpusOptions) {
+	var lout, rout outcome
+	var lerr, rerr error
+	lm := newCorpusMachine(lsyn, input, res.lprof, opts)
+	rm := newCorpusMachine(rsyn, input, res.rprof, opts)
+	lout.end, lout.ok, lerr = lm.run(lstart)
+	rout.end, rout.ok, rerr = rm.run(rstart)
+	lout.size, rout.size = len(input), len(input)
+	res.inputs++
+	events.inputMatched(file, lout, rout)
+	slog.Debug("matched corpus input", "path", file, "lhs", lout, "rhs", rout,
+		"lhs_err", lerr, "rhs_err", rerr)
+	if lerr != nil || rerr != nil {
+		res.overBudget = append(res.overBudget, overBudget{file, lerr, rerr})
+	} else if lout != rout {
+		d := inputDiff{path: file, lhs: lout, rhs: rout}
+		if opts.shrink {
+			sh := &shrinker{lsyn: lsyn, rsyn: rsyn, lstart: lstart, rstart: rstart, opts: opts}
+			d.minimal = sh.shrink(input, d)
+		}
+		res.diffs = append(res.diffs, d)
+	} else if !lout.accepted() && rm.failPos < lm.failPos {
+		res.errors = append(res.errors, errorRegression{file, newFailure(lm), newFailure(rm)})
+	}
+}
+
+// newCorpusMachine returns a machine for input configured with opts.
+func newCorpusMachine(s *syntax, input string, prof *profile, opts *corpusOptions) *machine {
+	m := newMachine(s, input, prof)
+	m.memoAll = opts.memo
+	m.strict = opts.strict
+	m.maxSteps = opts.maxSteps
+	m.ctx = opts.ctx
+	m.timeout = opts.timeout
+
+	return m
+}
+
+// budgetString returns the description of the budget error err.
+func budgetString(err error) string {
+	if err == nil {
+		return "completed"
+	}
+
+	return err.Error()
+}
+
+// writeCorpus writes the inputs where the grammars disagree or the rhs error
+// position regressed, the rules whose cost regressed and the number of inputs
+// where the grammars agree.
+func writeCorpus(w io.Writer, res *corpusResult) {
+	for _, d := range res.diffs {
+		fmt.Fprintf(w, "! input %q: lhs %s, rhs %s\n\n", d.path, d.lhs, d.rhs)
+		if m := d.minimal; m != nil {
+			fmt.Fprintf(w, "~ minimal input %q: lhs %s, rhs %s\n\n", m.input, m.lhs, m.rhs)
+		}
+	}
+	for _, b := range res.overBudget {
+		fmt.Fprintf(w, "! input %q over budget: lhs %s, rhs %s\n\n",
+			b.path, budgetString(b.lhs), budgetString(b.rhs))
+	}
+	writeErrorRegressions(w, res.errors)
+	for _, reg := range res.regressions {
+		fmt.Fprintf(w, "! rule %q cost regressed on %d inputs\n", reg.name, res.inputs)
+		fmt.Fprintf(w, "> calls %d, backtracks %d, max depth %d, memo hits %d\n",
+			reg.rhs.calls, reg.rhs.backtracks, reg.rhs.maxDepth, reg.rhs.memoHits)
+		fmt.Fprintf(w, "< calls %d, backtracks %d, max depth %d, memo hits %d\n\n",
+			reg.lhs.calls, reg.lhs.backtracks, reg.lhs.maxDepth, reg.lhs.memoHits)
+	}
+	if res.lprof.memoLookups > 0 || res.rprof.memoLookups > 0 {
+		fmt.Fprintf(w, "! memoization cache on %d inputs\n", res.inputs)
+		fmt.Fprintf(w, "> %d hits of %d lookups\n", res.rprof.memoHits, res.rprof.memoLookups)
+		fmt.Fprintf(w, "< %d hits of %d lookups\n\n", res.lprof.memoHits, res.lprof.memoLookups)
+	}
+	fmt.Fprintf(w, "~ grammars agree on %d of %d inputs\n\n", res.inputs-len(res.diffs)-len(res.overBudget), res.inputs)
+}
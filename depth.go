@@ -0,0 +1,152 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ruleDepth is the maximum static nesting depth of a rule: the number of
+// nested expressions, including the rules they reference, on the deepest
+// path from the rule.  For a recursive rule the path ends at the first
+// reference to a rule of its recursion group, and the depth is the one of a
+// recursion level.
+type ruleDepth struct {
+	depth int
+	group int // rules in the recursion group, 0 if not recursive
+}
+
+func (d ruleDepth) String() string {
+	switch {
+	case d.group == 1:
+		return fmt.Sprintf("depth %d, recursive", d.depth)
+	case d.group > 1:
+		return fmt.Sprintf("depth %d, mutually recursive with %d rules", d.depth, d.group)
+	}
+
+	return fmt.Sprintf("depth %d", d.depth)
+}
+
+// ruleDepths returns the depth of the rules of s.
+func ruleDepths(s *syntax) map[string]ruleDepth {
+	g := newRefGraph(s)
+	depths := make(map[string]ruleDepth)
+	comp := make(map[string]int)
+
+	// A component follows the components it references, whose depths are
+	// then known.
+	for i, c := range components(g, ruleOrder(s)) {
+		for _, name := range c {
+			comp[name] = i
+		}
+		group := 0
+		if len(c) > 1 || slices.Contains(g[c[0]], c[0]) {
+			group = len(c)
+		}
+		for _, name := range c {
+			depths[name] = ruleDepth{1 + nodeDepth(s.nodes[name], func(ref string) int {
+				if j, ok := comp[ref]; ok && j != i {
+					return depths[ref].depth
+				}
+
+				return 0
+			}), group}
+		}
+	}
+
+	return depths
+}
+
+// nodeDepth returns the nesting depth of n, with the depth of the rule named
+// ref, as returned by rule, added to the depth of each reference to it.
+func nodeDepth(n node, rule func(ref string) int) int {
+	var d int
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			d = max(d, nodeDepth(alt, rule))
+		}
+	case *seqNode:
+		for _, item := range n.items {
+			d = max(d, nodeDepth(item, rule))
+		}
+	case *predNode:
+		d = nodeDepth(n.expr, rule)
+	case *repeatNode:
+		d = nodeDepth(n.expr, rule)
+	case *recoveryNode:
+		d = max(nodeDepth(n.expr, rule), nodeDepth(n.recover, rule))
+	case *refNode:
+		d = rule(n.name)
+	}
+
+	return 1 + d
+}
+
+// depthChange is a rule defined in both grammars whose depth grew
+// substantially.
+type depthChange struct {
+	name     string
+	lhs, rhs ruleDepth
+	maxDepth int
+}
+
+// notes returns the notable consequences of the change.
+func (c depthChange) notes() []string {
+	var list []string
+	if c.lhs.depth > 0 {
+		list = append(list, fmt.Sprintf("grew %.1f times", float64(c.rhs.depth)/float64(c.lhs.depth)))
+	}
+	if c.lhs.group == 0 && c.rhs.group > 0 {
+		list = append(list, "now recursive")
+	}
+	if c.maxDepth > 0 && c.rhs.depth > c.maxDepth {
+		list = append(list, fmt.Sprintf("exceeds the maximum depth %d", c.maxDepth))
+	}
+
+	return list
+}
+
+// diffDepths returns the rules of rgrammar, in order, whose depth grew from
+// the lhs rule with the same name by at least ratio times, or beyond
+// maxDepth when not 0.
+func diffDepths(lgrammar, rgrammar []Rule, ratio float64, maxDepth int) []depthChange {
+	ld := ruleDepths(newSyntax(lgrammar))
+	rs := newSyntax(rgrammar)
+	rd := ruleDepths(rs)
+	var list []depthChange
+	seen := make(map[string]bool)
+	for _, rule := range rs.rules {
+		l, lok := ld[rule.Name]
+		r, rok := rd[rule.Name]
+		if !lok || !rok || seen[rule.Name] {
+			continue
+		}
+		seen[rule.Name] = true
+		if r.depth <= l.depth {
+			continue
+		}
+		if float64(r.depth) >= ratio*float64(l.depth) || maxDepth > 0 && r.depth > maxDepth {
+			list = append(list, depthChange{rule.Name, l, r, maxDepth})
+		}
+	}
+
+	return list
+}
+
+// writeDepths writes the rules whose depth grew.
+func writeDepths(w io.Writer, list []depthChange) {
+	for _, c := range list {
+		fmt.Fprintf(w, "! rule %q depth grew\n", c.name)
+		fmt.Fprintf(w, "> %s\n", c.rhs)
+		fmt.Fprintf(w, "< %s\n", c.lhs)
+		for _, note := range c.notes() {
+			fmt.Fprintf(w, "~ %s\n", note)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const diagramUsage = `Usage: pegcmp diagram [-o dir] path
+       pegcmp diagram -diff [-o dir] lhs-path rhs-path`
+
+// Railroad diagram metrics, in pixels.
+const (
+	railCharWidth = 8  // width of a character of the monospace font
+	railBoxHeight = 24 // height of a terminal or nonterminal box
+	railPad       = 8  // horizontal padding of the text in a box
+	railGap       = 16 // space between the items of a sequence
+	railIndent    = 20 // space on each side of the alternatives of a choice
+	railVSpace    = 10 // vertical space between the alternatives of a choice
+	railMargin    = 20 // margin around a diagram
+)
+
+// railStyle is the style of the railroad diagrams.
+const railStyle = `path { fill: none; stroke: #333; stroke-width: 1.5; }
+rect { fill: #fff; stroke: #333; stroke-width: 1.5; }
+rect.terminal { fill: #eef; }
+rect.bound { fill: #ffe; stroke-dasharray: 4 2; }
+rect.recovery, rect.throw { fill: #fed; }
+rect.state { fill: #eee; }
+rect.added { fill: #cfc; }
+rect.removed { fill: #fcc; }
+text { font: 13px monospace; text-anchor: middle; dominant-baseline: central; }
+text.title { font-weight: bold; text-anchor: start; }`
+
+// rail is the layout of a railroad diagram.  The track enters on the left
+// and exits on the right, at the baseline.
+type rail struct {
+	w, up, down int // width and height above and below the baseline
+
+	// draw writes the SVG elements of the diagram, with the left end of
+	// the baseline at x, y.
+	draw func(b *strings.Builder, x, y int)
+}
+
+// railLine writes a path through the points, alternating horizontal and
+// vertical segments.
+func railLine(b *strings.Builder, x, y int, coords ...int) {
+	fmt.Fprintf(b, `<path d="M%d %d`, x, y)
+	for i, c := range coords {
+		if i%2 == 0 {
+			fmt.Fprintf(b, " H%d", c)
+		} else {
+			fmt.Fprintf(b, " V%d", c)
+		}
+	}
+	b.WriteString("\"/>\n")
+}
+
+// railBox returns a box with the text, of the specified class.
+func railBox(text, class string, rounded bool) rail {
+	w := utf8.RuneCountInString(text)*railCharWidth + 2*railPad
+	r := 0
+	if rounded {
+		r = railBoxHeight / 2
+	}
+
+	return rail{w, railBoxHeight / 2, railBoxHeight / 2, func(b *strings.Builder, x, y int) {
+		fmt.Fprintf(b, `<rect class="%s" x="%d" y="%d" width="%d" height="%d" rx="%d"/>`+"\n",
+			class, x, y-railBoxHeight/2, w, railBoxHeight, r)
+		fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`+"\n", x+w/2, y, html.EscapeString(text))
+	}}
+}
+
+// railSeq returns the items connected in sequence.
+func railSeq(items []rail) rail {
+	r := rail{}
+	for i, item := range items {
+		if i > 0 {
+			r.w += railGap
+		}
+		r.w += item.w
+		r.up = max(r.up, item.up)
+		r.down = max(r.down, item.down)
+	}
+	r.draw = func(b *strings.Builder, x, y int) {
+		for i, item := range items {
+			if i > 0 {
+				railLine(b, x, y, x+railGap)
+				x += railGap
+			}
+			item.draw(b, x, y)
+			x += item.w
+		}
+	}
+
+	return r
+}
+
+// railChoice returns the alternatives stacked vertically, with the first on
+// the baseline.
+func railChoice(alts []rail) rail {
+	inner := 0
+	for _, alt := range alts {
+		inner = max(inner, alt.w)
+	}
+	r := rail{w: inner + 2*railIndent, up: alts[0].up}
+	offsets := make([]int, len(alts))
+	for i, alt := range alts {
+		if i > 0 {
+			offsets[i] = offsets[i-1] + alts[i-1].down + railVSpace + alt.up
+		}
+		r.down = offsets[i] + alt.down
+	}
+	r.draw = func(b *strings.Builder, x, y int) {
+		end := x + r.w
+		for i, alt := range alts {
+			ay := y + offsets[i]
+			railLine(b, x, y, x+railIndent/2, ay, x+railIndent)
+			alt.draw(b, x+railIndent, ay)
+			railLine(b, x+railIndent+alt.w, ay, end-railIndent/2, y, end)
+		}
+	}
+
+	return r
+}
+
+// railLoop returns item with a track back to its start, below it.
+func railLoop(item rail) rail {
+	r := rail{w: item.w + 2*railIndent, up: item.up, down: item.down + railVSpace}
+	r.draw = func(b *strings.Builder, x, y int) {
+		railLine(b, x, y, x+railIndent)
+		item.draw(b, x+railIndent, y)
+		end := x + railIndent + item.w
+		railLine(b, end, y, x+r.w)
+		railLine(b, end, y, end+railIndent/2, y+r.down, x+railIndent/2, y, x+railIndent)
+	}
+
+	return r
+}
+
+// railEmpty is an empty track.
+var railEmpty = rail{draw: func(*strings.Builder, int, int) {}}
+
+// newRail returns the railroad diagram of n.  The boxes of the nodes whose
+// canonical form is in highlight have the specified class.
+func newRail(n node, highlight map[string]bool, class string) rail {
+	boxClass := func(base string) string {
+		if highlight[exprString(n)] {
+			return class
+		}
+
+		return base
+	}
+	switch n := n.(type) {
+	case *choiceNode:
+		list := make([]rail, len(n.alts))
+		for i, alt := range n.alts {
+			list[i] = newRail(alt, highlight, class)
+		}
+
+		return railChoice(list)
+	case *seqNode:
+		list := make([]rail, len(n.items))
+		for i, item := range n.items {
+			list[i] = newRail(item, highlight, class)
+		}
+
+		return railSeq(list)
+	case *predNode:
+		return railSeq([]rail{railBox(string(n.op), boxClass("predicate"), false), newRail(n.expr, highlight, class)})
+	case *repeatNode:
+		item := newRail(n.expr, highlight, class)
+		switch n.op {
+		case '?':
+			return railChoice([]rail{railEmpty, item})
+		case '*':
+			return railChoice([]rail{railEmpty, railLoop(item)})
+		case '{':
+			// The loop is followed by a box with the bounds.
+			loop := railSeq([]rail{railLoop(item), railBox(boundString(n.lo, n.hi), boxClass("bound"), false)})
+			if n.lo == 0 {
+				return railChoice([]rail{railEmpty, loop})
+			}
+
+			return loop
+		}
+
+		return railLoop(item)
+	case *recoveryNode:
+		box := railBox("//{"+strings.Join(n.labels, ", ")+"}", boxClass("recovery"), false)
+
+		return railChoice([]rail{newRail(n.expr, highlight, class), railSeq([]rail{box, newRail(n.recover, highlight, class)})})
+	case *throwNode:
+		return railBox("%{"+n.label+"}", boxClass("throw"), false)
+	case *stateNode:
+		return railBox("#{…}", boxClass("state"), false)
+	case *refNode:
+		return railBox(n.name, boxClass("nonterminal"), false)
+	case *litNode:
+		return railBox(n.text, boxClass("terminal"), true)
+	case *classNode:
+		return railBox(n.text, boxClass("terminal"), true)
+	case *anyNode:
+		return railBox(".", boxClass("terminal"), true)
+	}
+
+	return railEmpty
+}
+
+// railTrack returns the diagram of a rule, with the start and end markers.
+func railTrack(r rail) rail {
+	return rail{r.w + 2*railGap, r.up, r.down, func(b *strings.Builder, x, y int) {
+		end := x + r.w + 2*railGap
+		fmt.Fprintf(b, `<path d="M%d %d V%d M%d %d V%d"/>`+"\n",
+			x, y-railBoxHeight/2, y+railBoxHeight/2, end, y-railBoxHeight/2, y+railBoxHeight/2)
+		railLine(b, x, y, x+railGap)
+		r.draw(b, x+railGap, y)
+		railLine(b, x+railGap+r.w, y, end)
+	}}
+}
+
+// writeSVG writes the diagrams side by side, each with its title, as an SVG
+// document.
+func writeSVG(path string, titles []string, rails []rail) error {
+	var body strings.Builder
+	width, height := railMargin, 0
+	for i, r := range rails {
+		r = railTrack(r)
+		fmt.Fprintf(&body, `<text class="title" x="%d" y="%d">%s</text>`+"\n",
+			width, railMargin, html.EscapeString(titles[i]))
+		r.draw(&body, width, 2*railMargin+r.up)
+		width += r.w + railMargin
+		height = max(height, 2*railMargin+r.up+r.down+railMargin)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, "<style>\n%s\n</style>\n", railStyle)
+	b.WriteString(body.String())
+	b.WriteString("</svg>\n")
+
+	return os.WriteFile(path, []byte(b.String()), 0o666)
+}
+
+// nodeStrings returns the canonical form of n and of each of its
+// descendants.
+func nodeStrings(n node) map[string]bool {
+	set := make(map[string]bool)
+	walk(n, func(n node) {
+		set[exprString(n)] = true
+	})
+
+	return set
+}
+
+// missingStrings returns the canonical form of the descendants of n that are
+// not in other.
+func missingStrings(n node, other map[string]bool) map[string]bool {
+	set := make(map[string]bool)
+	walk(n, func(n node) {
+		if s := exprString(n); !other[s] {
+			set[s] = true
+		}
+	})
+
+	return set
+}
+
+// runDiagram writes an SVG railroad diagram for each rule of a grammar or,
+// with -diff, for each rule that differs between two grammars, with the lhs
+// and rhs diagrams side by side and the removed and added expressions
+// highlighted.
+func runDiagram(args []string) {
+	flags := flag.NewFlagSet("diagram", flag.ExitOnError)
+	dir := flags.String("o", ".", "directory of the SVG files, one for each rule")
+	diff := flags.Bool("diff", false, "write the diagrams of the rules that differ between two grammars")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, diagramUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	want := 1
+	if *diff {
+		want = 2
+	}
+	if flags.NArg() != want {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	if err := os.MkdirAll(*dir, 0o777); err != nil {
+		fatal(err)
+	}
+	file := func(name string) string {
+		return filepath.Join(*dir, name+".svg")
+	}
+
+	if !*diff {
+		grammar, err := parse(flags.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		s := newSyntax(grammar)
+		for _, rule := range grammar {
+			n, ok := s.nodes[rule.Name]
+			if !ok {
+				slog.Warn("skipping rule with invalid expression", "rule", rule.Name, "err", s.errs[rule.Name])
+
+				continue
+			}
+			if err := writeSVG(file(rule.Name), []string{rule.Name}, []rail{newRail(n, nil, "")}); err != nil {
+				fatal(err)
+			}
+		}
+
+		return
+	}
+
+	opts := compareOptions()
+	lpath, rpath := flags.Arg(0), flags.Arg(1)
+	lgrammar, err := parse(lpath)
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar, err := parse(rpath)
+	if err != nil {
+		fatal(err)
+	}
+	lsyn, rsyn := newSyntax(lgrammar), newSyntax(rgrammar)
+	for _, c := range compare(normalizeRules(lgrammar), normalizeRules(rgrammar), opts) {
+		var titles []string
+		var rails []rail
+		name := changeName(c)
+		lnode, lok := lsyn.nodes[name]
+		rnode, rok := rsyn.nodes[name]
+		switch {
+		case c.kind == ruleEqual:
+			continue
+		case c.kind == ruleAdded && rok:
+			titles = []string{name + " (added)"}
+			rails = []rail{newRail(rnode, nodeStrings(rnode), "added")}
+		case c.kind == ruleRemoved && lok:
+			titles = []string{name + " (removed)"}
+			rails = []rail{newRail(lnode, nodeStrings(lnode), "removed")}
+		case c.kind == ruleModified && lok && rok:
+			titles = []string{name + " (" + lpath + ")", name + " (" + rpath + ")"}
+			rails = []rail{
+				newRail(lnode, missingStrings(lnode, nodeStrings(rnode)), "removed"),
+				newRail(rnode, missingStrings(rnode, nodeStrings(lnode)), "added"),
+			}
+		default:
+			slog.Warn("skipping rule with invalid expression", "rule", name)
+
+			continue
+		}
+		if err := writeSVG(file(name), titles, rails); err != nil {
+			fatal(err)
+		}
+	}
+}
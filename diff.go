@@ -0,0 +1,192 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// editOp is the operation of a single edit in an edit script.
+type editOp int
+
+const (
+	opEqual editOp = iota
+	opDelete
+	opInsert
+)
+
+// edit is a single step of an edit script transforming a into b.  For
+// opEqual both indices are valid; for opDelete i is the deleted element of a
+// and j is the insertion point in b; for opInsert j is the inserted element
+// of b and i is the insertion point in a.
+type edit struct {
+	op   editOp
+	i, j int
+}
+
+// myers returns the shortest edit script transforming a into b, using the
+// linear space variation of the O(ND) algorithm described in "An O(ND)
+// Difference Algorithm and Its Variations" by Eugene W. Myers: the script is
+// split at the middle snake of an optimal path, and each half is computed
+// recursively.
+func myers[T comparable](a, b []T) []edit {
+	n := len(a) + len(b) + 1
+	d := &differ[T]{a: a, b: b, vf: make([]int, 2*n+2), vb: make([]int, 2*n+2)}
+	d.compare(0, len(a), 0, len(b))
+
+	return d.script
+}
+
+// differ computes an edit script with myers.  vf and vb are the furthest
+// reaching paths of the forward and reverse searches, shared by the
+// recursive calls.
+type differ[T comparable] struct {
+	a, b   []T
+	vf, vb []int
+	script []edit
+}
+
+// compare appends the edit script transforming a[a0:a1] into b[b0:b1].
+func (d *differ[T]) compare(a0, a1, b0, b1 int) {
+	// Strip the common prefix and suffix.
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.script = append(d.script, edit{opEqual, a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1 && b0 < b1 && d.a[a1-1] == d.b[b1-1] {
+		a1--
+		b1--
+		suffix++
+	}
+
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.script = append(d.script, edit{opInsert, a0, j})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.script = append(d.script, edit{opDelete, i, b0})
+		}
+	default:
+		// With no common prefix and suffix the distance is at least 2,
+		// and both halves are shorter.
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.script = append(d.script, edit{opEqual, x, y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for k := 0; k < suffix; k++ {
+		d.script = append(d.script, edit{opEqual, a1 + k, b1 + k})
+	}
+}
+
+// middleSnake returns the start (x, y) and the end (u, v) of the middle
+// snake of an optimal path from (a0, b0) to (a1, b1), found by searching
+// from both ends until the paths overlap.
+func (d *differ[T]) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	a, b := d.a[a0:a1], d.b[b0:b1]
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	off := max + 1
+	vf, vb := d.vf[:2*max+3], d.vb[:2*max+3]
+	vf[off+1], vb[off+1] = 0, 0
+	for D := 0; D <= max; D++ {
+		// Forward search, on the diagonals k = x - y.
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kb := delta - k; odd && kb >= -(D-1) && kb <= D-1 && x+vb[off+kb] >= n {
+				return a0 + x0, b0 + y0, a0 + x, b0 + y
+			}
+		}
+
+		// Reverse search, on the diagonals of the reversed sequences.
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -D && kf <= D && vf[off+kf]+x >= n {
+				return a0 + n - x, b0 + m - y, a0 + n - x0, b0 + m - y0
+			}
+		}
+	}
+
+	panic("unreachable")
+}
+
+// hunk is a group of edits surrounded by at most ctx equal edits.
+type hunk []edit
+
+// hunks splits an edit script into hunks, keeping ctx equal edits of context
+// around each group of changes.
+func hunks(script []edit, ctx int) []hunk {
+	var list []hunk
+	for start := 0; start < len(script); {
+		// Find the next change.
+		for start < len(script) && script[start].op == opEqual {
+			start++
+		}
+		if start == len(script) {
+			break
+		}
+
+		// Extend the hunk while the gap between changes is small enough
+		// to be covered by the context of both.
+		end := start
+		for end < len(script) {
+			if script[end].op != opEqual {
+				end++
+
+				continue
+			}
+			gap := end
+			for gap < len(script) && script[gap].op == opEqual {
+				gap++
+			}
+			if gap == len(script) || gap-end > 2*ctx {
+				break
+			}
+			end = gap
+		}
+
+		lo := start - ctx
+		if lo < 0 {
+			lo = 0
+		}
+		hi := end + ctx
+		if hi > len(script) {
+			hi = len(script)
+		}
+		list = append(list, hunk(script[lo:hi]))
+		start = end
+	}
+
+	return list
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// nullFile is the file used by git for a side of a diff where the file does
+// not exist.
+const nullFile = "/dev/null"
+
+// runGitDiff compares the grammars passed by git to an external diff
+// command, as
+//
+//	path old-file old-hex old-mode new-file new-hex new-mode [new-path info]
+//
+// writing the report to stdout, where git expects it.  The rules are
+// reported at the path of the file in the repository, instead of at the
+// temporary files created by git.
+func runGitDiff(args []string) {
+	if len(args) != 7 && len(args) != 9 {
+		fatalf("-git-difftool: got %d arguments, want 7 or 9", len(args))
+	}
+	format, ok := formatters[*formatFlag]
+	if !ok {
+		fatalf("unknown format %q", *formatFlag)
+	}
+	opts := compareOptions()
+	lname, rname := args[0], args[0]
+	if len(args) == 9 {
+		rname = args[7]
+	}
+	lpath, rpath := "a/"+lname, "b/"+rname
+
+	lgrammar, err := parseGitFile(args[1], lpath)
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar, err := parseGitFile(args[4], rpath)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("pegcmp %s %s\n", lpath, rpath)
+	if err := format(os.Stdout, newReport(lpath, rpath, lgrammar, rgrammar, opts)); err != nil {
+		fatal(err)
+	}
+}
+
+// parseGitFile parses the grammar in the file at path, passed by git to an
+// external diff command, reporting its rules at name.  The grammar of the
+// null file is empty.
+func parseGitFile(path, name string) ([]Rule, error) {
+	if path == nullFile {
+		return nil, nil
+	}
+	grammar, err := parse(path)
+	if err != nil {
+		return nil, err
+	}
+	file := displayName(cliFS, cliFS.name(path))
+	for i := range grammar {
+		if grammar[i].Pos.Filename == file {
+			grammar[i].Pos.Filename = name
+		}
+	}
+
+	return grammar, nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dirResult is the result of comparing a pair of grammars in directory mode.
+type dirResult struct {
+	output     []byte
+	violations []violation
+	err        error
+}
+
+// cachedResult is the representation of a dirResult in the result cache.
+type cachedResult struct {
+	Output     []byte            `json:"output"`
+	Violations []cachedViolation `json:"violations"`
+}
+
+// cachedViolation is the representation of a violation in the result cache.
+type cachedViolation struct {
+	Category string `json:"category"`
+	Rule     string `json:"rule"`
+	Pos      Pos    `json:"pos"`
+	Msg      string `json:"msg"`
+}
+
+// isDir reports whether the operating system path p is a directory.
+func isDir(p string) bool {
+	fi, err := os.Stat(p)
+
+	return err == nil && fi.IsDir()
+}
+
+// dirGrammars returns the paths of the .peg files in the directory at the
+// operating system path root, relative to root.
+func dirGrammars(root string) ([]string, error) {
+	name := cliFS.name(root)
+	files, err := grammarFiles(cliFS, name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, len(files))
+	for i, f := range files {
+		list[i] = strings.TrimPrefix(f, name+"/")
+	}
+
+	return list, nil
+}
+
+// compareDirs compares the grammars with the same path relative to the lhs
+// and rhs directories, using at most jobs goroutines.  A grammar only in one
+// directory is compared to an empty grammar.  The report of each pair is
+// written as soon as it and the ones before it are done, in path order,
+// preceded by a pegcmp lhs rhs line when not empty, so that at most jobs
+// reports are kept in memory.  The results of the pairs of grammars that did
+// not change are taken from cache, unless nil.  The progress of the pairs
+// is reported on the terminal, unless -no-progress.  The result is the exit
+// status: 1 when a grammar is invalid or a change violates the policy.
+func compareDirs(lroot, rroot string, opts *options, pol *policy, cache *resultCache, jobs int) int {
+	format := formatters[*formatFlag]
+	w := os.Stdout
+	if *formatFlag == "text" {
+		w = os.Stderr
+	}
+
+	lfiles, err := dirGrammars(lroot)
+	if err != nil {
+		fatal(err)
+	}
+	rfiles, err := dirGrammars(rroot)
+	if err != nil {
+		fatal(err)
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, f := range append(lfiles, rfiles...) {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	lhas := make(map[string]bool)
+	for _, f := range lfiles {
+		lhas[f] = true
+	}
+	rhas := make(map[string]bool)
+	for _, f := range rfiles {
+		rhas[f] = true
+	}
+
+	compareFile := func(rel string) *dirResult {
+		lpath := filepath.Join(lroot, filepath.FromSlash(rel))
+		rpath := filepath.Join(rroot, filepath.FromSlash(rel))
+		var lgrammar, rgrammar []Rule
+		var err error
+		if lhas[rel] {
+			if lgrammar, err = parse(lpath); err != nil {
+				return &dirResult{err: err}
+			}
+			events.fileParsed(lpath, lgrammar)
+			if *duplicatesFlag != "error" {
+				lgrammar, _ = resolveDuplicates(lpath, lgrammar, *duplicatesFlag)
+			}
+		}
+		if rhas[rel] {
+			if rgrammar, err = parse(rpath); err != nil {
+				return &dirResult{err: err}
+			}
+			events.fileParsed(rpath, rgrammar)
+			if rgrammar, err = resolveDuplicates(rpath, rgrammar, *duplicatesFlag); err != nil {
+				return &dirResult{err: err}
+			}
+		}
+
+		// The last commit of a rule may change with the same grammars, and
+		// the events of a comparison are not cached.
+		key := ""
+		if cache != nil && !*blameFlag && events == nil {
+			key = cacheKey(lgrammar, rgrammar, opts, lpath, rpath, *formatFlag, pol.denyList())
+			if data, ok := cache.get(key); ok {
+				var cr cachedResult
+				if err := json.Unmarshal(data, &cr); err == nil {
+					res := &dirResult{output: cr.Output}
+					for _, v := range cr.Violations {
+						res.violations = append(res.violations, violation{v.Category, &Rule{Name: v.Rule, Pos: v.Pos}, v.Msg})
+					}
+
+					return res
+				}
+			}
+		}
+
+		// The report, with its grammars and syntax trees, is released
+		// once formatted.
+		r := newReport(lpath, rpath, lgrammar, rgrammar, opts)
+		events.compared(r)
+		if *blameFlag {
+			r.blame = blameChanges(r.changes)
+		}
+		var b bytes.Buffer
+		if err := format(&b, r); err != nil {
+			return &dirResult{err: err}
+		}
+		res := &dirResult{output: b.Bytes()}
+		if pol != nil {
+			res.violations = pol.check(r)
+		}
+		if key != "" {
+			cr := cachedResult{Output: res.output}
+			for _, v := range res.violations {
+				cr.Violations = append(cr.Violations, cachedViolation{v.category, v.rule.Name, v.rule.Pos, v.msg})
+			}
+			if data, err := json.Marshal(cr); err == nil {
+				cache.put(key, data)
+			}
+		}
+
+		return res
+	}
+
+	// Each result is sent on its own channel, and the number of results
+	// not yet written is limited by the semaphore.
+	results := make([]chan *dirResult, len(files))
+	for i := range results {
+		results[i] = make(chan *dirResult, 1)
+	}
+	sem := make(chan bool, jobs)
+	go func() {
+		for i, rel := range files {
+			sem <- true
+			go func(i int, rel string) {
+				results[i] <- compareFile(rel)
+			}(i, rel)
+		}
+	}()
+
+	status := 0
+	prog := newProgress(!*noProgressFlag, "compare", len(files))
+	for i, rel := range files {
+		res := <-results[i]
+		<-sem
+		slog.Debug("compared grammars", "path", rel)
+		if res.err != nil || len(res.output) > 0 || len(res.violations) > 0 {
+			prog.clear()
+		}
+		if res.err != nil {
+			logError(res.err)
+			status = 1
+			prog.step()
+
+			continue
+		}
+		if len(res.output) > 0 {
+			rel := filepath.FromSlash(rel)
+			fmt.Fprintf(w, "pegcmp %s %s\n", filepath.Join(lroot, rel), filepath.Join(rroot, rel))
+			w.Write(res.output)
+		}
+		writeViolations(os.Stderr, res.violations)
+		if len(res.violations) > 0 {
+			status = 1
+		}
+		prog.step()
+	}
+	prog.clear()
+	if *cacheStatsFlag && cache != nil {
+		cache.writeStats(os.Stderr)
+	}
+
+	return status
+}
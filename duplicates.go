@@ -0,0 +1,117 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// duplicatePolicies are the supported policies for the rules defined more
+// than once, by name.
+var duplicatePolicies = map[string]func(grammar []Rule) []Rule{
+	"merge": mergeDuplicates,
+	"first": func(grammar []Rule) []Rule {
+		return keepDuplicate(grammar, false)
+	},
+	"last": func(grammar []Rule) []Rule {
+		return keepDuplicate(grammar, true)
+	},
+}
+
+// resolveDuplicates applies the named policy to the rules defined more than
+// once in the grammar at path.  With the error policy, the grammar is
+// returned unchanged, with an error when duplicate rules have different
+// expressions.
+func resolveDuplicates(path string, grammar []Rule, policy string) ([]Rule, error) {
+	if policy == "error" {
+		return grammar, validate(path, grammar)
+	}
+	resolve, ok := duplicatePolicies[policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown duplicate rule policy %q", policy)
+	}
+
+	return resolve(grammar), nil
+}
+
+// keepDuplicate returns grammar with only the first or, when last is true,
+// the last definition of each rule, at its position.
+func keepDuplicate(grammar []Rule, last bool) []Rule {
+	index := make(map[string]int)
+	for i, rule := range grammar {
+		if _, ok := index[rule.Name]; !ok || last {
+			index[rule.Name] = i
+		}
+	}
+	var list []Rule
+	for i, rule := range grammar {
+		if index[rule.Name] == i {
+			list = append(list, rule)
+		}
+	}
+
+	return list
+}
+
+// mergeDuplicates returns grammar with the definitions of each rule merged,
+// at the position of the first, as the alternatives of a choice in
+// definition order.  Identical definitions are merged once.
+func mergeDuplicates(grammar []Rule) []Rule {
+	index := make(map[string]int)
+	alts := make(map[string][]string)
+	var list []Rule
+	for _, rule := range grammar {
+		if _, ok := index[rule.Name]; !ok {
+			index[rule.Name] = len(list)
+			list = append(list, rule)
+		}
+		seen := false
+		for _, expr := range alts[rule.Name] {
+			seen = seen || expr == rule.Expr
+		}
+		if !seen {
+			alts[rule.Name] = append(alts[rule.Name], rule.Expr)
+		}
+	}
+	for i := range list {
+		rule := &list[i]
+		if exprs := alts[rule.Name]; len(exprs) > 1 {
+			rule.Expr = mergeExprs(exprs)
+		}
+	}
+
+	return list
+}
+
+// mergeExprs returns the choice of the expressions, in canonical form when
+// they are all valid.
+func mergeExprs(exprs []string) string {
+	var choice []node
+	for _, expr := range exprs {
+		n, err := parseExpr(expr)
+		if err != nil {
+			return joinAlternatives(exprs)
+		}
+		if c, ok := n.(*choiceNode); ok {
+			choice = append(choice, c.alts...)
+		} else {
+			choice = append(choice, n)
+		}
+	}
+
+	return exprString(&choiceNode{alts: choice})
+}
+
+// joinAlternatives returns the expressions separated by a slash, each in
+// parentheses.
+func joinAlternatives(exprs []string) string {
+	s := ""
+	for i, expr := range exprs {
+		if i > 0 {
+			s += " / "
+		}
+		s += "(" + expr + ")"
+	}
+
+	return s
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// failure is the farthest failure of a grammar rejecting an input, at
+// offset, line and column, with the terminals expected there, sorted.
+type failure struct {
+	offset    int
+	line, col int
+	expected  []string
+}
+
+// newFailure returns the farthest failure of the run of m.
+func newFailure(m *machine) failure {
+	f := failure{offset: max(m.failPos, 0), expected: slices.Clone(m.expected)}
+	sort.Strings(f.expected)
+	prefix := m.input[:f.offset]
+	f.line = strings.Count(prefix, "\n") + 1
+	f.col = len(prefix) - strings.LastIndexByte(prefix, '\n')
+
+	return f
+}
+
+func (f failure) String() string {
+	return fmt.Sprintf("%d:%d", f.line, f.col)
+}
+
+// expectedString returns the terminals expected at f, comma separated.
+func (f failure) expectedString() string {
+	if len(f.expected) == 0 {
+		return "nothing"
+	}
+
+	return strings.Join(f.expected, ", ")
+}
+
+// errorRegression is an input rejected by both grammars, where the rhs
+// grammar fails at an earlier position than the lhs grammar, producing a less
+// precise error.
+type errorRegression struct {
+	path     string
+	lhs, rhs failure
+}
+
+// writeErrorRegressions writes the inputs where the error position of the
+// rhs grammar regressed.
+func writeErrorRegressions(w io.Writer, list []errorRegression) {
+	for _, reg := range list {
+		fmt.Fprintf(w, "! input %q: rhs error position regressed to %s, was %s\n", reg.path, reg.rhs, reg.lhs)
+		fmt.Fprintf(w, "> expected %s\n", reg.rhs.expectedString())
+		fmt.Fprintf(w, "< expected %s\n\n", reg.lhs.expectedString())
+	}
+}
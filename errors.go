@@ -0,0 +1,213 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// ParseError is a syntax error in a grammar file.
+type ParseError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Pos, e.Pos.Offset, e.Msg)
+}
+
+// DuplicateRuleError is a rule defined more than once with different
+// expressions or, with MultipleFiles, in more than one file of a manifest.
+type DuplicateRuleError struct {
+	Name          string
+	Pos, PrevPos  Pos
+	Expr          string
+	PrevExpr      string
+	MultipleFiles bool
+}
+
+func (e *DuplicateRuleError) Error() string {
+	if e.MultipleFiles {
+		return fmt.Sprintf("%s: rule %q defined in multiple files, first at %s", e.Pos, e.Name, e.PrevPos)
+	}
+
+	return fmt.Sprintf("%s: duplicate rule %q does not match the definition at %s", e.Pos, e.Name, e.PrevPos)
+}
+
+// Is reports whether target is the generic duplicate rule error.
+func (e *DuplicateRuleError) Is(target error) bool {
+	return target == errDuplicateRule
+}
+
+// DialectError is a failure of the plugin reading a grammar in another
+// dialect.
+type DialectError struct {
+	Dialect string
+	Path    string
+	Err     error
+}
+
+func (e *DialectError) Error() string {
+	return fmt.Sprintf("%s: %s dialect: %v", e.Path, e.Dialect, e.Err)
+}
+
+func (e *DialectError) Unwrap() error {
+	return e.Err
+}
+
+// parseError converts an error of the generated parser for the file at path
+// to ParseError values, joined when more than one.
+func parseError(path string, err error) error {
+	list, ok := err.(errList)
+	if !ok {
+		return err
+	}
+	errs := make([]error, len(list))
+	for i, err := range list {
+		perr, ok := err.(*parserError)
+		if !ok {
+			errs[i] = err
+
+			continue
+		}
+		errs[i] = &ParseError{
+			Pos: Pos{Filename: path, Line: perr.pos.line, Col: perr.pos.col, Offset: perr.pos.offset},
+			Msg: perr.Inner.Error(),
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// splitErrors returns the errors joined in err, recursively.
+func splitErrors(err error) []error {
+	if join, ok := err.(interface{ Unwrap() []error }); ok {
+		var list []error
+		for _, err := range join.Unwrap() {
+			list = append(list, splitErrors(err)...)
+		}
+
+		return list
+	}
+
+	return []error{err}
+}
+
+// writeDuplicate writes the definitions of a duplicate rule.
+func writeDuplicate(w io.Writer, e *DuplicateRuleError) {
+	if e.MultipleFiles {
+		fmt.Fprintf(w, "! rule %q defined in multiple files\n", e.Name)
+	} else {
+		fmt.Fprintf(w, "! duplicate rule %q does not match\n", e.Name)
+	}
+	fmt.Fprintf(w, "> %s\n", textPos(e.Pos))
+	fmt.Fprintf(w, "> %s\n\n", e.Expr)
+	fmt.Fprintf(w, "< %s\n", textPos(e.PrevPos))
+	fmt.Fprintf(w, "< %s\n\n", e.PrevExpr)
+}
+
+// logError reports err on stderr: the duplicate rules with both
+// definitions, followed by a single duplicate rule error, and the other
+// errors as logged diagnostics.
+func logError(err error) {
+	reportError(os.Stderr, err, func(msg string) {
+		slog.Error(msg)
+	})
+}
+
+// writeError writes err to w as logError, with the plain error messages
+// instead of logged diagnostics.
+func writeError(w io.Writer, err error) {
+	reportError(w, err, func(msg string) {
+		fmt.Fprintln(w, msg)
+	})
+}
+
+// reportError writes the duplicate rules in err to w with both definitions,
+// followed by a single duplicate rule error, and reports the other errors
+// with report.
+func reportError(w io.Writer, err error, report func(msg string)) {
+	dup := false
+	for _, err := range splitErrors(err) {
+		var derr *DuplicateRuleError
+		if errors.As(err, &derr) {
+			writeDuplicate(w, derr)
+			dup = true
+
+			continue
+		}
+		report(err.Error())
+	}
+	if dup {
+		report(errDuplicateRule.Error())
+	}
+}
+
+// syntaxError is a rule definition that does not parse, skipped with
+// -continue-on-error.
+type syntaxError struct {
+	name string
+	err  *ParseError
+}
+
+// parseContinue parses the grammar at the operating system path or URL p as
+// parse, skipping the rule definitions that do not parse.
+func parseContinue(p string) ([]Rule, []syntaxError, error) {
+	fsys, name, err := grammarFS(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	var errs []syntaxError
+	inc := newIncluder(fsys)
+	inc.onError = func(name string, err *ParseError) {
+		errs = append(errs, syntaxError{name, err})
+	}
+	grammar, err := inc.load(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return grammar, errs, nil
+}
+
+// skipRules returns grammar without the rules named as the syntax errors,
+// so that a rule that does not parse in one grammar is not reported as
+// removed or added.
+func skipRules(grammar []Rule, errs []syntaxError) []Rule {
+	if len(errs) == 0 {
+		return grammar
+	}
+	skip := make(map[string]bool)
+	for _, e := range errs {
+		skip[e.name] = true
+	}
+	var list []Rule
+	for _, rule := range grammar {
+		if !skip[rule.Name] {
+			list = append(list, rule)
+		}
+	}
+
+	return list
+}
+
+// syntaxFindings returns the syntax errors as error findings.
+func syntaxFindings(errs []syntaxError) []finding {
+	list := make([]finding, len(errs))
+	for i, e := range errs {
+		list[i] = finding{
+			analyzer: "syntax",
+			severity: severityError,
+			rule:     &Rule{Name: e.name, Pos: e.err.Pos},
+			msg:      "syntax error: " + e.err.Msg,
+		}
+	}
+
+	return list
+}
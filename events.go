@@ -0,0 +1,152 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// eventLog writes the progress and the results of a run as a stream of
+// newline-delimited JSON events, for the tools displaying live results.  The
+// events are
+//
+//	{"event": "started", "lhs": "...", "rhs": "..."}
+//	{"event": "file-parsed", "path": "...", "count": 12}
+//	{"event": "rule-compared", "path": "...", "rule": "A", "change": "modified"}
+//	{"event": "finding", "path": "...", "rule": "A", "finding": {...}}
+//	{"event": "input-matched", "path": "...", "lhs": "...", "rhs": "...", "agree": true}
+//	{"event": "summary", "status": 1, "rules": {"modified": 1}, "findings": 1}
+//
+// each with the time of the event.  The path of the rule-compared and
+// finding events is the rhs grammar, and the rules of the grammars compared
+// with a cached result are not reported.  A nil eventLog writes nothing.
+type eventLog struct {
+	mu       sync.Mutex
+	f        *os.File
+	enc      *json.Encoder
+	start    time.Time
+	rules    map[string]int // compared rules by status
+	findings int
+}
+
+// jsonEvent is an event written by eventLog.
+type jsonEvent struct {
+	Event    string         `json:"event"`
+	Time     time.Time      `json:"time"`
+	Path     string         `json:"path,omitempty"`
+	LHS      string         `json:"lhs,omitempty"`
+	RHS      string         `json:"rhs,omitempty"`
+	Rule     string         `json:"rule,omitempty"`
+	Status   *int           `json:"status,omitempty"`
+	Change   string         `json:"change,omitempty"`
+	Finding  *jsonFinding   `json:"finding,omitempty"`
+	Agree    *bool          `json:"agree,omitempty"`
+	Count    *int           `json:"count,omitempty"` // rules of a parsed file
+	Rules    map[string]int `json:"rules,omitempty"`
+	Findings *int           `json:"findings,omitempty"`
+	Elapsed  float64        `json:"elapsed,omitempty"` // seconds
+}
+
+// events is the event log of the run, if requested.
+var events *eventLog
+
+// openEvents returns the event log writing to dest: a file descriptor number,
+// as 3, or a file path.
+func openEvents(dest string) (*eventLog, error) {
+	var f *os.File
+	if fd, err := strconv.ParseUint(dest, 10, 0); err == nil {
+		if f = os.NewFile(uintptr(fd), "fd "+dest); f == nil {
+			return nil, fmt.Errorf("invalid events file descriptor %s", dest)
+		}
+	} else if f, err = os.Create(dest); err != nil {
+		return nil, err
+	}
+
+	return &eventLog{f: f, enc: json.NewEncoder(f), start: time.Now(), rules: make(map[string]int)}, nil
+}
+
+// write writes ev, setting its time.  A write error disables the log, since
+// the reader is gone.
+func (e *eventLog) write(ev jsonEvent) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.enc == nil {
+		return
+	}
+	ev.Time = time.Now()
+	if err := e.enc.Encode(ev); err != nil {
+		logError(fmt.Errorf("events: %w", err))
+		e.enc = nil
+	}
+}
+
+// started reports the start of the comparison of lhs and rhs.
+func (e *eventLog) started(lhs, rhs string) {
+	e.write(jsonEvent{Event: "started", LHS: lhs, RHS: rhs})
+}
+
+// fileParsed reports that the grammar at path was parsed.
+func (e *eventLog) fileParsed(path string, grammar []Rule) {
+	n := len(grammar)
+	e.write(jsonEvent{Event: "file-parsed", Path: path, Count: &n})
+}
+
+// compared reports the rule changes and the findings of r.
+func (e *eventLog) compared(r *report) {
+	if e == nil {
+		return
+	}
+	for _, c := range r.changes {
+		rule := c.rhs
+		if rule == nil {
+			rule = c.lhs
+		}
+		status := statusNames[c.kind]
+		e.mu.Lock()
+		e.rules[status]++
+		e.mu.Unlock()
+		e.write(jsonEvent{Event: "rule-compared", Path: r.rpath, Rule: rule.Name, Change: status})
+	}
+	for _, f := range r.findings {
+		jf := newJSONFinding(f)
+		e.mu.Lock()
+		e.findings++
+		e.mu.Unlock()
+		e.write(jsonEvent{Event: "finding", Path: r.rpath, Rule: f.rule.Name, Finding: &jf})
+	}
+}
+
+// inputMatched reports the outcomes of matching a corpus input.
+func (e *eventLog) inputMatched(path string, lhs, rhs outcome) {
+	agree := lhs == rhs
+	e.write(jsonEvent{Event: "input-matched", Path: path, LHS: lhs.String(), RHS: rhs.String(), Agree: &agree})
+}
+
+// summary reports the end of the run, with its exit status, and closes the
+// log.
+func (e *eventLog) summary(status int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	rules, findings := e.rules, e.findings
+	e.mu.Unlock()
+	e.write(jsonEvent{
+		Event:    "summary",
+		Status:   &status,
+		Rules:    rules,
+		Findings: &findings,
+		Elapsed:  time.Since(e.start).Seconds(),
+	})
+	e.f.Close()
+}
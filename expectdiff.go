@@ -0,0 +1,35 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// expectDiffDirective marks a rhs rule as intentionally different from the
+// lhs rule.
+const expectDiffDirective = "pegcmp:expect-diff"
+
+// applyExpectDiff removes from r the changes of the rhs rules with the
+// expect-diff directive, and reports as an error finding each of these rules
+// that matches the lhs rule, since the directive is stale.
+func applyExpectDiff(r *report) {
+	var stale []finding
+	changes := r.changes[:0]
+	for _, c := range r.changes {
+		if c.rhs == nil || !c.rhs.hasDirective(expectDiffDirective) {
+			changes = append(changes, c)
+
+			continue
+		}
+		if c.kind == ruleEqual {
+			stale = append(stale, finding{
+				analyzer: "expect-diff",
+				severity: severityError,
+				rule:     c.rhs,
+				msg:      "rule matches the lhs rule, remove the # " + expectDiffDirective + " directive",
+			})
+			changes = append(changes, c)
+		}
+	}
+	r.changes = changes
+	r.findings = append(stale, r.findings...)
+}
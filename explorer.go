@@ -0,0 +1,95 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+)
+
+// The frontend of the explorer.
+var (
+	//go:embed explorer/explorer.html
+	explorerHTML string
+
+	//go:embed explorer/explorer.js
+	explorerJS string
+)
+
+var explorerTemplate = template.Must(template.New("explorer").Parse(explorerHTML))
+
+// explorerToken is a token of a rule expression, with its edit operation in
+// the diff view.
+type explorerToken struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// explorerRule is a rule in the data of the explorer.
+type explorerRule struct {
+	Name    string          `json:"name"`
+	Status  string          `json:"status"`
+	Moved   bool            `json:"moved,omitempty"`
+	LHS     []string        `json:"lhs,omitempty"`
+	RHS     []string        `json:"rhs,omitempty"`
+	Diff    []explorerToken `json:"diff,omitempty"`
+	LHSRefs []string        `json:"lhs_refs,omitempty"`
+	RHSRefs []string        `json:"rhs_refs,omitempty"`
+}
+
+var editNames = [...]string{
+	opEqual:  "equal",
+	opDelete: "delete",
+	opInsert: "insert",
+}
+
+// formatExplorer writes an HTML page to explore the rules, with the lhs, rhs
+// and diff view of each rule, links from the rule references to their
+// definitions and the highlighting of the rules reachable from a start rule.
+func formatExplorer(w io.Writer, r *report) error {
+	lgraph := newRefGraph(newSyntax(r.lgrammar))
+	rgraph := newRefGraph(newSyntax(r.rgrammar))
+
+	var rules []explorerRule
+	for _, c := range r.changes {
+		rule := explorerRule{
+			Name:   changeName(c),
+			Status: statusNames[c.kind],
+			Moved:  c.moved,
+		}
+		if c.lhs != nil {
+			rule.LHS = tokenize(c.lhs.Expr)
+			rule.LHSRefs = lgraph[c.lhs.Name]
+		}
+		if c.rhs != nil {
+			rule.RHS = tokenize(c.rhs.Expr)
+			rule.RHSRefs = rgraph[c.rhs.Name]
+		}
+		if c.kind == ruleModified {
+			for _, e := range c.edits {
+				tok := explorerToken{Op: editNames[e.op]}
+				if e.op == opDelete {
+					tok.Text = c.ltoks[e.i]
+				} else {
+					tok.Text = c.rtoks[e.j]
+				}
+				rule.Diff = append(rule.Diff, tok)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return explorerTemplate.Execute(w, struct {
+		LPath, RPath string
+		Data         interface{}
+		Script       template.JS
+	}{
+		LPath:  r.lpath,
+		RPath:  r.rpath,
+		Data:   map[string]interface{}{"lhs": r.lpath, "rhs": r.rpath, "rules": rules},
+		Script: template.JS(explorerJS),
+	})
+}
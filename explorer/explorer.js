@@ -0,0 +1,107 @@
+// Grammar explorer for the pegcmp explorer report.
+(function () {
+  "use strict";
+
+  const ident = /^[A-Za-z_][A-Za-z0-9_]*$/;
+  const rules = new Map(data.rules.map((r) => [r.name, r]));
+
+  // Append the expression tokens to parent, linking the rule references and
+  // wrapping inserted and deleted tokens.
+  function render(parent, tokens) {
+    for (const t of tokens) {
+      let node = document.createTextNode(t.text);
+      if (ident.test(t.text) && rules.has(t.text)) {
+        const a = document.createElement("a");
+        a.className = "ref";
+        a.href = "#rule-" + t.text;
+        a.appendChild(node);
+        node = a;
+      }
+      if (t.op === "insert" || t.op === "delete") {
+        const w = document.createElement(t.op === "insert" ? "ins" : "del");
+        w.appendChild(node);
+        node = w;
+      }
+      parent.appendChild(node);
+    }
+  }
+
+  function plain(expr) {
+    return expr === undefined ? [] : expr.map((text) => ({ op: "equal", text }));
+  }
+
+  // Return the rules reachable from start, following the rhs references or
+  // the lhs references for the rules only defined in lhs.
+  function reachable(start) {
+    const seen = new Set();
+    const stack = [start];
+    while (stack.length > 0) {
+      const name = stack.pop();
+      const r = rules.get(name);
+      if (seen.has(name) || r === undefined) {
+        continue;
+      }
+      seen.add(name);
+      stack.push(...(r.rhs_refs || r.lhs_refs || []));
+    }
+    return seen;
+  }
+
+  const main = document.getElementById("rules");
+  const sections = new Map();
+  for (const r of data.rules) {
+    const sec = document.createElement("section");
+    sec.id = "rule-" + r.name;
+    const h = document.createElement("h2");
+    h.textContent = r.name;
+    const status = document.createElement("span");
+    status.className = "status";
+    status.textContent = r.status + (r.moved ? ", moved" : "");
+    h.appendChild(status);
+    sec.appendChild(h);
+
+    const views = {
+      lhs: plain(r.lhs),
+      rhs: plain(r.rhs),
+      diff: r.diff || plain(r.rhs || r.lhs),
+    };
+    const pre = document.createElement("pre");
+    const buttons = [];
+    const show = (view) => {
+      pre.textContent = "";
+      render(pre, views[view]);
+      for (const b of buttons) {
+        b.classList.toggle("active", b.textContent === view);
+      }
+    };
+    for (const view of ["lhs", "rhs", "diff"]) {
+      const b = document.createElement("button");
+      b.textContent = view;
+      b.disabled = view !== "diff" && r[view] === undefined;
+      b.onclick = () => show(view);
+      buttons.push(b);
+      sec.appendChild(b);
+    }
+    sec.appendChild(pre);
+    show("diff");
+    main.appendChild(sec);
+    sections.set(r.name, sec);
+  }
+
+  const select = document.getElementById("start");
+  for (const r of data.rules) {
+    const opt = document.createElement("option");
+    opt.value = opt.textContent = r.name;
+    select.appendChild(opt);
+  }
+  const summary = document.getElementById("summary");
+  select.onchange = () => {
+    const start = select.value;
+    const set = start ? reachable(start) : null;
+    for (const [name, sec] of sections) {
+      sec.classList.toggle("reachable", set !== null && set.has(name));
+      sec.classList.toggle("unreachable", set !== null && !set.has(name));
+    }
+    summary.textContent = set ? set.size + " of " + rules.size + " rules reachable from " + start : "";
+  };
+})();
@@ -0,0 +1,118 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const exprUsage = `Usage: pegcmp expr [lhs-expr rhs-expr]
+
+The expressions are normalized with -normalize=` + exprNormalize + `
+unless -normalize is specified.`
+
+// exprRule is the name of the rule defined by an expression passed to expr.
+const exprRule = "expr"
+
+// exprNormalize is the default normalization of the expressions passed to
+// expr, so that they are equal regardless of how they are spaced.
+const exprNormalize = "strip-comments,normalize-whitespace"
+
+// parseExprArg parses the expression as the only rule of the grammar named
+// name.
+func parseExprArg(name, expr string) ([]Rule, error) {
+	grammar, err := ParseGrammar(name, []byte(exprRule+" <- "+expr+"\n"))
+	if err != nil {
+		return nil, err
+	}
+	if len(grammar) != 1 {
+		return nil, fmt.Errorf("%s: invalid expression %q", name, expr)
+	}
+
+	return grammar, nil
+}
+
+// readExprs returns the non empty lines of stdin, that must be two.
+func readExprs() ([]string, error) {
+	var list []string
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			list = append(list, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) != 2 {
+		return nil, fmt.Errorf("stdin: got %d expressions, want 2", len(list))
+	}
+
+	return list, nil
+}
+
+// runExpr compares two expressions, passed as arguments or as the lines of
+// stdin, with the normalization specified on the command line or else
+// exprNormalize.  It writes
+// the report when they differ, and exits with status 1, so that it can be
+// used in shell assertions.
+func runExpr(args []string) {
+	flags := flag.NewFlagSet("expr", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, exprUsage)
+	}
+	flags.Parse(args)
+	exprs := flags.Args()
+	switch len(exprs) {
+	case 0:
+		var err error
+		if exprs, err = readExprs(); err != nil {
+			fatal(err)
+		}
+	case 2:
+	default:
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	opts := compareOptions()
+	normalize := false
+	flag.Visit(func(f *flag.Flag) {
+		normalize = normalize || f.Name == "normalize"
+	})
+	if !normalize {
+		n, _ := parseNormalizer(exprNormalize)
+		opts.normalizer = append(n, opts.normalizer...)
+	}
+	lgrammar, err := parseExprArg("lhs", exprs[0])
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar, err := parseExprArg("rhs", exprs[1])
+	if err != nil {
+		fatal(err)
+	}
+	lgrammar, rgrammar = opts.normalizer.Normalize(lgrammar), opts.normalizer.Normalize(rgrammar)
+	changes := compare(lgrammar, rgrammar, opts)
+	for _, c := range changes {
+		if c.kind != ruleEqual {
+			writeReport(&report{
+				lpath:    "lhs",
+				rpath:    "rhs",
+				lgrammar: lgrammar,
+				rgrammar: rgrammar,
+				changes:  changes,
+				context:  opts.context,
+			})
+
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// byteRange is the byte range [pos, end) of a part of an expression.
+type byteRange struct {
+	pos, end int
+}
+
+// changedRanges returns the parts of lexpr and rexpr that differ, in order,
+// from the difference of their syntax trees: the alternatives and sequence
+// items added, removed or replaced, and the operators changed.  The result
+// is nil when an expression does not parse.
+func changedRanges(lexpr, rexpr string) (lranges, rranges []byteRange) {
+	l, lerr := parseExpr(lexpr)
+	r, rerr := parseExpr(rexpr)
+	if lerr != nil || rerr != nil {
+		return nil, nil
+	}
+	d := new(nodeDiff)
+	d.diff(l, r)
+	sort.Slice(d.lhs, func(i, j int) bool { return d.lhs[i].pos < d.lhs[j].pos })
+	sort.Slice(d.rhs, func(i, j int) bool { return d.rhs[i].pos < d.rhs[j].pos })
+
+	return d.lhs, d.rhs
+}
+
+// nodeDiff collects the changed ranges of two syntax trees.
+type nodeDiff struct {
+	lhs, rhs []byteRange
+}
+
+func spanRange(n node) byteRange {
+	pos, end := n.span()
+
+	return byteRange{pos, end}
+}
+
+// diff adds the ranges of l and r that differ.
+func (d *nodeDiff) diff(l, r node) {
+	if exprString(l) == exprString(r) {
+		return
+	}
+	switch l := l.(type) {
+	case *choiceNode:
+		if r, ok := r.(*choiceNode); ok {
+			d.diffList(l.alts, r.alts)
+
+			return
+		}
+	case *seqNode:
+		if r, ok := r.(*seqNode); ok {
+			d.diffList(l.items, r.items)
+
+			return
+		}
+	case *predNode:
+		if r, ok := r.(*predNode); ok {
+			if l.op != r.op {
+				d.lhs = append(d.lhs, byteRange{l.pos, l.pos + 1})
+				d.rhs = append(d.rhs, byteRange{r.pos, r.pos + 1})
+			}
+			d.diff(l.expr, r.expr)
+
+			return
+		}
+	case *repeatNode:
+		if r, ok := r.(*repeatNode); ok {
+			// The operator follows the repeated expression.
+			if l.op != r.op || l.lo != r.lo || l.hi != r.hi {
+				_, lend := l.expr.span()
+				_, rend := r.expr.span()
+				d.lhs = append(d.lhs, byteRange{lend, l.end})
+				d.rhs = append(d.rhs, byteRange{rend, r.end})
+			}
+			d.diff(l.expr, r.expr)
+
+			return
+		}
+	case *recoveryNode:
+		if r, ok := r.(*recoveryNode); ok && slices.Equal(l.labels, r.labels) {
+			d.diff(l.expr, r.expr)
+			d.diff(l.recover, r.recover)
+
+			return
+		}
+	}
+	d.lhs = append(d.lhs, spanRange(l))
+	d.rhs = append(d.rhs, spanRange(r))
+}
+
+// diffList adds the ranges of the alternatives or items of l and r that
+// differ.  The items replaced by the same number of items are compared in
+// pairs, and otherwise each item is compared with the next replacing item of
+// the same kind, if any; the others are added or removed.
+func (d *nodeDiff) diffList(l, r []node) {
+	lstrs := make([]string, len(l))
+	for i, n := range l {
+		lstrs[i] = exprString(n)
+	}
+	rstrs := make([]string, len(r))
+	for j, n := range r {
+		rstrs[j] = exprString(n)
+	}
+	var deleted, inserted []int
+	flush := func() {
+		paired := make([]bool, len(inserted))
+		next := 0
+		for k, i := range deleted {
+			if len(deleted) == len(inserted) {
+				d.diff(l[i], r[inserted[k]])
+				paired[k] = true
+
+				continue
+			}
+			m := next
+			for m < len(inserted) && reflect.TypeOf(l[i]) != reflect.TypeOf(r[inserted[m]]) {
+				m++
+			}
+			if m == len(inserted) {
+				d.lhs = append(d.lhs, spanRange(l[i]))
+
+				continue
+			}
+			d.diff(l[i], r[inserted[m]])
+			paired[m] = true
+			next = m + 1
+		}
+		for k, j := range inserted {
+			if !paired[k] {
+				d.rhs = append(d.rhs, spanRange(r[j]))
+			}
+		}
+		deleted, inserted = nil, nil
+	}
+	for _, e := range myers(lstrs, rstrs) {
+		switch e.op {
+		case opEqual:
+			flush()
+		case opDelete:
+			deleted = append(deleted, e.i)
+		case opInsert:
+			inserted = append(inserted, e.j)
+		}
+	}
+	flush()
+}
+
+// exprSource returns the expression of rule as written in the grammar file,
+// with its comments, and its byte offset in the file.  The result is false
+// when the text of the rule is not known.
+func exprSource(rule *Rule) (string, int, bool) {
+	i := strings.Index(rule.Text, "<-")
+	if i < 0 {
+		return "", 0, false
+	}
+
+	return rule.Text[i+2:], rule.Pos.Offset + i + 2, true
+}
+
+// sourceRanges returns the changed ranges of the lhs and rhs rules, as byte
+// offsets in their grammar files.
+func sourceRanges(lhs, rhs *Rule) (lranges, rranges []byteRange) {
+	lsrc, loff, lok := exprSource(lhs)
+	rsrc, roff, rok := exprSource(rhs)
+	if !lok || !rok {
+		return nil, nil
+	}
+	lranges, rranges = changedRanges(lsrc, rsrc)
+	for i := range lranges {
+		lranges[i].pos += loff
+		lranges[i].end += loff
+	}
+	for i := range rranges {
+		rranges[i].pos += roff
+		rranges[i].end += roff
+	}
+
+	return lranges, rranges
+}
+
+// markExpr returns expr with the ranges marked by open and close or, when
+// colorOutput is set, highlighted and underlined.
+func markExpr(expr string, ranges []byteRange, open, close string) string {
+	var b strings.Builder
+	if !colorOutput {
+		prev := 0
+		for _, r := range ranges {
+			b.WriteString(expr[prev:r.pos])
+			b.WriteString(open + expr[r.pos:r.end] + close)
+			prev = r.end
+		}
+		b.WriteString(expr[prev:])
+
+		return b.String()
+	}
+
+	changed := func(i int) bool {
+		for _, r := range ranges {
+			if i >= r.pos && i < r.end {
+				return true
+			}
+		}
+
+		return false
+	}
+	// write writes expr[pos:end] with the SGR parameters sgr, splitting it
+	// in runs with the same changed state.
+	write := func(pos, end int, sgr string) {
+		for i := pos; i < end; {
+			j := i + 1
+			for j < end && changed(j) == changed(i) {
+				j++
+			}
+			params := sgr
+			if changed(i) {
+				params = strings.TrimPrefix(params+";4", ";")
+			}
+			if params == "" {
+				b.WriteString(expr[i:j])
+			} else {
+				b.WriteString("\x1b[" + params + "m" + expr[i:j] + "\x1b[0m")
+			}
+			i = j
+		}
+	}
+	prev := 0
+	for _, s := range highlightSpans(expr) {
+		write(prev, s.pos, "")
+		write(s.pos, s.end, ansiColors[s.class])
+		prev = s.end
+	}
+	write(prev, len(expr), "")
+
+	return b.String()
+}
+
+// markedExprs returns the expressions of the lhs and rhs rules of a change,
+// as textExpr, with the changed ranges marked when -mark-changes is set.
+func markedExprs(lhs, rhs *Rule, col int) (string, string) {
+	if !*markChangesFlag {
+		return textExpr(lhs, col), textExpr(rhs, col)
+	}
+	lexpr, rexpr := ruleExpr(lhs, col), ruleExpr(rhs, col)
+	lranges, rranges := changedRanges(lexpr, rexpr)
+
+	return markExpr(lexpr, lranges, "[-", "-]"), markExpr(rexpr, rranges, "{+", "+}")
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const extractUsage = `Usage: pegcmp extract [-w] path rule:index[.index...] new-rule`
+
+// parseInterspersed parses the flags in args, allowing them after the
+// positional arguments, and returns the positional arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var list []string
+	flags.Parse(args)
+	for flags.NArg() > 0 {
+		list = append(list, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+
+	return list
+}
+
+// selectNode returns the node selected by path in n, where each index, 1
+// based, selects an alternative of a choice, an item of a sequence, the
+// expression or the recovery of a recovery expression or, with index 1, the
+// operand of a predicate or repetition.
+func selectNode(n node, path []int) (node, error) {
+	for k, i := range path {
+		var children []node
+		switch n := n.(type) {
+		case *choiceNode:
+			children = n.alts
+		case *seqNode:
+			children = n.items
+		case *predNode:
+			children = []node{n.expr}
+		case *repeatNode:
+			children = []node{n.expr}
+		case *recoveryNode:
+			children = []node{n.expr, n.recover}
+		}
+		if i < 1 || i > len(children) {
+			return nil, fmt.Errorf("no expression at index %s", joinPath(path[:k+1]))
+		}
+		n = children[i-1]
+	}
+
+	return n, nil
+}
+
+// joinPath returns the path of indices separated by dots.
+func joinPath(path []int) string {
+	list := make([]string, len(path))
+	for i, v := range path {
+		list[i] = strconv.Itoa(v)
+	}
+
+	return strings.Join(list, ".")
+}
+
+// parseSelector parses a selector rule:index[.index...].
+func parseSelector(sel string) (string, []int, error) {
+	name, indices, ok := strings.Cut(sel, ":")
+	if !ok || !isIdent(name) || indices == "" {
+		return "", nil, fmt.Errorf("invalid selector %q, want rule:index[.index...]", sel)
+	}
+	var path []int
+	for _, s := range strings.Split(indices, ".") {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid selector %q, want rule:index[.index...]", sel)
+		}
+		path = append(path, i)
+	}
+
+	return name, path, nil
+}
+
+// extract returns an edit of src replacing the expression selected by path
+// in the rule sr with a reference to the new rule name, and another for the
+// definition of the new rule after sr.  When the expression is the only
+// content of a group, the parentheses are replaced too.
+func extract(src *source, sr *sourceRule, path []int, name string) ([]sourceEdit, error) {
+	root, err := src.parseExpr(sr)
+	if err != nil {
+		return nil, err
+	}
+	n, err := selectNode(root, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: rule %q: %v", sr.rule.Pos, sr.rule.Name, err)
+	}
+	pos, end := n.span()
+	text := src.exprText(sr)
+	expr := text[pos:end]
+
+	// Widen to the enclosing parentheses.
+	before := strings.TrimRight(text[:pos], " \t\r\n")
+	after := strings.TrimLeft(text[end:], " \t\r\n")
+	if strings.HasSuffix(before, "(") && strings.HasPrefix(after, ")") {
+		pos = len(before) - 1
+		end = len(text) - len(after) + 1
+	}
+
+	return []sourceEdit{
+		{sr.expr + pos, sr.expr + end, name},
+		src.insertRule(sr, name, expr),
+	}, nil
+}
+
+// runExtract moves the selected expression of a rule into a new rule,
+// replacing it with a reference to the new rule.
+func runExtract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the grammar to the file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, extractUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	args = parseInterspersed(flags, args)
+	if len(args) != 3 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	path, sel, name := args[0], args[1], args[2]
+	rule, indices, err := parseSelector(sel)
+	if err != nil {
+		fatal(err)
+	}
+	if !isIdent(name) {
+		fatalf("invalid rule name %q", name)
+	}
+
+	data, err := readFile(cliFS, cliFS.name(path))
+	if err != nil {
+		fatal(err)
+	}
+	src, err := newSource(path, data)
+	if err != nil {
+		fatal(err)
+	}
+	if src.rule(name) != nil {
+		fatalf("rule %q already defined", name)
+	}
+	sr := src.rule(rule)
+	if sr == nil {
+		fatalf("rule %q not defined", rule)
+	}
+	edits, err := extract(src, sr, indices, name)
+	if err != nil {
+		fatal(err)
+	}
+	out := src.apply(edits)
+	if _, err := newSource(path, out); err != nil {
+		fatalf("extracted grammar is invalid: %v", err)
+	}
+
+	if *write {
+		if err := os.WriteFile(path, out, 0o666); err != nil {
+			fatal(err)
+		}
+	} else {
+		os.Stdout.Write(out)
+	}
+}
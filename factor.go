@@ -0,0 +1,309 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// items returns the items of n, when n is a sequence, or n.
+func items(n node) []node {
+	if seq, ok := n.(*seqNode); ok {
+		return seq.items
+	}
+
+	return []node{n}
+}
+
+// newSeq returns the sequence of the items, or the item when there is only
+// one.
+func newSeq(list []node) node {
+	if len(list) == 1 {
+		return list[0]
+	}
+
+	return &seqNode{items: list}
+}
+
+// newChoice returns the choice of the alternatives, or the alternative when
+// there is only one.
+func newChoice(list []node) node {
+	if len(list) == 1 {
+		return list[0]
+	}
+
+	return &choiceNode{alts: list}
+}
+
+// leftFactor returns n with the consecutive alternatives of each choice that
+// start with the same items rewritten as a single alternative, as in
+//
+//	"in" "t" / "in" "line"  =>  "in" ("t" / "line")
+//	"e" "+" / "e"           =>  "e" "+"?
+//
+// which is equivalent, since a parsing expression always matches the same
+// input at the same position.  The result is false when n is unchanged.
+func leftFactor(n node) (node, bool) {
+	switch n := n.(type) {
+	case *choiceNode:
+		changed := false
+		alts := make([]node, len(n.alts))
+		for i, alt := range n.alts {
+			var ok bool
+			alts[i], ok = leftFactor(alt)
+			changed = changed || ok
+		}
+
+		var list []node
+		for i := 0; i < len(alts); {
+			alt, k := factorRun(alts[i:])
+			if alt != nil {
+				list = append(list, alt)
+				changed = true
+			} else {
+				list = append(list, alts[i:i+k]...)
+			}
+			i += k
+		}
+		if !changed {
+			return n, false
+		}
+		if len(list) == 1 {
+			return list[0], true
+		}
+		choice := &choiceNode{alts: list}
+		if factored, ok := leftFactor(choice); ok {
+			// A factored alternative may share a prefix with the next.
+			return factored, true
+		}
+
+		return choice, true
+	case *seqNode:
+		changed := false
+		list := make([]node, len(n.items))
+		for i, item := range n.items {
+			var ok bool
+			list[i], ok = leftFactor(item)
+			changed = changed || ok
+		}
+		if !changed {
+			return n, false
+		}
+
+		return &seqNode{items: list}, true
+	case *predNode:
+		if expr, ok := leftFactor(n.expr); ok {
+			return &predNode{op: n.op, expr: expr}, true
+		}
+	case *repeatNode:
+		if expr, ok := leftFactor(n.expr); ok {
+			r := *n
+			r.expr = expr
+
+			return &r, true
+		}
+	case *recoveryNode:
+		expr, lok := leftFactor(n.expr)
+		recover, rok := leftFactor(n.recover)
+		if lok || rok {
+			return &recoveryNode{expr: expr, labels: n.labels, recover: recover}, true
+		}
+	}
+
+	return n, false
+}
+
+// factorRun returns the leading alternatives that start with the same item as
+// a single alternative, with their longest common prefix followed by the
+// choice of the rest of each alternative, and the number of alternatives it
+// replaces.  An alternative that is the prefix itself ends the run, making
+// the choice optional; the alternatives after it can never match.  The result
+// is nil when the leading alternatives cannot be factored.
+func factorRun(alts []node) (node, int) {
+	first := func(n node) string {
+		if list := items(n); len(list) > 0 {
+			return exprString(list[0])
+		}
+
+		return ""
+	}
+	key := first(alts[0])
+	if key == "" {
+		// The empty sequence always matches.
+		return nil, 1
+	}
+	k := 1
+	for k < len(alts) && first(alts[k]) == key {
+		k++
+	}
+	alts = alts[:k]
+
+	for {
+		if len(alts) < 2 {
+			return nil, k
+		}
+		prefix := items(alts[0])
+		for _, alt := range alts[1:] {
+			list := items(alt)
+			n := 0
+			for n < len(prefix) && n < len(list) && exprString(prefix[n]) == exprString(list[n]) {
+				n++
+			}
+			prefix = prefix[:n]
+		}
+
+		var rest []node
+		for i, alt := range alts {
+			list := items(alt)
+			if len(list) > len(prefix) {
+				rest = append(rest, newSeq(list[len(prefix):]))
+
+				continue
+			}
+			if i == 0 {
+				// The first alternative always wins.
+				return nil, 1
+			}
+			if i+1 < len(alts) {
+				// Factor the alternatives up to the prefix, and leave
+				// the rest to the next run.
+				alts = alts[:i+1]
+				k = i + 1
+
+				break
+			}
+		}
+		if len(rest) < len(alts)-1 {
+			continue
+		}
+
+		choice, _ := leftFactor(newChoice(rest))
+		if len(rest) < len(alts) {
+			choice = &repeatNode{op: '?', expr: choice}
+		}
+
+		return newSeq(append(append([]node(nil), prefix...), choice)), k
+	}
+}
+
+// leftFactorSource returns the edits of src that left factor the choices of
+// each rule.
+func leftFactorSource(src *source) ([]sourceEdit, error) {
+	var edits []sourceEdit
+	for _, sr := range src.rules {
+		list, err := leftFactorEdits(src, sr)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, list...)
+	}
+
+	return edits, nil
+}
+
+// leftFactorEdits returns the edits of src that left factor the choices of
+// the rule sr, replacing the source text of each factored run of
+// alternatives with its canonical form.
+func leftFactorEdits(src *source, sr *sourceRule) ([]sourceEdit, error) {
+	root, err := src.parseExpr(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []sourceEdit
+	var visit func(n node)
+	visit = func(n node) {
+		switch n := n.(type) {
+		case *choiceNode:
+			alts := make([]node, len(n.alts))
+			for i, alt := range n.alts {
+				alts[i], _ = leftFactor(alt)
+			}
+			var runs []sourceEdit
+			var list, rest []node
+			for i := 0; i < len(alts); {
+				alt, k := factorRun(alts[i:])
+				if alt == nil {
+					list = append(list, alts[i:i+k]...)
+					rest = append(rest, n.alts[i:i+k]...)
+				} else {
+					list = append(list, alt)
+					pos, _ := n.alts[i].span()
+					_, end := n.alts[i+k-1].span()
+					runs = append(runs, sourceEdit{sr.expr + pos, sr.expr + end, exprString(alt)})
+				}
+				i += k
+			}
+			if len(runs) > 0 && len(list) > 1 {
+				if factored, ok := leftFactor(&choiceNode{alts: list}); ok {
+					// The factored runs can be factored again:
+					// replace the whole choice.
+					pos, end := n.span()
+					edits = append(edits, sourceEdit{sr.expr + pos, sr.expr + end, exprString(factored)})
+
+					return
+				}
+			}
+			edits = append(edits, runs...)
+			for _, alt := range rest {
+				visit(alt)
+			}
+		case *seqNode:
+			for _, item := range n.items {
+				visit(item)
+			}
+		case *predNode:
+			visit(n.expr)
+		case *repeatNode:
+			visit(n.expr)
+		case *recoveryNode:
+			visit(n.expr)
+			visit(n.recover)
+		}
+	}
+	visit(root)
+
+	return edits, nil
+}
+
+// leftFactorRules returns a copy of grammar with the rule expressions left
+// factored, in canonical form.  Rules that are unchanged, or invalid, keep
+// their expression.
+func leftFactorRules(grammar []Rule) []Rule {
+	list := make([]Rule, len(grammar))
+	for i, rule := range grammar {
+		if n, err := parseExpr(rule.Expr); err == nil {
+			if factored, ok := leftFactor(n); ok {
+				rule.Expr = exprString(factored)
+			}
+		}
+		list[i] = rule
+	}
+
+	return list
+}
+
+// leftFactorAnalyzer suggests the left factoring of choices with alternatives
+// starting with the same expressions.
+var leftFactorAnalyzer = &analyzer{
+	name: "left-factor",
+	run:  runLeftFactor,
+}
+
+func runLeftFactor(s *syntax) []finding {
+	var list []finding
+	for i := range s.rules {
+		rule := &s.rules[i]
+		root, ok := s.nodes[rule.Name]
+		if !ok {
+			continue
+		}
+		if factored, ok := leftFactor(root); ok {
+			list = append(list, finding{
+				severity: severityInfo,
+				rule:     rule,
+				msg:      "alternatives with a common prefix can be left factored as " + exprString(factored),
+			})
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+)
+
+const findUsage = `Usage: pegcmp find -expr expr | -regexp regexp path...`
+
+// runFind lists the rules, in the grammar files at the specified paths or in
+// the specified directories or archives, whose expression contains the queried
+// expression or matches the queried regular expression.  Invalid grammars
+// are reported and skipped.  The exit status is 1 when no rule is found.
+func runFind(args []string) {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	exprQuery := flags.String("expr", "",
+		"find the rules containing the expression, ignoring quoting and white space")
+	regexpQuery := flags.String("regexp", "", "find the rules whose expression matches the regular expression")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, findUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 || (*exprQuery == "") == (*regexpQuery == "") {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	var match func(n node, expr string) bool
+	if *exprQuery != "" {
+		query, err := parseExpr(*exprQuery)
+		if err != nil {
+			fatalf("invalid expression: %v", err)
+		}
+		match = func(n node, _ string) bool {
+			return contains(n, query)
+		}
+	} else {
+		re, err := regexp.Compile(*regexpQuery)
+		if err != nil {
+			fatal(err)
+		}
+		match = func(_ node, expr string) bool {
+			return re.MatchString(expr)
+		}
+	}
+
+	type file struct {
+		fsys fs.FS
+		name string
+	}
+	var files []file
+	for _, path := range flags.Args() {
+		fsys, root, err := openPath(path)
+		if err != nil {
+			fatal(err)
+		}
+		list, err := grammarFiles(fsys, root)
+		if err != nil {
+			fatal(err)
+		}
+		for _, name := range list {
+			files = append(files, file{fsys, name})
+		}
+	}
+
+	found := false
+	prog := newProgress(!*noProgressFlag, "find", len(files))
+	for _, f := range files {
+		prog.step()
+		grammar, err := parseFS(f.fsys, f.name)
+		if err != nil {
+			prog.clear()
+			slog.Warn("skipping invalid grammar", "path", displayName(f.fsys, f.name), "err", err)
+
+			continue
+		}
+		s := newSyntax(grammar)
+		for i := range s.rules {
+			rule := &s.rules[i]
+			n, ok := s.nodes[rule.Name]
+			if !ok || !match(n, rule.Expr) {
+				continue
+			}
+			prog.clear()
+			fmt.Printf("%s: rule %q: %s\n", rule.Pos, rule.Name, rule.Expr)
+			found = true
+		}
+	}
+	prog.clear()
+	if !found {
+		os.Exit(1)
+	}
+}
+
+// grammarFiles returns root, if it is a file, or the .peg files in the
+// directory named root in fsys, in lexical order.
+func grammarFiles(fsys fs.FS, root string) ([]string, error) {
+	var list []string
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return displayError(fsys, err)
+		}
+		if p == root && !d.IsDir() || d.Type().IsRegular() && path.Ext(p) == ".peg" {
+			list = append(list, p)
+		}
+
+		return nil
+	})
+
+	return list, err
+}
+
+// contains reports whether query occurs in n.  A sequence query also occurs
+// as a contiguous part of a longer sequence.
+func contains(n, query node) bool {
+	found := false
+	walk(n, func(m node) {
+		if found {
+			return
+		}
+		if equalNodes(m, query) {
+			found = true
+
+			return
+		}
+		seq, ok1 := m.(*seqNode)
+		sub, ok2 := query.(*seqNode)
+		if !ok1 || !ok2 {
+			return
+		}
+		for i := 0; i+len(sub.items) <= len(seq.items) && !found; i++ {
+			found = equalLists(seq.items[i:i+len(sub.items)], sub.items)
+		}
+	})
+
+	return found
+}
+
+// equalNodes reports whether a and b are the same expression.  Literals are
+// compared by value and character classes by their set of code points.
+func equalNodes(a, b node) bool {
+	switch a := a.(type) {
+	case *choiceNode:
+		b, ok := b.(*choiceNode)
+
+		return ok && equalLists(a.alts, b.alts)
+	case *seqNode:
+		b, ok := b.(*seqNode)
+
+		return ok && equalLists(a.items, b.items)
+	case *predNode:
+		b, ok := b.(*predNode)
+
+		return ok && a.op == b.op && equalNodes(a.expr, b.expr)
+	case *repeatNode:
+		b, ok := b.(*repeatNode)
+
+		return ok && a.op == b.op && a.lo == b.lo && a.hi == b.hi && equalNodes(a.expr, b.expr)
+	case *recoveryNode:
+		b, ok := b.(*recoveryNode)
+
+		return ok && slices.Equal(a.labels, b.labels) && equalNodes(a.expr, b.expr) && equalNodes(a.recover, b.recover)
+	case *throwNode:
+		b, ok := b.(*throwNode)
+
+		return ok && a.label == b.label
+	case *stateNode:
+		b, ok := b.(*stateNode)
+
+		return ok && a.code == b.code
+	case *refNode:
+		b, ok := b.(*refNode)
+
+		return ok && a.name == b.name
+	case *litNode:
+		b, ok := b.(*litNode)
+
+		return ok && a.value == b.value
+	case *classNode:
+		b, ok := b.(*classNode)
+
+		return ok && a.set.equal(b.set)
+	case *anyNode:
+		_, ok := b.(*anyNode)
+
+		return ok
+	}
+
+	return false
+}
+
+func equalLists(a, b []node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equalNodes(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
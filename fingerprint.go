@@ -0,0 +1,198 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FingerprintVersion is the version of the fingerprints returned by
+// Rule.Fingerprint, its prefix.
+const FingerprintVersion = "v1"
+
+// fingerprintVectors are the test vectors of the fingerprints, as lines with
+// a fingerprint and a rule definition separated by a tab.
+//
+//go:embed schema/fingerprint-v1.txt
+var fingerprintVectors []byte
+
+// Fingerprint returns the fingerprint of the rule, as "v1:" followed by the
+// hex encoded SHA-256 digest of the canonical form of its name and
+// expression, so that formatting and comments are ignored.
+//
+// The fingerprints of a version never change: a change of the canonical form
+// is a new version, and the fingerprints of each version are checked against
+// the test vectors in schema/fingerprint-v1.txt, with pegcmp fingerprint
+// -self-test.  Unlike the canonical form used for the comparison, it does not
+// depend on the normalization options.
+//
+// The canonical form of version 1 is the rule name, a NUL byte and the
+// expression as an s-expression, where
+//
+//	e1 / e2      is (/ e1 e2)
+//	e1 e2        is (. e1 e2)
+//	&e, !e       are (& e), (! e)
+//	e{lo,hi}     is ({} lo hi e), with e? e* e+ as {0,1} {0,} {1,}
+//	             and hi -1 when unbounded
+//	e //{l} r    is (// (l) e r)
+//	%{l}         is (% l)
+//	#{code}      is (# "code"), with runs of white space collapsed
+//	Name         is Name
+//	"lit"        is "lit", the unescaped value quoted as Go does
+//	[class]      is ([] lo hi ...), with the sorted, merged ranges of
+//	             code points in decimal, or ([] "[class]") when it has
+//	             Unicode classes, since their tables change with Unicode
+//	.            is .
+//
+// A rule whose expression does not parse has the canonical form of its
+// name, a NUL byte, ! and the expression without comments.
+func (r *Rule) Fingerprint() string {
+	var b strings.Builder
+	b.WriteString(r.Name)
+	b.WriteByte(0)
+	if n, err := parseExpr(r.Expr); err == nil {
+		writeCanonical(&b, n)
+	} else {
+		b.WriteString("!" + strip(r.Expr))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+
+	return FingerprintVersion + ":" + hex.EncodeToString(sum[:])
+}
+
+// writeCanonical writes the canonical form of n, for Fingerprint.  It must
+// not change.
+func writeCanonical(b *strings.Builder, n node) {
+	list := func(op string, nodes ...node) {
+		b.WriteString("(" + op)
+		for _, n := range nodes {
+			b.WriteByte(' ')
+			writeCanonical(b, n)
+		}
+		b.WriteString(")")
+	}
+	switch n := n.(type) {
+	case *choiceNode:
+		list("/", n.alts...)
+	case *seqNode:
+		list(".", n.items...)
+	case *predNode:
+		list(string(n.op), n.expr)
+	case *repeatNode:
+		lo, hi := n.bounds()
+		list(fmt.Sprintf("{} %d %d", lo, hi), n.expr)
+	case *recoveryNode:
+		list("// ("+strings.Join(n.labels, " ")+")", n.expr, n.recover)
+	case *throwNode:
+		b.WriteString("(% " + n.label + ")")
+	case *stateNode:
+		b.WriteString("(# " + strconv.Quote(n.code) + ")")
+	case *refNode:
+		b.WriteString(n.name)
+	case *litNode:
+		b.WriteString(strconv.Quote(n.value))
+	case *classNode:
+		if strings.Contains(n.text, `\p`) {
+			b.WriteString("([] " + strconv.Quote(n.text) + ")")
+
+			break
+		}
+		b.WriteString("([]")
+		for _, r := range append(runeSet(nil), n.set...).normalize() {
+			fmt.Fprintf(b, " %d %d", r.lo, r.hi)
+		}
+		b.WriteString(")")
+	case *anyNode:
+		b.WriteString(".")
+	}
+}
+
+const fingerprintUsage = `Usage: pegcmp fingerprint path...
+       pegcmp fingerprint -self-test`
+
+// runFingerprint writes the fingerprint and the name of each rule of the
+// grammars or, with -self-test, checks the fingerprints of the test vectors,
+// exiting with status 1 when one differs.
+func runFingerprint(args []string) {
+	flags := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	selfTest := flags.Bool("self-test", false, "check the fingerprints of the test vectors")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, fingerprintUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *selfTest {
+		if flags.NArg() > 0 {
+			flags.Usage()
+
+			os.Exit(2)
+		}
+		failed, total := checkFingerprints()
+		fmt.Printf("%d of %d fingerprint vectors passed\n", total-failed, total)
+		if failed > 0 {
+			os.Exit(1)
+		}
+
+		return
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	for _, path := range flags.Args() {
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		for i := range grammar {
+			fmt.Printf("%s  %s\n", grammar[i].Fingerprint(), grammar[i].Name)
+		}
+	}
+}
+
+// checkFingerprints checks the fingerprints of the test vectors, writing the
+// ones that differ, and returns the number of failed and total vectors.
+func checkFingerprints() (failed, total int) {
+	sc := bufio.NewScanner(bytes.NewReader(fingerprintVectors))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		total++
+		want, def, ok := strings.Cut(line, "\t")
+		if !ok {
+			fmt.Printf("fingerprint-v1.txt:%d: invalid vector\n", n)
+			failed++
+
+			continue
+		}
+		rules, err := ParseGrammar("fingerprint-v1.txt", []byte(def))
+		if err != nil || len(rules) != 1 {
+			fmt.Printf("fingerprint-v1.txt:%d: invalid rule %q\n", n, def)
+			failed++
+
+			continue
+		}
+		if got := rules[0].Fingerprint(); got != want {
+			fmt.Printf("fingerprint-v1.txt:%d: %s: got %s, want %s\n", n, def, got, want)
+			failed++
+		}
+	}
+
+	return failed, total
+}
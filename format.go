@@ -0,0 +1,675 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// report is the result of comparing two grammars.
+type report struct {
+	lpath, rpath       string
+	lgrammar, rgrammar []Rule
+	changes            []change
+
+	// Analysis findings in rhs that are not in lhs.
+	findings []finding
+
+	// Problems of the lhs reference grammar, reported so that a broken
+	// baseline is noticed.
+	lhsIssues []finding
+
+	// Lexical rules of the changes, when the report is divided in lexical
+	// and syntactic sections, or nil.
+	lexical map[*Rule]bool
+
+	// Number of unchanged rules written before and after each changed
+	// rule, or -1 for the default of the format.
+	context int
+
+	// Terminals used by only one grammar, if requested.
+	terminals *terminalDiff
+
+	// Probable keywords used by only one grammar, if requested.
+	keywords *keywordDiff
+
+	// Operator precedence differences, if requested.
+	precedence *precedenceDiff
+
+	// Rule tests passing in only one grammar, if requested.
+	ruleTests []ruleTestDiff
+
+	// Rules whose properties changed, if requested.
+	properties []propChange
+
+	// Rules whose match length bounds changed, if requested.
+	lengths []lengthChange
+
+	// Recursion groups of the grammars and their changes, if requested.
+	recursion *recursionDiff
+
+	// Rules whose depth grew, if requested.
+	depths []depthChange
+
+	// Result of the comparison on a corpus, if requested.
+	corpus *corpusResult
+
+	// Evidence of the equivalence of the grammars, or nil when the report
+	// does not compare whole grammars.
+	equiv *equivalence
+
+	// Commit that last changed each added or modified rhs rule, if
+	// requested.
+	blame map[*Rule]*gitCommit
+
+	// Names of the public rules in either grammar.
+	public map[string]bool
+
+	// Rules that depend on each modified rhs rule.
+	impact map[*Rule][]string
+}
+
+// formatter writes a report in a specific format.  The output must follow
+// the order of the changes and findings, never the iteration order of a map,
+// so that the reports of two runs can be compared.
+type formatter func(w io.Writer, r *report) error
+
+var formatters = map[string]formatter{
+	"text":         formatText,
+	"udiff":        formatUnified,
+	"side-by-side": formatSideBySide,
+	"word-diff":    formatWordDiff,
+	"html":         formatHTML,
+	"explorer":     formatExplorer,
+	"json":         formatJSON,
+	"overlap":      formatOverlap,
+	"tap":          formatTAP,
+	"sqlite":       formatSQLite,
+}
+
+// udiffContext is the number of context rules in an unified diff hunk.
+const udiffContext = 3
+
+// formatText writes each rhs rule that is not found or that does not match
+// the lhs rule, in the lexical and syntactic sections when requested.
+func formatText(w io.Writer, r *report) error {
+	writeLHSIssues(w, r)
+	if list := renamed(r.changes); len(list) > 0 {
+		writeRenamed(w, list)
+	}
+	if r.lexical != nil {
+		writeSections(w, r, func(changes []change) {
+			writeTextChanges(w, r, changes)
+		})
+	} else {
+		writeTextChanges(w, r, r.changes)
+	}
+	for _, f := range r.findings {
+		fmt.Fprintf(w, "! rule %q: %s (%s)\n", f.rule.Name, f.msg, f.analyzer)
+		fmt.Fprintf(w, "> %s\n", textPos(f.rule.Pos))
+		fmt.Fprintf(w, "> %s\n\n", textExpr(f.rule, 2))
+	}
+	if r.terminals != nil {
+		writeTerminals(w, r.terminals)
+	}
+	if r.keywords != nil {
+		writeKeywords(w, r.keywords)
+	}
+	if r.precedence != nil {
+		writePrecedence(w, r.precedence)
+	}
+	writeRuleTests(w, r.ruleTests)
+	writeProperties(w, r.properties)
+	writeLengths(w, r.lengths)
+	writeRecursion(w, r.recursion)
+	writeDepths(w, r.depths)
+	if r.corpus != nil {
+		writeCorpus(w, r.corpus)
+	}
+	if r.equiv != nil {
+		writeVerdict(w, r)
+	}
+
+	return nil
+}
+
+// writeTextChanges writes each added rule and each modified rule in
+// changes.
+func writeTextChanges(w io.Writer, r *report, changes []change) {
+	ctx := newTextContext(r)
+	for _, c := range changes {
+		if c.rhs != nil && c.kind != ruleEqual {
+			ctx.write(w, c.rhs, -1)
+		}
+		switch c.kind {
+		case ruleAdded:
+			fmt.Fprintf(w, "! rule %q not found\n", c.rhs.Name)
+			fmt.Fprintf(w, "> %s\n", textPos(c.rhs.Pos))
+			writeBlame(w, r.blame[c.rhs])
+			fmt.Fprintf(w, "> %s\n\n", textExpr(c.rhs, 2))
+		case ruleModified:
+			fmt.Fprintf(w, "! rule %q does not match\n", c.rhs.Name)
+			fmt.Fprintf(w, "> %s\n", textPos(c.rhs.Pos))
+			writeBlame(w, r.blame[c.rhs])
+			lexpr, rexpr := markedExprs(c.lhs, c.rhs, 2)
+			var lanchors, ranchors []anchor
+			if *anchorsFlag {
+				lranges, rranges := sourceRanges(c.lhs, c.rhs)
+				lanchors, ranchors = ruleAnchors(c.lhs, lranges), ruleAnchors(c.rhs, rranges)
+			}
+			fmt.Fprintf(w, "> %s\n", rexpr)
+			writeAnchors(w, ">", ranchors)
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "< %s\n", textPos(c.lhs.Pos))
+			fmt.Fprintf(w, "< %s\n", lexpr)
+			writeAnchors(w, "<", lanchors)
+			fmt.Fprintln(w)
+			if deps := r.impact[c.rhs]; len(deps) > 0 {
+				fmt.Fprintf(w, "~ affects %s\n\n", impactString(deps))
+			}
+			if len(c.alts) > 0 {
+				writeAlternatives(w, c.alts)
+				fmt.Fprintln(w)
+			}
+			if len(c.classes) > 0 {
+				writeClasses(w, c.classes)
+				fmt.Fprintln(w)
+			}
+			if len(c.literals) > 0 {
+				writeLiterals(w, c.literals)
+				fmt.Fprintln(w)
+			}
+			if len(c.bounds) > 0 {
+				writeBounds(w, c.bounds)
+				fmt.Fprintln(w)
+			}
+		}
+		if c.rhs != nil && c.kind != ruleEqual {
+			ctx.write(w, c.rhs, 1)
+		}
+	}
+}
+
+// textContext writes the unchanged rhs rules around the changed rules, each
+// rule at most once.
+type textContext struct {
+	n       int
+	grammar []Rule
+	index   map[*Rule]int
+	changed map[int]bool
+	written map[int]bool
+}
+
+// newTextContext returns the context of the changes of r, or nil when no
+// context is requested.
+func newTextContext(r *report) *textContext {
+	if r.context <= 0 {
+		return nil
+	}
+	ctx := &textContext{
+		n:       r.context,
+		grammar: r.rgrammar,
+		index:   make(map[*Rule]int),
+		changed: make(map[int]bool),
+		written: make(map[int]bool),
+	}
+	for i := range r.rgrammar {
+		ctx.index[&r.rgrammar[i]] = i
+	}
+	for _, c := range r.changes {
+		if i, ok := ctx.index[c.rhs]; ok && c.kind != ruleEqual {
+			ctx.changed[i] = true
+		}
+	}
+
+	return ctx
+}
+
+// write writes the unchanged rules before the changed rule, with dir -1, or
+// after it, with dir 1, up to the nearest changed rule.
+func (ctx *textContext) write(w io.Writer, rule *Rule, dir int) {
+	if ctx == nil {
+		return
+	}
+	i, ok := ctx.index[rule]
+	if !ok {
+		return
+	}
+	var list []int
+	for j := i + dir; j >= 0 && j < len(ctx.grammar) && j != i+dir*(ctx.n+1) && !ctx.changed[j]; j += dir {
+		list = append(list, j)
+	}
+	if dir < 0 {
+		slices.Reverse(list)
+	}
+	n := 0
+	for _, j := range list {
+		if !ctx.written[j] {
+			ctx.written[j] = true
+			rule := &ctx.grammar[j]
+			writePrefixed(w, "  ", textDef(rule, 0))
+			n++
+		}
+	}
+	if n > 0 {
+		fmt.Fprintln(w)
+	}
+}
+
+// writeLHSIssues writes the reference grammar issues, if any, in their own
+// section before the changes.
+func writeLHSIssues(w io.Writer, r *report) {
+	if len(r.lhsIssues) == 0 {
+		return
+	}
+	noun := "issues"
+	if len(r.lhsIssues) == 1 {
+		noun = "issue"
+	}
+	fmt.Fprintf(w, "! reference grammar %s: %d %s\n\n", r.lpath, len(r.lhsIssues), noun)
+	for _, f := range r.lhsIssues {
+		fmt.Fprintf(w, "! rule %q: %s (%s)\n", f.rule.Name, f.msg, f.analyzer)
+		fmt.Fprintf(w, "< %s\n", textPos(f.rule.Pos))
+		fmt.Fprintf(w, "< %s\n\n", textExpr(f.rule, 2))
+	}
+}
+
+// maxImpactRules is the maximum number of dependent rules printed for a
+// modified rule.
+const maxImpactRules = 10
+
+// impactString returns the description of the dependent rules.
+func impactString(deps []string) string {
+	noun := "rules"
+	if len(deps) == 1 {
+		noun = "rule"
+	}
+	list := deps
+	more := ""
+	if len(list) > maxImpactRules {
+		list = list[:maxImpactRules]
+		more = fmt.Sprintf(" and %d more", len(deps)-maxImpactRules)
+	}
+
+	return fmt.Sprintf("%d %s: %s%s", len(deps), noun, strings.Join(list, ", "), more)
+}
+
+// writeBlame writes the commit that last changed a rule, if known.
+func writeBlame(w io.Writer, c *gitCommit) {
+	if c != nil {
+		fmt.Fprintf(w, "> %s\n", blameString(c))
+	}
+}
+
+// writeAlternatives writes the changed alternatives of a choice expression.
+func writeAlternatives(w io.Writer, alts []altChange) {
+	for _, a := range alts {
+		switch a.kind {
+		case ruleAdded:
+			fmt.Fprintf(w, "+ alternative %d added: %s\n", a.ri, colorText(a.rhs))
+		case ruleRemoved:
+			fmt.Fprintf(w, "- alternative %d removed: %s\n", a.li, colorText(a.lhs))
+		case ruleModified:
+			fmt.Fprintf(w, "~ alternative %d modified (was %d): %s\n", a.ri, a.li, colorText(a.rhs))
+		case ruleEqual:
+			fmt.Fprintf(w, "~ alternative %d moved (was %d): %s\n", a.ri, a.li, colorText(a.rhs))
+		}
+	}
+}
+
+// writeClasses writes the changed character classes, with the code points
+// added and removed by the rhs class.
+func writeClasses(w io.Writer, classes []classChange) {
+	for _, c := range classes {
+		switch c.relation() {
+		case "equal":
+			fmt.Fprintf(w, "~ class %s is equivalent to %s\n", c.rhs, c.lhs)
+		case "superset":
+			fmt.Fprintf(w, "~ class %s adds %s vs %s (strict superset)\n", c.rhs, c.added, c.lhs)
+		case "subset":
+			fmt.Fprintf(w, "~ class %s removes %s vs %s (strict subset)\n", c.rhs, c.removed, c.lhs)
+		default:
+			fmt.Fprintf(w, "~ class %s adds %s, removes %s vs %s\n", c.rhs, c.added, c.removed, c.lhs)
+		}
+	}
+}
+
+// writeLiterals writes the changed literals that only differ in their Unicode
+// composition.
+func writeLiterals(w io.Writer, literals []literalChange) {
+	for _, l := range literals {
+		fmt.Fprintf(w, "~ literal %s (%s) is canonically equivalent to %s (%s)\n",
+			escapeNonASCII(l.rhs), formName(l.rhs), escapeNonASCII(l.lhs), formName(l.lhs))
+	}
+}
+
+// writeBounds writes the repetitions that only changed their bounds.
+func writeBounds(w io.Writer, bounds []boundChange) {
+	for _, b := range bounds {
+		switch b.relation() {
+		case "wider":
+			fmt.Fprintf(w, "~ repetition %s allows more repetitions than %s\n", b.rhs, b.lhs)
+		case "narrower":
+			fmt.Fprintf(w, "~ repetition %s allows fewer repetitions than %s\n", b.rhs, b.lhs)
+		default:
+			fmt.Fprintf(w, "~ repetition %s changes the bounds of %s\n", b.rhs, b.lhs)
+		}
+	}
+}
+
+// formatUnified writes an unified diff of the rule sequences.  Hunk ranges
+// count rules, not lines.
+func formatUnified(w io.Writer, r *report) error {
+	llines := ruleLines(r.lgrammar)
+	rlines := ruleLines(r.rgrammar)
+	script := myers(llines, rlines)
+	n := udiffContext
+	if r.context >= 0 {
+		n = r.context
+	}
+	list := hunks(script, n)
+	if len(list) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n", r.lpath)
+	fmt.Fprintf(w, "+++ %s\n", r.rpath)
+	for _, h := range list {
+		var lcount, rcount int
+		for _, e := range h {
+			switch e.op {
+			case opEqual:
+				lcount++
+				rcount++
+			case opDelete:
+				lcount++
+			case opInsert:
+				rcount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n",
+			hunkRange(h[0].i, lcount), hunkRange(h[0].j, rcount))
+		for _, e := range h {
+			switch e.op {
+			case opEqual:
+				writePrefixed(w, " ", llines[e.i])
+			case opDelete:
+				writePrefixed(w, "-", llines[e.i])
+			case opInsert:
+				writePrefixed(w, "+", rlines[e.j])
+			}
+		}
+	}
+
+	return nil
+}
+
+// hunkRange formats an unified diff hunk range, with start 0 based.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// writePrefixed writes each line of s with the specified prefix.
+func writePrefixed(w io.Writer, prefix, s string) {
+	for _, line := range strings.Split(s, "\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+// ruleLines returns the definition of each rule in grammar.
+func ruleLines(grammar []Rule) []string {
+	lines := make([]string, len(grammar))
+	for i, rule := range grammar {
+		lines[i] = ruleDef(&rule, 0)
+	}
+
+	return lines
+}
+
+// formatSideBySide writes the lhs and rhs rules in two columns, marking
+// modified rules with '|', removed rules with '<' and added rules with '>'.
+func formatSideBySide(w io.Writer, r *report) error {
+	const maxWidth = 60
+
+	width := 0
+	for _, c := range r.changes {
+		if c.lhs != nil {
+			if n := len(oneLine(c.lhs)); n > width {
+				width = n
+			}
+		}
+	}
+	if width > maxWidth {
+		width = maxWidth
+	}
+
+	for _, c := range r.changes {
+		var left, right, pad string
+		if c.lhs != nil {
+			left = oneLine(c.lhs)
+		}
+		if c.rhs != nil {
+			right = oneLine(c.rhs)
+		}
+		if n := utf8.RuneCountInString(left); n < width {
+			pad = strings.Repeat(" ", width-n)
+		}
+		if colorOutput {
+			left, right = colorDef(left), colorDef(right)
+		}
+		mark := " "
+		switch c.kind {
+		case ruleModified:
+			mark = "|"
+		case ruleAdded:
+			mark = ">"
+		case ruleRemoved:
+			mark = "<"
+		}
+		note := ""
+		switch {
+		case c.moved:
+			note = "  (moved)"
+		case c.copyOf != nil:
+			note = fmt.Sprintf("  (copy of %s)", c.copyOf.Name)
+		}
+		line := fmt.Sprintf("%s%s %s %s%s", left, pad, mark, right, note)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+
+	return nil
+}
+
+// oneLine returns the definition of rule on a single line.
+func oneLine(rule *Rule) string {
+	return rule.Name + " <- " + joinTokens(styleTokens(rule.Expr))
+}
+
+// colorDef returns the definition of a rule on a single line, as written by
+// oneLine, highlighted.
+func colorDef(def string) string {
+	name, expr, ok := strings.Cut(def, " <- ")
+	if !ok {
+		return def
+	}
+
+	return name + " <- " + highlightANSI(expr)
+}
+
+// formatWordDiff writes each changed rule, marking deleted tokens with
+// [-...-] and inserted tokens with {+...+}.
+func formatWordDiff(w io.Writer, r *report) error {
+	for _, c := range r.changes {
+		switch c.kind {
+		case ruleEqual:
+			if !c.moved {
+				continue
+			}
+			fmt.Fprintf(w, "%s: (moved)\n", textPos(c.rhs.Pos))
+			fmt.Fprintf(w, "%s\n\n", ruleDef(c.rhs, 0))
+		case ruleAdded:
+			note := ""
+			if c.copyOf != nil {
+				note = fmt.Sprintf(" (copy of %s)", c.copyOf.Name)
+			}
+			fmt.Fprintf(w, "%s:%s\n", textPos(c.rhs.Pos), note)
+			fmt.Fprintf(w, "{+%s+}\n\n", ruleDef(c.rhs, 2))
+		case ruleRemoved:
+			fmt.Fprintf(w, "%s:\n", textPos(c.lhs.Pos))
+			fmt.Fprintf(w, "[-%s-]\n\n", ruleDef(c.lhs, 2))
+		case ruleModified:
+			note := ""
+			if c.moved {
+				note = " (moved)"
+			}
+			fmt.Fprintf(w, "%s:%s\n", textPos(c.rhs.Pos), note)
+			fmt.Fprintf(w, "%s <- ", c.rhs.Name)
+			for _, run := range tokenRuns(c) {
+				switch run.op {
+				case opEqual:
+					fmt.Fprint(w, run.text)
+				case opDelete:
+					fmt.Fprintf(w, "[-%s-]", run.text)
+				case opInsert:
+					fmt.Fprintf(w, "{+%s+}", run.text)
+				}
+			}
+			fmt.Fprint(w, "\n\n")
+		}
+	}
+
+	return nil
+}
+
+// tokenRun is a sequence of consecutive tokens with the same edit operation.
+type tokenRun struct {
+	op   editOp
+	text string
+}
+
+// tokenRuns merges the token edit script of c into runs.
+func tokenRuns(c change) []tokenRun {
+	var runs []tokenRun
+	for _, e := range c.edits {
+		var tok string
+		if e.op == opDelete {
+			tok = c.ltoks[e.i]
+		} else {
+			tok = c.rtoks[e.j]
+		}
+		if n := len(runs); n > 0 && runs[n-1].op == e.op {
+			runs[n-1].text += tok
+		} else {
+			runs = append(runs, tokenRun{e.op, tok})
+		}
+	}
+
+	return runs
+}
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.LPath}} vs {{.RPath}}</title>
+<style>
+table { border-collapse: collapse; font-family: monospace; }
+td, th { border: 1px solid #ccc; padding: 2px 6px; vertical-align: top; white-space: pre-wrap; }
+del { background: #fdd; text-decoration: none; }
+ins { background: #dfd; text-decoration: none; }
+tr.added td.rhs { background: #dfd; }
+tr.removed td.lhs { background: #fdd; }
+td.note { color: #888; }
+span.op { font-weight: bold; }
+span.lit { color: #080; }
+span.cls { color: #a0a; }
+span.pred { color: #c00; }
+span.ref { color: #06c; }
+span.code { color: #a60; }
+</style>
+</head>
+<body>
+<table>
+<tr><th>rule</th><th>{{.LPath}}</th><th>{{.RPath}}</th><th></th></tr>
+{{range .Rows}}<tr class="{{.Class}}"><td>{{.Name}}</td><td class="lhs">{{.LHS}}</td><td class="rhs">{{.RHS}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// formatHTML writes an HTML page with the lhs and rhs rules side by side,
+// highlighting the changed tokens.
+func formatHTML(w io.Writer, r *report) error {
+	type row struct {
+		Class, Name string
+		LHS, RHS    template.HTML
+		Note        string
+	}
+	data := struct {
+		LPath, RPath string
+		Rows         []row
+	}{
+		LPath: r.lpath,
+		RPath: r.rpath,
+	}
+
+	for _, c := range r.changes {
+		var row row
+		switch c.kind {
+		case ruleEqual:
+			row.Class = "equal"
+			row.Name = c.rhs.Name
+			row.LHS = highlightHTML(ruleExpr(c.lhs, 0))
+			row.RHS = highlightHTML(ruleExpr(c.rhs, 0))
+		case ruleAdded:
+			row.Class = "added"
+			row.Name = c.rhs.Name
+			row.RHS = highlightHTML(ruleExpr(c.rhs, 0))
+			if c.copyOf != nil {
+				row.Note = "copy of " + c.copyOf.Name
+			}
+		case ruleRemoved:
+			row.Class = "removed"
+			row.Name = c.lhs.Name
+			row.LHS = highlightHTML(ruleExpr(c.lhs, 0))
+		case ruleModified:
+			row.Class = "modified"
+			row.Name = c.rhs.Name
+			var lb, rb strings.Builder
+			for _, run := range tokenRuns(c) {
+				text := string(highlightHTML(run.text))
+				switch run.op {
+				case opEqual:
+					lb.WriteString(text)
+					rb.WriteString(text)
+				case opDelete:
+					lb.WriteString("<del>" + text + "</del>")
+				case opInsert:
+					rb.WriteString("<ins>" + text + "</ins>")
+				}
+			}
+			row.LHS = template.HTML(lb.String())
+			row.RHS = template.HTML(rb.String())
+		}
+		if c.moved {
+			row.Note = "moved"
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
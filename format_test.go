@@ -0,0 +1,86 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateFlag = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// goldenRuns is the number of times each output is written, to check that
+// it does not depend on the map iteration order.
+const goldenRuns = 10
+
+// TestGolden checks the text, JSON, HTML and Markdown outputs of the
+// comparison of the grammars in testdata/golden against the golden files.
+func TestGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "golden")
+	lpath, rpath := filepath.Join(dir, "lhs.peg"), filepath.Join(dir, "rhs.peg")
+	lgrammar, err := parse(lpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgrammar, err := parse(rpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := compareOptions()
+
+	for _, test := range []struct {
+		golden string
+		write  func(w io.Writer) error
+	}{
+		{"report.txt", func(w io.Writer) error {
+			return formatText(w, newReport(lpath, rpath, lgrammar, rgrammar, opts))
+		}},
+		{"report.json", func(w io.Writer) error {
+			return formatJSON(w, newReport(lpath, rpath, lgrammar, rgrammar, opts))
+		}},
+		{"report.html", func(w io.Writer) error {
+			return formatHTML(w, newReport(lpath, rpath, lgrammar, rgrammar, opts))
+		}},
+		{"changelog.md", func(w io.Writer) error {
+			writeChangelogMarkdown(w, newChangelog(lgrammar, rgrammar, opts))
+
+			return nil
+		}},
+	} {
+		t.Run(test.golden, func(t *testing.T) {
+			var got []byte
+			for i := 0; i < goldenRuns; i++ {
+				var buf bytes.Buffer
+				if err := test.write(&buf); err != nil {
+					t.Fatal(err)
+				}
+				if i > 0 && !bytes.Equal(buf.Bytes(), got) {
+					t.Fatalf("run %d: output differs from the first run", i+1)
+				}
+				got = buf.Bytes()
+			}
+
+			path := filepath.Join(dir, test.golden)
+			if *updateFlag {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s; run go test -run TestGolden -update to update it\ngot:\n%s", path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Grammars, manifests and corpora are read from an fs.FS, with names in the
+// file system syntax; include and manifest paths are resolved relative to
+// the including file, or to the root for absolute paths.
+
+// osFS is the operating system file system used by the command line, rooted
+// at the root directory, that reports names with the paths given on the
+// command line.
+type osFS struct {
+	fs.FS
+	root string // root directory
+	wd   string // working directory
+
+	mu    sync.Mutex
+	given map[string]string // the given paths, by name
+	dirs  map[string]string // the directories of the given paths, by name
+}
+
+// cliFS is the file system of the command line arguments.
+var cliFS = newOSFS()
+
+func newOSFS() *osFS {
+	wd, _ := os.Getwd()
+	root := filepath.VolumeName(wd) + string(filepath.Separator)
+
+	return &osFS{
+		FS:    os.DirFS(root),
+		root:  root,
+		wd:    wd,
+		given: make(map[string]string),
+		dirs:  make(map[string]string),
+	}
+}
+
+// name returns the name in the file system of the operating system path p,
+// recording p as the display name.
+func (f *osFS) name(p string) string {
+	abs := p
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(f.wd, abs)
+	}
+	rel, err := filepath.Rel(f.root, abs)
+	if err != nil {
+		return p
+	}
+	name := filepath.ToSlash(rel)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.given[name]; !ok {
+		f.given[name] = p
+		f.dirs[path.Dir(name)] = filepath.Dir(p)
+	}
+
+	return name
+}
+
+// displayName returns the path of name as given on the command line.  A file
+// not given, like an included grammar, is reported relative to the nearest
+// given directory, or of a given file, containing it, otherwise with its
+// absolute path.
+func (f *osFS) displayName(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.given[name]; ok {
+		return p
+	}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		p, ok := f.given[dir]
+		if !ok {
+			p, ok = f.dirs[dir]
+		}
+		if ok {
+			rel := strings.TrimPrefix(name, dir+"/")
+			if dir == "." {
+				rel = name
+			}
+
+			return filepath.Join(p, filepath.FromSlash(rel))
+		}
+		if dir == "." {
+			break
+		}
+	}
+
+	return filepath.Join(f.root, filepath.FromSlash(name))
+}
+
+// displayName returns name as reported for a file in fsys.
+func displayName(fsys fs.FS, name string) string {
+	if d, ok := fsys.(interface{ displayName(string) string }); ok {
+		return d.displayName(name)
+	}
+
+	return name
+}
+
+// readFile reads the file named name in fsys, reporting the display name in
+// the error.
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, name)
+
+	return data, displayError(fsys, err)
+}
+
+// displayError returns err with the path of an fs.PathError replaced by its
+// display name.
+func displayError(fsys fs.FS, err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		pe.Path = displayName(fsys, pe.Path)
+	}
+
+	return err
+}
+
+// resolve returns the name of the file at the slash separated path p,
+// relative to the directory of the file name.
+func resolve(name, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p[1:])
+	}
+
+	return path.Join(path.Dir(name), p)
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitCommit is a commit that changed a file.
+type gitCommit struct {
+	hash    string
+	author  string
+	date    time.Time
+	subject string
+	path    string // path of the file in the commit, relative to the repository
+}
+
+// short returns the abbreviated commit hash.
+func (c *gitCommit) short() string {
+	if len(c.hash) > 7 {
+		return c.hash[:7]
+	}
+
+	return c.hash
+}
+
+// git runs the git command with args in dir, returning its standard output.
+func git(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// gitLog returns the commits that changed the file at the operating system
+// path p, following renames, from the oldest to the newest.  When since is
+// not empty, only the commits after the revision since are returned.
+func gitLog(p, since string) ([]*gitCommit, error) {
+	args := []string{"log", "--follow", "--name-only", "--format=%x00%H%x00%an%x00%aI%x00%s"}
+	if since != "" {
+		args = append(args, since+"..HEAD")
+	}
+	args = append(args, "--", filepath.Base(p))
+	out, err := git(filepath.Dir(p), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each record is the formatted header followed by the name of the file.
+	var list []*gitCommit
+	fields := strings.Split(string(out), "\x00")
+	for i := 1; i+3 < len(fields); i += 4 {
+		date, err := time.Parse(time.RFC3339, fields[i+2])
+		if err != nil {
+			return nil, err
+		}
+		subject, path, _ := strings.Cut(fields[i+3], "\n")
+		list = append(list, &gitCommit{
+			hash:    fields[i],
+			author:  fields[i+1],
+			date:    date,
+			subject: subject,
+			path:    strings.TrimSpace(path),
+		})
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+
+	return list, nil
+}
+
+// gitShow returns the content of the file at path, relative to the
+// repository, in the revision rev of the repository containing dir.
+func gitShow(dir, rev, path string) ([]byte, error) {
+	return git(dir, "show", rev+":"+path)
+}
+
+// gitBlame returns the commits that last changed each line of the file at
+// the operating system path p, indexed by line number starting from 1.
+func gitBlame(p string) ([]*gitCommit, error) {
+	out, err := git(filepath.Dir(p), "blame", "--line-porcelain", "--", filepath.Base(p))
+	if err != nil {
+		return nil, err
+	}
+
+	// Each line is described by a header with the commit hash, the commit
+	// attributes and the line content prefixed by a tab.
+	list := []*gitCommit{nil}
+	commits := make(map[string]*gitCommit)
+	var cur *gitCommit
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case cur == nil:
+			hash, _, _ := strings.Cut(line, " ")
+			if hash == "" {
+				continue
+			}
+			if cur = commits[hash]; cur == nil {
+				cur = &gitCommit{hash: hash}
+				commits[hash] = cur
+			}
+		case strings.HasPrefix(line, "\t"):
+			list = append(list, cur)
+			cur = nil
+		default:
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "author":
+				cur.author = value
+			case "author-time":
+				if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+					cur.date = time.Unix(sec, 0).UTC()
+				}
+			case "summary":
+				cur.subject = value
+			case "filename":
+				cur.path = value
+			}
+		}
+	}
+
+	return list, nil
+}
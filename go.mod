@@ -1,3 +1,3 @@
 module github.com/perillo/pegcmp
 
-go 1.19
+go 1.24
@@ -0,0 +1,47 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// moduleFile returns the path, in the module cache, of the file in a Go
+// module specified as module@version:path.  The module is downloaded with
+// the go command if not in the cache.
+func moduleFile(spec string) (string, error) {
+	mod, file, ok := strings.Cut(spec, ":")
+	if !ok || !strings.Contains(mod, "@") || file == "" {
+		return "", fmt.Errorf("invalid module file %q, want module@version:path", spec)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "mod", "download", "-json", mod)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	var info struct {
+		Dir   string
+		Error string
+	}
+	if jerr := json.Unmarshal(stdout.Bytes(), &info); jerr != nil {
+		if err == nil {
+			err = jerr
+		}
+
+		return "", fmt.Errorf("go mod download %s: %v: %s", mod, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if info.Error != "" {
+		return "", fmt.Errorf("go mod download %s: %s", mod, info.Error)
+	}
+
+	return filepath.Join(info.Dir, filepath.FromSlash(file)), nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// refGraph is the rule reference graph of a grammar, mapping each rule to
+// the rules it references, in order of first reference.
+type refGraph map[string][]string
+
+// newRefGraph returns the rule reference graph of s.
+func newRefGraph(s *syntax) refGraph {
+	g := make(refGraph)
+	for name, n := range s.nodes {
+		g[name] = refs(n)
+	}
+
+	return g
+}
+
+// refs returns the names of the rules referenced by n, in order of first
+// reference.
+func refs(n node) []string {
+	var list []string
+	seen := make(map[string]bool)
+	walk(n, func(n node) {
+		if ref, ok := n.(*refNode); ok && !seen[ref.name] {
+			seen[ref.name] = true
+			list = append(list, ref.name)
+		}
+	})
+
+	return list
+}
+
+// reaches reports whether the rule to is reachable from the references of
+// the rule from.
+func (g refGraph) reaches(from, to string) bool {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), g[from]...)
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if name == to {
+			return true
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		stack = append(stack, g[name]...)
+	}
+
+	return false
+}
+
+// path returns the shortest sequence of rules from the rule from to the rule
+// to, including both, or nil when to is not reachable from the references of
+// from.
+func (g refGraph) path(from, to string) []string {
+	prev := make(map[string]string)
+	queue := []string{from}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range g[name] {
+			if _, ok := prev[next]; ok {
+				continue
+			}
+			prev[next] = name
+			if next == to {
+				list := []string{to}
+				for cur := name; cur != from; cur = prev[cur] {
+					list = append(list, cur)
+				}
+				list = append(list, from)
+				for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+					list[i], list[j] = list[j], list[i]
+				}
+
+				return list
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	return nil
+}
+
+// dependents returns the rules that reference, directly or transitively, the
+// named rule, excluding the rule itself, in the order of rules.
+func (g refGraph) dependents(name string, rules []Rule) []string {
+	rev := make(map[string][]string)
+	for from, list := range g {
+		for _, to := range list {
+			rev[to] = append(rev[to], from)
+		}
+	}
+	seen := map[string]bool{name: true}
+	stack := []string{name}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, from := range rev[cur] {
+			if !seen[from] {
+				seen[from] = true
+				stack = append(stack, from)
+			}
+		}
+	}
+
+	var list []string
+	for _, rule := range rules {
+		if rule.Name != name && seen[rule.Name] {
+			list = append(list, rule.Name)
+			seen[rule.Name] = false
+		}
+	}
+
+	return list
+}
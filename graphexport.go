@@ -0,0 +1,221 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+const graphUsage = `Usage: pegcmp graph [-format dot|graphml|json] path [new-path]`
+
+// graphDiff is the difference between the rule reference graphs of two
+// grammars.  The status of a node is the status of the change of its rule,
+// and the status of an edge is added, removed or equal.
+type graphDiff struct {
+	nodes []graphNode
+}
+
+// graphNode is a rule of either grammar, with its references.
+type graphNode struct {
+	name   string
+	status string
+	edges  []graphEdge
+}
+
+// graphEdge is a reference to the rule named to.
+type graphEdge struct {
+	to     string
+	status string
+}
+
+// newGraphDiff returns the difference between the reference graphs of
+// lgrammar and rgrammar, with the rhs rules in order followed by the rules
+// removed from lhs.  The references to undefined rules are omitted.
+func newGraphDiff(lgrammar, rgrammar []Rule, opts *options) *graphDiff {
+	lgrammar, rgrammar = opts.normalizer.Normalize(lgrammar), opts.normalizer.Normalize(rgrammar)
+	lgraph, rgraph := newRefGraph(newSyntax(lgrammar)), newRefGraph(newSyntax(rgrammar))
+	defined := func(g refGraph, name string) bool {
+		_, ok := g[name]
+
+		return ok
+	}
+	node := func(name, status string) graphNode {
+		n := graphNode{name: name, status: status}
+		seen := make(map[string]bool)
+		for _, to := range rgraph[name] {
+			if !defined(rgraph, to) {
+				continue
+			}
+			seen[to] = true
+			status := statusNames[ruleAdded]
+			if slices.Contains(lgraph[name], to) {
+				status = statusNames[ruleEqual]
+			}
+			n.edges = append(n.edges, graphEdge{to, status})
+		}
+		for _, to := range lgraph[name] {
+			if !seen[to] && defined(lgraph, to) {
+				n.edges = append(n.edges, graphEdge{to, statusNames[ruleRemoved]})
+			}
+		}
+
+		return n
+	}
+
+	d := new(graphDiff)
+	var removed []graphNode
+	for _, c := range compare(lgrammar, rgrammar, opts) {
+		if c.rhs != nil {
+			d.nodes = append(d.nodes, node(c.rhs.Name, statusNames[c.kind]))
+		} else {
+			removed = append(removed, node(c.lhs.Name, statusNames[c.kind]))
+		}
+	}
+	d.nodes = append(d.nodes, removed...)
+
+	return d
+}
+
+// graphColors are the DOT colors of each status.
+var graphColors = map[string]string{
+	statusNames[ruleEqual]:    "black",
+	statusNames[ruleModified]: "orange",
+	statusNames[ruleAdded]:    "green",
+	statusNames[ruleRemoved]:  "red",
+}
+
+// writeDOT writes d in the Graphviz DOT language.
+func (d *graphDiff) writeDOT(w io.Writer) error {
+	fmt.Fprintln(w, "digraph grammar {")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, n := range d.nodes {
+		fmt.Fprintf(w, "\t%s [color=%s, status=%s];\n", dotQuote(n.name), graphColors[n.status], n.status)
+	}
+	for _, n := range d.nodes {
+		for _, e := range n.edges {
+			style := "solid"
+			if e.status == statusNames[ruleRemoved] {
+				style = "dashed"
+			}
+			fmt.Fprintf(w, "\t%s -> %s [color=%s, style=%s, status=%s];\n",
+				dotQuote(n.name), dotQuote(e.to), graphColors[e.status], style, e.status)
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+
+	return err
+}
+
+// dotQuote returns s as a DOT quoted identifier.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// writeGraphML writes d in the GraphML format, with the status of the nodes
+// and edges in the status attribute.
+func (d *graphDiff) writeGraphML(w io.Writer) error {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+
+		return b.String()
+	}
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="status" for="all" attr.name="status" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <graph id="grammar" edgedefault="directed">`)
+	for _, n := range d.nodes {
+		fmt.Fprintf(w, "    <node id=\"%s\"><data key=\"status\">%s</data></node>\n", esc(n.name), n.status)
+	}
+	for _, n := range d.nodes {
+		for _, e := range n.edges {
+			fmt.Fprintf(w, "    <edge source=\"%s\" target=\"%s\"><data key=\"status\">%s</data></edge>\n",
+				esc(n.name), esc(e.to), e.status)
+		}
+	}
+	fmt.Fprintln(w, "  </graph>")
+	_, err := fmt.Fprintln(w, "</graphml>")
+
+	return err
+}
+
+// jsonGraph is the JSON representation of a graph diff, as adjacency lists.
+type jsonGraph struct {
+	Nodes []jsonGraphNode `json:"nodes"`
+}
+
+type jsonGraphNode struct {
+	Name   string          `json:"name"`
+	Status string          `json:"status"`
+	Edges  []jsonGraphEdge `json:"edges"`
+}
+
+type jsonGraphEdge struct {
+	To     string `json:"to"`
+	Status string `json:"status"`
+}
+
+// writeJSON writes d as JSON adjacency lists.
+func (d *graphDiff) writeJSON(w io.Writer) error {
+	doc := jsonGraph{Nodes: []jsonGraphNode{}}
+	for _, n := range d.nodes {
+		node := jsonGraphNode{Name: n.name, Status: n.status, Edges: []jsonGraphEdge{}}
+		for _, e := range n.edges {
+			node.Edges = append(node.Edges, jsonGraphEdge{e.to, e.status})
+		}
+		doc.Nodes = append(doc.Nodes, node)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(doc)
+}
+
+// runGraph writes the rule reference graph of a grammar or, with two
+// grammars, the difference between their graphs.
+func runGraph(args []string) {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := flags.String("format", "dot", "output format: dot, graphml or json")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, graphUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	write, ok := map[string]func(*graphDiff, io.Writer) error{
+		"dot":     (*graphDiff).writeDOT,
+		"graphml": (*graphDiff).writeGraphML,
+		"json":    (*graphDiff).writeJSON,
+	}[*format]
+	if !ok {
+		fatalf("unknown graph format %q", *format)
+	}
+
+	lgrammar, err := parse(flags.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar := lgrammar
+	if flags.NArg() == 2 {
+		if rgrammar, err = parse(flags.Arg(1)); err != nil {
+			fatal(err)
+		}
+	}
+	if err := write(newGraphDiff(lgrammar, rgrammar, compareOptions()), os.Stdout); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The gRPC protocol over HTTP/2, as described in
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md, with the
+// messages encoded as protocol buffers.  The messages are not compressed.
+
+// gRPC status codes.
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+)
+
+// grpcError is an error with its gRPC status code.
+type grpcError struct {
+	code int
+	err  error
+}
+
+func (e *grpcError) Error() string {
+	return e.err.Error()
+}
+
+func (e *grpcError) Unwrap() error {
+	return e.err
+}
+
+// isGRPC reports whether r is a gRPC request.
+func isGRPC(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return err == nil && r.ProtoMajor == 2 && (mt == "application/grpc" || mt == "application/grpc+proto")
+}
+
+// grpcStream is the stream of the gRPC transport.
+type grpcStream struct {
+	w http.ResponseWriter
+}
+
+func (s *grpcStream) send(msg protoMessage) error {
+	frame := msg.appendProto(make([]byte, 5))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(frame)-5))
+	if _, err := s.w.Write(frame); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// readGRPCMessage reads the only message of the request body r, of at most
+// maxSize bytes.
+func readGRPCMessage(r io.Reader, maxSize int64) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, grpcReadError(err)
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, errors.New("compressed messages are not supported")}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if int64(size) > maxSize {
+		return nil, &grpcError{grpcResourceExhausted, fmt.Errorf("request message of %d bytes exceeds the limit of %d bytes", size, maxSize)}
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, grpcReadError(err)
+	}
+	if n, _ := r.Read(prefix[:1]); n > 0 {
+		return nil, &grpcError{grpcInvalidArgument, errors.New("more than one request message")}
+	}
+
+	return data, nil
+}
+
+// grpcReadError returns the error reading the request message.
+func grpcReadError(err error) error {
+	if errors.As(err, new(*http.MaxBytesError)) {
+		return &grpcError{grpcResourceExhausted, err}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = errors.New("truncated request message")
+	}
+
+	return &grpcError{grpcInvalidArgument, err}
+}
+
+// serveGRPC decodes the request message of r, of at most maxSize bytes, into
+// req and invokes fn with the stream of the responses, replying with the
+// status of the call in the trailers.  It returns the error of the call.
+func serveGRPC(w http.ResponseWriter, r *http.Request, maxSize int64, req protoRequest, fn func(req protoRequest, s stream) error) error {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+		w.Header().Set("Grpc-Accept-Encoding", "identity")
+	}
+
+	data, err := readGRPCMessage(r.Body, maxSize)
+	if err == nil {
+		if err = req.unmarshalProto(data); err != nil {
+			err = &grpcError{grpcInvalidArgument, err}
+		}
+	}
+	if err == nil {
+		err = fn(req, &grpcStream{w})
+	}
+
+	code := grpcOK
+	var gerr *grpcError
+	switch {
+	case err == nil:
+	case errors.As(err, &gerr):
+		code = gerr.code
+	case errors.Is(err, context.Canceled):
+		code = grpcCanceled
+	default:
+		code = grpcInvalidArgument
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if err != nil {
+		w.Header().Set("Grpc-Message", grpcMessage(err.Error()))
+	}
+
+	return err
+}
+
+// grpcMessage returns msg percent encoded, as the value of the grpc-message
+// header.
+func grpcMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
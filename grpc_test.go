@@ -0,0 +1,35 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestGRPCMessageSize checks that a request message declaring a length
+// larger than the limit is rejected before it is read.
+func TestGRPCMessageSize(t *testing.T) {
+	const maxSize = 1 << 10
+
+	r := httptest.NewRequest(http.MethodPost, servicePath+"Compare", strings.NewReader("\x00\xff\xff\xff\xf0"))
+	r.ProtoMajor, r.ProtoMinor = 2, 0
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	err := serveGRPC(w, r, maxSize, new(compareRequest), func(req protoRequest, s stream) error {
+		t.Error("the call is invoked with an oversized request message")
+
+		return nil
+	})
+	if err == nil {
+		t.Fatal("got no error, want resource exhausted")
+	}
+	if got, want := w.Header().Get("Grpc-Status"), strconv.Itoa(grpcResourceExhausted); got != want {
+		t.Errorf("got status %s, want %s: %v", got, want, err)
+	}
+}
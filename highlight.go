@@ -0,0 +1,195 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// highlightClass is the syntactic class of a part of an expression.
+type highlightClass int
+
+const (
+	hlOperator  highlightClass = iota // choice, grouping, repetition and recovery
+	hlLiteral                         // literal
+	hlClass                           // character class and any character
+	hlPredicate                       // and and not predicates
+	hlRef                             // rule reference
+	hlCode                            // state change block and labeled failure
+)
+
+// highlightSpan is a part of an expression, with its byte offsets.
+type highlightSpan struct {
+	pos, end int
+	class    highlightClass
+}
+
+// highlightSpans returns the parts of expr that are not white space, in
+// order, classified by the nodes of its syntax tree or, when expr does not
+// parse, as a fragment of an expression, by its tokens.
+func highlightSpans(expr string) []highlightSpan {
+	var list []highlightSpan
+	if n, err := parseExpr(expr); err == nil {
+		walk(n, func(n node) {
+			pos, end := n.span()
+			switch n.(type) {
+			case *litNode:
+				list = append(list, highlightSpan{pos, end, hlLiteral})
+			case *classNode, *anyNode:
+				list = append(list, highlightSpan{pos, end, hlClass})
+			case *refNode:
+				list = append(list, highlightSpan{pos, end, hlRef})
+			case *stateNode, *throwNode:
+				list = append(list, highlightSpan{pos, end, hlCode})
+			case *predNode:
+				list = append(list, highlightSpan{pos, pos + 1, hlPredicate})
+			}
+		})
+	} else {
+		pos := 0
+		for _, tok := range tokenize(expr) {
+			span := highlightSpan{pos, pos + len(tok), hlOperator}
+			pos += len(tok)
+			switch c := tok[0]; {
+			case isSpace(c):
+				continue
+			case c == '\'' || c == '"':
+				span.class = hlLiteral
+			case c == '[' || tok == ".":
+				span.class = hlClass
+			case c == '&' || c == '!':
+				span.class = hlPredicate
+			case identLen(tok) > 0:
+				span.class = hlRef
+			case strings.HasPrefix(tok, "#{") || strings.HasPrefix(tok, "%{"):
+				span.class = hlCode
+			}
+			list = append(list, span)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].pos < list[j].pos })
+
+	// The runs of text between the spans are operators.
+	var all []highlightSpan
+	ops := func(pos, end int) {
+		for i := pos; i < end; i++ {
+			if isSpace(expr[i]) {
+				continue
+			}
+			j := i
+			for j < end && !isSpace(expr[j]) {
+				j++
+			}
+			all = append(all, highlightSpan{i, j, hlOperator})
+			i = j
+		}
+	}
+	prev := 0
+	for _, span := range list {
+		ops(prev, span.pos)
+		all = append(all, span)
+		prev = span.end
+	}
+	ops(prev, len(expr))
+
+	return all
+}
+
+// ansiColors are the ANSI SGR parameters of each class.
+var ansiColors = map[highlightClass]string{
+	hlOperator:  "1",  // bold
+	hlLiteral:   "32", // green
+	hlClass:     "35", // magenta
+	hlPredicate: "31", // red
+	hlRef:       "36", // cyan
+	hlCode:      "33", // yellow
+}
+
+// htmlClasses are the HTML classes of the spans of each class.
+var htmlClasses = map[highlightClass]string{
+	hlOperator:  "op",
+	hlLiteral:   "lit",
+	hlClass:     "cls",
+	hlPredicate: "pred",
+	hlRef:       "ref",
+	hlCode:      "code",
+}
+
+// highlight returns expr with each part written by mark, and the text in
+// between written by text.
+func highlight(expr string, text func(string) string, mark func(string, highlightClass) string) string {
+	var b strings.Builder
+	prev := 0
+	for _, s := range highlightSpans(expr) {
+		b.WriteString(text(expr[prev:s.pos]))
+		b.WriteString(mark(expr[s.pos:s.end], s.class))
+		prev = s.end
+	}
+	b.WriteString(text(expr[prev:]))
+
+	return b.String()
+}
+
+// highlightANSI returns expr highlighted with ANSI escape sequences.
+func highlightANSI(expr string) string {
+	return highlight(expr, func(s string) string { return s }, func(s string, c highlightClass) string {
+		return "\x1b[" + ansiColors[c] + "m" + s + "\x1b[0m"
+	})
+}
+
+// highlightHTML returns expr escaped and highlighted with HTML spans.
+func highlightHTML(expr string) template.HTML {
+	return template.HTML(highlight(expr, template.HTMLEscapeString, func(s string, c highlightClass) string {
+		return `<span class="` + htmlClasses[c] + `">` + template.HTMLEscapeString(s) + "</span>"
+	}))
+}
+
+// colorOutput reports whether the text outputs are highlighted with ANSI
+// escape sequences.
+var colorOutput bool
+
+// colorEnabled reports whether the text outputs are highlighted with the
+// color mode: always, never or, with auto, when the output is a terminal and
+// the NO_COLOR environment variable is not set.
+func colorEnabled(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return *outFlag == "" && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout), nil
+	}
+
+	return false, fmt.Errorf("unknown color mode %q, want auto, always or never", mode)
+}
+
+// textExpr returns the expression of rule in the print style, as ruleExpr,
+// highlighted when colorOutput is set.
+func textExpr(rule *Rule, col int) string {
+	return colorText(ruleExpr(rule, col))
+}
+
+// textDef returns the definition of rule in the print style, as ruleDef,
+// highlighted when colorOutput is set.
+func textDef(rule *Rule, col int) string {
+	head := rule.Name + " <- "
+
+	return head + textExpr(rule, col+utf8.RuneCountInString(head))
+}
+
+// colorText returns expr highlighted when colorOutput is set.
+func colorText(expr string) string {
+	if !colorOutput {
+		return expr
+	}
+
+	return highlightANSI(expr)
+}
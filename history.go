@@ -0,0 +1,163 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const historyUsage = `Usage: pegcmp history [-since revision] [-markdown] path`
+
+// revision is the set of rule changes in a commit.
+type revision struct {
+	commit  *gitCommit
+	changes []change // added, removed and modified rules
+}
+
+// grammarHistory returns the rule changes in each commit that changed the
+// grammar file at the operating system path p, after the revision since.
+// The rules are compared in canonical form, ignoring formatting changes, and
+// commits where the grammar is invalid are skipped.
+func grammarHistory(p, since string, opts *options) ([]revision, error) {
+	commits, err := gitLog(p, since)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(p)
+
+	var list []revision
+	var prev []Rule
+	for i, c := range commits {
+		if i == 0 {
+			// The file does not exist before the first commit.
+			if data, err := gitShow(dir, c.hash+"^", c.path); err == nil {
+				if prev, err = parseFile(c.path, data); err != nil {
+					slog.Warn("skipping invalid grammar", "commit", c.short()+"^", "err", err)
+				}
+				prev = normalizeRules(prev)
+			}
+		}
+		data, err := gitShow(dir, c.hash, c.path)
+		if err != nil {
+			return nil, err
+		}
+		grammar, err := parseFile(c.path, data)
+		if err != nil {
+			slog.Warn("skipping invalid grammar", "commit", c.short(), "err", err)
+
+			continue
+		}
+		grammar = normalizeRules(grammar)
+
+		rev := revision{commit: c}
+		for _, ch := range compare(prev, grammar, opts) {
+			if ch.kind != ruleEqual {
+				rev.changes = append(rev.changes, ch)
+			}
+		}
+		if len(rev.changes) > 0 {
+			list = append(list, rev)
+		}
+		prev = grammar
+	}
+
+	return list, nil
+}
+
+// changeName returns the name of the rule of c.
+func changeName(c change) string {
+	if c.rhs != nil {
+		return c.rhs.Name
+	}
+
+	return c.lhs.Name
+}
+
+// writeHistory writes the changelog of the grammar, from the newest to the
+// oldest commit, as writeHistoryMarkdown.
+func writeHistory(w io.Writer, list []revision) {
+	for i := len(list) - 1; i >= 0; i-- {
+		rev := list[i]
+		c := rev.commit
+		fmt.Fprintf(w, "commit %s %s %s\n", c.short(), c.date.Format("2006-01-02"), c.author)
+		fmt.Fprintf(w, "    %s\n", c.subject)
+		for _, ch := range rev.changes {
+			switch ch.kind {
+			case ruleAdded:
+				fmt.Fprintf(w, "+ %s\n", textDef(ch.rhs, 2))
+			case ruleRemoved:
+				fmt.Fprintf(w, "- %s\n", textDef(ch.lhs, 2))
+			case ruleModified:
+				fmt.Fprintf(w, "~ %s\n", ch.rhs.Name)
+				fmt.Fprintf(w, "    was: %s\n", textExpr(ch.lhs, 9))
+				fmt.Fprintf(w, "    now: %s\n", textExpr(ch.rhs, 9))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeHistoryMarkdown writes the changelog of the grammar as Markdown
+// release notes, from the newest to the oldest commit.
+func writeHistoryMarkdown(w io.Writer, path string, list []revision) {
+	fmt.Fprintf(w, "# Changes to %s\n", path)
+	for i := len(list) - 1; i >= 0; i-- {
+		rev := list[i]
+		c := rev.commit
+		fmt.Fprintf(w, "\n## %s (%s, %s)\n\n", c.subject, c.short(), c.date.Format("2006-01-02"))
+		for _, ch := range rev.changes {
+			switch ch.kind {
+			case ruleAdded:
+				fmt.Fprintf(w, "- added `%s`: `%s`\n", ch.rhs.Name, ch.rhs.Expr)
+			case ruleRemoved:
+				fmt.Fprintf(w, "- removed `%s`: `%s`\n", ch.lhs.Name, ch.lhs.Expr)
+			case ruleModified:
+				fmt.Fprintf(w, "- modified `%s`\n", ch.rhs.Name)
+				fmt.Fprintf(w, "  - was: `%s`\n", ch.lhs.Expr)
+				fmt.Fprintf(w, "  - now: `%s`\n", ch.rhs.Expr)
+			}
+		}
+	}
+}
+
+// runHistory writes the rules added, removed and modified in each commit
+// that changed a grammar file.
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	since := flags.String("since", "", "only report the commits after the specified revision")
+	markdown := flags.Bool("markdown", false, "write the changelog as Markdown release notes")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, historyUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	list, err := grammarHistory(path, *since, compareOptions())
+	if err != nil {
+		fatal(err)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if *markdown {
+		writeHistoryMarkdown(w, path, list)
+	} else {
+		writeHistory(w, list)
+	}
+	if err := w.Flush(); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const hookUsage = `Usage: pegcmp hook [-staged] [-deny categories]`
+
+// emptyTree is the hash of the empty git tree, used as HEAD before the first
+// commit.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// runHook compares the changed .peg files in the git working tree, or in the
+// index with -staged, against HEAD, for use in a pre-commit hook.  The policy
+// is read from the pegcmp.toml file in the root of the repository, if any,
+// unless -deny is specified.  The exit status is 1 when a change is denied
+// by the policy.
+func runHook(args []string) {
+	flags := flag.NewFlagSet("hook", flag.ExitOnError)
+	staged := flags.Bool("staged", false, "compare the staged files instead of the working tree")
+	deny := flags.String("deny", categoryRemoved+","+categoryLeftRecursion,
+		"comma separated list of denied change categories: "+strings.Join(categoryNames(), ", "))
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, hookUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	opts := compareOptions()
+	out, err := git(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		fatal(err)
+	}
+	root := strings.TrimSpace(string(out))
+
+	explicit := false
+	flags.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "deny"
+	})
+	config := filepath.Join(root, policyFile)
+	var pol *policy
+	if _, serr := os.Stat(config); serr == nil && !explicit {
+		pol, err = readPolicy(cliFS, cliFS.name(config))
+	} else {
+		pol, err = parseDenyList(*deny)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	sizeBudget = sizeBudget.or(pol.budget)
+	head := "HEAD"
+	if _, err := git(root, "rev-parse", "--verify", "-q", head); err != nil {
+		head = emptyTree
+	}
+	diffArgs := []string{"diff", "--name-only", "--no-renames", "-z"}
+	if *staged {
+		diffArgs = append(diffArgs, "--cached")
+	}
+	diffArgs = append(diffArgs, head, "--", "*.peg")
+	if out, err = git(root, diffArgs...); err != nil {
+		fatal(err)
+	}
+
+	files, count := 0, 0
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+		lgrammar, err := parseRevision(root, head, path)
+		if err != nil {
+			fatal(err)
+		}
+		var rgrammar []Rule
+		if *staged {
+			rgrammar, err = parseRevision(root, "", path)
+		} else {
+			rgrammar, err = parseWorkTree(root, path)
+		}
+		if err != nil {
+			fatal(err)
+		}
+
+		r := newReport(path, path, lgrammar, rgrammar, opts)
+		list := pol.check(r)
+		writeViolations(os.Stderr, list)
+		if len(list) > 0 {
+			files++
+			count += len(list)
+		}
+	}
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "pegcmp: %d denied grammar changes in %d files\n", count, files)
+
+		os.Exit(1)
+	}
+}
+
+// parseRevision parses the grammar file at path, relative to the repository
+// root, in the revision rev, or in the index when rev is empty.  The grammar
+// of a file missing in the revision is empty.
+func parseRevision(root, rev, path string) ([]Rule, error) {
+	if _, err := git(root, "cat-file", "-e", rev+":"+path); err != nil {
+		return nil, nil
+	}
+	data, err := gitShow(root, rev, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFile(path, data)
+}
+
+// parseWorkTree parses the grammar file at path, relative to the repository
+// root, in the working tree.  The grammar of a deleted file is empty.
+func parseWorkTree(root, path string) ([]Rule, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseFile(path, data)
+}
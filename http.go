@@ -0,0 +1,179 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// httpClient is the client of the HTTP requests.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// isURL reports whether p is an HTTP or HTTPS URL.
+func isURL(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// httpFS is the file system of the files on an HTTP server, named by their
+// URL path without the leading slash.  The query of the base URL is sent
+// with each request.  The responses are cached by ETag in the user cache
+// directory.
+type httpFS struct {
+	base    *url.URL
+	headers http.Header
+}
+
+// newHTTPFS returns the file system of the server of the URL u, returning
+// the name of u.  Each header is in the "Name: value" format.
+func newHTTPFS(u string, headers []string) (*httpFS, string, error) {
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, "", err
+	}
+	h := make(http.Header)
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return nil, "", fmt.Errorf("invalid header %q", header)
+		}
+		h.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	name := strings.TrimPrefix(base.Path, "/")
+	base.Path, base.RawPath, base.Fragment = "/", "", ""
+
+	return &httpFS{base: base, headers: h}, name, nil
+}
+
+func (f *httpFS) url(name string) string {
+	u := *f.base
+	u.Path += name
+
+	return u.String()
+}
+
+// displayName returns the URL of the file without the query, that may hold
+// credentials.
+func (f *httpFS) displayName(name string) string {
+	u := *f.base
+	u.Path += name
+	u.RawQuery = ""
+
+	return u.String()
+}
+
+func (f *httpFS) Open(name string) (fs.File, error) {
+	data, err := f.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return memFS{name: {data: data}}.Open(name)
+}
+
+// ReadFile fetches the file, sending the ETag of the cached response if
+// available.
+func (f *httpFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	u := f.url(name)
+	cache := httpCachePath(u, f.headers)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range f.headers {
+		req.Header[k] = v
+	}
+	var etag, cached []byte
+	if cache != "" {
+		// Only revalidate the cached response when its body is still there.
+		if cached, err = os.ReadFile(cache); err == nil {
+			etag, _ = os.ReadFile(cache + ".etag")
+		}
+	}
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", string(etag))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, f.requestError(name, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		slog.Debug("using cached response", "url", f.displayName(name), "etag", string(etag))
+
+		return cached, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("GET %s: %s", f.displayName(name), resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, f.requestError(name, err)
+	}
+
+	if tag := resp.Header.Get("ETag"); tag != "" && cache != "" {
+		// The ETag is removed before the body is written and written after
+		// it, so that a body is never revalidated with the ETag of another
+		// response.  A body left without its ETag is never revalidated, so
+		// it is removed when the ETag cannot be written.  The response is
+		// fetched again when the cache is incomplete.
+		os.MkdirAll(filepath.Dir(cache), 0o755)
+		os.Remove(cache + ".etag")
+		if os.WriteFile(cache, data, 0o644) == nil && os.WriteFile(cache+".etag", []byte(tag), 0o644) != nil {
+			os.Remove(cache)
+		}
+	}
+
+	return data, nil
+}
+
+// requestError returns the error of the request of the file, naming it
+// without the query, unlike the url.Error values of the client.
+func (f *httpFS) requestError(name string, err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+
+	return fmt.Errorf("GET %s: %w", f.displayName(name), err)
+}
+
+// httpCachePath returns the path of the cached response for the URL u
+// requested with headers, or an empty string if the user has no cache
+// directory.
+func httpCachePath(u string, headers http.Header) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	io.WriteString(h, u)
+	for _, k := range slices.Sorted(maps.Keys(headers)) {
+		for _, v := range headers[k] {
+			fmt.Fprintf(h, "\n%s: %s", k, v)
+		}
+	}
+	sum := h.Sum(nil)
+
+	return filepath.Join(dir, "pegcmp", "http", hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestHTTPFSMissingCache checks that a file is fetched again when its
+// cached ETag is still there but the cached body was removed.
+func TestHTTPFSMissingCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	const etag = `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintln(w, "A <- 'a'")
+	}))
+	defer srv.Close()
+
+	f, name, err := newHTTPFS(srv.URL+"/a.peg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadFile(name); err != nil {
+		t.Fatal(err)
+	}
+	cache := httpCachePath(f.url(name), f.headers)
+	if _, err := os.Stat(cache + ".etag"); err != nil {
+		t.Fatalf("the response is not cached: %v", err)
+	}
+	if err := os.Remove(cache); err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "A <- 'a'\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestHTTPFSErrorQuery checks that the errors of the requests do not include
+// the query of the URL, that may hold credentials.
+func TestHTTPFSErrorQuery(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	f, name, err := newHTTPFS(srv.URL+"/a.peg?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.ReadFile(name)
+	if err == nil {
+		t.Fatal("got no error from a closed server")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q includes the query", err)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Include directives, on a line by themselves, followed by a quoted path
+// relative to the directory of the including file and an optional prefix
+// for the names of the included rules:
+//
+//	%import "common.peg"
+//	# pegcmp:include "common.peg" Common
+const (
+	importDirective  = "%import"
+	includeDirective = "pegcmp:include"
+)
+
+// includer loads a grammar from fsys and the grammars it includes, each
+// only once with the same prefix.
+type includer struct {
+	fsys   fs.FS
+	loaded map[include]bool // files loaded, with the prefix of the names
+	stack  []string         // files being loaded, for cycle detection
+
+	// dropText discards the text and comments of the rules, when only
+	// their names and expressions are needed.
+	dropText bool
+
+	// onError, when not nil, is called with the rule definitions that do
+	// not parse, that are skipped instead of failing the load.
+	onError func(name string, err *ParseError)
+}
+
+func newIncluder(fsys fs.FS) *includer {
+	return &includer{fsys: fsys, loaded: make(map[include]bool)}
+}
+
+// include is a grammar file to include, with the prefix of its rule names.
+type include struct {
+	path   string
+	prefix string
+}
+
+// load returns the rules of the grammar named name, followed by the rules of
+// the included grammars in order.
+func (inc *includer) load(name string) ([]Rule, error) {
+	return inc.loadPrefix(name, "")
+}
+
+// loadPrefix is like load, for a grammar whose rule names will be prefixed
+// with prefix, including the prefixes of the including grammars.  It returns
+// no rules when the grammar was already loaded with the same prefix.
+func (inc *includer) loadPrefix(name, prefix string) ([]Rule, error) {
+	key := path.Clean(name)
+	for i, p := range inc.stack {
+		if p == key {
+			var cycle []string
+			for _, name := range append(inc.stack[i:], key) {
+				cycle = append(cycle, displayName(inc.fsys, name))
+			}
+
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if inc.loaded[include{key, prefix}] {
+		return nil, nil
+	}
+	inc.loaded[include{key, prefix}] = true
+	inc.stack = append(inc.stack, key)
+	defer func() {
+		inc.stack = inc.stack[:len(inc.stack)-1]
+	}()
+
+	data, err := readFile(inc.fsys, key)
+	if err != nil {
+		return nil, err
+	}
+	display := displayName(inc.fsys, key)
+	var rules []Rule
+	err = parseRulesRecover(display, data, func(rule Rule) error {
+		if inc.dropText {
+			rule.Text, rule.Comments = "", nil
+		}
+		rules = append(rules, rule)
+
+		return nil
+	}, inc.onError)
+	if err != nil {
+		return nil, err
+	}
+	includes, err := includePaths(key, display, data)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make(prefixedNames)
+	prefixes.add(rules, "")
+	for _, include := range includes {
+		slog.Debug("including grammar", "path", displayName(inc.fsys, include.path), "from", display, "prefix", include.prefix)
+		list, err := inc.loadPrefix(include.path, prefix+include.prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := prefixes.add(list, include.prefix); err != nil {
+			return nil, fmt.Errorf("%s: %w", display, err)
+		}
+		rules = append(rules, prefixRules(list, include.prefix)...)
+	}
+
+	return rules, nil
+}
+
+// prefixedNames are the names of the merged rules, with the prefix added to
+// each.
+type prefixedNames map[string]string
+
+// add adds the rules of list, with prefix added to their names.  It returns
+// an error when a prefixed name is the name of a rule with a different
+// prefix, as with the prefixes A and AB of the rules BC and C.
+func (names prefixedNames) add(list []Rule, prefix string) error {
+	for _, rule := range list {
+		name := prefix + rule.Name
+		if p, ok := names[name]; ok && p != prefix {
+			return fmt.Errorf("rule %s with prefix %q collides with rule %s with prefix %q",
+				rule.Name, prefix, strings.TrimPrefix(name, p), p)
+		}
+		names[name] = prefix
+	}
+
+	return nil
+}
+
+// includePaths returns the include directives of the grammar named name,
+// reported as display, with content data.
+func includePaths(name, display string, data []byte) ([]include, error) {
+	var list []include
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		var arg string
+		switch {
+		case strings.HasPrefix(line, importDirective):
+			arg = line[len(importDirective):]
+		case strings.HasPrefix(line, "#"):
+			comment := strings.TrimSpace(line[1:])
+			if !strings.HasPrefix(comment, includeDirective) {
+				continue
+			}
+			arg = comment[len(includeDirective):]
+		default:
+			continue
+		}
+
+		arg = strings.TrimSpace(arg)
+		quoted, err := strconv.QuotedPrefix(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid include directive", display, n+1)
+		}
+		file, _ := strconv.Unquote(quoted)
+		prefix := strings.TrimSpace(arg[len(quoted):])
+		if !isIdent(prefix) {
+			return nil, fmt.Errorf("%s:%d: invalid include prefix %q", display, n+1, prefix)
+		}
+		list = append(list, include{resolve(name, file), prefix})
+	}
+
+	return list, nil
+}
+
+// importComments returns data with the %import directives turned into
+// comments, preserving the offsets.
+func importComments(data []byte) []byte {
+	if !bytes.Contains(data, []byte(importDirective)) {
+		return data
+	}
+
+	data = append([]byte(nil), data...)
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += start
+		}
+		line := data[start:end]
+		if i := len(line) - len(bytes.TrimLeft(line, " \t")); bytes.HasPrefix(line[i:], []byte(importDirective)) {
+			line[i] = '#'
+		}
+		start = end + 1
+	}
+
+	return data
+}
+
+// isIdent reports whether s is empty or a valid rule name prefix.
+func isIdent(s string) bool {
+	return identLen(s) == len(s)
+}
+
+// prefixRules returns the rules with prefix added to their names and to the
+// references to them.  References to rules not in the list are unchanged.
+func prefixRules(rules []Rule, prefix string) []Rule {
+	if prefix == "" {
+		return rules
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+	rename := func(expr string) string {
+		toks := tokenize(expr)
+		for i, tok := range toks {
+			if names[tok] {
+				toks[i] = prefix + tok
+			}
+		}
+
+		return strings.Join(toks, "")
+	}
+
+	list := make([]Rule, len(rules))
+	for i, rule := range rules {
+		rule.Name = prefix + rule.Name
+		rule.Expr = rename(rule.Expr)
+		rule.Text = rename(rule.Text)
+		list[i] = rule
+	}
+
+	return list
+}
@@ -0,0 +1,448 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Errors returned when a run exceeds its budget or is canceled.
+var (
+	errStepLimit = errors.New("step limit exceeded")
+	errTimeout   = errors.New("timeout exceeded")
+	errCanceled  = errors.New("canceled")
+)
+
+// deadlineInterval is the number of steps between two checks of the
+// deadline and of the context.
+const deadlineInterval = 1024
+
+// ruleStats are the profiling statistics of a rule.
+type ruleStats struct {
+	calls      int // invocations
+	backtracks int // failed alternatives of the choices in the rule
+	maxDepth   int // maximum number of nested invocations
+	memoHits   int // invocations resolved by the memoization cache
+}
+
+// profile are the profiling statistics of a grammar, accumulated over one or
+// more runs of the interpreter.
+type profile struct {
+	rules    map[string]*ruleStats
+	steps    int // evaluated expressions
+	maxDepth int // maximum number of nested rule invocations
+
+	// Memoization cache statistics.
+	memoHits    int
+	memoLookups int
+}
+
+func newProfile() *profile {
+	return &profile{rules: make(map[string]*ruleStats)}
+}
+
+// rule returns the statistics of the named rule.
+func (p *profile) rule(name string) *ruleStats {
+	stats, ok := p.rules[name]
+	if !ok {
+		stats = new(ruleStats)
+		p.rules[name] = stats
+	}
+
+	return stats
+}
+
+// names returns the names of the profiled rules, sorted.
+func (p *profile) names() []string {
+	list := make([]string, 0, len(p.rules))
+	for name := range p.rules {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// activation is a rule invocation at an input position.
+type activation struct {
+	name string
+	pos  int
+}
+
+// memoEntry is the memoized result of a rule invocation.
+type memoEntry struct {
+	end   int
+	ok    bool
+	label string     // failure label thrown by a failed invocation
+	node  *parseNode // parse tree of a successful invocation, if built
+}
+
+// seed is the result of a left recursive invocation, grown at each
+// iteration.
+type seed struct {
+	memoEntry
+	detected bool // a left recursive invocation used the seed
+}
+
+// machine interprets the grammar s on an input.  Invocations of the rules
+// with the memo directive, or of all rules when memoAll is true, are
+// memoized.
+//
+// Left recursive invocations are supported by growing a seed, as described
+// by Warth et al. in "Packrat Parsers Can Support Left Recursion", unless
+// strict is true and they fail.
+//
+// A labeled failure, thrown by %{label}, skips the alternatives of the
+// enclosing choices up to the recovery expression for the label.
+//
+// A run is aborted after maxSteps evaluated expressions or when timeout
+// elapsed since its start, unless they are zero, or when ctx, if not nil, is
+// done.
+//
+// When tree is true, the parse tree of the successful rule invocations is
+// built.
+type machine struct {
+	s        *syntax
+	input    string
+	prof     *profile
+	memoAll  bool
+	memo     map[activation]memoEntry
+	strict   bool
+	maxSteps int
+	timeout  time.Duration
+	deadline time.Time // of the current run
+	ctx      context.Context
+	steps    int
+
+	seeds     map[activation]*seed // left recursion seeds in progress
+	seedReads int                  // invocations that returned a seed
+	cuts      int                  // left recursive invocations failed in strict mode
+
+	thrown string // label of the failure being propagated, if any
+
+	tree bool
+	kids []*parseNode // children of the rule invocation being matched
+
+	// Farthest position where a terminal failed to match, outside the
+	// predicates, and the terminals expected there.
+	failPos  int
+	expected []string
+	preds    int // predicates being matched
+
+	active map[activation]bool // invocations in progress
+	depths map[string]int      // nested invocations of each rule
+	depth  int
+	cur    *ruleStats // statistics of the rule being evaluated
+}
+
+func newMachine(s *syntax, input string, prof *profile) *machine {
+	return &machine{
+		s:      s,
+		input:  input,
+		prof:   prof,
+		active: make(map[activation]bool),
+		depths: make(map[string]int),
+		memo:   make(map[activation]memoEntry),
+		seeds:  make(map[activation]*seed),
+
+		failPos: -1,
+	}
+}
+
+// fail records the failure of the terminal want at pos, for the farthest
+// failure heuristic.
+func (m *machine) fail(pos int, want string) {
+	switch {
+	case m.preds > 0 || pos < m.failPos:
+		return
+	case pos > m.failPos:
+		m.failPos = pos
+		m.expected = m.expected[:0]
+	}
+	if !slices.Contains(m.expected, want) {
+		m.expected = append(m.expected, want)
+	}
+}
+
+// run matches the input against the rule start, returning the end of the
+// match.  The error is errStepLimit or errTimeout when the run exceeded its
+// budget, or errCanceled when the context was canceled.
+func (m *machine) run(start string) (end int, ok bool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if v != errStepLimit && v != errTimeout && v != errCanceled {
+				panic(v)
+			}
+			end, ok, err = 0, false, v.(error)
+		}
+	}()
+	if m.timeout > 0 {
+		m.deadline = time.Now().Add(m.timeout)
+	}
+	end, ok = m.call(start, 0)
+
+	return end, ok, nil
+}
+
+// call invokes the named rule at pos.
+func (m *machine) call(name string, pos int) (int, bool) {
+	body, ok := m.s.nodes[name]
+	if !ok {
+		return pos, false
+	}
+	key := activation{name, pos}
+	if m.active[key] {
+		if m.strict {
+			m.cuts++
+
+			return pos, false
+		}
+		sd := m.seeds[key]
+		sd.detected = true
+		m.seedReads++
+		m.addNode(sd.node)
+
+		return sd.end, sd.ok
+	}
+
+	stats := m.prof.rule(name)
+	stats.calls++
+	memoize := m.memoAll || m.s.memo[name]
+	if memoize {
+		m.prof.memoLookups++
+		if e, ok := m.memo[key]; ok {
+			m.prof.memoHits++
+			stats.memoHits++
+			m.thrown = e.label
+			m.addNode(e.node)
+
+			return e.end, e.ok
+		}
+	}
+	m.active[key] = true
+	m.depth++
+	m.depths[name]++
+	if m.depth > m.prof.maxDepth {
+		m.prof.maxDepth = m.depth
+	}
+	if d := m.depths[name]; d > stats.maxDepth {
+		stats.maxDepth = d
+	}
+	prev := m.cur
+	m.cur = stats
+	reads, cuts := m.seedReads, m.cuts
+	kids := m.kids
+	m.kids = nil
+
+	var end int
+	var node *parseNode
+	if m.strict {
+		end, ok = m.match(body, pos)
+		node = m.node(key, end, ok)
+	} else {
+		end, ok, node = m.grow(key, body)
+	}
+
+	m.kids = kids
+	m.addNode(node)
+	m.cur = prev
+	m.depths[name]--
+	m.depth--
+	delete(m.active, key)
+	// Results that depend on a seed, or on a left recursive invocation
+	// failed because another invocation was active, are not final.
+	if memoize && m.seedReads == reads && m.cuts == cuts {
+		m.memo[key] = memoEntry{end, ok, m.thrown, node}
+	}
+
+	return end, ok
+}
+
+// node returns the parse tree of the invocation key, ending at end, with the
+// children matched since the last call, or nil when the invocation failed or
+// no tree is built.
+func (m *machine) node(key activation, end int, ok bool) *parseNode {
+	kids := m.kids
+	m.kids = nil
+	if !m.tree || !ok {
+		return nil
+	}
+
+	return &parseNode{rule: key.name, start: key.pos, end: end, children: kids}
+}
+
+// addNode adds n, if not nil, to the children of the invocation being
+// matched.
+func (m *machine) addNode(n *parseNode) {
+	if n != nil {
+		m.kids = append(m.kids, n)
+	}
+}
+
+// grow matches body for the invocation key, planting a seed for left
+// recursive invocations and growing it while the match gets longer.
+func (m *machine) grow(key activation, body node) (int, bool, *parseNode) {
+	sd := &seed{memoEntry: memoEntry{end: key.pos}}
+	m.seeds[key] = sd
+	defer delete(m.seeds, key)
+
+	m.kids = nil
+	end, ok := m.match(body, key.pos)
+	node := m.node(key, end, ok)
+	if !sd.detected || !ok {
+		return end, ok, node
+	}
+	for ok && (!sd.ok || end > sd.end) {
+		sd.end, sd.ok, sd.node = end, ok, node
+		end, ok = m.match(body, key.pos)
+		node = m.node(key, end, ok)
+	}
+
+	return sd.end, sd.ok, sd.node
+}
+
+// match matches n at pos, returning the end of the match.  The parse trees
+// of a failed match are discarded.
+func (m *machine) match(n node, pos int) (int, bool) {
+	kids := len(m.kids)
+	end, ok := m.eval(n, pos)
+	if !ok {
+		m.kids = m.kids[:kids]
+	}
+
+	return end, ok
+}
+
+// checkDeadline aborts the run when the deadline passed or the context is
+// done.
+func (m *machine) checkDeadline() {
+	if !m.deadline.IsZero() && time.Now().After(m.deadline) {
+		panic(errTimeout)
+	}
+	if m.ctx == nil {
+		return
+	}
+	switch m.ctx.Err() {
+	case nil:
+	case context.DeadlineExceeded:
+		panic(errTimeout)
+	default:
+		panic(errCanceled)
+	}
+}
+
+// eval matches n at pos, as match.
+func (m *machine) eval(n node, pos int) (int, bool) {
+	m.prof.steps++
+	m.steps++
+	if m.maxSteps > 0 && m.steps > m.maxSteps {
+		panic(errStepLimit)
+	}
+	if m.steps%deadlineInterval == 0 {
+		m.checkDeadline()
+	}
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			if end, ok := m.match(alt, pos); ok {
+				return end, true
+			}
+			if m.thrown != "" {
+				// A labeled failure is not handled by the choice.
+				return pos, false
+			}
+			m.cur.backtracks++
+		}
+
+		return pos, false
+	case *seqNode:
+		end := pos
+		for _, item := range n.items {
+			var ok bool
+			if end, ok = m.match(item, end); !ok {
+				return pos, false
+			}
+		}
+
+		return end, true
+	case *predNode:
+		kids := len(m.kids)
+		m.preds++
+		_, ok := m.match(n.expr, pos)
+		m.preds--
+		m.kids = m.kids[:kids]
+		if m.thrown != "" {
+			return pos, false
+		}
+		if n.op == '!' {
+			ok = !ok
+		}
+
+		return pos, ok
+	case *repeatNode:
+		min, max := n.bounds()
+		if max >= 0 && max < min {
+			return pos, false
+		}
+		start := pos
+		for count := 0; max < 0 || count < max; count++ {
+			end, ok := m.match(n.expr, pos)
+			if !ok {
+				if count < min || m.thrown != "" {
+					return start, false
+				}
+
+				return pos, true
+			}
+			// Stop when an iteration does not consume input.
+			if end == pos && count >= min {
+				return end, true
+			}
+			pos = end
+		}
+
+		return pos, true
+	case *recoveryNode:
+		if end, ok := m.match(n.expr, pos); ok || !slices.Contains(n.labels, m.thrown) {
+			return end, ok
+		}
+		m.thrown = ""
+
+		return m.match(n.recover, pos)
+	case *throwNode:
+		m.thrown = n.label
+
+		return pos, false
+	case *stateNode:
+		// The code is not run.
+		return pos, true
+	case *refNode:
+		return m.call(n.name, pos)
+	case *litNode:
+		if strings.HasPrefix(m.input[pos:], n.value) {
+			return pos + len(n.value), true
+		}
+		m.fail(pos, n.text)
+	case *classNode:
+		r, size := utf8.DecodeRuneInString(m.input[pos:])
+		if size > 0 && n.set.contains(r) {
+			return pos + size, true
+		}
+		m.fail(pos, n.text)
+	case *anyNode:
+		if _, size := utf8.DecodeRuneInString(m.input[pos:]); size > 0 {
+			return pos + size, true
+		}
+		m.fail(pos, "any character")
+	}
+
+	return pos, false
+}
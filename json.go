@@ -0,0 +1,678 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSON schema of the report.  The major version of jsonVersion changes only
+// when a change to the report is not backward compatible.
+const (
+	jsonVersion   = "1.0"
+	jsonSchemaURL = "https://github.com/perillo/pegcmp/raw/master/schema/v1.json"
+)
+
+//go:embed schema/v1.json
+var jsonSchema []byte
+
+// jsonReport is the JSON representation of a report.
+type jsonReport struct {
+	Schema   string        `json:"$schema"`
+	Version  string        `json:"version"`
+	LHS      string        `json:"lhs"`
+	RHS      string        `json:"rhs"`
+	Rules    []jsonRule    `json:"rules"`
+	Findings []jsonFinding `json:"findings"`
+	Corpus   *jsonCorpus   `json:"corpus,omitempty"`
+
+	// Terminals used by only one grammar.
+	Terminals *jsonTerminals `json:"terminals,omitempty"`
+
+	// Probable keywords used by only one grammar.
+	Keywords *jsonKeywords `json:"keywords,omitempty"`
+
+	// Operator precedence differences.
+	Precedence *jsonPrecedence `json:"precedence,omitempty"`
+
+	// Problems of the lhs reference grammar.
+	LHSIssues []jsonFinding `json:"lhs_issues,omitempty"`
+
+	// Rules matched with a lhs rule with a different name.
+	Renamed []jsonRename `json:"renamed,omitempty"`
+
+	// Rule tests passing in only one grammar.
+	RuleTests []jsonRuleTest `json:"rule_tests,omitempty"`
+
+	// Rules whose properties changed.
+	Properties []jsonPropChange `json:"properties,omitempty"`
+
+	// Rules whose match length bounds changed.
+	Lengths []jsonLengthChange `json:"lengths,omitempty"`
+
+	// Recursion groups of the grammars and their changes.
+	Recursion *jsonRecursion `json:"recursion,omitempty"`
+
+	// Rules whose depth grew.
+	Depths []jsonDepthChange `json:"depths,omitempty"`
+
+	// Equivalence of the grammars combining all the analyses.
+	Verdict *jsonVerdict `json:"verdict,omitempty"`
+}
+
+// jsonRuleTest is the JSON representation of a rule test passing in only one
+// grammar.
+type jsonRuleTest struct {
+	Rule    string `json:"rule"`
+	Accept  bool   `json:"accept"`
+	Input   string `json:"input"`
+	Pos     Pos    `json:"pos"`
+	LHSPass bool   `json:"lhs_pass"`
+	LHS     string `json:"lhs"`
+	RHS     string `json:"rhs"`
+}
+
+// jsonRuleProps is the JSON representation of the properties of a rule.
+// The maximum length is -1 when unbounded, and the lengths are null when the
+// rule never succeeds.
+type jsonRuleProps struct {
+	Min       *int `json:"min"`
+	Max       *int `json:"max"`
+	Nullable  bool `json:"nullable"`
+	EmptyOnly bool `json:"empty_only"`
+	Recursive bool `json:"recursive"`
+	Token     bool `json:"token"`
+}
+
+func newJSONRuleProps(p ruleProps) jsonRuleProps {
+	props := jsonRuleProps{
+		Nullable:  p.nullable(),
+		EmptyOnly: p.emptyOnly(),
+		Recursive: p.recursive,
+		Token:     p.lexical,
+	}
+	if p.min != never {
+		props.Min, props.Max = &p.min, &p.max
+	}
+
+	return props
+}
+
+// jsonPropChange is the JSON representation of a rule whose properties
+// changed.
+type jsonPropChange struct {
+	Rule string        `json:"rule"`
+	LHS  jsonRuleProps `json:"lhs"`
+	RHS  jsonRuleProps `json:"rhs"`
+}
+
+// jsonLengthBounds is the JSON representation of the match length bounds of
+// a rule, null when the rule never succeeds, with the maximum -1 when
+// unbounded.
+type jsonLengthBounds struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func newJSONLengthBounds(b lengthBounds) *jsonLengthBounds {
+	if b.min == never {
+		return nil
+	}
+
+	return &jsonLengthBounds{b.min, b.max}
+}
+
+// jsonLengthChange is the JSON representation of a rule whose match length
+// bounds changed.
+type jsonLengthChange struct {
+	Rule  string            `json:"rule"`
+	LHS   *jsonLengthBounds `json:"lhs"`
+	RHS   *jsonLengthBounds `json:"rhs"`
+	Notes []string          `json:"notes,omitempty"`
+}
+
+// jsonRecursion is the JSON representation of the recursion groups of the
+// grammars and their changes.
+type jsonRecursion struct {
+	LHS     [][]string            `json:"lhs"`
+	RHS     [][]string            `json:"rhs"`
+	Changes []jsonRecursionChange `json:"changes"`
+}
+
+type jsonRecursionChange struct {
+	Kind  string     `json:"kind"`
+	LHS   [][]string `json:"lhs"`
+	RHS   [][]string `json:"rhs"`
+	Notes []string   `json:"notes,omitempty"`
+}
+
+// jsonRuleDepth is the JSON representation of the depth of a rule, with the
+// number of rules of its recursion group, 0 if not recursive.
+type jsonRuleDepth struct {
+	Depth     int `json:"depth"`
+	Recursive int `json:"recursive"`
+}
+
+type jsonDepthChange struct {
+	Rule  string        `json:"rule"`
+	LHS   jsonRuleDepth `json:"lhs"`
+	RHS   jsonRuleDepth `json:"rhs"`
+	Notes []string      `json:"notes,omitempty"`
+}
+
+// jsonVerdict is the JSON representation of a verdict.
+type jsonVerdict struct {
+	Equivalent bool     `json:"equivalent"`
+	Confidence string   `json:"confidence,omitempty"`
+	Evidence   []string `json:"evidence,omitempty"`
+	Summary    string   `json:"summary"`
+}
+
+// jsonRename is the JSON representation of a rhs rule matched with a lhs
+// rule with a different name.
+type jsonRename struct {
+	LHS string `json:"lhs"`
+	RHS string `json:"rhs"`
+}
+
+// jsonTerminals is the JSON representation of the terminals used by only one
+// grammar.  The code points are ranges of two elements.
+type jsonTerminals struct {
+	LHSOnly       []string `json:"lhs_only"`
+	RHSOnly       []string `json:"rhs_only"`
+	LHSCodePoints [][2]int `json:"lhs_code_points"`
+	RHSCodePoints [][2]int `json:"rhs_code_points"`
+}
+
+// jsonCodePoints returns the ranges of set.
+func jsonCodePoints(set runeSet) [][2]int {
+	list := [][2]int{}
+	for _, r := range set {
+		list = append(list, [2]int{int(r.lo), int(r.hi)})
+	}
+
+	return list
+}
+
+// jsonKeywords is the JSON representation of the keywords used by only one
+// grammar.
+type jsonKeywords struct {
+	Removed []jsonKeyword `json:"removed"`
+	Added   []jsonKeyword `json:"added"`
+}
+
+// jsonKeyword is the JSON representation of a keyword.
+type jsonKeyword struct {
+	Keyword string   `json:"keyword"`
+	Rules   []string `json:"rules"`
+}
+
+// jsonKeywordList returns the JSON representation of list.
+func jsonKeywordList(list []keyword) []jsonKeyword {
+	out := []jsonKeyword{}
+	for _, kw := range list {
+		out = append(out, jsonKeyword{kw.name, kw.rules})
+	}
+
+	return out
+}
+
+// jsonPrecedence is the JSON representation of the operator precedence
+// differences, with the precedence ladders of each grammar from the lowest
+// level.
+type jsonPrecedence struct {
+	Changes    []string          `json:"changes"`
+	LHSLadders [][]jsonPrecLevel `json:"lhs_ladders"`
+	RHSLadders [][]jsonPrecLevel `json:"rhs_ladders"`
+}
+
+// jsonPrecLevel is the JSON representation of a precedence level.
+type jsonPrecLevel struct {
+	Rule      string   `json:"rule"`
+	Operators []string `json:"operators"`
+	Assoc     string   `json:"assoc"`
+}
+
+// jsonLadders returns the JSON representation of the ladders.
+func jsonLadders(ladders [][]*precLevel) [][]jsonPrecLevel {
+	list := [][]jsonPrecLevel{}
+	for _, ladder := range ladders {
+		levels := []jsonPrecLevel{}
+		for _, l := range ladder {
+			assoc := "left"
+			if l.right {
+				assoc = "right"
+			}
+			levels = append(levels, jsonPrecLevel{l.rule, l.ops, assoc})
+		}
+		list = append(list, levels)
+	}
+
+	return list
+}
+
+// jsonCorpus is the JSON representation of a corpus comparison.
+type jsonCorpus struct {
+	Inputs      int              `json:"inputs"`
+	LHSMemo     jsonMemo         `json:"lhs_memo"`
+	RHSMemo     jsonMemo         `json:"rhs_memo"`
+	Differences []jsonInputDiff  `json:"differences"`
+	OverBudget  []jsonOverBudget `json:"over_budget"`
+	Regressions []jsonRegression `json:"regressions"`
+
+	// Inputs where the error position of the rhs grammar regressed.
+	ErrorRegressions []jsonErrorRegression `json:"error_regressions"`
+}
+
+// jsonErrorRegression is the JSON representation of an input where the error
+// position of the rhs grammar regressed.
+type jsonErrorRegression struct {
+	Path string      `json:"path"`
+	LHS  jsonFailure `json:"lhs"`
+	RHS  jsonFailure `json:"rhs"`
+}
+
+// jsonFailure is the JSON representation of the farthest failure on an
+// input.
+type jsonFailure struct {
+	Offset   int      `json:"offset"`
+	Line     int      `json:"line"`
+	Col      int      `json:"col"`
+	Expected []string `json:"expected"`
+}
+
+// newJSONFailure returns the JSON representation of f.
+func newJSONFailure(f failure) jsonFailure {
+	expected := f.expected
+	if expected == nil {
+		expected = []string{}
+	}
+
+	return jsonFailure{f.offset, f.line, f.col, expected}
+}
+
+// jsonOverBudget is the JSON representation of an input where a run exceeded
+// its budget.  The error of a completed run is empty.
+type jsonOverBudget struct {
+	Path string `json:"path"`
+	LHS  string `json:"lhs,omitempty"`
+	RHS  string `json:"rhs,omitempty"`
+}
+
+// jsonMemo is the JSON representation of the memoization cache statistics.
+type jsonMemo struct {
+	Hits    int `json:"hits"`
+	Lookups int `json:"lookups"`
+}
+
+// jsonInputDiff is the JSON representation of an input where the grammars
+// disagree.
+type jsonInputDiff struct {
+	Path    string        `json:"path"`
+	LHS     jsonOutcome   `json:"lhs"`
+	RHS     jsonOutcome   `json:"rhs"`
+	Minimal *jsonMinInput `json:"minimal,omitempty"`
+}
+
+// jsonMinInput is the JSON representation of the minimal input where the
+// grammars disagree.
+type jsonMinInput struct {
+	Input string      `json:"input"`
+	LHS   jsonOutcome `json:"lhs"`
+	RHS   jsonOutcome `json:"rhs"`
+}
+
+// jsonOutcome is the JSON representation of the result of matching an input.
+type jsonOutcome struct {
+	Accepted bool `json:"accepted"`
+	Matched  bool `json:"matched"`
+	End      int  `json:"end"`
+}
+
+// jsonRegression is the JSON representation of a rule cost regression.
+type jsonRegression struct {
+	Rule string    `json:"rule"`
+	LHS  jsonStats `json:"lhs"`
+	RHS  jsonStats `json:"rhs"`
+}
+
+// jsonStats is the JSON representation of the profile of a rule.
+type jsonStats struct {
+	Calls      int `json:"calls"`
+	Backtracks int `json:"backtracks"`
+	MaxDepth   int `json:"max_depth"`
+	MemoHits   int `json:"memo_hits"`
+}
+
+// jsonFinding is the JSON representation of an analysis finding introduced
+// by rhs.
+type jsonFinding struct {
+	Analyzer string `json:"analyzer"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Pos      Pos    `json:"pos"`
+	Message  string `json:"message"`
+}
+
+// jsonRule is the JSON representation of a rule change.
+type jsonRule struct {
+	Name         string            `json:"name"`
+	Status       string            `json:"status"`
+	Moved        bool              `json:"moved,omitempty"`
+	CopyOf       string            `json:"copy_of,omitempty"`
+	LHS          *jsonDef          `json:"lhs,omitempty"`
+	RHS          *jsonDef          `json:"rhs,omitempty"`
+	Alternatives []jsonAlternative `json:"alternatives,omitempty"`
+	Classes      []jsonClass       `json:"classes,omitempty"`
+	Literals     []jsonLiteral     `json:"literals,omitempty"`
+	Bounds       []jsonBound       `json:"bounds,omitempty"`
+	Blame        *jsonBlame        `json:"blame,omitempty"`
+	Affects      []string          `json:"affects,omitempty"`
+	Class        string            `json:"class,omitempty"`
+}
+
+// jsonBlame is the JSON representation of the commit that last changed a
+// rule.
+type jsonBlame struct {
+	Commit  string    `json:"commit"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// jsonDef is the JSON representation of a rule definition, with the byte
+// ranges in the grammar file of the parts of the expression changed by a
+// modified rule.
+type jsonDef struct {
+	Expr    string      `json:"expr"`
+	Pos     Pos         `json:"pos"`
+	Changed []jsonRange `json:"changed,omitempty"`
+}
+
+// jsonRange is the JSON representation of a byte range, comparable with the
+// offset of a position, with the line and column of its start.
+type jsonRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Line  int `json:"line"`
+	Col   int `json:"col"`
+}
+
+// newJSONRanges returns the JSON representation of the ranges of rule.
+func newJSONRanges(rule *Rule, ranges []byteRange) []jsonRange {
+	var list []jsonRange
+	for _, r := range ranges {
+		p := offsetPos(rule, r.pos)
+		list = append(list, jsonRange{r.pos, r.end, p.Line, p.Col})
+	}
+
+	return list
+}
+
+// jsonAlternative is the JSON representation of an alternative change.
+// Indices are 1 based.
+type jsonAlternative struct {
+	Status   string `json:"status"`
+	Moved    bool   `json:"moved,omitempty"`
+	LHSIndex int    `json:"lhs_index,omitempty"`
+	RHSIndex int    `json:"rhs_index,omitempty"`
+	LHS      string `json:"lhs,omitempty"`
+	RHS      string `json:"rhs,omitempty"`
+}
+
+// jsonClass is the JSON representation of a character class change.
+// Relation is the relation of the rhs class to the lhs class.
+type jsonClass struct {
+	LHS      string   `json:"lhs"`
+	RHS      string   `json:"rhs"`
+	Relation string   `json:"relation"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// jsonLiteral is the JSON representation of two canonically equivalent
+// literals.
+type jsonLiteral struct {
+	LHS     string `json:"lhs"`
+	RHS     string `json:"rhs"`
+	LHSForm string `json:"lhs_form"`
+	RHSForm string `json:"rhs_form"`
+}
+
+// jsonBound is the JSON representation of a repetition that only changed
+// its bounds.
+type jsonBound struct {
+	LHS      string `json:"lhs"`
+	RHS      string `json:"rhs"`
+	Relation string `json:"relation"`
+}
+
+// jsonRanges returns the ranges of s in PEG character class syntax.
+func jsonRanges(s runeSet) []string {
+	var list []string
+	for _, r := range s {
+		list = append(list, runeSet{r}.String())
+	}
+
+	return list
+}
+
+var statusNames = [...]string{
+	ruleEqual:    "equal",
+	ruleModified: "modified",
+	ruleAdded:    "added",
+	ruleRemoved:  "removed",
+}
+
+// newJSONRule returns the JSON representation of the rule change c.
+func newJSONRule(c change) jsonRule {
+	rule := jsonRule{
+		Status: statusNames[c.kind],
+		Moved:  c.moved,
+	}
+	if c.lhs != nil {
+		rule.Name = c.lhs.Name
+		rule.LHS = &jsonDef{Expr: c.lhs.Expr, Pos: c.lhs.Pos}
+	}
+	if c.rhs != nil {
+		rule.Name = c.rhs.Name
+		rule.RHS = &jsonDef{Expr: c.rhs.Expr, Pos: c.rhs.Pos}
+	}
+	if c.kind == ruleModified {
+		lranges, rranges := sourceRanges(c.lhs, c.rhs)
+		rule.LHS.Changed, rule.RHS.Changed = newJSONRanges(c.lhs, lranges), newJSONRanges(c.rhs, rranges)
+	}
+	if c.copyOf != nil {
+		rule.CopyOf = c.copyOf.Name
+	}
+	for _, a := range c.alts {
+		rule.Alternatives = append(rule.Alternatives, jsonAlternative{
+			Status:   statusNames[a.kind],
+			Moved:    a.moved,
+			LHSIndex: a.li,
+			RHSIndex: a.ri,
+			LHS:      a.lhs,
+			RHS:      a.rhs,
+		})
+	}
+	for _, cc := range c.classes {
+		rule.Classes = append(rule.Classes, jsonClass{
+			LHS:      cc.lhs,
+			RHS:      cc.rhs,
+			Relation: cc.relation(),
+			Added:    jsonRanges(cc.added),
+			Removed:  jsonRanges(cc.removed),
+		})
+	}
+	for _, l := range c.literals {
+		rule.Literals = append(rule.Literals, jsonLiteral{
+			LHS:     l.lhs,
+			RHS:     l.rhs,
+			LHSForm: formName(l.lhs),
+			RHSForm: formName(l.rhs),
+		})
+	}
+	for _, b := range c.bounds {
+		rule.Bounds = append(rule.Bounds, jsonBound{
+			LHS:      b.lhs,
+			RHS:      b.rhs,
+			Relation: b.relation(),
+		})
+	}
+
+	return rule
+}
+
+// newJSONFinding returns the JSON representation of f.
+func newJSONFinding(f finding) jsonFinding {
+	return jsonFinding{
+		Analyzer: f.analyzer,
+		Severity: f.severity.String(),
+		Rule:     f.rule.Name,
+		Pos:      f.rule.Pos,
+		Message:  f.msg,
+	}
+}
+
+// formatJSON writes the changed rules as a JSON document.
+func formatJSON(w io.Writer, r *report) error {
+	doc := jsonReport{
+		Schema:   jsonSchemaURL,
+		Version:  jsonVersion,
+		LHS:      r.lpath,
+		RHS:      r.rpath,
+		Rules:    []jsonRule{},
+		Findings: []jsonFinding{},
+	}
+	for _, c := range r.changes {
+		if c.kind == ruleEqual && !c.moved {
+			continue
+		}
+		rule := newJSONRule(c)
+		rule.Affects = r.impact[c.rhs]
+		if r.lexical != nil {
+			rule.Class = "syntactic"
+			if r.isLexical(c) {
+				rule.Class = "lexical"
+			}
+		}
+		if b := r.blame[c.rhs]; b != nil {
+			rule.Blame = &jsonBlame{b.hash, b.author, b.date, b.subject}
+		}
+		doc.Rules = append(doc.Rules, rule)
+	}
+	for _, d := range r.ruleTests {
+		t := d.test
+		doc.RuleTests = append(doc.RuleTests, jsonRuleTest{t.rule.Name, t.accept, t.input, t.rule.Pos, d.lhsPass, d.lhs, d.rhs})
+	}
+	for _, c := range r.properties {
+		doc.Properties = append(doc.Properties, jsonPropChange{c.name, newJSONRuleProps(c.lhs), newJSONRuleProps(c.rhs)})
+	}
+	for _, c := range r.lengths {
+		doc.Lengths = append(doc.Lengths, jsonLengthChange{c.name, newJSONLengthBounds(c.lhs), newJSONLengthBounds(c.rhs), c.notes()})
+	}
+	if d := r.recursion; d != nil {
+		groups := func(list [][]string) [][]string {
+			if list == nil {
+				return [][]string{}
+			}
+
+			return list
+		}
+		doc.Recursion = &jsonRecursion{groups(d.lhs), groups(d.rhs), []jsonRecursionChange{}}
+		for _, c := range d.changes {
+			doc.Recursion.Changes = append(doc.Recursion.Changes, jsonRecursionChange{c.kind, groups(c.lhs), groups(c.rhs), c.notes()})
+		}
+	}
+	for _, c := range r.depths {
+		doc.Depths = append(doc.Depths, jsonDepthChange{c.name,
+			jsonRuleDepth{c.lhs.depth, c.lhs.group}, jsonRuleDepth{c.rhs.depth, c.rhs.group}, c.notes()})
+	}
+	if r.equiv != nil {
+		v := newVerdict(r)
+		doc.Verdict = &jsonVerdict{v.equivalent, v.confidence, v.evidence, v.String()}
+	}
+	for _, c := range renamed(r.changes) {
+		doc.Renamed = append(doc.Renamed, jsonRename{c.lhs.Name, c.rhs.Name})
+	}
+	for _, f := range r.findings {
+		doc.Findings = append(doc.Findings, newJSONFinding(f))
+	}
+	if d := r.terminals; d != nil {
+		doc.Terminals = &jsonTerminals{
+			LHSOnly:       append([]string{}, d.lhsOnly...),
+			RHSOnly:       append([]string{}, d.rhsOnly...),
+			LHSCodePoints: jsonCodePoints(d.lhsPoints),
+			RHSCodePoints: jsonCodePoints(d.rhsPoints),
+		}
+	}
+	if d := r.keywords; d != nil {
+		doc.Keywords = &jsonKeywords{jsonKeywordList(d.removed), jsonKeywordList(d.added)}
+	}
+	if d := r.precedence; d != nil {
+		doc.Precedence = &jsonPrecedence{d.changes, jsonLadders(d.lhs.ladders), jsonLadders(d.rhs.ladders)}
+	}
+	for _, f := range r.lhsIssues {
+		doc.LHSIssues = append(doc.LHSIssues, newJSONFinding(f))
+	}
+
+	if res := r.corpus; res != nil {
+		doc.Corpus = &jsonCorpus{
+			Inputs:      res.inputs,
+			LHSMemo:     jsonMemo{res.lprof.memoHits, res.lprof.memoLookups},
+			RHSMemo:     jsonMemo{res.rprof.memoHits, res.rprof.memoLookups},
+			Differences: []jsonInputDiff{},
+			OverBudget:  []jsonOverBudget{},
+			Regressions: []jsonRegression{},
+
+			ErrorRegressions: []jsonErrorRegression{},
+		}
+		for _, d := range res.diffs {
+			diff := jsonInputDiff{
+				Path: d.path,
+				LHS:  jsonOutcome{d.lhs.accepted(), d.lhs.ok, d.lhs.end},
+				RHS:  jsonOutcome{d.rhs.accepted(), d.rhs.ok, d.rhs.end},
+			}
+			if m := d.minimal; m != nil {
+				diff.Minimal = &jsonMinInput{
+					Input: m.input,
+					LHS:   jsonOutcome{m.lhs.accepted(), m.lhs.ok, m.lhs.end},
+					RHS:   jsonOutcome{m.rhs.accepted(), m.rhs.ok, m.rhs.end},
+				}
+			}
+			doc.Corpus.Differences = append(doc.Corpus.Differences, diff)
+		}
+		for _, b := range res.overBudget {
+			ob := jsonOverBudget{Path: b.path}
+			if b.lhs != nil {
+				ob.LHS = b.lhs.Error()
+			}
+			if b.rhs != nil {
+				ob.RHS = b.rhs.Error()
+			}
+			doc.Corpus.OverBudget = append(doc.Corpus.OverBudget, ob)
+		}
+		for _, reg := range res.errors {
+			doc.Corpus.ErrorRegressions = append(doc.Corpus.ErrorRegressions, jsonErrorRegression{
+				reg.path, newJSONFailure(reg.lhs), newJSONFailure(reg.rhs),
+			})
+		}
+		for _, reg := range res.regressions {
+			doc.Corpus.Regressions = append(doc.Corpus.Regressions, jsonRegression{
+				Rule: reg.name,
+				LHS:  jsonStats{reg.lhs.calls, reg.lhs.backtracks, reg.lhs.maxDepth, reg.lhs.memoHits},
+				RHS:  jsonStats{reg.rhs.calls, reg.rhs.backtracks, reg.rhs.maxDepth, reg.rhs.memoHits},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(doc)
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyword is a probable keyword of a grammar, with the rules using it.
+type keyword struct {
+	name  string
+	rules []string
+}
+
+// keywordDiff is the difference between the keywords of two grammars.
+type keywordDiff struct {
+	removed []keyword // only in lhs, with the lhs rules
+	added   []keyword // only in rhs, with the rhs rules
+}
+
+// isKeyword reports whether the literal value s is a probable keyword: at
+// least two letters and nothing else.
+func isKeyword(s string) bool {
+	if utf8.RuneCountInString(s) < 2 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keywords returns the probable keywords of s, sorted, with the rules using
+// each of them in rule order.
+func keywords(s *syntax) []keyword {
+	index := make(map[string]int)
+	var list []keyword
+	for i := range s.rules {
+		rule := &s.rules[i]
+		n, ok := s.nodes[rule.Name]
+		if !ok {
+			continue
+		}
+		walk(n, func(n node) {
+			lit, ok := n.(*litNode)
+			if !ok || !isKeyword(lit.value) {
+				return
+			}
+			j, ok := index[lit.value]
+			if !ok {
+				j = len(list)
+				index[lit.value] = j
+				list = append(list, keyword{name: lit.value})
+			}
+			if rules := list[j].rules; len(rules) == 0 || rules[len(rules)-1] != rule.Name {
+				list[j].rules = append(rules, rule.Name)
+			}
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+
+	return list
+}
+
+// keywordsMinus returns the keywords in a that are not in b.
+func keywordsMinus(a, b []keyword) []keyword {
+	seen := make(map[string]bool)
+	for _, kw := range b {
+		seen[kw.name] = true
+	}
+	var list []keyword
+	for _, kw := range a {
+		if !seen[kw.name] {
+			list = append(list, kw)
+		}
+	}
+
+	return list
+}
+
+// diffKeywords returns the probable keywords used by only one of lgrammar
+// and rgrammar, or nil when they use the same keywords.
+func diffKeywords(lgrammar, rgrammar []Rule) *keywordDiff {
+	lkeywords := keywords(newSyntax(lgrammar))
+	rkeywords := keywords(newSyntax(rgrammar))
+	d := &keywordDiff{
+		removed: keywordsMinus(lkeywords, rkeywords),
+		added:   keywordsMinus(rkeywords, lkeywords),
+	}
+	if len(d.removed) == 0 && len(d.added) == 0 {
+		return nil
+	}
+
+	return d
+}
+
+// writeKeywords writes the keywords removed and added, with the rules using
+// them.
+func writeKeywords(w io.Writer, d *keywordDiff) {
+	for _, kw := range d.removed {
+		fmt.Fprintf(w, "- keyword %q removed, used by %s\n", kw.name, strings.Join(kw.rules, ", "))
+	}
+	for _, kw := range d.added {
+		fmt.Fprintf(w, "+ keyword %q added, used by %s\n", kw.name, strings.Join(kw.rules, ", "))
+	}
+	fmt.Fprintln(w)
+}
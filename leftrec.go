@@ -0,0 +1,211 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// leftRecursionAnalyzer reports left recursive rules, which loop forever in
+// PEG implementations without support for left recursion.
+var leftRecursionAnalyzer = &analyzer{
+	name: "left-recursion",
+	run:  runLeftRecursion,
+}
+
+func runLeftRecursion(s *syntax) []finding {
+	var list []finding
+	graph := newLeftGraph(s)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		path := graph.path(rule.Name, rule.Name)
+		if path == nil {
+			continue
+		}
+		list = append(list, finding{
+			severity: severityWarning,
+			rule:     rule,
+			msg:      "rule is left recursive: " + strings.Join(path, " -> "),
+		})
+	}
+
+	return list
+}
+
+// newLeftGraph returns the graph of the rules that each rule of s may invoke
+// at the start of its input, in order of first reference.
+func newLeftGraph(s *syntax) refGraph {
+	p := newProps(s)
+	g := make(refGraph)
+	for name, n := range s.nodes {
+		seen := make(map[string]bool)
+		for _, ref := range leftRefs(p, n) {
+			if !seen[ref] {
+				seen[ref] = true
+				g[name] = append(g[name], ref)
+			}
+		}
+	}
+
+	return g
+}
+
+// leftRefs returns the names of the rules that n may invoke at the start of
+// its input.
+func leftRefs(p *props, n node) []string {
+	var list []string
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			list = append(list, leftRefs(p, alt)...)
+		}
+	case *seqNode:
+		for _, item := range n.items {
+			list = append(list, leftRefs(p, item)...)
+			if !p.nullable(item) {
+				break
+			}
+		}
+	case *predNode:
+		list = leftRefs(p, n.expr)
+	case *repeatNode:
+		list = leftRefs(p, n.expr)
+	case *recoveryNode:
+		list = append(leftRefs(p, n.expr), leftRefs(p, n.recover)...)
+	case *refNode:
+		list = []string{n.name}
+	}
+
+	return list
+}
+
+// eliminateLeftRecursion returns the expression n of the rule name with the
+// alternatives that start with a reference to the rule replaced by a
+// repetition, as in
+//
+//	E <- E "+" T / E "-" T / T  =>  E <- T ("+" T / "-" T)*
+//
+// The result is false when no alternative starts with a reference to the
+// rule, or when all of them do.
+func eliminateLeftRecursion(name string, n node) (node, bool) {
+	alts := []node{n}
+	if choice, ok := n.(*choiceNode); ok {
+		alts = choice.alts
+	}
+	var base, tails []node
+	for _, alt := range alts {
+		list := items(alt)
+		if len(list) == 0 {
+			base = append(base, alt)
+
+			continue
+		}
+		if ref, ok := list[0].(*refNode); ok && ref.name == name {
+			// An alternative with only the reference never matches.
+			if len(list) > 1 {
+				tails = append(tails, newSeq(list[1:]))
+			}
+
+			continue
+		}
+		base = append(base, alt)
+	}
+	if len(base) == len(alts) || len(base) == 0 {
+		return n, false
+	}
+	if len(tails) == 0 {
+		return newChoice(base), true
+	}
+	loop := &repeatNode{op: '*', expr: newChoice(tails)}
+	if len(base) == 1 {
+		return newSeq(append(slices.Clone(items(base[0])), loop)), true
+	}
+
+	return &seqNode{items: []node{newChoice(base), loop}}, true
+}
+
+// eliminateRule returns the expression n of the rule name with the left
+// recursion eliminated.  The result is false when the rule is still left
+// recursive, directly or through other rules.
+func eliminateRule(p *props, graph refGraph, name string, n node) (node, bool) {
+	expr, ok := eliminateLeftRecursion(name, n)
+	if !ok {
+		return n, false
+	}
+	for _, ref := range leftRefs(p, expr) {
+		if ref == name || graph.path(ref, name) != nil {
+			return n, false
+		}
+	}
+
+	return expr, true
+}
+
+// leftRecursionSource returns the edits of src that eliminate the direct
+// left recursion of each rule, reporting the transformed rules and the left
+// recursive rules that cannot be transformed on stderr.
+func leftRecursionSource(src *source) ([]sourceEdit, error) {
+	s := newSyntax(src.grammar())
+	p := newProps(s)
+	graph := newLeftGraph(s)
+
+	var edits []sourceEdit
+	for _, sr := range src.rules {
+		rule := sr.rule
+		path := graph.path(rule.Name, rule.Name)
+		if path == nil {
+			continue
+		}
+		n, err := src.parseExpr(sr)
+		if err != nil {
+			return nil, err
+		}
+		if expr, ok := eliminateRule(p, graph, rule.Name, n); ok {
+			edits = append(edits, sourceEdit{sr.expr, sr.exprEnd, exprString(expr)})
+			fmt.Fprintf(os.Stderr, "%s: rule %q: left recursion eliminated\n", rule.Pos, rule.Name)
+
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: rule %q: left recursion not eliminated: %s\n",
+			rule.Pos, rule.Name, strings.Join(path, " -> "))
+	}
+
+	return edits, nil
+}
+
+// eliminateLeftRecursionRules returns a copy of grammar with the direct left
+// recursion of the rule expressions eliminated, in canonical form.  The left
+// recursive rules that cannot be transformed are logged.
+func eliminateLeftRecursionRules(grammar []Rule) []Rule {
+	s := newSyntax(grammar)
+	p := newProps(s)
+	graph := newLeftGraph(s)
+
+	list := make([]Rule, len(grammar))
+	for i, rule := range grammar {
+		list[i] = rule
+		path := graph.path(rule.Name, rule.Name)
+		if path == nil {
+			continue
+		}
+		n, err := parseExpr(rule.Expr)
+		if err != nil {
+			continue
+		}
+		if expr, ok := eliminateRule(p, graph, rule.Name, n); ok {
+			list[i].Expr = exprString(expr)
+			slog.Info("eliminated left recursion", "rule", rule.Name, "pos", rule.Pos)
+
+			continue
+		}
+		slog.Warn("left recursion not eliminated", "rule", rule.Name, "path", strings.Join(path, " -> "))
+	}
+
+	return list
+}
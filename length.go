@@ -0,0 +1,94 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// lengthBounds are the minimum and maximum match lengths of a rule.
+type lengthBounds struct {
+	min, max int
+}
+
+func (b lengthBounds) String() string {
+	if b.min == never {
+		return "never succeeds"
+	}
+
+	return fmt.Sprintf("min %s, max %s", lengthString(b.min), lengthString(b.max))
+}
+
+// lengthChange is a rule defined in both grammars whose match length bounds
+// changed.
+type lengthChange struct {
+	name     string
+	lhs, rhs lengthBounds
+}
+
+// notes returns the notable consequences of the change.
+func (c lengthChange) notes() []string {
+	var list []string
+	switch {
+	case c.lhs.min == never && c.rhs.min != never:
+		list = append(list, "now succeeds")
+	case c.lhs.min != never && c.rhs.min == never:
+		list = append(list, "no longer succeeds")
+	case c.lhs.min > 0 && c.rhs.min == 0:
+		list = append(list, "now matches the empty string")
+	case c.lhs.min == 0 && c.rhs.min > 0:
+		list = append(list, "no longer matches the empty string")
+	}
+	if c.lhs.min == never || c.rhs.min == never {
+		return list
+	}
+	switch {
+	case c.lhs.max != unbounded && c.rhs.max == unbounded:
+		list = append(list, "now matches inputs of any length")
+	case c.lhs.max == unbounded && c.rhs.max != unbounded:
+		list = append(list, fmt.Sprintf("now matches at most %d characters", c.rhs.max))
+	}
+
+	return list
+}
+
+// diffLengths returns the rules of rgrammar, in order, whose match length
+// bounds differ from the lhs rule with the same name.
+func diffLengths(lgrammar, rgrammar []Rule) []lengthChange {
+	ll := newLengths(newSyntax(lgrammar))
+	rs := newSyntax(rgrammar)
+	rl := newLengths(rs)
+	var list []lengthChange
+	seen := make(map[string]bool)
+	for _, rule := range rs.rules {
+		lmin, lok := ll.min[rule.Name]
+		rmin, rok := rl.min[rule.Name]
+		if !lok || !rok || seen[rule.Name] {
+			continue
+		}
+		seen[rule.Name] = true
+		lb := lengthBounds{lmin, ll.max[rule.Name]}
+		rb := lengthBounds{rmin, rl.max[rule.Name]}
+		if lb != rb {
+			list = append(list, lengthChange{rule.Name, lb, rb})
+		}
+	}
+
+	return list
+}
+
+// writeLengths writes the rules whose match length bounds changed.
+func writeLengths(w io.Writer, list []lengthChange) {
+	for _, c := range list {
+		fmt.Fprintf(w, "! rule %q match length changed\n", c.name)
+		fmt.Fprintf(w, "> %s\n", c.rhs)
+		fmt.Fprintf(w, "< %s\n", c.lhs)
+		for _, note := range c.notes() {
+			fmt.Fprintf(w, "~ %s\n", note)
+		}
+		fmt.Fprintln(w)
+	}
+}
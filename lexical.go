@@ -0,0 +1,127 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The lexical and syntactic directives override the classification of a
+// rule.
+const (
+	lexicalDirective   = "pegcmp:lexical"
+	syntacticDirective = "pegcmp:syntactic"
+)
+
+// lexicalRules returns the names of the lexical rules of s: the rules with
+// the lexical directive and the rules whose expression only references other
+// lexical rules, besides literals and character classes.  The other rules
+// are syntactic.
+func lexicalRules(s *syntax) map[string]bool {
+	lexical := make(map[string]bool)
+	forced := make(map[string]bool)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		switch {
+		case rule.hasDirective(syntacticDirective):
+		case rule.hasDirective(lexicalDirective):
+			lexical[rule.Name] = true
+			forced[rule.Name] = true
+		default:
+			if _, ok := s.nodes[rule.Name]; ok {
+				lexical[rule.Name] = true
+			}
+		}
+	}
+
+	// Remove the rules that reference a syntactic rule, until none is
+	// left, so that mutually recursive lexical rules stay lexical.
+	for changed := true; changed; {
+		changed = false
+		for name := range lexical {
+			if forced[name] {
+				continue
+			}
+			for _, ref := range refs(s.nodes[name]) {
+				if !lexical[ref] {
+					delete(lexical, name)
+					changed = true
+
+					break
+				}
+			}
+		}
+	}
+
+	return lexical
+}
+
+// classifyChanges returns the lexical rules of the changes from lgrammar to
+// rgrammar, classified in the grammar of the rhs rule or, when removed, of
+// the lhs rule.
+func classifyChanges(changes []change, lgrammar, rgrammar []Rule) map[*Rule]bool {
+	llexical := lexicalRules(newSyntax(lgrammar))
+	rlexical := lexicalRules(newSyntax(rgrammar))
+	lexical := make(map[*Rule]bool)
+	for _, c := range changes {
+		if c.rhs != nil && rlexical[c.rhs.Name] {
+			lexical[c.rhs] = true
+		}
+		if c.lhs != nil && llexical[c.lhs.Name] && (c.rhs == nil || rlexical[c.rhs.Name]) {
+			lexical[c.lhs] = true
+		}
+	}
+
+	return lexical
+}
+
+// isLexical reports whether the rule of c is lexical in r.
+func (r *report) isLexical(c change) bool {
+	if c.rhs != nil {
+		return r.lexical[c.rhs]
+	}
+
+	return r.lexical[c.lhs]
+}
+
+// sectionSummary returns the number of changed rules of each kind in
+// changes, as in "2 modified, 1 added".
+func sectionSummary(changes []change) string {
+	var counts [len(statusNames)]int
+	for _, c := range changes {
+		counts[c.kind]++
+	}
+	var list []string
+	for _, kind := range []changeKind{ruleModified, ruleAdded, ruleRemoved} {
+		if counts[kind] > 0 {
+			list = append(list, fmt.Sprintf("%d %s", counts[kind], statusNames[kind]))
+		}
+	}
+	if len(list) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// writeSections writes the changes of the lexical rules and then of the
+// syntactic rules, each preceded by a summary, using fn to write the
+// changes of a section.
+func writeSections(w io.Writer, r *report, fn func(changes []change)) {
+	var lexical, syntactic []change
+	for _, c := range r.changes {
+		if r.isLexical(c) {
+			lexical = append(lexical, c)
+		} else {
+			syntactic = append(syntactic, c)
+		}
+	}
+	fmt.Fprintf(w, "~ lexical rules: %s\n\n", sectionSummary(lexical))
+	fn(lexical)
+	fmt.Fprintf(w, "~ syntactic rules: %s\n\n", sectionSummary(syntactic))
+	fn(syntactic)
+}
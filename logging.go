@@ -0,0 +1,65 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// daemonCommands are the long-running commands, whose logs are ingested by
+// log collectors.
+var daemonCommands = map[string]bool{
+	"monitor": true,
+	"serve":   true,
+}
+
+// setupLogging configures the default logger, writing the diagnostics with
+// the specified minimum level and format to stderr.  The time of the records
+// is only written with the json format or when timestamps is true.
+func setupLogging(level, format string, timestamps bool) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{
+		Level: lvl,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Omit the time of the text diagnostics of the other commands,
+			// for reproducible output.
+			if a.Key == slog.TimeKey && len(groups) == 0 && !timestamps && format == "text" {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	}
+
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	slog.SetDefault(slog.New(h))
+
+	return nil
+}
+
+// fatal writes err to stderr, as writeError, and exits with status 1.
+func fatal(err error) {
+	writeError(os.Stderr, err)
+	os.Exit(1)
+}
+
+// fatalf writes the formatted message to stderr and exits with status 1.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -8,11 +8,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io/fs"
 	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
 	"strings"
 )
 
@@ -21,123 +26,619 @@ type Rule struct {
 	Expr string
 	Text string
 	Pos  Pos
+
+	// Comments on the lines immediately before the rule, without the '#'
+	// and surrounding white space.
+	Comments []string
 }
 
 type Pos struct {
-	Filename string
-	Line     int
-	Col      int
-	Offset   int
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Offset   int    `json:"offset"`
+}
+
+// String returns the position in the file:line:col format.
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Col)
 }
 
 var errDuplicateRule = errors.New("duplicate rule")
 
-const usage = "Usage: pegcmp lhs-path rhs-path"
+// Flags.
+var formatFlag = flag.String("format", "text",
+	"output format: text, udiff, side-by-side, word-diff, html, explorer, json, overlap, tap or sqlite")
+var notifyURLFlag = flag.String("notify-url", "",
+	"post the summary of the comparison to the webhook at the specified URL when its category, the required semantic version increment, changes")
+var notifyTemplateFlag = flag.String("notify-template", "json",
+	"payload posted to the -notify-url webhook: json, slack, teams or the path of a Go template file")
+var outFlag = flag.String("o", "",
+	"write the report in the -format format to the specified file; the sqlite format appends to an existing database")
+var normalizeFlag = flag.String("unicode-normalize", "none",
+	"Unicode normalization form of literals and classes: NFC, NFD or none")
+var corpusFlag = flag.String("corpus", "",
+	"compare the grammars on the inputs in the specified file, directory or zip or tar archive")
+var gitDifftoolFlag = flag.Bool("git-difftool", false,
+	"compare the grammars passed by git to an external diff command (diff.peg.command)")
+var policyFlag = flag.String("policy", "",
+	"check the changes against the policy in the specified TOML file, exiting with status 1 on violations")
+var publicFlag = flag.Bool("public", false,
+	"only report the changes of the public rules and of the rules reachable from them")
+var publicPatternFlag = flag.String("public-pattern", "",
+	"rules whose name matches the regular expression are public, in addition to the rules marked with # pegcmp:public")
+var blameFlag = flag.Bool("blame", false,
+	"annotate the differing rules with the git commit that last changed them in rhs")
+var normalizerFlag = flag.String("normalize", "",
+	"comma separated normalization passes applied to both grammars before comparing them: "+passNames())
+var leftFactorFlag = flag.Bool("left-factor", false,
+	"left factor the choices of both grammars before comparing them, as -normalize=left-factor")
+var eliminateLeftRecursionFlag = flag.Bool("eliminate-left-recursion", false,
+	"eliminate the direct left recursion of both grammars before comparing them, as -normalize=left-recursion")
+var ignoreRecoveryFlag = flag.Bool("ignore-recovery", false,
+	"ignore the error recovery expressions and labeled failures when comparing, as -normalize=strip-labels")
+var ruleCompareCmdFlag = flag.String("rule-compare-cmd", "",
+	"command deciding if two rules with different expressions are equal, by exiting with status 0")
+var jobsFlag = flag.Int("j", runtime.GOMAXPROCS(0),
+	"maximum number of grammars compared in parallel when comparing directories")
+var digestOnlyFlag = flag.Bool("digest-only", false,
+	"print the SHA-256 digest of the rules of each grammar instead of comparing them")
+var continueOnErrorFlag = flag.Bool("continue-on-error", false,
+	"compare the rules that parse when a grammar has syntax errors, reporting each error as a finding")
+var duplicatesFlag = flag.String("duplicates", "error",
+	"handling of the rules defined more than once: error, when the definitions differ, merge, as the alternatives of a choice, first or last")
+var sectionsFlag = flag.Bool("sections", false,
+	"report the changes of the lexical rules, that only reference literals, classes and other lexical rules or are marked with # pegcmp:lexical, apart from the syntactic rules")
+var terminalsFlag = flag.Bool("terminals", false,
+	"report the literals and the code points of the character classes used by only one grammar")
+var keywordsFlag = flag.Bool("keywords", false,
+	"report the probable keywords, literals of two or more letters, used by only one grammar, with the rules using them")
+var precedenceFlag = flag.Bool("precedence", false,
+	"report the differences in the operator precedence and associativity implied by the rule chains of the grammars")
+var matchNamesFlag = flag.String("match-names", "exact",
+	"matching of the rule names and of the references to them: exact, fold, using Unicode case folding, or style, also ignoring underscores")
+var foldNamesFlag = flag.Bool("fold-names", false,
+	"match the rule names and the references to them using Unicode case folding, as -match-names=fold")
+var ruleTestsFlag = flag.Bool("rule-tests", false,
+	"run the # test accept: and # test reject: annotations of the rules with both grammars, reporting the tests passing in only one")
+var propertiesFlag = flag.Bool("properties", false,
+	"report the rules whose computed properties changed: the minimum and maximum match length, nullable, empty-only, recursive and token-like")
+var lengthsFlag = flag.Bool("lengths", false,
+	"report the rules whose minimum or maximum match length changed, as a rule now matching the empty string")
+var recursionFlag = flag.Bool("recursion", false,
+	"report the changes of the recursion groups, the mutually recursive rules, as groups merged, split, added or removed")
+var depthFlag = flag.Bool("depth", false,
+	"report the rules whose maximum static nesting depth, a measure of the stack usage of the generated parsers, grew by -depth-ratio or beyond -max-depth")
+var depthRatioFlag = flag.Float64("depth-ratio", 1.5,
+	"minimum ratio for a rule depth increase to be reported with -depth")
+var maxDepthFlag = flag.Int("max-depth", 0,
+	"report with -depth the rules whose depth grew beyond this value, whatever the ratio (default no maximum)")
+var maxAlternativesFlag = flag.Int("max-alternatives", 0,
+	"report the rules with a choice of more alternatives, overriding the budget of the policy (default no limit)")
+var maxTokensFlag = flag.Int("max-tokens", 0,
+	"report the rules whose expression has more tokens, overriding the budget of the policy (default no limit)")
+var maxLinesFlag = flag.Int("max-lines", 0,
+	"report the rules whose expression spans more lines, overriding the budget of the policy (default no limit)")
+var styleFlag = flag.String("style", "source",
+	"style of the reported expressions: source, compact, lines or aligned, overriding the format table of the policy")
+var widthFlag = flag.Int("width", 0,
+	"maximum width of the lines of the reported expressions, overriding the format table of the policy (default no maximum)")
+var colorFlag = flag.String("color", "auto",
+	"highlight the expressions of the text outputs: auto, when writing to a terminal and NO_COLOR is not set, always or never")
+var markChangesFlag = flag.Bool("mark-changes", false,
+	"mark the changed parts of the expressions of the modified rules, with [-...-] and {+...+} or, with -color, underlined")
+var anchorsFlag = flag.Bool("anchors", false,
+	"write the file:line:col location of each changed part of the modified rules in the text format")
+var hyperlinksFlag = flag.Bool("hyperlinks", false,
+	"write the locations of the text and word-diff formats as OSC 8 terminal hyperlinks to the grammar files")
+var pairByStructureFlag = flag.Bool("pair-by-structure", false,
+	"pair the rules not matched by name with the rules of the other grammar with the same structure, or else the most similar ones")
+var contextFlag = flag.Int("context", -1,
+	"number of unchanged rules written before and after each changed rule, in rhs order (default 0, or 3 with -format udiff)")
+var cacheFlag = flag.Bool("cache", false,
+	"cache the results when comparing directories in the user cache directory, reusing them for the unchanged grammars, unless -blame or -events")
+var cacheStatsFlag = flag.Bool("cache-stats", false,
+	"print the cache hits and misses when comparing directories or, with serve, after each request")
+var startFlag = flag.String("start", "", "start rule (default the first rule)")
+var costRatioFlag = flag.Float64("cost-ratio", 2,
+	"minimum ratio for a rule cost increase on the corpus to be reported")
+var memoFlag = flag.Bool("memo", false,
+	"memoize all rules on the corpus, not only the ones with a # memo comment")
+var noLeftRecursionFlag = flag.Bool("no-left-recursion", false,
+	"fail left recursive invocations on the corpus, as in strict PEG, and report the left recursive lhs rules")
+var timeoutFlag = flag.Duration("timeout", 0,
+	"maximum time for matching a corpus input with a grammar (default unlimited)")
+var noShrinkFlag = flag.Bool("no-shrink", false,
+	"do not shrink the corpus inputs where the grammars disagree to a minimal input")
+var eventsFlag = flag.String("events", "",
+	"write the progress and the results as newline-delimited JSON events to the specified file descriptor number or file")
+var noProgressFlag = flag.Bool("no-progress", false,
+	"do not report the progress of long operations on the terminal")
+var schemaFlag = flag.Bool("schema", false, "print the JSON schema of the json format and exit")
+var moduleFlag = flag.String("module", "",
+	"compare against the lhs grammar in a Go module, specified as module@version:path")
+var manifestFlag stringList
+var outputFlag outputList
+var pluginFlag stringList
+var headerFlag stringList
+var logLevelFlag = flag.String("log-level", "warn",
+	"minimum level of the logged diagnostics: debug, info, warn or error")
+var logFormatFlag = flag.String("log-format", "text", "format of the logged diagnostics: text or json")
+var maxStepsFlag = flag.Int("max-steps", 0,
+	"maximum number of evaluated expressions for matching a corpus input (default unlimited)")
+
+func init() {
+	flag.Var(&manifestFlag, "manifest",
+		"file listing the grammar files of a side, specified once for lhs and once for rhs")
+	flag.Var(&headerFlag, "header",
+		"HTTP header, as \"Name: value\", sent when fetching the grammars at an URL; may be repeated")
+	flag.Var(&outputFlag, "output",
+		"write the report in a format to a file, specified as format=path with - for stdout, instead of -format; may be repeated")
+	flag.Var(&pluginFlag, "plugin",
+		"command of a plugin reading other grammar dialects or running custom lint checks; may be repeated")
+}
+
+// stringList is a flag that can be specified multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+
+	return nil
+}
+
+// jsMain, when set, replaces the command line interface in the WebAssembly
+// build.
+var jsMain func()
 
 func main() {
-	// Setup log.
-	log.SetFlags(0)
+	if jsMain != nil {
+		jsMain()
+
+		return
+	}
 
 	// Parse command line.
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, usage())
 		fmt.Fprintln(os.Stderr, "Flags:")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
-	if flag.NArg() != 2 {
+	if err := setupLogging(*logLevelFlag, *logFormatFlag, daemonCommands[flag.Arg(0)]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		os.Exit(2)
+	}
+	if err := loadPlugins(pluginFlag); err != nil {
+		fatal(err)
+	}
+	sizeBudget = ruleBudget{*maxAlternativesFlag, *maxTokensFlag, *maxLinesFlag}
+	style, err := flagStyle()
+	if err != nil {
+		fatal(err)
+	}
+	printStyle = style
+	if colorOutput, err = colorEnabled(*colorFlag); err != nil {
+		fatal(err)
+	}
+	if *eventsFlag != "" {
+		var err error
+		if events, err = openEvents(*eventsFlag); err != nil {
+			fatal(err)
+		}
+	}
+	if *schemaFlag {
+		os.Stdout.Write(jsonSchema)
+
+		return
+	}
+	if cmd, ok := commands[flag.Arg(0)]; ok {
+		cmd.run(flag.Args()[1:])
+
+		return
+	}
+	if *digestOnlyFlag {
+		runDigest(flag.Args())
+
+		return
+	}
+	if *gitDifftoolFlag {
+		runGitDiff(flag.Args())
+
+		return
+	}
+	load := parse
+	var syntaxErrs []syntaxError
+	if *continueOnErrorFlag {
+		load = func(p string) ([]Rule, error) {
+			grammar, errs, err := parseContinue(p)
+			syntaxErrs = append(syntaxErrs, errs...)
+
+			return grammar, err
+		}
+	}
+	args := flag.Args()
+	if len(manifestFlag) > 0 {
+		load = parseManifest
+		args = append(manifestFlag, args...)
+	}
+	if *moduleFlag != "" {
+		path, err := moduleFile(*moduleFlag)
+		if err != nil {
+			fatal(err)
+		}
+		args = append([]string{path}, args...)
+	}
+	if len(args) != 2 {
 		flag.Usage()
 
 		os.Exit(2)
 	}
-	lpath := flag.Arg(0)
-	rpath := flag.Arg(1)
+	lpath := args[0]
+	rpath := args[1]
+	if _, ok := formatters[*formatFlag]; !ok {
+		fatalf("unknown format %q", *formatFlag)
+	}
+	opts := compareOptions()
+	if _, ok := duplicatePolicies[*duplicatesFlag]; !ok && *duplicatesFlag != "error" {
+		fatalf("unknown duplicate rule policy %q", *duplicatesFlag)
+	}
+	var pol *policy
+	if *policyFlag != "" {
+		var err error
+		if pol, err = readPolicy(cliFS, cliFS.name(*policyFlag)); err != nil {
+			fatal(err)
+		}
+		sizeBudget = sizeBudget.or(pol.budget)
+	}
+
+	if len(manifestFlag) == 0 && isDir(lpath) && isDir(rpath) {
+		if *corpusFlag != "" {
+			fatalf("-corpus is not supported when comparing directories")
+		}
+		if *outFlag != "" || *formatFlag == "sqlite" {
+			fatalf("-o and -format sqlite are not supported when comparing directories")
+		}
+		var cache *resultCache
+		if *cacheFlag {
+			cache = newResultCache(resultCacheDir())
+		}
+		events.started(lpath, rpath)
+		status := compareDirs(lpath, rpath, opts, pol, cache, max(*jobsFlag, 1))
+		events.summary(status)
+		os.Exit(status)
+	}
 
 	// Parse and compare the lhs and rhs grammars.
-	lgrammar, err := parse(lpath)
+	events.started(lpath, rpath)
+	lgrammar, err := load(lpath)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
-	rgrammar, err := parse(rpath)
+	events.fileParsed(lpath, lgrammar)
+	rgrammar, err := load(rpath)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	events.fileParsed(rpath, rgrammar)
 
-	// Use the lhs grammar as reference, assuming that it is a valid PEG grammar.
-	rules := make(map[string]Rule)
-	for _, lrule := range lgrammar {
-		rules[lrule.Name] = lrule
+	// Check for duplicates in the rhs grammar, or resolve them in both.
+	if *duplicatesFlag != "error" {
+		lgrammar, _ = resolveDuplicates(lpath, lgrammar, *duplicatesFlag)
+	}
+	if rgrammar, err = resolveDuplicates(rpath, rgrammar, *duplicatesFlag); err != nil {
+		fatal(err)
 	}
 
-	// Check for duplicates in the rhs grammar.
-	if err := validate(rpath, rgrammar); err != nil {
-		log.Fatal(err)
+	lgrammar, rgrammar = skipRules(lgrammar, syntaxErrs), skipRules(rgrammar, syntaxErrs)
+	r := newReport(lpath, rpath, lgrammar, rgrammar, opts)
+	r.findings = append(syntaxFindings(syntaxErrs), r.findings...)
+	events.compared(r)
+	if *blameFlag {
+		r.blame = blameChanges(r.changes)
+	}
+	if *corpusFlag != "" {
+		copts := &corpusOptions{
+			start:     *startFlag,
+			costRatio: *costRatioFlag,
+			memo:      *memoFlag,
+			strict:    *noLeftRecursionFlag,
+			progress:  !*noProgressFlag,
+			shrink:    !*noShrinkFlag,
+			timeout:   *timeoutFlag,
+			maxSteps:  *maxStepsFlag,
+		}
+		// An interrupt aborts the run in progress and the comparison.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		copts.ctx = ctx
+		fsys, root, err := openPath(*corpusFlag)
+		if err != nil {
+			fatal(err)
+		}
+		r.corpus, err = runCorpus(fsys, root, newSyntax(lgrammar), newSyntax(rgrammar), copts)
+		stop()
+		if err != nil {
+			fatal(err)
+		}
 	}
+	writeReport(r)
+	if err := flagNotifier(notifyStateDir()).notifyReport(context.Background(), r, opts); err != nil {
+		logError(err)
+	}
+	status := 0
+	if pol != nil {
+		list := pol.check(r)
+		writeViolations(os.Stderr, list)
+		if len(list) > 0 {
+			status = 1
+		}
+	}
+	events.summary(status)
+	os.Exit(status)
+}
 
-	// Compare each rhs rule against lhs.
-	for _, rrule := range rgrammar {
-		lrule, ok := rules[rrule.Name]
-		if !ok {
-			fmt.Fprintf(os.Stderr, "! rule %q not found\n", rrule.Name)
-			fmt.Fprintf(os.Stderr, "> %s:%d:%d\n", rpath, rrule.Pos.Line, rrule.Pos.Col)
-			fmt.Fprintln(os.Stderr, ">", rrule.Expr, "\n")
+// compareOptions returns the comparison options specified on the command
+// line.
+func compareOptions() *options {
+	opts := &options{
+		normalize: *normalizeFlag,
+	}
+	switch opts.normalize {
+	case "NFC", "NFD", "none":
+	default:
+		fatalf("unknown normalization form %q", opts.normalize)
+	}
+	if *publicPatternFlag != "" {
+		re, err := regexp.Compile(*publicPatternFlag)
+		if err != nil {
+			fatal(err)
+		}
+		opts.publicPattern = re
+	}
+	opts.publicOnly = *publicFlag
+	opts.strict = *noLeftRecursionFlag
+	opts.sections = *sectionsFlag
+	opts.terminals = *terminalsFlag
+	opts.keywords = *keywordsFlag
+	opts.precedence = *precedenceFlag
+	opts.context = *contextFlag
+	normalizer, err := parseNormalizer(*normalizerFlag)
+	if err != nil {
+		fatal(err)
+	}
+	for _, pass := range []struct {
+		enabled bool
+		name    string
+	}{
+		{*ignoreRecoveryFlag, "strip-labels"},
+		{*eliminateLeftRecursionFlag, "left-recursion"},
+		{*leftFactorFlag, "left-factor"},
+	} {
+		if pass.enabled {
+			normalizer = append(normalizer, lookupPass(pass.name))
+		}
+	}
+	opts.normalizer = normalizer
+	opts.ruleCompareCmd = *ruleCompareCmdFlag
+	opts.pairByStructure = *pairByStructureFlag
+	opts.ruleTests = *ruleTestsFlag
+	opts.properties = *propertiesFlag
+	opts.lengths = *lengthsFlag
+	opts.recursion = *recursionFlag
+	opts.depth = *depthFlag
+	opts.depthRatio = *depthRatioFlag
+	opts.maxDepth = *maxDepthFlag
+	opts.matchNames = *matchNamesFlag
+	switch opts.matchNames {
+	case "exact":
+		if *foldNamesFlag {
+			opts.matchNames = "fold"
+		}
+	case "fold", "style":
+	default:
+		fatalf("unknown rule name matching %q", opts.matchNames)
+	}
+
+	return opts
+}
 
-			continue
+// newReport compares the lhs and rhs grammars, reporting the analysis
+// findings introduced by rhs and the rules affected by each modified rule.
+func newReport(lpath, rpath string, lgrammar, rgrammar []Rule, opts *options) *report {
+	rawl, rawr := lgrammar, rgrammar
+	lgrammar, rgrammar = opts.normalizer.Normalize(lgrammar), opts.normalizer.Normalize(rgrammar)
+	lfindings := analyze(newSyntax(lgrammar))
+	rfindings := analyze(newSyntax(rgrammar))
+
+	r := &report{
+		lpath:     lpath,
+		rpath:     rpath,
+		lgrammar:  lgrammar,
+		rgrammar:  rgrammar,
+		changes:   compare(lgrammar, rgrammar, opts),
+		findings:  newFindings(lfindings, rfindings),
+		lhsIssues: grammarIssues(lpath, lgrammar, opts.strict),
+	}
+	r.equiv = newEquivalence(rawl, rawr, lgrammar, rgrammar, r.changes, opts)
+	applyExpectDiff(r)
+	r.context = opts.context
+	if opts.sections {
+		r.lexical = classifyChanges(r.changes, lgrammar, rgrammar)
+	}
+	if opts.terminals {
+		r.terminals = diffTerminals(lgrammar, rgrammar)
+	}
+	if opts.keywords {
+		r.keywords = diffKeywords(lgrammar, rgrammar)
+	}
+	if opts.precedence {
+		r.precedence = diffPrecedence(lgrammar, rgrammar)
+	}
+	if opts.properties {
+		r.properties = diffProperties(lgrammar, rgrammar)
+	}
+	if opts.lengths {
+		r.lengths = diffLengths(lgrammar, rgrammar)
+	}
+	if opts.recursion {
+		r.recursion = diffRecursion(lgrammar, rgrammar)
+	}
+	if opts.depth {
+		r.depths = diffDepths(lgrammar, rgrammar, opts.depthRatio, opts.maxDepth)
+	}
+	if opts.ruleTests {
+		r.ruleTests = diffRuleTests(lgrammar, rgrammar, &corpusOptions{strict: opts.strict})
+	}
+	rgraph := newRefGraph(newSyntax(rgrammar))
+	r.impact = make(map[*Rule][]string)
+	for _, c := range r.changes {
+		if c.kind == ruleModified {
+			r.impact[c.rhs] = rgraph.dependents(c.rhs.Name, rgrammar)
 		}
+	}
+	r.public = publicRules(lgrammar, opts.publicPattern)
+	for name := range publicRules(rgrammar, opts.publicPattern) {
+		r.public[name] = true
+	}
+	if len(r.public) == 0 {
+		r.public = nil
+	}
+	if opts.publicOnly {
+		if r.public == nil {
+			fatalf("-public: no public rules, mark them with # %s or -public-pattern", publicDirective)
+		}
+		filterSurface(r)
+	}
+
+	return r
+}
 
-		// Rule expressions are compared byte by byte, including whitespace.
-		if rrule.Expr != lrule.Expr {
-			fmt.Fprintf(os.Stderr, "! rule %q does not match\n", rrule.Name)
-			fmt.Fprintf(os.Stderr, "> %s:%d:%d\n", rpath, rrule.Pos.Line, rrule.Pos.Col)
-			fmt.Fprintln(os.Stderr, ">", rrule.Expr, "\n")
-			fmt.Fprintf(os.Stderr, "< %s:%d:%d\n", lpath, lrule.Pos.Line, lrule.Pos.Col)
-			fmt.Fprintln(os.Stderr, "<", lrule.Expr, "\n")
+// writeReport writes r in the format specified on the command line, to
+// stderr for the text format and to stdout otherwise, or to the outputs
+// specified on the command line with -o and -output.
+func writeReport(r *report) {
+	outputs := outputFlag
+	if *outFlag != "" {
+		outputs = append(outputs, output{format: *formatFlag, path: *outFlag})
+	}
+	if len(outputs) > 0 {
+		if err := writeOutputs(outputs, r); err != nil {
+			fatal(err)
 		}
+
+		return
+	}
+	format, ok := formatters[*formatFlag]
+	if !ok {
+		fatalf("unknown format %q", *formatFlag)
+	}
+	w := os.Stdout
+	if *formatFlag == "text" {
+		w = os.Stderr
+	}
+	if err := format(w, r); err != nil {
+		fatal(err)
 	}
 }
 
-func parse(path string) ([]Rule, error) {
-	data, err := os.ReadFile(path)
+// parse parses the grammar at the operating system path or URL p, merging
+// the rules of the included grammars.
+func parse(p string) ([]Rule, error) {
+	fsys, name, err := grammarFS(p)
 	if err != nil {
 		return nil, err
 	}
 
-	pn, err := Parse(path, data)
+	return parseFS(fsys, name)
+}
+
+// grammarFS returns the file system and the name in it of the grammar at the
+// operating system path or URL p.
+func grammarFS(p string) (fs.FS, string, error) {
+	if isURL(p) {
+		return newHTTPFS(p, headerFlag)
+	}
+
+	return cliFS, cliFS.name(p), nil
+}
+
+// parseFS parses the grammar named name in fsys, merging the rules of the
+// included grammars.
+func parseFS(fsys fs.FS, name string) ([]Rule, error) {
+	return newIncluder(fsys).load(name)
+}
+
+// parseFile parses the grammar at path, or reads it with the plugin of its
+// dialect, without resolving the include directives.
+func parseFile(path string, data []byte) ([]Rule, error) {
+	var rules []Rule
+	err := parseRules(path, data, func(rule Rule) error {
+		rules = append(rules, rule)
+
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert interface to concrete type.
-	slice := pn.([]interface{})
-	rules := make([]Rule, len(slice))
-	for i, ent := range slice {
-		rules[i] = ent.(Rule)
+	return rules, nil
+}
+
+// precedingComments returns the comments on the lines immediately before the
+// line at offset, provided that offset is at the start of the line.
+func precedingComments(data []byte, offset int) []string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	if len(bytes.TrimSpace(data[start:offset])) > 0 {
+		return nil
 	}
 
-	return rules, nil
+	var list []string
+	for end := start - 1; end > 0; end = start - 1 {
+		start = bytes.LastIndexByte(data[:end], '\n') + 1
+		line := bytes.TrimSpace(data[start:end])
+		if len(line) == 0 || line[0] != '#' || bytes.HasPrefix(line, []byte("#{")) {
+			break
+		}
+		list = append(list, string(bytes.TrimSpace(line[1:])))
+	}
+
+	// Reverse the list.
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+
+	return list
 }
 
+// validate checks that the rules defined more than once in grammar have the
+// same expression, returning a DuplicateRuleError for each one that does
+// not.
 func validate(path string, grammar []Rule) error {
-	var err error = nil
+	var errs []error
 	rules := make(map[string]Rule)
 	for _, rule := range grammar {
 		if prule, ok := rules[rule.Name]; ok {
 			// Ignore identical duplicate rules.
 			if rule.Expr != prule.Expr {
-				fmt.Fprintf(os.Stderr, "! duplicate rule %q does not match\n", prule.Name)
-				fmt.Fprintf(os.Stderr, "> %s:%d:%d\n", path, rule.Pos.Line, rule.Pos.Col)
-				fmt.Fprintln(os.Stderr, ">", rule.Expr, "\n")
-				fmt.Fprintf(os.Stderr, "< %s:%d:%d\n", path, prule.Pos.Line, prule.Pos.Col)
-				fmt.Fprintln(os.Stderr, "<", prule.Expr, "\n")
-
-				err = errDuplicateRule
+				errs = append(errs, &DuplicateRuleError{
+					Name:     rule.Name,
+					Pos:      rule.Pos,
+					PrevPos:  prule.Pos,
+					Expr:     rule.Expr,
+					PrevExpr: prule.Expr,
+				})
 			}
 		}
 
 		rules[rule.Name] = rule
 	}
 
-	return err
+	return errors.Join(errs...)
 }
 
 // strip removes leading and trailing white space and comments.
@@ -146,23 +647,14 @@ func strip(s string) string {
 		return strings.TrimSpace(s)
 	}
 
-	// Remove comments, assuming eol is LF.
+	// Remove comments, skipping literals and character classes that may
+	// contain a '#'.
 	var b strings.Builder
-	for i := 0; ; i++ {
-		start := strings.IndexByte(s, '#')
-		if start < 0 {
-			return strings.TrimSpace(b.String())
+	for _, tok := range tokenize(s) {
+		if !isCommentToken(tok) {
+			b.WriteString(tok)
 		}
-		end := strings.IndexByte(s[start:], '\n')
-		if end < 0 {
-			panic("unterminated comment")
-		}
-
-		tmp := s[0:start] + s[start+end+1:]
-		b.WriteString(tmp)
-
-		s = tmp
 	}
 
-	panic("unreachable")
+	return strings.TrimSpace(b.String())
 }
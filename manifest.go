@@ -0,0 +1,98 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// readManifest returns the grammar files listed in the manifest named name,
+// one per line and relative to the directory of the manifest, each
+// optionally followed by the prefix of its rule names.  Empty lines and
+// lines starting with '#' are ignored.
+func readManifest(fsys fs.FS, name string) ([]include, error) {
+	data, err := readFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []include
+	for n, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if len(fields) > 2 || len(fields) == 2 && !isIdent(fields[1]) {
+			return nil, fmt.Errorf("%s:%d: invalid manifest entry", displayName(fsys, name), n+1)
+		}
+		file := resolve(name, fields[0])
+		prefix := ""
+		if len(fields) == 2 {
+			prefix = fields[1]
+		}
+		list = append(list, include{file, prefix})
+	}
+
+	return list, nil
+}
+
+// parseManifest parses the grammar files listed in the manifest at the
+// operating system path p.
+func parseManifest(p string) ([]Rule, error) {
+	return parseManifestFS(cliFS, cliFS.name(p))
+}
+
+// parseManifestFS parses the grammar files listed in the manifest named name
+// in fsys, merging them in order.  A rule defined in more than one file is
+// reported as a duplicate.
+func parseManifestFS(fsys fs.FS, name string) ([]Rule, error) {
+	files, err := readManifest(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: empty manifest", displayName(fsys, name))
+	}
+
+	var grammar []Rule
+	inc := newIncluder(fsys)
+	prefixes := make(prefixedNames)
+	for _, file := range files {
+		rules, err := inc.loadPrefix(file.path, file.prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := prefixes.add(rules, file.prefix); err != nil {
+			return nil, fmt.Errorf("%s: %w", displayName(fsys, name), err)
+		}
+		grammar = append(grammar, prefixRules(rules, file.prefix)...)
+	}
+
+	var errs []error
+	rules := make(map[string]Rule)
+	for _, rule := range grammar {
+		prule, ok := rules[rule.Name]
+		if !ok {
+			rules[rule.Name] = rule
+
+			continue
+		}
+		if rule.Pos.Filename != prule.Pos.Filename {
+			errs = append(errs, &DuplicateRuleError{
+				Name:          rule.Name,
+				Pos:           rule.Pos,
+				PrevPos:       prule.Pos,
+				Expr:          rule.Expr,
+				PrevExpr:      prule.Expr,
+				MultipleFiles: true,
+			})
+		}
+	}
+
+	return grammar, errors.Join(errs...)
+}
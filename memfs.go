@@ -0,0 +1,178 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memFS is a read only file system of regular files in memory, named by
+// their slash separated path.  The directories are implied by the names of
+// the files.
+type memFS map[string]*memFile
+
+// memFile is a regular file of a memFS.
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m[name]; ok {
+		return &openMemFile{bytes.NewReader(f.data), memInfo{path.Base(name), f}}, nil
+	}
+	entries, err := m.ReadDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &openMemDir{info: memInfo{name: path.Base(name)}, entries: entries}, nil
+}
+
+func (m memFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return bytes.Clone(f.data), nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (m memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	seen := make(map[string]bool)
+	var list []fs.DirEntry
+	for p, f := range m {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok {
+			continue
+		}
+		child, _, isDir := strings.Cut(rest, "/")
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		info := memInfo{name: child}
+		if !isDir {
+			info.file = f
+		}
+		list = append(list, fs.FileInfoToDirEntry(info))
+	}
+	if len(list) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	slices.SortFunc(list, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return list, nil
+}
+
+// memInfo is the fs.FileInfo of a file, or of a directory when file is nil.
+type memInfo struct {
+	name string
+	file *memFile
+}
+
+func (i memInfo) Name() string {
+	return i.name
+}
+
+func (i memInfo) Size() int64 {
+	if i.file == nil {
+		return 0
+	}
+
+	return int64(len(i.file.data))
+}
+
+func (i memInfo) Mode() fs.FileMode {
+	if i.file == nil {
+		return fs.ModeDir | 0o555
+	}
+
+	return 0o444
+}
+
+func (i memInfo) ModTime() time.Time {
+	if i.file == nil {
+		return time.Time{}
+	}
+
+	return i.file.modTime
+}
+
+func (i memInfo) IsDir() bool {
+	return i.file == nil
+}
+
+func (i memInfo) Sys() any {
+	return nil
+}
+
+// openMemFile is an open regular file of a memFS.
+type openMemFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *openMemFile) Close() error {
+	return nil
+}
+
+// openMemDir is an open directory of a memFS.
+type openMemDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openMemDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *openMemDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *openMemDir) Close() error {
+	return nil
+}
+
+func (d *openMemDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	list := d.entries[d.offset:]
+	if n > 0 && len(list) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	d.offset += len(list)
+
+	return list, nil
+}
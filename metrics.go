@@ -0,0 +1,172 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricsPath is the path of the metrics of the service, in the Prometheus
+// text format.
+const metricsPath = "/metrics"
+
+// serveMetrics are the counters of the service, since it started.  It is
+// safe for concurrent use; a nil serveMetrics counts nothing.
+type serveMetrics struct {
+	mu          sync.Mutex
+	requests    map[string]int // by method
+	errors      map[string]int // failed requests by method
+	comparisons int
+	rules       int            // compared rules
+	differences map[string]int // by change status
+	findings    map[string]int // by analyzer
+	parseErrors int
+}
+
+// serveStats are the metrics of the service, when serving.
+var serveStats *serveMetrics
+
+// newServeMetrics returns the metrics of a service that has not served any
+// request.
+func newServeMetrics() *serveMetrics {
+	return &serveMetrics{
+		requests:    make(map[string]int),
+		errors:      make(map[string]int),
+		differences: make(map[string]int),
+		findings:    make(map[string]int),
+	}
+}
+
+// request counts a request of method, failed if err is not nil.
+func (m *serveMetrics) request(method string, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[method]++
+	if err != nil {
+		m.errors[method]++
+	}
+}
+
+// parseFailed counts a grammar of a request that is not valid.
+func (m *serveMetrics) parseFailed() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parseErrors++
+}
+
+// compared counts a comparison of a grammar with n rhs rules and its
+// responses, the changed rules and the findings.  The rules compared are the
+// rhs rules and the removed lhs rules.
+func (m *serveMetrics) compared(n int, responses []compareResponse) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.comparisons++
+	m.rules += n
+	for _, resp := range responses {
+		switch {
+		case resp.Rule != nil:
+			status := resp.Rule.Status
+			if status == statusNames[ruleRemoved] {
+				m.rules++
+			}
+			if status == statusNames[ruleEqual] && resp.Rule.Moved {
+				status = "moved"
+			}
+			m.differences[status]++
+		case resp.Finding != nil:
+			m.findings[resp.Finding.Analyzer]++
+		}
+	}
+}
+
+// comparedCached counts a comparison of a grammar with n rhs rules replied
+// from the cache, with the newline delimited responses in data.
+func (m *serveMetrics) comparedCached(n int, data []byte) {
+	if m == nil {
+		return
+	}
+	m.compared(n, decodeResponses(data))
+}
+
+// write writes the metrics and the statistics of cache in the Prometheus
+// text format.
+func (m *serveMetrics) write(w io.Writer, cache *resultCache) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	labeled := func(name, label string, values map[string]int) {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, promEscape(k), values[k])
+		}
+	}
+
+	metric("pegcmp_requests_total", "counter", "Requests served, by method.")
+	labeled("pegcmp_requests_total", "method", m.requests)
+	metric("pegcmp_request_errors_total", "counter", "Requests replied with an error, by method.")
+	labeled("pegcmp_request_errors_total", "method", m.errors)
+	metric("pegcmp_parse_errors_total", "counter", "Grammars of the requests that are not valid.")
+	fmt.Fprintf(w, "pegcmp_parse_errors_total %d\n", m.parseErrors)
+	metric("pegcmp_comparisons_total", "counter", "Comparisons of two grammars, including the ones replied from the cache.")
+	fmt.Fprintf(w, "pegcmp_comparisons_total %d\n", m.comparisons)
+	metric("pegcmp_rules_compared_total", "counter", "Rules compared.")
+	fmt.Fprintf(w, "pegcmp_rules_compared_total %d\n", m.rules)
+	metric("pegcmp_differences_total", "counter", "Changed rules, by category: added, modified, removed or moved.")
+	labeled("pegcmp_differences_total", "category", m.differences)
+	metric("pegcmp_findings_total", "counter", "Analysis findings introduced by the rhs grammars, by analyzer.")
+	labeled("pegcmp_findings_total", "analyzer", m.findings)
+
+	cache.mu.Lock()
+	hits, misses, entries := cache.hits, cache.misses, len(cache.entries)
+	cache.mu.Unlock()
+	metric("pegcmp_cache_hits_total", "counter", "Comparisons replied from the cache.")
+	fmt.Fprintf(w, "pegcmp_cache_hits_total %d\n", hits)
+	metric("pegcmp_cache_misses_total", "counter", "Comparisons not found in the cache.")
+	fmt.Fprintf(w, "pegcmp_cache_misses_total %d\n", misses)
+	metric("pegcmp_cache_entries", "gauge", "Comparison results in the cache.")
+	fmt.Fprintf(w, "pegcmp_cache_entries %d\n", entries)
+}
+
+// promEscape escapes s as a label value of the Prometheus text format.
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// serveMetricsHandler returns the handler of the metrics of the service
+// caching the comparisons in cache.
+func serveMetricsHandler(cache *resultCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if serveStats == nil {
+			return
+		}
+		serveStats.write(w, cache)
+	}
+}
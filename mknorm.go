@@ -0,0 +1,154 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+
+// mknorm generates the Unicode normalization tables in normtables.go, from
+// the UnicodeData.txt and DerivedNormalizationProps.txt files of the Unicode
+// Character Database.
+//
+// Usage: go run mknorm.go -ucd dir
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ucd = flag.String("ucd", ".", "directory of the Unicode Character Database")
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	decomps := make(map[rune][]rune)
+	classes := make(map[rune]int)
+	excluded := make(map[rune]bool)
+
+	// UnicodeData.txt: code;name;category;ccc;bidi;decomposition;...
+	each(filepath.Join(*ucd, "UnicodeData.txt"), func(fields []string) {
+		r := parseRune(fields[0])
+		if ccc, _ := strconv.Atoi(fields[3]); ccc != 0 {
+			classes[r] = ccc
+		}
+		// Compatibility decompositions start with a <tag>.
+		if d := fields[5]; d != "" && d[0] != '<' {
+			for _, f := range strings.Fields(d) {
+				decomps[r] = append(decomps[r], parseRune(f))
+			}
+		}
+	})
+
+	// DerivedNormalizationProps.txt: code[..code] ; property # comment
+	each(filepath.Join(*ucd, "DerivedNormalizationProps.txt"), func(fields []string) {
+		if len(fields) < 2 || strings.TrimSpace(fields[1]) != "Full_Composition_Exclusion" {
+			return
+		}
+		lo, hi := fields[0], fields[0]
+		if i := strings.Index(fields[0], ".."); i >= 0 {
+			lo, hi = fields[0][:i], fields[0][i+2:]
+		}
+		for r := parseRune(lo); r <= parseRune(hi); r++ {
+			excluded[r] = true
+		}
+	})
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by mknorm.go; DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "package main")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "// decompositions maps a code point to its canonical decomposition.")
+	fmt.Fprintln(&b, "var decompositions = map[rune][]rune{")
+	for _, r := range keys(decomps) {
+		var list []string
+		for _, d := range decomps[r] {
+			list = append(list, fmt.Sprintf("0x%04X", d))
+		}
+		fmt.Fprintf(&b, "0x%04X: {%s},\n", r, strings.Join(list, ", "))
+	}
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "// combiningClasses maps a code point to its non zero canonical combining class.")
+	fmt.Fprintln(&b, "var combiningClasses = map[rune]uint8{")
+	for _, r := range keys(classes) {
+		fmt.Fprintf(&b, "0x%04X: %d,\n", r, classes[r])
+	}
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "// compositionExclusions is the set of code points excluded from composition.")
+	fmt.Fprintln(&b, "var compositionExclusions = map[rune]bool{")
+	for _, r := range keys(excluded) {
+		fmt.Fprintf(&b, "0x%04X: true,\n", r)
+	}
+	fmt.Fprintln(&b, "}")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("normtables.go", src, 0o666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// each calls fn with the fields of each line in the file at path, ignoring
+// comments and empty lines.
+func each(path string, fn func([]string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		fn(fields)
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseRune(s string) rune {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return rune(v)
+}
+
+func keys[T any](m map[rune]T) []rune {
+	list := make([]rune, 0, len(m))
+	for r := range m {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i] < list[j]
+	})
+
+	return list
+}
@@ -0,0 +1,423 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const monitorUsage = `Usage: pegcmp monitor [-config path] [-once]`
+
+// monitorConfig is the configuration of the drift monitor, read from a TOML
+// file as
+//
+//	interval = "1h"
+//	state = ".pegcmp-monitor"
+//	webhook = "https://example.com/hook"
+//	addr = "localhost:8081"
+//
+//	[pair.spec]
+//	lhs = "https://example.com/spec.peg"
+//	rhs = "grammar.peg"
+//
+//	[pair.release]
+//	lhs = "git:v1.0:grammar.peg"
+//	rhs = "grammar.peg"
+//
+// where a grammar is a path, relative to the configuration file, an URL or a
+// git:rev:path file in a revision of the repository containing the
+// configuration file.  Only the pairs are required; the state directory,
+// relative to the configuration file, defaults to .pegcmp-monitor.
+type monitorConfig struct {
+	interval time.Duration
+	state    string
+	webhook  string
+	addr     string // address of the health endpoint, if not empty
+	pairs    []monitorPair
+}
+
+// monitorPair is a pair of grammars checked by the monitor.
+type monitorPair struct {
+	name     string
+	lhs, rhs string
+}
+
+// readMonitorConfig reads the monitor configuration file at path.
+func readMonitorConfig(path string) (*monitorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseTOML(path, data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	cfg := &monitorConfig{interval: time.Hour, state: filepath.Join(dir, ".pegcmp-monitor")}
+	for key, v := range doc[""] {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must be a string", path, key)
+		}
+		switch key {
+		case "interval":
+			if cfg.interval, err = time.ParseDuration(s); err != nil || cfg.interval <= 0 {
+				return nil, fmt.Errorf("%s: invalid interval %q", path, s)
+			}
+		case "state":
+			cfg.state = resolvePath(dir, s)
+		case "webhook":
+			cfg.webhook = s
+		case "addr":
+			cfg.addr = s
+		default:
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+	}
+	for table, keys := range doc {
+		name, ok := strings.CutPrefix(table, "pair.")
+		if !ok {
+			if table != "" {
+				return nil, fmt.Errorf("%s: unknown table %q", path, table)
+			}
+
+			continue
+		}
+		pair := monitorPair{name: name}
+		for key, v := range keys {
+			s, ok := v.(string)
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("%s: pair %s: %s must be a string", path, name, key)
+			case key == "lhs":
+				pair.lhs = monitorSource(dir, s)
+			case key == "rhs":
+				pair.rhs = monitorSource(dir, s)
+			default:
+				return nil, fmt.Errorf("%s: pair %s: unknown key %q", path, name, key)
+			}
+		}
+		if pair.lhs == "" || pair.rhs == "" {
+			return nil, fmt.Errorf("%s: pair %s: missing lhs or rhs", path, name)
+		}
+		cfg.pairs = append(cfg.pairs, pair)
+	}
+	if len(cfg.pairs) == 0 {
+		return nil, fmt.Errorf("%s: no [pair.name] tables", path)
+	}
+	sort.Slice(cfg.pairs, func(i, j int) bool {
+		return cfg.pairs[i].name < cfg.pairs[j].name
+	})
+
+	return cfg, nil
+}
+
+// resolvePath returns p relative to dir, unless it is absolute.
+func resolvePath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(dir, p)
+}
+
+// monitorSource returns the grammar source s of the configuration file in
+// dir, with the path resolved relative to dir, or to the repository root for
+// a git source.
+func monitorSource(dir, s string) string {
+	switch {
+	case isURL(s):
+		return s
+	case strings.HasPrefix(s, "git:"):
+		return s + "\x00" + dir
+	}
+
+	return resolvePath(dir, s)
+}
+
+// loadMonitorSource returns the grammar of a source returned by
+// monitorSource, and its display name.
+func loadMonitorSource(src string) ([]Rule, string, error) {
+	s, dir, ok := strings.Cut(src, "\x00")
+	if !ok {
+		grammar, err := parse(s)
+
+		return grammar, s, err
+	}
+	rev, path, ok := strings.Cut(strings.TrimPrefix(s, "git:"), ":")
+	if !ok || rev == "" || path == "" {
+		return nil, s, fmt.Errorf("invalid git source %q, want git:rev:path", s)
+	}
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, s, err
+	}
+	data, err := gitShow(strings.TrimSpace(string(out)), rev, path)
+	if err != nil {
+		return nil, s, err
+	}
+	grammar, err := parseFile(path, data)
+
+	return grammar, s, err
+}
+
+// monitorResult is the result of checking a pair.
+type monitorResult struct {
+	pair     monitorPair
+	lhs, rhs string   // display names
+	new      []string // differences not found in the previous check
+	baseline bool     // the pair was checked for the first time
+	report   *report
+	err      error
+}
+
+// differences returns the differences of a JSON report, one per line: the
+// changed rules and the findings.
+func differences(doc *jsonReport) []string {
+	var list []string
+	for _, r := range doc.Rules {
+		status := r.Status
+		if r.Moved && status == statusNames[ruleEqual] {
+			status = "moved"
+		}
+		list = append(list, fmt.Sprintf("rule %q %s", r.Name, status))
+	}
+	for _, f := range doc.Findings {
+		list = append(list, fmt.Sprintf("%s in rule %q: %s", f.Analyzer, f.Rule, f.Message))
+	}
+
+	return list
+}
+
+// check compares the grammars of pair, storing the JSON report in the state
+// directory, and returns the differences that were not in the stored
+// report.
+func (cfg *monitorConfig) check(pair monitorPair, opts *options) *monitorResult {
+	res := &monitorResult{pair: pair}
+	lgrammar, lname, err := loadMonitorSource(pair.lhs)
+	res.lhs = lname
+	if err != nil {
+		res.err = err
+
+		return res
+	}
+	rgrammar, rname, err := loadMonitorSource(pair.rhs)
+	res.rhs = rname
+	if err != nil {
+		res.err = err
+
+		return res
+	}
+	res.report = newReport(lname, rname, lgrammar, rgrammar, opts)
+	var buf bytes.Buffer
+	if res.err = formatJSON(&buf, res.report); res.err != nil {
+		return res
+	}
+	var doc jsonReport
+	if res.err = json.Unmarshal(buf.Bytes(), &doc); res.err != nil {
+		return res
+	}
+
+	path := filepath.Join(cfg.state, pair.name+".json")
+	prev := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		res.baseline = true
+	case err != nil:
+		res.err = err
+
+		return res
+	default:
+		var old jsonReport
+		if err := json.Unmarshal(data, &old); err != nil {
+			res.err = fmt.Errorf("%s: %w", path, err)
+
+			return res
+		}
+		for _, d := range differences(&old) {
+			prev[d] = true
+		}
+	}
+	for _, d := range differences(&doc) {
+		if !prev[d] && !res.baseline {
+			res.new = append(res.new, d)
+		}
+	}
+
+	if err := os.MkdirAll(cfg.state, 0o755); err != nil {
+		res.err = err
+
+		return res
+	}
+	res.err = os.WriteFile(path, buf.Bytes(), 0o644)
+
+	return res
+}
+
+// monitorPayload is the JSON payload posted to the webhook.
+type monitorPayload struct {
+	Pair        string    `json:"pair"`
+	LHS         string    `json:"lhs"`
+	RHS         string    `json:"rhs"`
+	Time        time.Time `json:"time"`
+	Differences []string  `json:"differences"`
+}
+
+// notify posts the new differences of res to the webhook.
+func (cfg *monitorConfig) notify(ctx context.Context, res *monitorResult) error {
+	data, err := json.Marshal(monitorPayload{res.pair.name, res.lhs, res.rhs, time.Now(), res.new})
+	if err != nil {
+		return err
+	}
+
+	return postWebhook(ctx, cfg.webhook, data)
+}
+
+// writeMonitorResult writes the outcome of a check.
+func writeMonitorResult(w io.Writer, res *monitorResult) {
+	switch {
+	case res.err != nil:
+		fmt.Fprintf(w, "! %s: %v\n", res.pair.name, res.err)
+	case res.baseline:
+		fmt.Fprintf(w, "~ %s: baseline recorded\n", res.pair.name)
+	case len(res.new) == 0:
+		fmt.Fprintf(w, "~ %s: no new differences\n", res.pair.name)
+	default:
+		fmt.Fprintf(w, "! %s: %d new differences between %s and %s\n", res.pair.name, len(res.new), res.lhs, res.rhs)
+		for _, d := range res.new {
+			fmt.Fprintf(w, "+ %s\n", d)
+		}
+	}
+}
+
+// monitorHealth is the health of the monitor: the pairs that failed or had
+// new differences in the last check.
+type monitorHealth struct {
+	mu     sync.Mutex
+	failed map[string]string // pair name to reason
+}
+
+func (h *monitorHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(h.failed) == 0 {
+		fmt.Fprintln(w, "ok")
+
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	names := make([]string, 0, len(h.failed))
+	for name := range h.failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s: %s\n", name, h.failed[name])
+	}
+}
+
+// update sets the health of the pair of res.
+func (h *monitorHealth) update(res *monitorResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case res.err != nil:
+		h.failed[res.pair.name] = res.err.Error()
+	case len(res.new) > 0:
+		h.failed[res.pair.name] = fmt.Sprintf("%d new differences", len(res.new))
+	default:
+		delete(h.failed, res.pair.name)
+	}
+}
+
+// runMonitor periodically compares the pairs of grammars of the
+// configuration, notifying the webhook of the new differences and the
+// -notify-url webhook of the changes of category.  With -once,
+// the pairs are checked once and the exit status is 1 when a check fails or
+// finds new differences.  Otherwise, the health endpoint at /healthz replies
+// with a service unavailable status while the last check of a pair failed or
+// found new differences.
+func runMonitor(args []string) {
+	flags := flag.NewFlagSet("monitor", flag.ExitOnError)
+	config := flags.String("config", "monitor.toml", "configuration file")
+	once := flags.Bool("once", false, "check the pairs once and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, monitorUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	cfg, err := readMonitorConfig(*config)
+	if err != nil {
+		fatal(err)
+	}
+	opts := compareOptions()
+	notify := flagNotifier(cfg.state)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	health := &monitorHealth{failed: make(map[string]string)}
+	if cfg.addr != "" && !*once {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", health)
+		go func() {
+			fatal(http.ListenAndServe(cfg.addr, mux))
+		}()
+		slog.Info("serving health", "addr", cfg.addr)
+	}
+
+	for {
+		status := 0
+		for _, pair := range cfg.pairs {
+			res := cfg.check(pair, opts)
+			writeMonitorResult(os.Stdout, res)
+			health.update(res)
+			if res.err != nil || len(res.new) > 0 {
+				status = 1
+			}
+			if len(res.new) > 0 && cfg.webhook != "" {
+				if err := cfg.notify(ctx, res); err != nil {
+					logError(err)
+				}
+			}
+			if res.report != nil {
+				if err := notify.notifyReport(ctx, res.report, opts); err != nil {
+					logError(err)
+				}
+			}
+		}
+		if *once {
+			os.Exit(status)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.interval):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// name returns the key matching the rule name s: s itself with exact
+// matching, s case folded with fold matching and s case folded without
+// underscores with style matching, so that parse_expr, ParseExpr and
+// parseExpr are the same rule.
+func (opts *options) name(s string) string {
+	switch opts.matchNames {
+	case "fold":
+		return foldName(s)
+	case "style":
+		return foldName(strings.ReplaceAll(s, "_", ""))
+	}
+
+	return s
+}
+
+// lhsName returns the key matching the lhs rule name s, as name, or the key
+// of the rhs rule paired with it by structure.
+func (opts *options) lhsName(s string) string {
+	key := opts.name(s)
+	if p, ok := opts.pairs[key]; ok {
+		return p
+	}
+
+	return key
+}
+
+// renameIdents returns toks with each identifier replaced by fn.
+func renameIdents(toks []string, fn func(string) string) []string {
+	list := make([]string, len(toks))
+	for i, tok := range toks {
+		if tok != "" && identLen(tok) == len(tok) {
+			tok = fn(tok)
+		}
+		list[i] = tok
+	}
+
+	return list
+}
+
+// foldName returns s with each rune replaced by the smallest rune
+// equivalent to it under Unicode simple case folding.
+func foldName(s string) string {
+	return strings.Map(func(r rune) rune {
+		fold := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < fold {
+				fold = f
+			}
+		}
+
+		return fold
+	}, s)
+}
+
+// renamed returns the changes matching rules with different names.
+func renamed(changes []change) []change {
+	var list []change
+	for _, c := range changes {
+		if c.lhs != nil && c.rhs != nil && c.lhs.Name != c.rhs.Name {
+			list = append(list, c)
+		}
+	}
+
+	return list
+}
+
+// writeRenamed writes the rhs rules matched with a lhs rule with a different
+// name.
+func writeRenamed(w io.Writer, list []change) {
+	for _, c := range list {
+		fmt.Fprintf(w, "~ rule %q matched with lhs rule %q\n", c.rhs.Name, c.lhs.Name)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,312 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:generate go run mknorm.go -ucd ucd
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Hangul syllable composition constants, as defined in chapter 3.12 of the
+// Unicode Standard.
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// compositions maps a canonical decomposition pair to its primary
+// composite.
+var compositions = func() map[[2]rune]rune {
+	m := make(map[[2]rune]rune)
+	for r, d := range decompositions {
+		if len(d) == 2 && !compositionExclusions[r] {
+			m[[2]rune{d[0], d[1]}] = r
+		}
+	}
+
+	return m
+}()
+
+// nfd returns s in Unicode Normalization Form D.
+func nfd(s string) string {
+	return string(decompose([]rune(s)))
+}
+
+// nfc returns s in Unicode Normalization Form C.
+func nfc(s string) string {
+	return string(compose(decompose([]rune(s))))
+}
+
+// normalizeForm returns s normalized to the specified form, NFC, NFD or
+// none.
+func normalizeForm(s, form string) string {
+	switch form {
+	case "NFC":
+		return nfc(s)
+	case "NFD":
+		return nfd(s)
+	}
+
+	return s
+}
+
+// decompose returns the full canonical decomposition of runes, in canonical
+// order.
+func decompose(runes []rune) []rune {
+	var list []rune
+	var add func(r rune)
+	add = func(r rune) {
+		if r >= hangulSBase && r < hangulSBase+hangulSCount {
+			i := r - hangulSBase
+			list = append(list, hangulLBase+i/hangulNCount)
+			list = append(list, hangulVBase+(i%hangulNCount)/hangulTCount)
+			if t := i % hangulTCount; t != 0 {
+				list = append(list, hangulTBase+t)
+			}
+
+			return
+		}
+		if d, ok := decompositions[r]; ok {
+			for _, c := range d {
+				add(c)
+			}
+
+			return
+		}
+		list = append(list, r)
+	}
+	for _, r := range runes {
+		add(r)
+	}
+
+	// Sort each sequence of non starters by combining class.
+	for i := 0; i < len(list); {
+		if combiningClasses[list[i]] == 0 {
+			i++
+
+			continue
+		}
+		j := i
+		for j < len(list) && combiningClasses[list[j]] != 0 {
+			j++
+		}
+		seq := list[i:j]
+		sort.SliceStable(seq, func(a, b int) bool {
+			return combiningClasses[seq[a]] < combiningClasses[seq[b]]
+		})
+		i = j
+	}
+
+	return list
+}
+
+// compose applies the canonical composition algorithm to the decomposed
+// runes.
+func compose(runes []rune) []rune {
+	if len(runes) == 0 {
+		return runes
+	}
+
+	list := []rune{runes[0]}
+	starter := 0
+	if combiningClasses[runes[0]] != 0 {
+		starter = -1
+	}
+	last := -1 // combining class of the last non composed rune after starter
+	for _, r := range runes[1:] {
+		// r is blocked from the starter when a rune in between has a
+		// combining class of zero or not lower than that of r.
+		ccc := int(combiningClasses[r])
+		if starter >= 0 && (last == -1 || last < ccc) {
+			if c, ok := composePair(list[starter], r); ok {
+				list[starter] = c
+
+				continue
+			}
+		}
+		if ccc == 0 {
+			starter = len(list)
+			last = -1
+		} else {
+			last = ccc
+		}
+		list = append(list, r)
+	}
+
+	return list
+}
+
+// composePair returns the primary composite of a and b, if any.
+func composePair(a, b rune) (rune, bool) {
+	// Hangul LV and LVT syllables.
+	if a >= hangulLBase && a < hangulLBase+hangulLCount &&
+		b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+(b-hangulVBase))*hangulTCount, true
+	}
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + (b - hangulTBase), true
+	}
+	c, ok := compositions[[2]rune{a, b}]
+
+	return c, ok
+}
+
+// normalizeTokens normalizes the literals and character classes in toks to
+// the specified form.
+func normalizeTokens(toks []string, form string) []string {
+	if form == "" || form == "none" {
+		return toks
+	}
+
+	list := make([]string, len(toks))
+	for i, tok := range toks {
+		switch {
+		case isLiteral(tok):
+			tok = normalizeForm(tok, form)
+		case tok[0] == '[':
+			tok = normalizeClass(tok, form)
+		}
+		list[i] = tok
+	}
+
+	return list
+}
+
+// normalizeClass normalizes the single code points of the character class
+// tok to the specified form, when their normalization is a single code
+// point.  The ranges, the escapes and the Unicode classes are left alone,
+// since normalizing an endpoint would change the matched code points.
+func normalizeClass(tok, form string) string {
+	if len(tok) < 2 || tok[len(tok)-1] != ']' {
+		return tok
+	}
+	s := tok[1 : len(tok)-1]
+
+	var b strings.Builder
+	b.WriteByte('[')
+	for len(s) > 0 {
+		if strings.HasPrefix(s, `\p`) {
+			_, n, err := parseCategory(s)
+			if err != nil {
+				// Leave the invalid class as is.
+				return tok
+			}
+			b.WriteString(s[:n])
+			s = s[n:]
+
+			continue
+		}
+
+		_, n := parseChar(s)
+		if len(s) > n+1 && s[n] == '-' {
+			_, m := parseChar(s[n+1:])
+			b.WriteString(s[:n+1+m])
+			s = s[n+1+m:]
+
+			continue
+		}
+		c := s[:n]
+		if c[0] != '\\' {
+			if norm := normalizeForm(c, form); utf8.RuneCountInString(norm) == 1 {
+				c = norm
+			}
+		}
+		b.WriteString(c)
+		s = s[n:]
+	}
+	b.WriteByte(']')
+
+	return b.String()
+}
+
+// isLiteral reports whether tok is a quoted literal.
+func isLiteral(tok string) bool {
+	return tok[0] == '\'' || tok[0] == '"'
+}
+
+// literalChange describes two byte different literals that are canonically
+// equivalent.
+type literalChange struct {
+	lhs, rhs string
+}
+
+// diffLiterals returns the literals replaced in the token edit script of c
+// that only differ in their Unicode composition, pairing them in order.
+func diffLiterals(c change) []literalChange {
+	var changes []literalChange
+	var ldel, rins []string
+	flush := func() {
+		for k := 0; k < len(ldel) && k < len(rins); k++ {
+			if nfd(ldel[k]) == nfd(rins[k]) {
+				changes = append(changes, literalChange{ldel[k], rins[k]})
+			}
+		}
+		ldel, rins = ldel[:0], rins[:0]
+	}
+
+	for _, e := range c.edits {
+		switch e.op {
+		case opEqual:
+			if !isSpaceToken(c.ltoks[e.i]) {
+				flush()
+			}
+		case opDelete:
+			if tok := c.ltoks[e.i]; isLiteral(tok) {
+				ldel = append(ldel, tok)
+			}
+		case opInsert:
+			if tok := c.rtoks[e.j]; isLiteral(tok) {
+				rins = append(rins, tok)
+			}
+		}
+	}
+	flush()
+
+	return changes
+}
+
+// formName returns the normalization form of s: NFC, NFD, NFC and NFD when s
+// is not affected by normalization, or none.
+func formName(s string) string {
+	isNFC := nfc(s) == s
+	isNFD := nfd(s) == s
+	switch {
+	case isNFC && isNFD:
+		return "NFC and NFD"
+	case isNFC:
+		return "NFC"
+	case isNFD:
+		return "NFD"
+	}
+
+	return "none"
+}
+
+// escapeNonASCII returns s with non ASCII code points as \u escapes, so that
+// canonically equivalent literals can be told apart.
+func escapeNonASCII(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x80 {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "\\u%04X", r)
+		}
+	}
+
+	return b.String()
+}
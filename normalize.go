@@ -0,0 +1,374 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// normalizePass is a named normalization of the rule expressions of a
+// grammar.
+type normalizePass struct {
+	name string
+	help string
+	run  func(grammar []Rule) []Rule
+}
+
+// normalizePasses are the normalization passes, by name.
+var normalizePasses = []*normalizePass{
+	{"strip-comments", "remove the comments", tokenPass(stripComments)},
+	{"normalize-whitespace", "collapse the spacing between tokens", tokenPass(normalizeSpacing)},
+	{"normalize-literals", "quote the literals with double quotes and minimal escapes", tokenPass(normalizeLiterals)},
+	{"merge-charclasses", "sort and merge the ranges of the character classes", tokenPass(mergeClasses)},
+	{"strip-labels", "remove the recovery expressions and labeled failures", func(grammar []Rule) []Rule {
+		return stripRecoveryRules(normalizeRules(grammar))
+	}},
+	{"strip-actions", "remove the state change blocks", astPass(stripActions)},
+	{"canonical-assoc", "flatten nested choices and sequences, removing redundant parentheses", astPass(flatten)},
+	{"left-recursion", "eliminate the direct left recursion", func(grammar []Rule) []Rule {
+		return eliminateLeftRecursionRules(normalizeRules(grammar))
+	}},
+	{"left-factor", "left factor the choices", func(grammar []Rule) []Rule {
+		return leftFactorRules(normalizeRules(grammar))
+	}},
+}
+
+// Normalizer is a pipeline of normalization passes, applied in order to both
+// grammars before comparison so that the differences they remove are not
+// reported.  Normalizers compose by appending.
+type Normalizer []*normalizePass
+
+// parseNormalizer returns the normalizer with the comma separated passes in
+// s.
+func parseNormalizer(s string) (Normalizer, error) {
+	var n Normalizer
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		pass := lookupPass(name)
+		if pass == nil {
+			return nil, fmt.Errorf("unknown normalization pass %q, want one of %s", name, passNames())
+		}
+		n = append(n, pass)
+	}
+
+	return n, nil
+}
+
+// lookupPass returns the named normalization pass, or nil.
+func lookupPass(name string) *normalizePass {
+	for _, pass := range normalizePasses {
+		if pass.name == name {
+			return pass
+		}
+	}
+
+	return nil
+}
+
+// passNames returns the names of the normalization passes, comma separated.
+func passNames() string {
+	list := make([]string, len(normalizePasses))
+	for i, pass := range normalizePasses {
+		list[i] = pass.name
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// Normalize returns a copy of grammar with the passes of n applied in order.
+func (n Normalizer) Normalize(grammar []Rule) []Rule {
+	for _, pass := range n {
+		grammar = pass.run(grammar)
+	}
+
+	return grammar
+}
+
+// String returns the names of the passes of n, comma separated.
+func (n Normalizer) String() string {
+	list := make([]string, len(n))
+	for i, pass := range n {
+		list[i] = pass.name
+	}
+
+	return strings.Join(list, ",")
+}
+
+// tokenPass returns a pass rewriting the tokens of each rule expression with
+// fn.
+func tokenPass(fn func(toks []string) []string) func(grammar []Rule) []Rule {
+	return func(grammar []Rule) []Rule {
+		list := make([]Rule, len(grammar))
+		for i, rule := range grammar {
+			rule.Expr = strings.Join(fn(tokenize(rule.Expr)), "")
+			list[i] = rule
+		}
+
+		return list
+	}
+}
+
+// astPass returns a pass rewriting the syntax tree of each rule expression
+// with fn.  Like the other passes on the syntax tree, the expressions are
+// left in canonical form, except for invalid ones.
+func astPass(fn func(n node) (node, bool)) func(grammar []Rule) []Rule {
+	return func(grammar []Rule) []Rule {
+		list := make([]Rule, len(grammar))
+		for i, rule := range grammar {
+			if n, err := parseExpr(rule.Expr); err == nil {
+				n, _ = fn(n)
+				rule.Expr = exprString(n)
+			}
+			list[i] = rule
+		}
+
+		return list
+	}
+}
+
+// stripComments returns toks without the comments.  The parser already
+// removes the comments from the rule expressions, but not the grammars
+// loaded from other sources, such as a snapshot.
+func stripComments(toks []string) []string {
+	var list []string
+	for _, tok := range toks {
+		if !isCommentToken(tok) {
+			list = append(list, tok)
+		}
+	}
+
+	return list
+}
+
+// normalizeSpacing returns toks with a single space between tokens, except
+// after an open parenthesis or a prefix operator and before a close
+// parenthesis or a suffix operator, where the spacing is removed, as at the
+// start and end.
+func normalizeSpacing(toks []string) []string {
+	var list []string
+	for _, tok := range toks {
+		if isSpaceToken(tok) {
+			continue
+		}
+		if len(list) > 0 {
+			prev := list[len(list)-1]
+			_, _, bound := parseBound(tok)
+			if !bound && prev != "(" && prev != "&" && prev != "!" &&
+				tok != ")" && tok != "?" && tok != "*" && tok != "+" {
+				list = append(list, " ")
+			}
+		}
+		list = append(list, tok)
+	}
+
+	return list
+}
+
+// normalizeLiterals returns toks with each literal double quoted, escaping
+// only the characters that need it.
+func normalizeLiterals(toks []string) []string {
+	list := make([]string, len(toks))
+	for i, tok := range toks {
+		if isLiteral(tok) && len(tok) >= 2 {
+			var b strings.Builder
+			b.WriteByte('"')
+			for _, r := range unquote(tok[1 : len(tok)-1]) {
+				b.WriteString(escapeChar(r, `"\`))
+			}
+			b.WriteByte('"')
+			tok = b.String()
+		}
+		list[i] = tok
+	}
+
+	return list
+}
+
+// mergeClasses returns toks with each character class rewritten with its
+// ranges sorted and merged.  Classes with Unicode categories or scripts are
+// kept, since their ranges are too many.
+func mergeClasses(toks []string) []string {
+	list := make([]string, len(toks))
+	for i, tok := range toks {
+		if tok[0] == '[' && !strings.Contains(tok, `\p`) {
+			if set, err := parseClass(tok); err == nil {
+				var b strings.Builder
+				b.WriteByte('[')
+				for _, r := range set {
+					b.WriteString(escapeChar(r.lo, `[]\-`))
+					if r.hi > r.lo {
+						if r.hi > r.lo+1 {
+							b.WriteByte('-')
+						}
+						b.WriteString(escapeChar(r.hi, `[]\-`))
+					}
+				}
+				b.WriteByte(']')
+				tok = b.String()
+			}
+		}
+		list[i] = tok
+	}
+
+	return list
+}
+
+// escapeChar returns r escaped for a literal or character class, where the
+// characters in special must be escaped.  Non printable characters are
+// escaped in octal when possible.
+func escapeChar(r rune, special string) string {
+	switch r {
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	case '-':
+		if strings.ContainsRune(special, r) {
+			// The grammar has no escape for '-'.
+			return `\055`
+		}
+	}
+	if strings.ContainsRune(special, r) {
+		return `\` + string(r)
+	}
+	if !unicode.IsPrint(r) && r < 0o300 {
+		return fmt.Sprintf(`\%03o`, r)
+	}
+
+	return string(r)
+}
+
+// stripActions returns n without the state change blocks.  A sequence of
+// only state change blocks is replaced by the empty literal, since both
+// match the empty string.  The result is false when n is unchanged.
+func stripActions(n node) (node, bool) {
+	switch n := n.(type) {
+	case *stateNode:
+		return &litNode{text: `""`}, true
+	case *seqNode:
+		changed := false
+		var list []node
+		for _, item := range n.items {
+			if _, ok := item.(*stateNode); ok {
+				changed = true
+
+				continue
+			}
+			item, ok := stripActions(item)
+			changed = changed || ok
+			list = append(list, item)
+		}
+		if !changed {
+			return n, false
+		}
+		if len(list) == 0 {
+			return &litNode{text: `""`}, true
+		}
+
+		return newSeq(list), true
+	case *choiceNode:
+		changed := false
+		list := make([]node, len(n.alts))
+		for i, alt := range n.alts {
+			var ok bool
+			list[i], ok = stripActions(alt)
+			changed = changed || ok
+		}
+		if !changed {
+			return n, false
+		}
+
+		return &choiceNode{alts: list}, true
+	case *predNode:
+		if expr, ok := stripActions(n.expr); ok {
+			return &predNode{op: n.op, expr: expr}, true
+		}
+	case *repeatNode:
+		if expr, ok := stripActions(n.expr); ok {
+			r := *n
+			r.expr = expr
+
+			return &r, true
+		}
+	case *recoveryNode:
+		expr, lok := stripActions(n.expr)
+		recover, rok := stripActions(n.recover)
+		if lok || rok {
+			return &recoveryNode{expr: expr, labels: n.labels, recover: recover}, true
+		}
+	}
+
+	return n, false
+}
+
+// flatten returns n with the choices nested in a choice and the sequences
+// nested in a sequence merged into it, since both operators are
+// associative.  The result is false when n is unchanged.
+func flatten(n node) (node, bool) {
+	switch n := n.(type) {
+	case *choiceNode:
+		changed := false
+		var list []node
+		for _, alt := range n.alts {
+			alt, ok := flatten(alt)
+			changed = changed || ok
+			if choice, ok := alt.(*choiceNode); ok {
+				list = append(list, choice.alts...)
+				changed = true
+			} else {
+				list = append(list, alt)
+			}
+		}
+		if !changed {
+			return n, false
+		}
+
+		return &choiceNode{alts: list}, true
+	case *seqNode:
+		changed := false
+		var list []node
+		for _, item := range n.items {
+			item, ok := flatten(item)
+			changed = changed || ok
+			if seq, ok := item.(*seqNode); ok {
+				list = append(list, seq.items...)
+				changed = true
+			} else {
+				list = append(list, item)
+			}
+		}
+		if !changed {
+			return n, false
+		}
+
+		return &seqNode{items: list}, true
+	case *predNode:
+		if expr, ok := flatten(n.expr); ok {
+			return &predNode{op: n.op, expr: expr}, true
+		}
+	case *repeatNode:
+		if expr, ok := flatten(n.expr); ok {
+			r := *n
+			r.expr = expr
+
+			return &r, true
+		}
+	case *recoveryNode:
+		expr, lok := flatten(n.expr)
+		recover, rok := flatten(n.recover)
+		if lok || rok {
+			return &recoveryNode{expr: expr, labels: n.labels, recover: recover}, true
+		}
+	}
+
+	return n, false
+}
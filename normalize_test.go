@@ -0,0 +1,53 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// fuzzPass checks that the normalization pass named name never panics and
+// that the expressions it returns parse when the grammar parses.  When
+// idempotent is set, it also checks that applying the pass again does not
+// change the rules.
+func fuzzPass(f *testing.F, name string, idempotent bool) {
+	pass := lookupPass(name)
+	if pass == nil {
+		f.Fatalf("unknown normalization pass %q", name)
+	}
+	for _, seed := range grammarSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		grammar, err := ParseGrammar("fuzz.peg", []byte(src))
+		if err != nil {
+			return
+		}
+		once := Normalizer{pass}.Normalize(grammar)
+		for _, rule := range once {
+			if _, err := parseExprArg("fuzz.peg", rule.Expr); err != nil {
+				t.Fatalf("rule %s: normalized expression %q does not parse: %v", rule.Name, rule.Expr, err)
+			}
+		}
+		if !idempotent {
+			return
+		}
+		twice := Normalizer{pass}.Normalize(once)
+		if !slices.EqualFunc(once, twice, func(a, b Rule) bool { return a.Name == b.Name && a.Expr == b.Expr }) {
+			t.Fatalf("pass is not idempotent:\n%v\n%v", once, twice)
+		}
+	})
+}
+
+func FuzzStripComments(f *testing.F)       { fuzzPass(f, "strip-comments", true) }
+func FuzzNormalizeWhitespace(f *testing.F) { fuzzPass(f, "normalize-whitespace", true) }
+func FuzzNormalizeLiterals(f *testing.F)   { fuzzPass(f, "normalize-literals", true) }
+func FuzzMergeCharclasses(f *testing.F)    { fuzzPass(f, "merge-charclasses", true) }
+func FuzzStripLabels(f *testing.F)         { fuzzPass(f, "strip-labels", true) }
+func FuzzStripActions(f *testing.F)        { fuzzPass(f, "strip-actions", true) }
+func FuzzCanonicalAssoc(f *testing.F)      { fuzzPass(f, "canonical-assoc", true) }
+func FuzzLeftRecursion(f *testing.F)       { fuzzPass(f, "left-recursion", false) }
+func FuzzLeftFactor(f *testing.F)          { fuzzPass(f, "left-factor", false) }
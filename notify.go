@@ -0,0 +1,246 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// notifySummary is the summary of a comparison posted to the webhook.  The
+// category is the semantic version increment required by the changes, and
+// the previous category the one of the last comparison of the same
+// grammars.
+type notifySummary struct {
+	LHS      string         `json:"lhs"`
+	RHS      string         `json:"rhs"`
+	Category string         `json:"category"`
+	Previous string         `json:"previous"`
+	Rules    map[string]int `json:"rules"` // changed rules by status
+	Findings int            `json:"findings"`
+	Reasons  []string       `json:"reasons,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+// maxNotifyReasons is the maximum number of reasons in a summary.
+const maxNotifyReasons = 10
+
+// newNotifySummary returns the summary of the comparison of lgrammar and
+// rgrammar, with changes and a number of findings.
+func newNotifySummary(lname, rname string, lgrammar, rgrammar []Rule, changes []change, findings int, opts *options) *notifySummary {
+	level, reasons := classify(lgrammar, rgrammar, opts)
+	s := &notifySummary{
+		LHS:      lname,
+		RHS:      rname,
+		Category: level.String(),
+		Rules:    make(map[string]int),
+		Findings: findings,
+		Time:     time.Now(),
+	}
+	for _, c := range changes {
+		if c.kind != ruleEqual {
+			s.Rules[statusNames[c.kind]]++
+		}
+	}
+	for _, r := range reasons {
+		if len(s.Reasons) == maxNotifyReasons {
+			break
+		}
+		s.Reasons = append(s.Reasons, fmt.Sprintf("%s: rule %q: %s", r.level, r.rule.Name, r.msg))
+	}
+
+	return s
+}
+
+// Text returns the summary as a line of text, for the chat templates.
+func (s *notifySummary) Text() string {
+	var counts []string
+	for _, status := range statusNames {
+		if n := s.Rules[status]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	if s.Findings > 0 {
+		counts = append(counts, fmt.Sprintf("%d findings", s.Findings))
+	}
+	text := fmt.Sprintf("pegcmp: %s -> %s changed from %s to %s", s.LHS, s.RHS, s.Previous, s.Category)
+	if len(counts) > 0 {
+		text += ": " + strings.Join(counts, ", ")
+	}
+
+	return text
+}
+
+// notifyTemplates are the included webhook payload templates, executed with
+// the summary.  The json function encodes a value as JSON.
+var notifyTemplates = map[string]string{
+	"json":  `{{json .}}`,
+	"slack": `{"text": {{json .Text}}}`,
+	"teams": `{"@type": "MessageCard", "@context": "https://schema.org/extensions", "summary": {{json .Text}}, "title": "pegcmp", "text": {{json .Text}}}`,
+}
+
+// parseNotifyTemplate returns the included template name or, when it is not
+// an included template, the template in the file named name.
+func parseNotifyTemplate(name string) (*template.Template, error) {
+	text, ok := notifyTemplates[name]
+	if !ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("notify template: %w", err)
+		}
+		text = string(data)
+	}
+	funcs := template.FuncMap{
+		"json": func(v any) (string, error) {
+			var b strings.Builder
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			err := enc.Encode(v)
+
+			return strings.TrimSuffix(b.String(), "\n"), err
+		},
+	}
+
+	return template.New(name).Funcs(funcs).Parse(text)
+}
+
+// categoryStore is the category of the last comparison of each pair of
+// grammars, kept in memory and, when dir is not empty, persisted in dir.  It
+// is safe for concurrent use.
+type categoryStore struct {
+	dir string
+
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// notifyStateDir returns the directory of the persisted categories, or an
+// empty string if the user has no cache directory.
+func notifyStateDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "pegcmp", "notify")
+}
+
+// swap sets the category of the comparison of lhs and rhs, returning the
+// previous one, or none when they were never compared.
+func (s *categoryStore) swap(lhs, rhs, category string) string {
+	h := sha256.Sum256([]byte(lhs + "\x00" + rhs))
+	key := hex.EncodeToString(h[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.last[key]
+	if !ok {
+		prev = semverNone.String()
+		if s.dir != "" {
+			if data, err := os.ReadFile(filepath.Join(s.dir, key)); err == nil {
+				prev = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	s.last[key] = category
+	if s.dir != "" && prev != category {
+		// A lost category only causes a repeated notification.
+		os.MkdirAll(s.dir, 0o755)
+		os.WriteFile(filepath.Join(s.dir, key), []byte(category+"\n"), 0o644)
+	}
+
+	return prev
+}
+
+// notifier posts the summary of the comparisons whose category changed to a
+// webhook.  A nil notifier posts nothing.
+type notifier struct {
+	url   string
+	tmpl  *template.Template
+	store *categoryStore
+}
+
+// newNotifier returns a notifier posting to url the payload of the template
+// tmpl, with the categories persisted in dir if not empty.
+func newNotifier(url, tmpl, dir string) (*notifier, error) {
+	t, err := parseNotifyTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notifier{url, t, &categoryStore{dir: dir, last: make(map[string]string)}}, nil
+}
+
+// notify posts s to the webhook when its category differs from the one of
+// the last comparison of the same grammars.
+func (n *notifier) notify(ctx context.Context, s *notifySummary) error {
+	if n == nil {
+		return nil
+	}
+	if s.Previous = n.store.swap(s.LHS, s.RHS, s.Category); s.Previous == s.Category {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, s); err != nil {
+		return fmt.Errorf("notify template: %w", err)
+	}
+
+	return postWebhook(ctx, n.url, buf.Bytes())
+}
+
+// notifyReport posts the summary of r, as notify.
+func (n *notifier) notifyReport(ctx context.Context, r *report, opts *options) error {
+	if n == nil {
+		return nil
+	}
+
+	return n.notify(ctx, newNotifySummary(r.lpath, r.rpath, r.lgrammar, r.rgrammar, r.changes, len(r.findings), opts))
+}
+
+// postWebhook posts the JSON payload data to the webhook at url.
+func postWebhook(ctx context.Context, url string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// flagNotifier returns the notifier specified on the command line, with the
+// categories persisted in dir, or nil.
+func flagNotifier(dir string) *notifier {
+	if *notifyURLFlag == "" {
+		return nil
+	}
+	n, err := newNotifier(*notifyURLFlag, *notifyTemplateFlag, dir)
+	if err != nil {
+		fatal(err)
+	}
+
+	return n
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// output is a report sink: a format and the path of the file where the
+// report is written, or "-" for stdout.
+type output struct {
+	format string
+	path   string
+}
+
+// outputList is a flag that can be specified multiple times, as
+// format=path.
+type outputList []output
+
+func (l *outputList) String() string {
+	list := make([]string, len(*l))
+	for i, o := range *l {
+		list[i] = o.format + "=" + o.path
+	}
+
+	return strings.Join(list, ",")
+}
+
+func (l *outputList) Set(s string) error {
+	format, path, ok := strings.Cut(s, "=")
+	switch {
+	case !ok || path == "":
+		return fmt.Errorf("%q: want format=path", s)
+	case formatters[format] == nil:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	*l = append(*l, output{format: format, path: path})
+
+	return nil
+}
+
+// writeOutputs writes r to each output in l.
+func writeOutputs(l outputList, r *report) error {
+	for _, o := range l {
+		if err := writeOutput(o, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeOutput writes r in the format of o to its file, or appends it to the
+// database for the sqlite format.
+func writeOutput(o output, r *report) error {
+	switch {
+	case o.path == "-":
+		return formatters[o.format](os.Stdout, r)
+	case o.format == "sqlite":
+		return appendSQLite(o.path, r)
+	}
+	f, err := os.Create(o.path)
+	if err != nil {
+		return err
+	}
+	if err := formatters[o.format](f, r); err != nil {
+		f.Close()
+
+		return fmt.Errorf("%s: %w", o.path, err)
+	}
+
+	return f.Close()
+}
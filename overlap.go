@@ -0,0 +1,44 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// formatOverlap writes the rules defined by both grammars, marking the equal
+// rules with '=' and the modified rules with '~', followed by a summary with
+// the number of rules defined only by lhs or rhs.
+func formatOverlap(w io.Writer, r *report) error {
+	var equal, modified, lonly, ronly int
+	for _, c := range r.changes {
+		switch c.kind {
+		case ruleEqual:
+			equal++
+			fmt.Fprintf(w, "= %s\n", c.rhs.Name)
+		case ruleModified:
+			modified++
+			fmt.Fprintf(w, "~ %s\n", c.rhs.Name)
+		case ruleRemoved:
+			lonly++
+		case ruleAdded:
+			ronly++
+		}
+	}
+	if equal+modified > 0 {
+		fmt.Fprintln(w)
+	}
+
+	shared := equal + modified
+	fmt.Fprintf(w, "%d shared rules: %d equal, %d modified\n", shared, equal, modified)
+	fmt.Fprintf(w, "%d lhs only rules, %d rhs only rules\n", lonly, ronly)
+	if total := shared + lonly; total > 0 {
+		fmt.Fprintf(w, "%.1f%% of the lhs rules are shared, %.1f%% are equal\n",
+			100*float64(shared)/float64(total), 100*float64(equal)/float64(total))
+	}
+
+	return nil
+}
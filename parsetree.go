@@ -0,0 +1,144 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const parseUsage = `Usage: pegcmp parse [-format sexp|json] [-start rule] path input-path`
+
+// parseNode is a successful rule invocation in a parse tree, matching the
+// input from start to end.
+type parseNode struct {
+	rule       string
+	start, end int
+	children   []*parseNode
+}
+
+// parseTree matches input with the rule start of s, returning the parse tree
+// of the match.
+func parseTree(s *syntax, input, start string, opts *corpusOptions) (*parseNode, outcome, error) {
+	m := newCorpusMachine(s, input, newProfile(), opts)
+	m.tree = true
+	var out outcome
+	var err error
+	out.end, out.ok, err = m.run(start)
+	out.size = len(input)
+	if err != nil || !out.ok {
+		return nil, out, err
+	}
+
+	return m.kids[0], out, nil
+}
+
+// writeSexp writes the tree n as an s-expression, one node per line indented
+// by its depth, with the text matched by the leaves.
+func writeSexp(w io.Writer, n *parseNode, input string) {
+	var b strings.Builder
+	var write func(n *parseNode, depth int)
+	write = func(n *parseNode, depth int) {
+		if depth > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString("(" + n.rule)
+		if len(n.children) == 0 {
+			b.WriteString(" " + strconv.Quote(input[n.start:n.end]))
+		}
+		for _, child := range n.children {
+			write(child, depth+1)
+		}
+		b.WriteString(")")
+	}
+	write(n, 0)
+	fmt.Fprintln(w, b.String())
+}
+
+// jsonParseNode is the JSON representation of a parse tree.
+type jsonParseNode struct {
+	Rule     string          `json:"rule"`
+	Start    int             `json:"start"`
+	End      int             `json:"end"`
+	Text     string          `json:"text,omitempty"`
+	Children []jsonParseNode `json:"children,omitempty"`
+}
+
+// newJSONParseNode returns the JSON representation of the tree n, with the
+// text matched by the leaves.
+func newJSONParseNode(n *parseNode, input string) jsonParseNode {
+	node := jsonParseNode{Rule: n.rule, Start: n.start, End: n.end}
+	if len(n.children) == 0 {
+		node.Text = input[n.start:n.end]
+	}
+	for _, child := range n.children {
+		node.Children = append(node.Children, newJSONParseNode(child, input))
+	}
+
+	return node
+}
+
+// runParse matches an input with a grammar, writing the parse tree.  It exits
+// with status 1 when the grammar does not accept the whole input.
+func runParse(args []string) {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	format := flags.String("format", "sexp", "output format: sexp or json")
+	start := flags.String("start", "", "start rule (default the first rule)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, parseUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	args = parseInterspersed(flags, args)
+	if len(args) != 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	if *format != "sexp" && *format != "json" {
+		fatalf("unknown format %q", *format)
+	}
+
+	grammar, err := parse(args[0])
+	if err != nil {
+		fatal(err)
+	}
+	data, err := readFile(cliFS, cliFS.name(args[1]))
+	if err != nil {
+		fatal(err)
+	}
+	input := string(data)
+	opts := &corpusOptions{
+		memo:     *memoFlag,
+		strict:   *noLeftRecursionFlag,
+		timeout:  *timeoutFlag,
+		maxSteps: *maxStepsFlag,
+	}
+	n, out, err := parseTree(newSyntax(grammar), input, startRule(grammar, *start), opts)
+	if err != nil {
+		fatalf("%s: %v", args[1], err)
+	}
+	if n != nil {
+		switch *format {
+		case "sexp":
+			writeSexp(os.Stdout, n, input)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(newJSONParseNode(n, input)); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	if !out.accepted() {
+		fatalf("%s: %s", args[1], out)
+	}
+}
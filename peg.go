@@ -22,30 +22,30 @@ var g = &grammar{
 	rules: []*rule{
 		{
 			name: "Grammar",
-			pos:  position{line: 10, col: 1, offset: 144},
+			pos:  position{line: 17, col: 1, offset: 361},
 			expr: &actionExpr{
-				pos: position{line: 10, col: 15, offset: 158},
+				pos: position{line: 17, col: 15, offset: 375},
 				run: (*parser).callonGrammar1,
 				expr: &seqExpr{
-					pos: position{line: 10, col: 15, offset: 158},
+					pos: position{line: 17, col: 15, offset: 375},
 					exprs: []interface{}{
 						&ruleRefExpr{
-							pos:  position{line: 10, col: 15, offset: 158},
+							pos:  position{line: 17, col: 15, offset: 375},
 							name: "Spacing",
 						},
 						&labeledExpr{
-							pos:   position{line: 10, col: 23, offset: 166},
+							pos:   position{line: 17, col: 23, offset: 383},
 							label: "def",
 							expr: &oneOrMoreExpr{
-								pos: position{line: 10, col: 27, offset: 170},
+								pos: position{line: 17, col: 27, offset: 387},
 								expr: &ruleRefExpr{
-									pos:  position{line: 10, col: 27, offset: 170},
+									pos:  position{line: 17, col: 27, offset: 387},
 									name: "Definition",
 								},
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 10, col: 39, offset: 182},
+							pos:  position{line: 17, col: 39, offset: 399},
 							name: "EndOfFile",
 						},
 					},
@@ -54,30 +54,30 @@ var g = &grammar{
 		},
 		{
 			name: "Definition",
-			pos:  position{line: 13, col: 1, offset: 216},
+			pos:  position{line: 20, col: 1, offset: 433},
 			expr: &actionExpr{
-				pos: position{line: 13, col: 15, offset: 230},
+				pos: position{line: 20, col: 15, offset: 447},
 				run: (*parser).callonDefinition1,
 				expr: &seqExpr{
-					pos: position{line: 13, col: 15, offset: 230},
+					pos: position{line: 20, col: 15, offset: 447},
 					exprs: []interface{}{
 						&labeledExpr{
-							pos:   position{line: 13, col: 15, offset: 230},
+							pos:   position{line: 20, col: 15, offset: 447},
 							label: "name",
 							expr: &ruleRefExpr{
-								pos:  position{line: 13, col: 20, offset: 235},
+								pos:  position{line: 20, col: 20, offset: 452},
 								name: "Identifier",
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 13, col: 31, offset: 246},
+							pos:  position{line: 20, col: 31, offset: 463},
 							name: "LEFTARROW",
 						},
 						&labeledExpr{
-							pos:   position{line: 13, col: 41, offset: 256},
+							pos:   position{line: 20, col: 41, offset: 473},
 							label: "expr",
 							expr: &ruleRefExpr{
-								pos:  position{line: 13, col: 46, offset: 261},
+								pos:  position{line: 20, col: 46, offset: 478},
 								name: "Expression",
 							},
 						},
@@ -87,29 +87,29 @@ var g = &grammar{
 		},
 		{
 			name: "Expression",
-			pos:  position{line: 30, col: 1, offset: 533},
+			pos:  position{line: 37, col: 1, offset: 750},
 			expr: &actionExpr{
-				pos: position{line: 30, col: 15, offset: 547},
+				pos: position{line: 37, col: 15, offset: 764},
 				run: (*parser).callonExpression1,
 				expr: &seqExpr{
-					pos: position{line: 30, col: 15, offset: 547},
+					pos: position{line: 37, col: 15, offset: 764},
 					exprs: []interface{}{
 						&ruleRefExpr{
-							pos:  position{line: 30, col: 15, offset: 547},
-							name: "Sequence",
+							pos:  position{line: 37, col: 15, offset: 764},
+							name: "Choice",
 						},
 						&zeroOrMoreExpr{
-							pos: position{line: 30, col: 24, offset: 556},
+							pos: position{line: 37, col: 22, offset: 771},
 							expr: &seqExpr{
-								pos: position{line: 30, col: 25, offset: 557},
+								pos: position{line: 37, col: 23, offset: 772},
 								exprs: []interface{}{
 									&ruleRefExpr{
-										pos:  position{line: 30, col: 25, offset: 557},
-										name: "SLASH",
+										pos:  position{line: 37, col: 23, offset: 772},
+										name: "RECOVER",
 									},
 									&ruleRefExpr{
-										pos:  position{line: 30, col: 31, offset: 563},
-										name: "Sequence",
+										pos:  position{line: 37, col: 31, offset: 780},
+										name: "Choice",
 									},
 								},
 							},
@@ -118,41 +118,70 @@ var g = &grammar{
 				},
 			},
 		},
+		{
+			name: "Choice",
+			pos:  position{line: 41, col: 1, offset: 892},
+			expr: &seqExpr{
+				pos: position{line: 41, col: 15, offset: 906},
+				exprs: []interface{}{
+					&ruleRefExpr{
+						pos:  position{line: 41, col: 15, offset: 906},
+						name: "Sequence",
+					},
+					&zeroOrMoreExpr{
+						pos: position{line: 41, col: 24, offset: 915},
+						expr: &seqExpr{
+							pos: position{line: 41, col: 25, offset: 916},
+							exprs: []interface{}{
+								&ruleRefExpr{
+									pos:  position{line: 41, col: 25, offset: 916},
+									name: "SLASH",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 41, col: 31, offset: 922},
+									name: "Sequence",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "Sequence",
-			pos:  position{line: 34, col: 1, offset: 677},
+			pos:  position{line: 42, col: 1, offset: 933},
 			expr: &zeroOrMoreExpr{
-				pos: position{line: 34, col: 15, offset: 691},
+				pos: position{line: 42, col: 15, offset: 947},
 				expr: &ruleRefExpr{
-					pos:  position{line: 34, col: 15, offset: 691},
+					pos:  position{line: 42, col: 15, offset: 947},
 					name: "Prefix",
 				},
 			},
 		},
 		{
 			name: "Prefix",
-			pos:  position{line: 35, col: 1, offset: 699},
+			pos:  position{line: 43, col: 1, offset: 955},
 			expr: &seqExpr{
-				pos: position{line: 35, col: 15, offset: 713},
+				pos: position{line: 43, col: 15, offset: 969},
 				exprs: []interface{}{
 					&zeroOrOneExpr{
-						pos: position{line: 35, col: 15, offset: 713},
+						pos: position{line: 43, col: 15, offset: 969},
 						expr: &choiceExpr{
-							pos: position{line: 35, col: 16, offset: 714},
+							pos: position{line: 43, col: 16, offset: 970},
 							alternatives: []interface{}{
 								&ruleRefExpr{
-									pos:  position{line: 35, col: 16, offset: 714},
+									pos:  position{line: 43, col: 16, offset: 970},
 									name: "AND",
 								},
 								&ruleRefExpr{
-									pos:  position{line: 35, col: 22, offset: 720},
+									pos:  position{line: 43, col: 22, offset: 976},
 									name: "NOT",
 								},
 							},
 						},
 					},
 					&ruleRefExpr{
-						pos:  position{line: 35, col: 28, offset: 726},
+						pos:  position{line: 43, col: 28, offset: 982},
 						name: "Suffix",
 					},
 				},
@@ -160,31 +189,35 @@ var g = &grammar{
 		},
 		{
 			name: "Suffix",
-			pos:  position{line: 36, col: 1, offset: 733},
+			pos:  position{line: 44, col: 1, offset: 989},
 			expr: &seqExpr{
-				pos: position{line: 36, col: 15, offset: 747},
+				pos: position{line: 44, col: 15, offset: 1003},
 				exprs: []interface{}{
 					&ruleRefExpr{
-						pos:  position{line: 36, col: 15, offset: 747},
+						pos:  position{line: 44, col: 15, offset: 1003},
 						name: "Primary",
 					},
 					&zeroOrOneExpr{
-						pos: position{line: 36, col: 23, offset: 755},
+						pos: position{line: 44, col: 23, offset: 1011},
 						expr: &choiceExpr{
-							pos: position{line: 36, col: 24, offset: 756},
+							pos: position{line: 44, col: 24, offset: 1012},
 							alternatives: []interface{}{
 								&ruleRefExpr{
-									pos:  position{line: 36, col: 24, offset: 756},
+									pos:  position{line: 44, col: 24, offset: 1012},
 									name: "QUESTION",
 								},
 								&ruleRefExpr{
-									pos:  position{line: 36, col: 35, offset: 767},
+									pos:  position{line: 44, col: 35, offset: 1023},
 									name: "STAR",
 								},
 								&ruleRefExpr{
-									pos:  position{line: 36, col: 42, offset: 774},
+									pos:  position{line: 44, col: 42, offset: 1030},
 									name: "PLUS",
 								},
+								&ruleRefExpr{
+									pos:  position{line: 44, col: 49, offset: 1037},
+									name: "BOUND",
+								},
 							},
 						},
 					},
@@ -193,80 +226,88 @@ var g = &grammar{
 		},
 		{
 			name: "Primary",
-			pos:  position{line: 37, col: 1, offset: 781},
+			pos:  position{line: 45, col: 1, offset: 1045},
 			expr: &choiceExpr{
-				pos: position{line: 37, col: 15, offset: 795},
+				pos: position{line: 45, col: 15, offset: 1059},
 				alternatives: []interface{}{
 					&seqExpr{
-						pos: position{line: 37, col: 15, offset: 795},
+						pos: position{line: 45, col: 15, offset: 1059},
 						exprs: []interface{}{
 							&ruleRefExpr{
-								pos:  position{line: 37, col: 15, offset: 795},
+								pos:  position{line: 45, col: 15, offset: 1059},
 								name: "Identifier",
 							},
 							&notExpr{
-								pos: position{line: 37, col: 26, offset: 806},
+								pos: position{line: 45, col: 26, offset: 1070},
 								expr: &ruleRefExpr{
-									pos:  position{line: 37, col: 27, offset: 807},
+									pos:  position{line: 45, col: 27, offset: 1071},
 									name: "LEFTARROW",
 								},
 							},
 						},
 					},
 					&seqExpr{
-						pos: position{line: 38, col: 15, offset: 831},
+						pos: position{line: 46, col: 15, offset: 1095},
 						exprs: []interface{}{
 							&ruleRefExpr{
-								pos:  position{line: 38, col: 15, offset: 831},
+								pos:  position{line: 46, col: 15, offset: 1095},
 								name: "OPEN",
 							},
 							&ruleRefExpr{
-								pos:  position{line: 38, col: 20, offset: 836},
+								pos:  position{line: 46, col: 20, offset: 1100},
 								name: "Expression",
 							},
 							&ruleRefExpr{
-								pos:  position{line: 38, col: 31, offset: 847},
+								pos:  position{line: 46, col: 31, offset: 1111},
 								name: "CLOSE",
 							},
 						},
 					},
 					&ruleRefExpr{
-						pos:  position{line: 39, col: 15, offset: 867},
+						pos:  position{line: 47, col: 15, offset: 1131},
 						name: "Literal",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 39, col: 25, offset: 877},
+						pos:  position{line: 47, col: 25, offset: 1141},
 						name: "Class",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 39, col: 33, offset: 885},
+						pos:  position{line: 47, col: 33, offset: 1149},
 						name: "DOT",
 					},
+					&ruleRefExpr{
+						pos:  position{line: 47, col: 39, offset: 1155},
+						name: "THROW",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 47, col: 47, offset: 1163},
+						name: "STATE",
+					},
 				},
 			},
 		},
 		{
 			name: "Identifier",
-			pos:  position{line: 42, col: 1, offset: 908},
+			pos:  position{line: 50, col: 1, offset: 1188},
 			expr: &actionExpr{
-				pos: position{line: 42, col: 15, offset: 922},
+				pos: position{line: 50, col: 15, offset: 1202},
 				run: (*parser).callonIdentifier1,
 				expr: &seqExpr{
-					pos: position{line: 42, col: 15, offset: 922},
+					pos: position{line: 50, col: 15, offset: 1202},
 					exprs: []interface{}{
 						&ruleRefExpr{
-							pos:  position{line: 42, col: 15, offset: 922},
+							pos:  position{line: 50, col: 15, offset: 1202},
 							name: "IdentStart",
 						},
 						&zeroOrMoreExpr{
-							pos: position{line: 42, col: 26, offset: 933},
+							pos: position{line: 50, col: 26, offset: 1213},
 							expr: &ruleRefExpr{
-								pos:  position{line: 42, col: 26, offset: 933},
+								pos:  position{line: 50, col: 26, offset: 1213},
 								name: "IdentCont",
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 42, col: 37, offset: 944},
+							pos:  position{line: 50, col: 37, offset: 1224},
 							name: "Spacing",
 						},
 					},
@@ -275,30 +316,30 @@ var g = &grammar{
 		},
 		{
 			name: "IdentStart",
-			pos:  position{line: 46, col: 1, offset: 1054},
+			pos:  position{line: 54, col: 1, offset: 1334},
 			expr: &charClassMatcher{
-				pos:        position{line: 46, col: 15, offset: 1068},
-				val:        "[a-zA-Z_]",
+				pos:        position{line: 54, col: 15, offset: 1348},
+				val:        "[\\pL_]",
 				chars:      []rune{'_'},
-				ranges:     []rune{'a', 'z', 'A', 'Z'},
+				classes:    []*unicode.RangeTable{rangeTable("L")},
 				ignoreCase: false,
 				inverted:   false,
 			},
 		},
 		{
 			name: "IdentCont",
-			pos:  position{line: 47, col: 1, offset: 1078},
+			pos:  position{line: 55, col: 1, offset: 1355},
 			expr: &choiceExpr{
-				pos: position{line: 47, col: 15, offset: 1092},
+				pos: position{line: 55, col: 15, offset: 1369},
 				alternatives: []interface{}{
 					&ruleRefExpr{
-						pos:  position{line: 47, col: 15, offset: 1092},
+						pos:  position{line: 55, col: 15, offset: 1369},
 						name: "IdentStart",
 					},
 					&charClassMatcher{
-						pos:        position{line: 47, col: 28, offset: 1105},
-						val:        "[0-9]",
-						ranges:     []rune{'0', '9'},
+						pos:        position{line: 55, col: 28, offset: 1382},
+						val:        "[\\p{Nd}]",
+						classes:    []*unicode.RangeTable{rangeTable("Nd")},
 						ignoreCase: false,
 						inverted:   false,
 					},
@@ -307,29 +348,29 @@ var g = &grammar{
 		},
 		{
 			name: "Literal",
-			pos:  position{line: 49, col: 1, offset: 1112},
+			pos:  position{line: 57, col: 1, offset: 1392},
 			expr: &choiceExpr{
-				pos: position{line: 49, col: 15, offset: 1126},
+				pos: position{line: 57, col: 15, offset: 1406},
 				alternatives: []interface{}{
 					&seqExpr{
-						pos: position{line: 49, col: 15, offset: 1126},
+						pos: position{line: 57, col: 15, offset: 1406},
 						exprs: []interface{}{
 							&charClassMatcher{
-								pos:        position{line: 49, col: 15, offset: 1126},
+								pos:        position{line: 57, col: 15, offset: 1406},
 								val:        "[']",
 								chars:      []rune{'\''},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&zeroOrMoreExpr{
-								pos: position{line: 49, col: 19, offset: 1130},
+								pos: position{line: 57, col: 19, offset: 1410},
 								expr: &seqExpr{
-									pos: position{line: 49, col: 20, offset: 1131},
+									pos: position{line: 57, col: 20, offset: 1411},
 									exprs: []interface{}{
 										&notExpr{
-											pos: position{line: 49, col: 20, offset: 1131},
+											pos: position{line: 57, col: 20, offset: 1411},
 											expr: &charClassMatcher{
-												pos:        position{line: 49, col: 21, offset: 1132},
+												pos:        position{line: 57, col: 21, offset: 1412},
 												val:        "[']",
 												chars:      []rune{'\''},
 												ignoreCase: false,
@@ -337,44 +378,44 @@ var g = &grammar{
 											},
 										},
 										&ruleRefExpr{
-											pos:  position{line: 49, col: 25, offset: 1136},
+											pos:  position{line: 57, col: 25, offset: 1416},
 											name: "Char",
 										},
 									},
 								},
 							},
 							&charClassMatcher{
-								pos:        position{line: 49, col: 32, offset: 1143},
+								pos:        position{line: 57, col: 32, offset: 1423},
 								val:        "[']",
 								chars:      []rune{'\''},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&ruleRefExpr{
-								pos:  position{line: 49, col: 36, offset: 1147},
+								pos:  position{line: 57, col: 36, offset: 1427},
 								name: "Spacing",
 							},
 						},
 					},
 					&seqExpr{
-						pos: position{line: 50, col: 15, offset: 1169},
+						pos: position{line: 58, col: 15, offset: 1449},
 						exprs: []interface{}{
 							&charClassMatcher{
-								pos:        position{line: 50, col: 15, offset: 1169},
+								pos:        position{line: 58, col: 15, offset: 1449},
 								val:        "[\"]",
 								chars:      []rune{'"'},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&zeroOrMoreExpr{
-								pos: position{line: 50, col: 19, offset: 1173},
+								pos: position{line: 58, col: 19, offset: 1453},
 								expr: &seqExpr{
-									pos: position{line: 50, col: 20, offset: 1174},
+									pos: position{line: 58, col: 20, offset: 1454},
 									exprs: []interface{}{
 										&notExpr{
-											pos: position{line: 50, col: 20, offset: 1174},
+											pos: position{line: 58, col: 20, offset: 1454},
 											expr: &charClassMatcher{
-												pos:        position{line: 50, col: 21, offset: 1175},
+												pos:        position{line: 58, col: 21, offset: 1455},
 												val:        "[\"]",
 												chars:      []rune{'"'},
 												ignoreCase: false,
@@ -382,21 +423,21 @@ var g = &grammar{
 											},
 										},
 										&ruleRefExpr{
-											pos:  position{line: 50, col: 25, offset: 1179},
+											pos:  position{line: 58, col: 25, offset: 1459},
 											name: "Char",
 										},
 									},
 								},
 							},
 							&charClassMatcher{
-								pos:        position{line: 50, col: 32, offset: 1186},
+								pos:        position{line: 58, col: 32, offset: 1466},
 								val:        "[\"]",
 								chars:      []rune{'"'},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&ruleRefExpr{
-								pos:  position{line: 50, col: 36, offset: 1190},
+								pos:  position{line: 58, col: 36, offset: 1470},
 								name: "Spacing",
 							},
 						},
@@ -406,77 +447,147 @@ var g = &grammar{
 		},
 		{
 			name: "Class",
-			pos:  position{line: 52, col: 1, offset: 1199},
+			pos:  position{line: 60, col: 1, offset: 1479},
 			expr: &seqExpr{
-				pos: position{line: 52, col: 15, offset: 1213},
+				pos: position{line: 60, col: 15, offset: 1493},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 52, col: 15, offset: 1213},
+						pos:        position{line: 60, col: 15, offset: 1493},
 						val:        "[",
 						ignoreCase: false,
 						want:       "\"[\"",
 					},
 					&zeroOrMoreExpr{
-						pos: position{line: 52, col: 19, offset: 1217},
+						pos: position{line: 60, col: 19, offset: 1497},
 						expr: &seqExpr{
-							pos: position{line: 52, col: 20, offset: 1218},
+							pos: position{line: 60, col: 20, offset: 1498},
 							exprs: []interface{}{
 								&notExpr{
-									pos: position{line: 52, col: 20, offset: 1218},
+									pos: position{line: 60, col: 20, offset: 1498},
 									expr: &litMatcher{
-										pos:        position{line: 52, col: 21, offset: 1219},
+										pos:        position{line: 60, col: 21, offset: 1499},
 										val:        "]",
 										ignoreCase: false,
 										want:       "\"]\"",
 									},
 								},
-								&ruleRefExpr{
-									pos:  position{line: 52, col: 25, offset: 1223},
-									name: "Range",
+								&choiceExpr{
+									pos: position{line: 60, col: 26, offset: 1504},
+									alternatives: []interface{}{
+										&ruleRefExpr{
+											pos:  position{line: 60, col: 26, offset: 1504},
+											name: "Category",
+										},
+										&ruleRefExpr{
+											pos:  position{line: 60, col: 37, offset: 1515},
+											name: "Range",
+										},
+									},
 								},
 							},
 						},
 					},
 					&litMatcher{
-						pos:        position{line: 52, col: 33, offset: 1231},
+						pos:        position{line: 60, col: 46, offset: 1524},
 						val:        "]",
 						ignoreCase: false,
 						want:       "\"]\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 52, col: 37, offset: 1235},
+						pos:  position{line: 60, col: 50, offset: 1528},
 						name: "Spacing",
 					},
 				},
 			},
 		},
+		{
+			name: "Category",
+			pos:  position{line: 61, col: 1, offset: 1536},
+			expr: &seqExpr{
+				pos: position{line: 61, col: 15, offset: 1550},
+				exprs: []interface{}{
+					&litMatcher{
+						pos:        position{line: 61, col: 15, offset: 1550},
+						val:        "\\",
+						ignoreCase: false,
+						want:       "\"\\\\\"",
+					},
+					&litMatcher{
+						pos:        position{line: 61, col: 20, offset: 1555},
+						val:        "p",
+						ignoreCase: false,
+						want:       "\"p\"",
+					},
+					&choiceExpr{
+						pos: position{line: 61, col: 25, offset: 1560},
+						alternatives: []interface{}{
+							&charClassMatcher{
+								pos:        position{line: 61, col: 25, offset: 1560},
+								val:        "[a-zA-Z]",
+								ranges:     []rune{'a', 'z', 'A', 'Z'},
+								ignoreCase: false,
+								inverted:   false,
+							},
+							&seqExpr{
+								pos: position{line: 61, col: 36, offset: 1571},
+								exprs: []interface{}{
+									&litMatcher{
+										pos:        position{line: 61, col: 36, offset: 1571},
+										val:        "{",
+										ignoreCase: false,
+										want:       "\"{\"",
+									},
+									&oneOrMoreExpr{
+										pos: position{line: 61, col: 40, offset: 1575},
+										expr: &charClassMatcher{
+											pos:        position{line: 61, col: 40, offset: 1575},
+											val:        "[a-zA-Z_]",
+											chars:      []rune{'_'},
+											ranges:     []rune{'a', 'z', 'A', 'Z'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+									&litMatcher{
+										pos:        position{line: 61, col: 51, offset: 1586},
+										val:        "}",
+										ignoreCase: false,
+										want:       "\"}\"",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "Range",
-			pos:  position{line: 53, col: 1, offset: 1243},
+			pos:  position{line: 62, col: 1, offset: 1591},
 			expr: &choiceExpr{
-				pos: position{line: 53, col: 15, offset: 1257},
+				pos: position{line: 62, col: 15, offset: 1605},
 				alternatives: []interface{}{
 					&seqExpr{
-						pos: position{line: 53, col: 15, offset: 1257},
+						pos: position{line: 62, col: 15, offset: 1605},
 						exprs: []interface{}{
 							&ruleRefExpr{
-								pos:  position{line: 53, col: 15, offset: 1257},
+								pos:  position{line: 62, col: 15, offset: 1605},
 								name: "Char",
 							},
 							&litMatcher{
-								pos:        position{line: 53, col: 20, offset: 1262},
+								pos:        position{line: 62, col: 20, offset: 1610},
 								val:        "-",
 								ignoreCase: false,
 								want:       "\"-\"",
 							},
 							&ruleRefExpr{
-								pos:  position{line: 53, col: 24, offset: 1266},
+								pos:  position{line: 62, col: 24, offset: 1614},
 								name: "Char",
 							},
 						},
 					},
 					&ruleRefExpr{
-						pos:  position{line: 53, col: 31, offset: 1273},
+						pos:  position{line: 62, col: 31, offset: 1621},
 						name: "Char",
 					},
 				},
@@ -484,21 +595,21 @@ var g = &grammar{
 		},
 		{
 			name: "Char",
-			pos:  position{line: 54, col: 1, offset: 1278},
+			pos:  position{line: 63, col: 1, offset: 1626},
 			expr: &choiceExpr{
-				pos: position{line: 54, col: 15, offset: 1292},
+				pos: position{line: 63, col: 15, offset: 1640},
 				alternatives: []interface{}{
 					&seqExpr{
-						pos: position{line: 54, col: 15, offset: 1292},
+						pos: position{line: 63, col: 15, offset: 1640},
 						exprs: []interface{}{
 							&litMatcher{
-								pos:        position{line: 54, col: 15, offset: 1292},
+								pos:        position{line: 63, col: 15, offset: 1640},
 								val:        "\\",
 								ignoreCase: false,
 								want:       "\"\\\\\"",
 							},
 							&charClassMatcher{
-								pos:        position{line: 54, col: 20, offset: 1297},
+								pos:        position{line: 63, col: 20, offset: 1645},
 								val:        "[nrt'\"[\\]\\\\]",
 								chars:      []rune{'n', 'r', 't', '\'', '"', '[', ']', '\\'},
 								ignoreCase: false,
@@ -507,30 +618,30 @@ var g = &grammar{
 						},
 					},
 					&seqExpr{
-						pos: position{line: 55, col: 15, offset: 1324},
+						pos: position{line: 64, col: 15, offset: 1672},
 						exprs: []interface{}{
 							&litMatcher{
-								pos:        position{line: 55, col: 15, offset: 1324},
+								pos:        position{line: 64, col: 15, offset: 1672},
 								val:        "\\",
 								ignoreCase: false,
 								want:       "\"\\\\\"",
 							},
 							&charClassMatcher{
-								pos:        position{line: 55, col: 20, offset: 1329},
+								pos:        position{line: 64, col: 20, offset: 1677},
 								val:        "[0-2]",
 								ranges:     []rune{'0', '2'},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&charClassMatcher{
-								pos:        position{line: 55, col: 25, offset: 1334},
+								pos:        position{line: 64, col: 25, offset: 1682},
 								val:        "[0-7]",
 								ranges:     []rune{'0', '7'},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&charClassMatcher{
-								pos:        position{line: 55, col: 30, offset: 1339},
+								pos:        position{line: 64, col: 30, offset: 1687},
 								val:        "[0-7]",
 								ranges:     []rune{'0', '7'},
 								ignoreCase: false,
@@ -539,25 +650,25 @@ var g = &grammar{
 						},
 					},
 					&seqExpr{
-						pos: position{line: 56, col: 15, offset: 1359},
+						pos: position{line: 65, col: 15, offset: 1707},
 						exprs: []interface{}{
 							&litMatcher{
-								pos:        position{line: 56, col: 15, offset: 1359},
+								pos:        position{line: 65, col: 15, offset: 1707},
 								val:        "\\",
 								ignoreCase: false,
 								want:       "\"\\\\\"",
 							},
 							&charClassMatcher{
-								pos:        position{line: 56, col: 20, offset: 1364},
+								pos:        position{line: 65, col: 20, offset: 1712},
 								val:        "[0-7]",
 								ranges:     []rune{'0', '7'},
 								ignoreCase: false,
 								inverted:   false,
 							},
 							&zeroOrOneExpr{
-								pos: position{line: 56, col: 25, offset: 1369},
+								pos: position{line: 65, col: 25, offset: 1717},
 								expr: &charClassMatcher{
-									pos:        position{line: 56, col: 25, offset: 1369},
+									pos:        position{line: 65, col: 25, offset: 1717},
 									val:        "[0-7]",
 									ranges:     []rune{'0', '7'},
 									ignoreCase: false,
@@ -567,19 +678,19 @@ var g = &grammar{
 						},
 					},
 					&seqExpr{
-						pos: position{line: 57, col: 15, offset: 1390},
+						pos: position{line: 66, col: 15, offset: 1738},
 						exprs: []interface{}{
 							&notExpr{
-								pos: position{line: 57, col: 15, offset: 1390},
+								pos: position{line: 66, col: 15, offset: 1738},
 								expr: &litMatcher{
-									pos:        position{line: 57, col: 16, offset: 1391},
+									pos:        position{line: 66, col: 16, offset: 1739},
 									val:        "\\",
 									ignoreCase: false,
 									want:       "\"\\\\\"",
 								},
 							},
 							&anyMatcher{
-								line: 57, col: 21, offset: 1396,
+								line: 66, col: 21, offset: 1744,
 							},
 						},
 					},
@@ -588,18 +699,18 @@ var g = &grammar{
 		},
 		{
 			name: "LEFTARROW",
-			pos:  position{line: 59, col: 1, offset: 1399},
+			pos:  position{line: 68, col: 1, offset: 1747},
 			expr: &seqExpr{
-				pos: position{line: 59, col: 15, offset: 1413},
+				pos: position{line: 68, col: 15, offset: 1761},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 59, col: 15, offset: 1413},
+						pos:        position{line: 68, col: 15, offset: 1761},
 						val:        "<-",
 						ignoreCase: false,
 						want:       "\"<-\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 59, col: 20, offset: 1418},
+						pos:  position{line: 68, col: 20, offset: 1766},
 						name: "Spacing",
 					},
 				},
@@ -607,18 +718,27 @@ var g = &grammar{
 		},
 		{
 			name: "SLASH",
-			pos:  position{line: 60, col: 1, offset: 1426},
+			pos:  position{line: 69, col: 1, offset: 1774},
 			expr: &seqExpr{
-				pos: position{line: 60, col: 15, offset: 1440},
+				pos: position{line: 69, col: 15, offset: 1788},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 60, col: 15, offset: 1440},
+						pos:        position{line: 69, col: 15, offset: 1788},
 						val:        "/",
 						ignoreCase: false,
 						want:       "\"/\"",
 					},
+					&notExpr{
+						pos: position{line: 69, col: 19, offset: 1792},
+						expr: &litMatcher{
+							pos:        position{line: 69, col: 20, offset: 1793},
+							val:        "/{",
+							ignoreCase: false,
+							want:       "\"/{\"",
+						},
+					},
 					&ruleRefExpr{
-						pos:  position{line: 60, col: 19, offset: 1444},
+						pos:  position{line: 69, col: 25, offset: 1798},
 						name: "Spacing",
 					},
 				},
@@ -626,18 +746,18 @@ var g = &grammar{
 		},
 		{
 			name: "AND",
-			pos:  position{line: 61, col: 1, offset: 1452},
+			pos:  position{line: 70, col: 1, offset: 1806},
 			expr: &seqExpr{
-				pos: position{line: 61, col: 15, offset: 1466},
+				pos: position{line: 70, col: 15, offset: 1820},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 61, col: 15, offset: 1466},
+						pos:        position{line: 70, col: 15, offset: 1820},
 						val:        "&",
 						ignoreCase: false,
 						want:       "\"&\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 61, col: 19, offset: 1470},
+						pos:  position{line: 70, col: 19, offset: 1824},
 						name: "Spacing",
 					},
 				},
@@ -645,18 +765,18 @@ var g = &grammar{
 		},
 		{
 			name: "NOT",
-			pos:  position{line: 62, col: 1, offset: 1478},
+			pos:  position{line: 71, col: 1, offset: 1832},
 			expr: &seqExpr{
-				pos: position{line: 62, col: 15, offset: 1492},
+				pos: position{line: 71, col: 15, offset: 1846},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 62, col: 15, offset: 1492},
+						pos:        position{line: 71, col: 15, offset: 1846},
 						val:        "!",
 						ignoreCase: false,
 						want:       "\"!\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 62, col: 19, offset: 1496},
+						pos:  position{line: 71, col: 19, offset: 1850},
 						name: "Spacing",
 					},
 				},
@@ -664,18 +784,18 @@ var g = &grammar{
 		},
 		{
 			name: "QUESTION",
-			pos:  position{line: 63, col: 1, offset: 1504},
+			pos:  position{line: 72, col: 1, offset: 1858},
 			expr: &seqExpr{
-				pos: position{line: 63, col: 15, offset: 1518},
+				pos: position{line: 72, col: 15, offset: 1872},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 63, col: 15, offset: 1518},
+						pos:        position{line: 72, col: 15, offset: 1872},
 						val:        "?",
 						ignoreCase: false,
 						want:       "\"?\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 63, col: 19, offset: 1522},
+						pos:  position{line: 72, col: 19, offset: 1876},
 						name: "Spacing",
 					},
 				},
@@ -683,18 +803,18 @@ var g = &grammar{
 		},
 		{
 			name: "STAR",
-			pos:  position{line: 64, col: 1, offset: 1530},
+			pos:  position{line: 73, col: 1, offset: 1884},
 			expr: &seqExpr{
-				pos: position{line: 64, col: 15, offset: 1544},
+				pos: position{line: 73, col: 15, offset: 1898},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 64, col: 15, offset: 1544},
+						pos:        position{line: 73, col: 15, offset: 1898},
 						val:        "*",
 						ignoreCase: false,
 						want:       "\"*\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 64, col: 19, offset: 1548},
+						pos:  position{line: 73, col: 19, offset: 1902},
 						name: "Spacing",
 					},
 				},
@@ -702,18 +822,18 @@ var g = &grammar{
 		},
 		{
 			name: "PLUS",
-			pos:  position{line: 65, col: 1, offset: 1556},
+			pos:  position{line: 74, col: 1, offset: 1910},
 			expr: &seqExpr{
-				pos: position{line: 65, col: 15, offset: 1570},
+				pos: position{line: 74, col: 15, offset: 1924},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 65, col: 15, offset: 1570},
+						pos:        position{line: 74, col: 15, offset: 1924},
 						val:        "+",
 						ignoreCase: false,
 						want:       "\"+\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 65, col: 19, offset: 1574},
+						pos:  position{line: 74, col: 19, offset: 1928},
 						name: "Spacing",
 					},
 				},
@@ -721,18 +841,18 @@ var g = &grammar{
 		},
 		{
 			name: "OPEN",
-			pos:  position{line: 66, col: 1, offset: 1582},
+			pos:  position{line: 75, col: 1, offset: 1936},
 			expr: &seqExpr{
-				pos: position{line: 66, col: 15, offset: 1596},
+				pos: position{line: 75, col: 15, offset: 1950},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 66, col: 15, offset: 1596},
+						pos:        position{line: 75, col: 15, offset: 1950},
 						val:        "(",
 						ignoreCase: false,
 						want:       "\"(\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 66, col: 19, offset: 1600},
+						pos:  position{line: 75, col: 19, offset: 1954},
 						name: "Spacing",
 					},
 				},
@@ -740,18 +860,18 @@ var g = &grammar{
 		},
 		{
 			name: "CLOSE",
-			pos:  position{line: 67, col: 1, offset: 1608},
+			pos:  position{line: 76, col: 1, offset: 1962},
 			expr: &seqExpr{
-				pos: position{line: 67, col: 15, offset: 1622},
+				pos: position{line: 76, col: 15, offset: 1976},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 67, col: 15, offset: 1622},
+						pos:        position{line: 76, col: 15, offset: 1976},
 						val:        ")",
 						ignoreCase: false,
 						want:       "\")\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 67, col: 19, offset: 1626},
+						pos:  position{line: 76, col: 19, offset: 1980},
 						name: "Spacing",
 					},
 				},
@@ -759,37 +879,299 @@ var g = &grammar{
 		},
 		{
 			name: "DOT",
-			pos:  position{line: 68, col: 1, offset: 1634},
+			pos:  position{line: 77, col: 1, offset: 1988},
 			expr: &seqExpr{
-				pos: position{line: 68, col: 15, offset: 1648},
+				pos: position{line: 77, col: 15, offset: 2002},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 68, col: 15, offset: 1648},
+						pos:        position{line: 77, col: 15, offset: 2002},
 						val:        ".",
 						ignoreCase: false,
 						want:       "\".\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 68, col: 19, offset: 1652},
+						pos:  position{line: 77, col: 19, offset: 2006},
 						name: "Spacing",
 					},
 				},
 			},
 		},
+		{
+			name: "BOUND",
+			pos:  position{line: 78, col: 1, offset: 2014},
+			expr: &actionExpr{
+				pos: position{line: 78, col: 15, offset: 2028},
+				run: (*parser).callonBOUND1,
+				expr: &seqExpr{
+					pos: position{line: 78, col: 15, offset: 2028},
+					exprs: []interface{}{
+						&litMatcher{
+							pos:        position{line: 78, col: 15, offset: 2028},
+							val:        "{",
+							ignoreCase: false,
+							want:       "\"{\"",
+						},
+						&zeroOrMoreExpr{
+							pos: position{line: 78, col: 19, offset: 2032},
+							expr: &charClassMatcher{
+								pos:        position{line: 78, col: 19, offset: 2032},
+								val:        "[0-9]",
+								ranges:     []rune{'0', '9'},
+								ignoreCase: false,
+								inverted:   false,
+							},
+						},
+						&zeroOrOneExpr{
+							pos: position{line: 78, col: 26, offset: 2039},
+							expr: &seqExpr{
+								pos: position{line: 78, col: 27, offset: 2040},
+								exprs: []interface{}{
+									&litMatcher{
+										pos:        position{line: 78, col: 27, offset: 2040},
+										val:        ",",
+										ignoreCase: false,
+										want:       "\",\"",
+									},
+									&zeroOrMoreExpr{
+										pos: position{line: 78, col: 31, offset: 2044},
+										expr: &charClassMatcher{
+											pos:        position{line: 78, col: 31, offset: 2044},
+											val:        "[0-9]",
+											ranges:     []rune{'0', '9'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+								},
+							},
+						},
+						&litMatcher{
+							pos:        position{line: 78, col: 40, offset: 2053},
+							val:        "}",
+							ignoreCase: false,
+							want:       "\"}\"",
+						},
+						&ruleRefExpr{
+							pos:  position{line: 78, col: 44, offset: 2057},
+							name: "Spacing",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RECOVER",
+			pos:  position{line: 86, col: 1, offset: 2332},
+			expr: &seqExpr{
+				pos: position{line: 86, col: 15, offset: 2346},
+				exprs: []interface{}{
+					&litMatcher{
+						pos:        position{line: 86, col: 15, offset: 2346},
+						val:        "//{",
+						ignoreCase: false,
+						want:       "\"//{\"",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 86, col: 21, offset: 2352},
+						name: "Label",
+					},
+					&zeroOrMoreExpr{
+						pos: position{line: 86, col: 27, offset: 2358},
+						expr: &seqExpr{
+							pos: position{line: 86, col: 28, offset: 2359},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 86, col: 28, offset: 2359},
+									val:        ",",
+									ignoreCase: false,
+									want:       "\",\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 86, col: 32, offset: 2363},
+									name: "Label",
+								},
+							},
+						},
+					},
+					&litMatcher{
+						pos:        position{line: 86, col: 40, offset: 2371},
+						val:        "}",
+						ignoreCase: false,
+						want:       "\"}\"",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 86, col: 44, offset: 2375},
+						name: "Spacing",
+					},
+				},
+			},
+		},
+		{
+			name: "THROW",
+			pos:  position{line: 87, col: 1, offset: 2383},
+			expr: &seqExpr{
+				pos: position{line: 87, col: 15, offset: 2397},
+				exprs: []interface{}{
+					&litMatcher{
+						pos:        position{line: 87, col: 15, offset: 2397},
+						val:        "%{",
+						ignoreCase: false,
+						want:       "\"%{\"",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 87, col: 20, offset: 2402},
+						name: "Label",
+					},
+					&litMatcher{
+						pos:        position{line: 87, col: 26, offset: 2408},
+						val:        "}",
+						ignoreCase: false,
+						want:       "\"}\"",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 87, col: 30, offset: 2412},
+						name: "Spacing",
+					},
+				},
+			},
+		},
+		{
+			name: "Label",
+			pos:  position{line: 88, col: 1, offset: 2420},
+			expr: &seqExpr{
+				pos: position{line: 88, col: 15, offset: 2434},
+				exprs: []interface{}{
+					&zeroOrMoreExpr{
+						pos: position{line: 88, col: 15, offset: 2434},
+						expr: &charClassMatcher{
+							pos:        position{line: 88, col: 15, offset: 2434},
+							val:        "[ \\t]",
+							chars:      []rune{' ', '\t'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+					},
+					&ruleRefExpr{
+						pos:  position{line: 88, col: 22, offset: 2441},
+						name: "IdentStart",
+					},
+					&zeroOrMoreExpr{
+						pos: position{line: 88, col: 33, offset: 2452},
+						expr: &ruleRefExpr{
+							pos:  position{line: 88, col: 33, offset: 2452},
+							name: "IdentCont",
+						},
+					},
+					&zeroOrMoreExpr{
+						pos: position{line: 88, col: 44, offset: 2463},
+						expr: &charClassMatcher{
+							pos:        position{line: 88, col: 44, offset: 2463},
+							val:        "[ \\t]",
+							chars:      []rune{' ', '\t'},
+							ignoreCase: false,
+							inverted:   false,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "STATE",
+			pos:  position{line: 89, col: 1, offset: 2470},
+			expr: &seqExpr{
+				pos: position{line: 89, col: 15, offset: 2484},
+				exprs: []interface{}{
+					&litMatcher{
+						pos:        position{line: 89, col: 15, offset: 2484},
+						val:        "#{",
+						ignoreCase: false,
+						want:       "\"#{\"",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 89, col: 20, offset: 2489},
+						name: "Code",
+					},
+					&litMatcher{
+						pos:        position{line: 89, col: 25, offset: 2494},
+						val:        "}",
+						ignoreCase: false,
+						want:       "\"}\"",
+					},
+					&ruleRefExpr{
+						pos:  position{line: 89, col: 29, offset: 2498},
+						name: "Spacing",
+					},
+				},
+			},
+		},
+		{
+			name: "Code",
+			pos:  position{line: 90, col: 1, offset: 2506},
+			expr: &zeroOrMoreExpr{
+				pos: position{line: 90, col: 15, offset: 2520},
+				expr: &choiceExpr{
+					pos: position{line: 90, col: 16, offset: 2521},
+					alternatives: []interface{}{
+						&oneOrMoreExpr{
+							pos: position{line: 90, col: 16, offset: 2521},
+							expr: &seqExpr{
+								pos: position{line: 90, col: 17, offset: 2522},
+								exprs: []interface{}{
+									&notExpr{
+										pos: position{line: 90, col: 17, offset: 2522},
+										expr: &charClassMatcher{
+											pos:        position{line: 90, col: 18, offset: 2523},
+											val:        "[{}]",
+											chars:      []rune{'{', '}'},
+											ignoreCase: false,
+											inverted:   false,
+										},
+									},
+									&anyMatcher{
+										line: 90, col: 23, offset: 2528,
+									},
+								},
+							},
+						},
+						&seqExpr{
+							pos: position{line: 90, col: 29, offset: 2534},
+							exprs: []interface{}{
+								&litMatcher{
+									pos:        position{line: 90, col: 29, offset: 2534},
+									val:        "{",
+									ignoreCase: false,
+									want:       "\"{\"",
+								},
+								&ruleRefExpr{
+									pos:  position{line: 90, col: 33, offset: 2538},
+									name: "Code",
+								},
+								&litMatcher{
+									pos:        position{line: 90, col: 38, offset: 2543},
+									val:        "}",
+									ignoreCase: false,
+									want:       "\"}\"",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "Spacing",
-			pos:  position{line: 70, col: 1, offset: 1661},
+			pos:  position{line: 92, col: 1, offset: 2550},
 			expr: &zeroOrMoreExpr{
-				pos: position{line: 70, col: 15, offset: 1675},
+				pos: position{line: 92, col: 15, offset: 2564},
 				expr: &choiceExpr{
-					pos: position{line: 70, col: 16, offset: 1676},
+					pos: position{line: 92, col: 16, offset: 2565},
 					alternatives: []interface{}{
 						&ruleRefExpr{
-							pos:  position{line: 70, col: 16, offset: 1676},
+							pos:  position{line: 92, col: 16, offset: 2565},
 							name: "Space",
 						},
 						&ruleRefExpr{
-							pos:  position{line: 70, col: 24, offset: 1684},
+							pos:  position{line: 92, col: 24, offset: 2573},
 							name: "Comment",
 						},
 					},
@@ -798,36 +1180,45 @@ var g = &grammar{
 		},
 		{
 			name: "Comment",
-			pos:  position{line: 71, col: 1, offset: 1694},
+			pos:  position{line: 93, col: 1, offset: 2583},
 			expr: &seqExpr{
-				pos: position{line: 71, col: 15, offset: 1708},
+				pos: position{line: 93, col: 15, offset: 2597},
 				exprs: []interface{}{
 					&litMatcher{
-						pos:        position{line: 71, col: 15, offset: 1708},
+						pos:        position{line: 93, col: 15, offset: 2597},
 						val:        "#",
 						ignoreCase: false,
 						want:       "\"#\"",
 					},
+					&notExpr{
+						pos: position{line: 93, col: 19, offset: 2601},
+						expr: &litMatcher{
+							pos:        position{line: 93, col: 20, offset: 2602},
+							val:        "{",
+							ignoreCase: false,
+							want:       "\"{\"",
+						},
+					},
 					&zeroOrMoreExpr{
-						pos: position{line: 71, col: 19, offset: 1712},
+						pos: position{line: 93, col: 24, offset: 2606},
 						expr: &seqExpr{
-							pos: position{line: 71, col: 20, offset: 1713},
+							pos: position{line: 93, col: 25, offset: 2607},
 							exprs: []interface{}{
 								&notExpr{
-									pos: position{line: 71, col: 20, offset: 1713},
+									pos: position{line: 93, col: 25, offset: 2607},
 									expr: &ruleRefExpr{
-										pos:  position{line: 71, col: 21, offset: 1714},
+										pos:  position{line: 93, col: 26, offset: 2608},
 										name: "EndOfLine",
 									},
 								},
 								&anyMatcher{
-									line: 71, col: 31, offset: 1724,
+									line: 93, col: 36, offset: 2618,
 								},
 							},
 						},
 					},
 					&ruleRefExpr{
-						pos:  position{line: 71, col: 35, offset: 1728},
+						pos:  position{line: 93, col: 40, offset: 2622},
 						name: "EndOfLine",
 					},
 				},
@@ -835,24 +1226,24 @@ var g = &grammar{
 		},
 		{
 			name: "Space",
-			pos:  position{line: 72, col: 1, offset: 1738},
+			pos:  position{line: 94, col: 1, offset: 2632},
 			expr: &choiceExpr{
-				pos: position{line: 72, col: 15, offset: 1752},
+				pos: position{line: 94, col: 15, offset: 2646},
 				alternatives: []interface{}{
 					&litMatcher{
-						pos:        position{line: 72, col: 15, offset: 1752},
+						pos:        position{line: 94, col: 15, offset: 2646},
 						val:        " ",
 						ignoreCase: false,
 						want:       "\" \"",
 					},
 					&litMatcher{
-						pos:        position{line: 72, col: 21, offset: 1758},
+						pos:        position{line: 94, col: 21, offset: 2652},
 						val:        "\t",
 						ignoreCase: false,
 						want:       "\"\\t\"",
 					},
 					&ruleRefExpr{
-						pos:  position{line: 72, col: 28, offset: 1765},
+						pos:  position{line: 94, col: 28, offset: 2659},
 						name: "EndOfLine",
 					},
 				},
@@ -860,24 +1251,24 @@ var g = &grammar{
 		},
 		{
 			name: "EndOfLine",
-			pos:  position{line: 73, col: 1, offset: 1775},
+			pos:  position{line: 95, col: 1, offset: 2669},
 			expr: &choiceExpr{
-				pos: position{line: 73, col: 15, offset: 1789},
+				pos: position{line: 95, col: 15, offset: 2683},
 				alternatives: []interface{}{
 					&litMatcher{
-						pos:        position{line: 73, col: 15, offset: 1789},
+						pos:        position{line: 95, col: 15, offset: 2683},
 						val:        "\r\n",
 						ignoreCase: false,
 						want:       "\"\\r\\n\"",
 					},
 					&litMatcher{
-						pos:        position{line: 73, col: 24, offset: 1798},
+						pos:        position{line: 95, col: 24, offset: 2692},
 						val:        "\n",
 						ignoreCase: false,
 						want:       "\"\\n\"",
 					},
 					&litMatcher{
-						pos:        position{line: 73, col: 31, offset: 1805},
+						pos:        position{line: 95, col: 31, offset: 2699},
 						val:        "\r",
 						ignoreCase: false,
 						want:       "\"\\r\"",
@@ -887,11 +1278,11 @@ var g = &grammar{
 		},
 		{
 			name: "EndOfFile",
-			pos:  position{line: 74, col: 1, offset: 1810},
+			pos:  position{line: 96, col: 1, offset: 2704},
 			expr: &notExpr{
-				pos: position{line: 74, col: 15, offset: 1824},
+				pos: position{line: 96, col: 15, offset: 2718},
 				expr: &anyMatcher{
-					line: 74, col: 16, offset: 1825,
+					line: 96, col: 16, offset: 2719,
 				},
 			},
 		},
@@ -953,6 +1344,21 @@ func (p *parser) callonIdentifier1() (interface{}, error) {
 	return p.cur.onIdentifier1()
 }
 
+func (c *current) onBOUND1() (interface{}, error) {
+	// Reject the bounds with max less than min, or not representable.
+	tok, _, _ := strings.Cut(string(c.text), "}")
+	if _, _, ok := parseBound(tok + "}"); !ok {
+		return nil, fmt.Errorf("invalid repetition bound %s}", tok)
+	}
+	return nil, nil
+}
+
+func (p *parser) callonBOUND1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onBOUND1()
+}
+
 var (
 	// errNoRule is returned when the grammar to parse has no rule.
 	errNoRule = errors.New("grammar has no rule")
@@ -2234,3 +2640,18 @@ func (p *parser) parseZeroOrOneExpr(expr *zeroOrOneExpr) (interface{}, bool) {
 	// whether it matched or not, consider it a match
 	return val, true
 }
+
+func rangeTable(class string) *unicode.RangeTable {
+	if rt, ok := unicode.Categories[class]; ok {
+		return rt
+	}
+	if rt, ok := unicode.Properties[class]; ok {
+		return rt
+	}
+	if rt, ok := unicode.Scripts[class]; ok {
+		return rt
+	}
+
+	// cannot happen
+	panic(fmt.Sprintf("invalid Unicode class: %s", class))
+}
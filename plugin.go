@@ -0,0 +1,209 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A plugin is an external command that reads grammars in other dialects or
+// runs custom lint checks.  The command is run once per request, with a JSON
+// request on stdin, and writes a JSON response on stdout:
+//
+//	{"method": "describe"}
+//	  => {"name": "antlr", "extensions": [".g4"], "checks": ["naming"]}
+//	{"method": "read", "path": "x.g4", "data": "..."}
+//	  => {"rules": [{"name": "A", "expr": "'a' B", "pos": {"line": 1, "col": 1, "offset": 0}}]}
+//	{"method": "check", "path": "x.peg", "rules": [...]}
+//	  => {"findings": [{"check": "naming", "severity": "warning", "rule": "A", "message": "..."}]}
+//
+// A read response must contain the rules converted to the pegcmp dialect.  A
+// response with an "error" member reports a failure.
+type plugin struct {
+	command    []string
+	name       string
+	extensions []string
+	checks     []string
+}
+
+// pluginRequest is a request sent to a plugin.
+type pluginRequest struct {
+	Method string       `json:"method"`
+	Path   string       `json:"path,omitempty"`
+	Data   string       `json:"data,omitempty"`
+	Rules  []pluginRule `json:"rules,omitempty"`
+}
+
+// pluginResponse is the response of a plugin to any request.
+type pluginResponse struct {
+	Error      string          `json:"error"`
+	Name       string          `json:"name"`
+	Extensions []string        `json:"extensions"`
+	Checks     []string        `json:"checks"`
+	Rules      []pluginRule    `json:"rules"`
+	Findings   []pluginFinding `json:"findings"`
+}
+
+// pluginRule is a rule exchanged with a plugin.
+type pluginRule struct {
+	Name     string   `json:"name"`
+	Expr     string   `json:"expr"`
+	Pos      Pos      `json:"pos"`
+	Comments []string `json:"comments,omitempty"`
+}
+
+// pluginFinding is a finding of a plugin check.
+type pluginFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// plugins are the loaded plugins.
+var plugins []*plugin
+
+// loadPlugins starts each plugin command, a program followed by its
+// arguments separated by spaces, registering the dialects it reads and the
+// analyzer of its checks.
+func loadPlugins(commands []string) error {
+	for _, command := range commands {
+		p := &plugin{command: strings.Fields(command)}
+		if len(p.command) == 0 {
+			return fmt.Errorf("empty plugin command")
+		}
+		resp, err := p.call(&pluginRequest{Method: "describe"})
+		if err != nil {
+			return err
+		}
+		p.name = resp.Name
+		if p.name == "" {
+			p.name = filepath.Base(p.command[0])
+		}
+		p.extensions = resp.Extensions
+		p.checks = resp.Checks
+		plugins = append(plugins, p)
+		if len(p.checks) > 0 {
+			analyzers = append(analyzers, &analyzer{
+				name: p.name,
+				run:  p.check,
+			})
+		}
+	}
+
+	return nil
+}
+
+// call sends req to the plugin, returning its response.
+func (p *plugin) call(req *pluginRequest) (*pluginResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin %s: %s: %v: %s", p.command[0], req.Method, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	resp := new(pluginResponse)
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("plugin %s: %s: invalid response: %v", p.command[0], req.Method, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %s: %s", p.command[0], resp.Error)
+	}
+
+	return resp, nil
+}
+
+// dialectPlugin returns the plugin reading the grammar at path, by its
+// extension, or nil.
+func dialectPlugin(path string) *plugin {
+	ext := filepath.Ext(path)
+	for _, p := range plugins {
+		for _, e := range p.extensions {
+			if e == ext {
+				return p
+			}
+		}
+	}
+
+	return nil
+}
+
+// read returns the rules of the grammar at path with content data, as
+// converted by the plugin.
+func (p *plugin) read(path string, data []byte) ([]Rule, error) {
+	resp, err := p.call(&pluginRequest{Method: "read", Path: path, Data: string(data)})
+	if err != nil {
+		return nil, &DialectError{p.name, path, err}
+	}
+	rules := make([]Rule, len(resp.Rules))
+	for i, r := range resp.Rules {
+		if !isIdent(r.Name) {
+			return nil, &DialectError{p.name, path, fmt.Errorf("invalid rule name %q", r.Name)}
+		}
+		rules[i] = Rule{
+			Name:     r.Name,
+			Expr:     strings.TrimSpace(r.Expr),
+			Text:     r.Name + " <- " + r.Expr,
+			Pos:      r.Pos,
+			Comments: r.Comments,
+		}
+		rules[i].Pos.Filename = path
+	}
+
+	return rules, nil
+}
+
+// check runs the checks of the plugin on s.  A plugin failure is reported as
+// an error finding on the first rule.
+func (p *plugin) check(s *syntax) []finding {
+	if len(s.rules) == 0 {
+		return nil
+	}
+	req := &pluginRequest{Method: "check", Path: s.rules[0].Pos.Filename}
+	index := make(map[string]*Rule)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		req.Rules = append(req.Rules, pluginRule{rule.Name, rule.Expr, rule.Pos, rule.Comments})
+		if _, ok := index[rule.Name]; !ok {
+			index[rule.Name] = rule
+		}
+	}
+	resp, err := p.call(req)
+	if err != nil {
+		return []finding{{severity: severityError, rule: &s.rules[0], msg: err.Error()}}
+	}
+
+	var list []finding
+	for _, f := range resp.Findings {
+		rule, ok := index[f.Rule]
+		if !ok {
+			rule = &s.rules[0]
+		}
+		sev := severityWarning
+		for i, name := range severityNames {
+			if name == f.Severity {
+				sev = severity(i)
+			}
+		}
+		msg := f.Message
+		if f.Check != "" {
+			msg = f.Check + ": " + msg
+		}
+		list = append(list, finding{severity: sev, rule: rule, msg: msg})
+	}
+
+	return list
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// policyFile is the name of the configuration file with the policy, in the
+// root of a project.
+const policyFile = "pegcmp.toml"
+
+// Change categories checked by a policy.
+const (
+	categoryAdded         = "added"          // a rule is added
+	categoryRemoved       = "removed"        // a rule is removed
+	categoryModified      = "modified"       // the expression of a rule is changed
+	categoryFirstSet      = "first-set"      // the FIRST set of a public rule, or of any rule, is changed
+	categoryLeftRecursion = "left-recursion" // a rule becomes left recursive
+	categoryBudget        = "budget"         // a rule exceeds the size budget
+)
+
+// policyCategories are the change categories, with their description.
+var policyCategories = map[string]string{
+	categoryAdded:         "adding rules",
+	categoryRemoved:       "removing rules",
+	categoryModified:      "modifying rules",
+	categoryFirstSet:      "changing FIRST sets of public rules",
+	categoryLeftRecursion: "introducing left recursion",
+	categoryBudget:        "exceeding the rule size budget",
+}
+
+// policy is the set of change categories that are denied, and the rule size
+// budget.
+type policy struct {
+	deny   map[string]bool
+	budget ruleBudget
+}
+
+// parseDenyList returns the policy denying the comma separated list of
+// categories.
+func parseDenyList(list string) (*policy, error) {
+	p := &policy{deny: make(map[string]bool)}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := policyCategories[name]; !ok {
+			return nil, fmt.Errorf("unknown change category %q, want one of %s",
+				name, strings.Join(categoryNames(), ", "))
+		}
+		p.deny[name] = true
+	}
+
+	return p, nil
+}
+
+// readPolicy reads the policy in the policy table of the TOML configuration
+// file named name in fsys, where each key is a change category and its
+// value is "allow" or "deny":
+//
+//	[policy]
+//	added = "allow"
+//	removed = "deny"
+//	budget = "deny"
+//
+//	[budget]
+//	alternatives = 20
+//	tokens = 200
+//	lines = 30
+//
+// Categories that are not specified are allowed.  The budget table sets the
+// limits of the rule size checked by the budget analyzer.
+func readPolicy(fsys fs.FS, name string) (*policy, error) {
+	data, err := readFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	file := displayName(fsys, name)
+	doc, err := parseTOML(file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &policy{deny: make(map[string]bool)}
+	for key, v := range doc["policy"] {
+		if _, ok := policyCategories[key]; !ok {
+			return nil, fmt.Errorf("%s: unknown change category %q, want one of %s",
+				file, key, strings.Join(categoryNames(), ", "))
+		}
+		switch v {
+		case "allow":
+		case "deny":
+			p.deny[key] = true
+		default:
+			return nil, fmt.Errorf("%s: invalid policy %v for %s, want allow or deny", file, v, key)
+		}
+	}
+	limits := p.budget.keys()
+	for key, v := range doc["budget"] {
+		limit, ok := limits[key]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown budget limit %q, want alternatives, tokens or lines", file, key)
+		}
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%s: invalid budget %v for %s, want a non-negative integer", file, v, key)
+		}
+		*limit = int(n)
+	}
+
+	return p, nil
+}
+
+// denyList returns the sorted categories denied by p, separated by commas,
+// or an empty string when p is nil.
+func (p *policy) denyList() string {
+	if p == nil {
+		return ""
+	}
+	list := make([]string, 0, len(p.deny))
+	for name := range p.deny {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
+
+// categoryNames returns the names of the change categories, sorted.
+func categoryNames() []string {
+	list := make([]string, 0, len(policyCategories))
+	for name := range policyCategories {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// violation is a change denied by a policy.
+type violation struct {
+	category string
+	rule     *Rule // rhs rule, or lhs rule when removed
+	msg      string
+}
+
+// check returns the changes in r denied by the policy, in report order.
+func (p *policy) check(r *report) []violation {
+	var list []violation
+	var lprops, rprops *props
+	if p.deny[categoryFirstSet] {
+		lprops = newProps(newSyntax(r.lgrammar))
+		rprops = newProps(newSyntax(r.rgrammar))
+	}
+	for _, c := range r.changes {
+		switch {
+		case c.kind == ruleAdded && p.deny[categoryAdded]:
+			list = append(list, violation{categoryAdded, c.rhs, "rule added"})
+		case c.kind == ruleRemoved && p.deny[categoryRemoved]:
+			list = append(list, violation{categoryRemoved, c.lhs, "rule removed"})
+		case c.kind == ruleModified && p.deny[categoryModified]:
+			list = append(list, violation{categoryModified, c.rhs, "rule modified"})
+		}
+		// Only the FIRST sets of the public rules matter, if any.
+		public := r.public == nil || c.rhs != nil && r.public[c.rhs.Name]
+		if lprops != nil && c.lhs != nil && c.rhs != nil && public {
+			if msg := firstSetChange(lprops, rprops, c.lhs.Name); msg != "" {
+				list = append(list, violation{categoryFirstSet, c.rhs, msg})
+			}
+		}
+	}
+	if p.deny[categoryLeftRecursion] {
+		for _, f := range r.findings {
+			if f.analyzer == leftRecursionAnalyzer.name {
+				list = append(list, violation{categoryLeftRecursion, f.rule, f.msg})
+			}
+		}
+	}
+	if p.deny[categoryBudget] {
+		for _, f := range r.findings {
+			if f.analyzer == budgetAnalyzer.name {
+				list = append(list, violation{categoryBudget, f.rule, f.msg})
+			}
+		}
+	}
+
+	return list
+}
+
+// firstSetChange returns the description of the change of the FIRST set of
+// the named rule, or the empty string if the set is unchanged or the rule
+// is invalid.
+func firstSetChange(lprops, rprops *props, name string) string {
+	lnode, lok := lprops.s.nodes[name]
+	rnode, rok := rprops.s.nodes[name]
+	if !lok || !rok {
+		return ""
+	}
+	lset, rset := lprops.first(lnode), rprops.first(rnode)
+	added, removed := rset.minus(lset), lset.minus(rset)
+	switch {
+	case len(added) == 0 && len(removed) == 0:
+		return ""
+	case len(removed) == 0:
+		return fmt.Sprintf("FIRST set adds %s", added)
+	case len(added) == 0:
+		return fmt.Sprintf("FIRST set removes %s", removed)
+	}
+
+	return fmt.Sprintf("FIRST set adds %s, removes %s", added, removed)
+}
+
+// writeViolations writes each violation in the file:line:col: format.
+func writeViolations(w io.Writer, list []violation) {
+	for _, v := range list {
+		fmt.Fprintf(w, "%s: rule %q: %s (%s)\n", v.rule.Pos, v.rule.Name, v.msg, policyCategories[v.category])
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// precLevel is a level of an operator precedence ladder: a rule combining
+// the operands of the next level with its binary operators, as in
+//
+//	Expr <- Term (("+" / "-") Term)*     left associative
+//	Expr <- Expr "+" Term / Term         left associative
+//	Pow  <- Unary "^" Pow / Unary        right associative
+//	Pow  <- Unary ("^" Pow)?             right associative
+type precLevel struct {
+	rule  string
+	next  string // rule of the operands
+	ops   []string
+	right bool // right associative
+}
+
+func (l *precLevel) String() string {
+	list := make([]string, len(l.ops))
+	for i, op := range l.ops {
+		list[i] = strconv.Quote(op)
+	}
+	assoc := "left"
+	if l.right {
+		assoc = "right"
+	}
+
+	return fmt.Sprintf("%s %s (%s)", l.rule, strings.Join(list, " "), assoc)
+}
+
+// precedence is the operator precedence implied by the rule references of a
+// grammar.
+type precedence struct {
+	ladders [][]*precLevel // from the lowest precedence level
+
+	// The index in its ladder of the level of each operator, and the
+	// level, for the first level defining it.
+	depth map[string]int
+	level map[string]*precLevel
+}
+
+// precParser recognizes the precedence levels of a grammar.
+type precParser struct {
+	s *syntax
+	p *props
+}
+
+// glue reports whether n is an item ignored between the operators and the
+// operands, a reference to a rule that matches the empty string, such as
+// the spacing.
+func (pp *precParser) glue(n node) bool {
+	ref, ok := n.(*refNode)
+
+	return ok && pp.p.nullable(ref)
+}
+
+// items returns the items of n, without the glue.
+func (pp *precParser) items(n node) []node {
+	var list []node
+	for _, item := range items(n) {
+		if !pp.glue(item) {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// operand returns the name of the rule referenced by n.
+func (pp *precParser) operand(n node) (string, bool) {
+	ref, ok := n.(*refNode)
+	if !ok || pp.p.nullable(ref) {
+		return "", false
+	}
+
+	return ref.name, true
+}
+
+// operators returns the literals matched by n when it is an operator: a
+// literal, a choice of operators or a reference to a rule that is an
+// operator, possibly followed by glue.
+func (pp *precParser) operators(n node, depth int) ([]string, bool) {
+	list := pp.items(n)
+	if len(list) != 1 || depth > 2 {
+		return nil, false
+	}
+	switch n := list[0].(type) {
+	case *litNode:
+		if n.value == "" {
+			return nil, false
+		}
+
+		return []string{n.value}, true
+	case *choiceNode:
+		var ops []string
+		for _, alt := range n.alts {
+			alts, ok := pp.operators(alt, depth)
+			if !ok {
+				return nil, false
+			}
+			ops = append(ops, alts...)
+		}
+
+		return ops, true
+	case *refNode:
+		if body, ok := pp.s.nodes[n.name]; ok {
+			return pp.operators(body, depth+1)
+		}
+	}
+
+	return nil, false
+}
+
+// binary matches the items of a binary expression a op b.
+func (pp *precParser) binary(n node) (lhs string, ops []string, rhs string, ok bool) {
+	list := pp.items(n)
+	if len(list) != 3 {
+		return "", nil, "", false
+	}
+	lhs, lok := pp.operand(list[0])
+	ops, ook := pp.operators(list[1], 0)
+	rhs, rok := pp.operand(list[2])
+
+	return lhs, ops, rhs, lok && ook && rok
+}
+
+// tail matches the items op b of a repetition or an option.
+func (pp *precParser) tail(n node) (ops []string, rhs string, ok bool) {
+	list := pp.items(n)
+	if len(list) != 2 {
+		return nil, "", false
+	}
+	ops, ook := pp.operators(list[0], 0)
+	rhs, rok := pp.operand(list[1])
+
+	return ops, rhs, ook && rok
+}
+
+// level returns the precedence level of the rule name with expression n, or
+// nil.
+func (pp *precParser) level(name string, n node) *precLevel {
+	if ch, ok := n.(*choiceNode); ok {
+		// Alternatives with one operator each, followed by the operand.
+		last := len(ch.alts) - 1
+		next, ok := pp.operand(newSeq(pp.items(ch.alts[last])))
+		if !ok || next == name {
+			return nil
+		}
+		l := &precLevel{rule: name, next: next}
+		for i, alt := range ch.alts[:last] {
+			lhs, ops, rhs, ok := pp.binary(alt)
+			right := lhs == next && rhs == name
+			if !ok || !right && (lhs != name || rhs != next) || i > 0 && right != l.right {
+				return nil
+			}
+			l.ops = append(l.ops, ops...)
+			l.right = right
+		}
+
+		return l
+	}
+
+	list := pp.items(n)
+	if len(list) != 2 {
+		return nil
+	}
+	next, ok := pp.operand(list[0])
+	rep, rok := list[1].(*repeatNode)
+	if !ok || !rok || next == name {
+		return nil
+	}
+	ops, rhs, ok := pp.tail(rep.expr)
+	switch {
+	case !ok:
+		return nil
+	case rep.op == '*' && rhs == next:
+		return &precLevel{rule: name, next: next, ops: ops}
+	case rep.op == '?' && rhs == name:
+		return &precLevel{rule: name, next: next, ops: ops, right: true}
+	}
+
+	return nil
+}
+
+// newPrecedence returns the precedence ladders of s, starting from the
+// levels that are not the operands of another level.
+func newPrecedence(s *syntax) *precedence {
+	pp := &precParser{s: s, p: newProps(s)}
+	levels := make(map[string]*precLevel)
+	operand := make(map[string]bool)
+	for i := range s.rules {
+		name := s.rules[i].Name
+		n, ok := s.nodes[name]
+		if _, dup := levels[name]; !ok || dup {
+			continue
+		}
+		if l := pp.level(name, n); l != nil {
+			levels[name] = l
+			operand[l.next] = true
+		}
+	}
+
+	prec := &precedence{depth: make(map[string]int), level: make(map[string]*precLevel)}
+	for i := range s.rules {
+		name := s.rules[i].Name
+		if levels[name] == nil || operand[name] {
+			continue
+		}
+		var ladder []*precLevel
+		seen := make(map[string]bool)
+		for l := levels[name]; l != nil && !seen[l.rule]; l = levels[l.next] {
+			seen[l.rule] = true
+			for _, op := range l.ops {
+				if _, ok := prec.level[op]; !ok {
+					prec.depth[op] = len(ladder)
+					prec.level[op] = l
+				}
+			}
+			ladder = append(ladder, l)
+		}
+		prec.ladders = append(prec.ladders, ladder)
+		levels[name] = nil
+	}
+
+	return prec
+}
+
+// precedenceDiff is the difference between the operator precedence of two
+// grammars.
+type precedenceDiff struct {
+	lhs, rhs *precedence
+
+	// Differences in the precedence or associativity of the operators
+	// common to both grammars.
+	changes []string
+}
+
+// relation returns the relation of the precedence of the operators a and b
+// in prec.
+func (prec *precedence) relation(a, b string) string {
+	switch da, db := prec.depth[a], prec.depth[b]; {
+	case prec.level[a] == prec.level[b]:
+		return "the same precedence"
+	case prec.ladderOf(a) != prec.ladderOf(b):
+		return "unrelated precedence"
+	case da > db:
+		return strconv.Quote(a) + " binding tighter"
+	default:
+		return strconv.Quote(b) + " binding tighter"
+	}
+}
+
+// ladderOf returns the index of the ladder defining the operator op.
+func (prec *precedence) ladderOf(op string) int {
+	for i, ladder := range prec.ladders {
+		for _, l := range ladder {
+			if l == prec.level[op] {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// diffPrecedence returns the differences in the precedence and
+// associativity of the operators defined by the precedence ladders of both
+// lgrammar and rgrammar, or nil.
+func diffPrecedence(lgrammar, rgrammar []Rule) *precedenceDiff {
+	d := &precedenceDiff{
+		lhs: newPrecedence(newSyntax(lgrammar)),
+		rhs: newPrecedence(newSyntax(rgrammar)),
+	}
+	var ops []string
+	for _, ladder := range d.lhs.ladders {
+		for _, l := range ladder {
+			for _, op := range l.ops {
+				if d.lhs.level[op] == l && d.rhs.level[op] != nil {
+					ops = append(ops, op)
+				}
+			}
+		}
+	}
+	for _, op := range ops {
+		l, r := d.lhs.level[op], d.rhs.level[op]
+		if l.right != r.right {
+			assoc := map[bool]string{false: "left", true: "right"}
+			d.changes = append(d.changes, fmt.Sprintf("operator %q is %s associative in %s, was %s associative in %s",
+				op, assoc[r.right], r.rule, assoc[l.right], l.rule))
+		}
+	}
+	for i, a := range ops {
+		for _, b := range ops[i+1:] {
+			if lrel, rrel := d.lhs.relation(a, b), d.rhs.relation(a, b); lrel != rrel {
+				d.changes = append(d.changes, fmt.Sprintf("operators %q and %q have %s, was %s",
+					a, b, rrel, lrel))
+			}
+		}
+	}
+	if len(d.changes) == 0 {
+		return nil
+	}
+
+	return d
+}
+
+// writePrecedence writes the precedence changes and the ladders of both
+// grammars.
+func writePrecedence(w io.Writer, d *precedenceDiff) {
+	for _, msg := range d.changes {
+		fmt.Fprintf(w, "! %s\n", msg)
+	}
+	fmt.Fprintln(w)
+	for _, ladder := range d.rhs.ladders {
+		fmt.Fprintf(w, "> %s\n", ladderString(ladder))
+	}
+	fmt.Fprintln(w)
+	for _, ladder := range d.lhs.ladders {
+		fmt.Fprintf(w, "< %s\n", ladderString(ladder))
+	}
+	fmt.Fprintln(w)
+}
+
+// ladderString returns the levels of ladder, from the lowest precedence.
+func ladderString(ladder []*precLevel) string {
+	list := make([]string, len(ladder))
+	for i, l := range ladder {
+		list[i] = l.String()
+	}
+
+	return strings.Join(list, " < ")
+}
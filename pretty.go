@@ -0,0 +1,225 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// exprStyle is the style of the expressions written by the diff printers.
+// With the source style the expressions are written as in the grammar.  The
+// other styles collapse the white space, including the white space in code
+// blocks, and omit the comments:
+//
+//	compact  each expression on a single line
+//	lines    each alternative of a choice on its own line, indented
+//	aligned  each alternative of a choice on its own line, aligned with
+//	         the first alternative
+//
+// When width is not 0, an expression fitting in width columns is written on
+// a single line, and one that does not fit is written as with the lines
+// style if compact.
+type exprStyle struct {
+	name  string
+	width int
+}
+
+// styleNames are the names of the expression styles.
+var styleNames = []string{"source", "compact", "lines", "aligned"}
+
+// printStyle is the style of the expressions written by the diff printers,
+// set from the command line and the project configuration.
+var printStyle = exprStyle{name: "source"}
+
+func (s exprStyle) String() string {
+	return fmt.Sprintf("%s,%d", s.name, s.width)
+}
+
+// readStyle reads the style in the format table of the TOML configuration
+// file named name in fsys:
+//
+//	[format]
+//	style = "aligned"
+//	width = 100
+//
+// The keys that are not specified are set to the default style.
+func readStyle(fsys fs.FS, name string) (exprStyle, error) {
+	s := exprStyle{name: "source"}
+	data, err := readFile(fsys, name)
+	if err != nil {
+		return s, err
+	}
+	file := displayName(fsys, name)
+	doc, err := parseTOML(file, data)
+	if err != nil {
+		return s, err
+	}
+	for key, v := range doc["format"] {
+		switch key {
+		case "style":
+			name, ok := v.(string)
+			if !ok || !slices.Contains(styleNames, name) {
+				return s, fmt.Errorf("%s: invalid style %v, want one of %s", file, v, strings.Join(styleNames, ", "))
+			}
+			s.name = name
+		case "width":
+			n, ok := v.(int64)
+			if !ok || n < 0 {
+				return s, fmt.Errorf("%s: invalid width %v, want a non-negative integer", file, v)
+			}
+			s.width = int(n)
+		default:
+			return s, fmt.Errorf("%s: unknown format key %q, want style or width", file, key)
+		}
+	}
+
+	return s, nil
+}
+
+// flagStyle returns the print style specified on the command line, with the
+// keys not specified read from the -policy file or, if not specified, from
+// the policy file in the current directory, if any.
+func flagStyle() (exprStyle, error) {
+	s := exprStyle{name: "source"}
+	config := *policyFlag
+	if _, err := os.Stat(policyFile); err == nil && config == "" {
+		config = policyFile
+	}
+	if config != "" {
+		var err error
+		if s, err = readStyle(cliFS, cliFS.name(config)); err != nil {
+			return s, err
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "style":
+			s.name = *styleFlag
+		case "width":
+			s.width = *widthFlag
+		}
+	})
+	if !slices.Contains(styleNames, s.name) {
+		return s, fmt.Errorf("unknown style %q, want one of %s", s.name, strings.Join(styleNames, ", "))
+	}
+	if s.width < 0 {
+		return s, fmt.Errorf("invalid width %d", s.width)
+	}
+
+	return s, nil
+}
+
+// styleToken is a token of an expression, with the white space before it
+// collapsed to a single space.
+type styleToken struct {
+	text  string
+	space bool
+}
+
+// styleTokens returns the tokens of expr, without white space and comments.
+func styleTokens(expr string) []styleToken {
+	var list []styleToken
+	space := false
+	for _, tok := range tokenize(expr) {
+		switch {
+		case isSpace(tok[0]) || tok[0] == '#' && !strings.HasPrefix(tok, "#{"):
+			space = true
+		case tok[0] == '{' || strings.HasPrefix(tok, "#{") || strings.HasPrefix(tok, "%{") || strings.HasPrefix(tok, "//{"):
+			list = append(list, styleToken{strings.Join(strings.Fields(tok), " "), space && len(list) > 0})
+			space = false
+		default:
+			list = append(list, styleToken{tok, space && len(list) > 0})
+			space = false
+		}
+	}
+
+	return list
+}
+
+// joinTokens returns the text of toks.
+func joinTokens(toks []styleToken) string {
+	var b strings.Builder
+	for i, tok := range toks {
+		if tok.space && i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok.text)
+	}
+
+	return b.String()
+}
+
+// expr returns expr in the style s, with the first line of expr
+// written at column col.
+func (s exprStyle) expr(expr string, col int) string {
+	if s.name == "source" {
+		return expr
+	}
+	toks := styleTokens(expr)
+	compact := joinTokens(toks)
+	if s.width > 0 && col+utf8.RuneCountInString(compact) <= s.width {
+		return compact
+	}
+	if s.name == "compact" && s.width == 0 {
+		return compact
+	}
+
+	// Split the choice at the top level.
+	var alts [][]styleToken
+	depth, start := 0, 0
+	for i, tok := range toks {
+		switch tok.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case "/":
+			if depth == 0 {
+				alts = append(alts, toks[start:i])
+				start = i + 1
+			}
+		}
+	}
+	alts = append(alts, toks[start:])
+	if len(alts) == 1 {
+		return compact
+	}
+	indent := "    "
+	if s.name == "aligned" {
+		indent = strings.Repeat(" ", max(col-2, 0))
+	}
+	var b strings.Builder
+	for i, alt := range alts {
+		if i > 0 {
+			b.WriteString("\n" + indent + "/ ")
+		}
+		if len(alt) > 0 {
+			alt[0].space = false
+		}
+		b.WriteString(joinTokens(alt))
+	}
+
+	return b.String()
+}
+
+// ruleExpr returns the expression of rule in the print style, written after
+// a prefix of col columns.
+func ruleExpr(rule *Rule, col int) string {
+	return printStyle.expr(rule.Expr, col)
+}
+
+// ruleDef returns the definition of rule in the print style, written after
+// a prefix of col columns.
+func ruleDef(rule *Rule, col int) string {
+	head := rule.Name + " <- "
+
+	return head + ruleExpr(rule, col+utf8.RuneCountInString(head))
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// progressInterval is the minimum interval between two progress updates.
+const progressInterval = 100 * time.Millisecond
+
+// progress reports the progress of a long operation on a single terminal
+// line.  A nil progress reports nothing.
+type progress struct {
+	w     io.Writer
+	label string
+	total int
+	done  int
+	start time.Time
+	last  time.Time
+	shown bool // the line is on the terminal
+}
+
+// newProgress returns a progress for an operation on total items, when
+// enabled and stderr is a terminal, or nil.
+func newProgress(enabled bool, label string, total int) *progress {
+	if !enabled || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	return &progress{w: os.Stderr, label: label, total: total, start: time.Now()}
+}
+
+// isTerminal reports whether f is a character device.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// step records an item as done.
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.done++
+	now := time.Now()
+	if p.shown && now.Sub(p.last) < progressInterval && p.done < p.total {
+		return
+	}
+	p.last = now
+	p.shown = true
+
+	eta := ""
+	if p.done > 0 && p.done < p.total {
+		elapsed := now.Sub(p.start)
+		left := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+		eta = fmt.Sprintf(", ETA %s", left.Round(time.Second))
+	}
+	fmt.Fprintf(p.w, "\r\x1b[K%s %d/%d (%d%%)%s", p.label, p.done, p.total, 100*p.done/p.total, eta)
+}
+
+// clear clears the progress line, before writing other output or when the
+// operation is done.  The next step draws the line again.
+func (p *progress) clear() {
+	if p == nil || !p.shown {
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[K")
+	p.shown = false
+}
@@ -0,0 +1,335 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Match lengths, in characters.  A maximum length is unbounded when the
+// rule can match inputs of any length, and a minimum length is never when
+// the rule never succeeds.
+const (
+	unbounded = -1
+	never     = math.MaxInt
+)
+
+// ruleProps are the computed properties of a rule.
+type ruleProps struct {
+	min, max  int  // match length
+	recursive bool // the rule references itself, directly or not
+	lexical   bool // the rule is token-like, see lexicalRules
+}
+
+// nullable reports whether the rule can succeed without consuming input.
+func (p ruleProps) nullable() bool {
+	return p.min == 0
+}
+
+// emptyOnly reports whether the rule can only succeed without consuming
+// input.
+func (p ruleProps) emptyOnly() bool {
+	return p.min == 0 && p.max == 0
+}
+
+// finite reports whether the rule matches inputs of bounded length.
+func (p ruleProps) finite() bool {
+	return p.max != unbounded
+}
+
+func (p ruleProps) String() string {
+	list := []string{"never succeeds"}
+	if p.min != never {
+		list = []string{"min " + lengthString(p.min), "max " + lengthString(p.max)}
+	}
+	for _, prop := range []struct {
+		name string
+		ok   bool
+	}{
+		{"nullable", p.nullable()},
+		{"empty-only", p.emptyOnly()},
+		{"finite", p.min != never && p.finite()},
+		{"recursive", p.recursive},
+		{"token", p.lexical},
+	} {
+		if prop.ok {
+			list = append(list, prop.name)
+		}
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// lengthString returns the match length n as a string.
+func lengthString(n int) string {
+	if n == unbounded {
+		return "unbounded"
+	}
+
+	return strconv.Itoa(n)
+}
+
+// lengths computes the minimum and maximum match lengths of the rules of a
+// grammar.
+type lengths struct {
+	s        *syntax
+	min, max map[string]int
+}
+
+// newLengths computes the match lengths of the rules of s, as fixed points.
+// The minimum lengths only decrease, from never.  The maximum lengths only
+// increase, and the ones still increasing after as many iterations as rules
+// are unbounded, since they grow along a cycle.
+func newLengths(s *syntax) *lengths {
+	l := &lengths{s: s, min: make(map[string]int), max: make(map[string]int)}
+	for name := range s.nodes {
+		l.min[name] = never
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, n := range s.nodes {
+			if m := l.minLen(n); m < l.min[name] {
+				l.min[name] = m
+				changed = true
+			}
+		}
+	}
+
+	for i, changed := 0, true; changed; i++ {
+		changed = false
+		for name, n := range s.nodes {
+			m := l.maxLen(n)
+			if i > len(s.nodes) && m != l.max[name] {
+				m = unbounded
+			}
+			if m != l.max[name] && l.max[name] != unbounded {
+				l.max[name] = m
+				changed = true
+			}
+		}
+	}
+
+	return l
+}
+
+// addLen returns the sum of the lengths a and b, with never and unbounded
+// absorbing the other lengths.
+func addLen(a, b int) int {
+	switch {
+	case a == never || b == never:
+		return never
+	case a == unbounded || b == unbounded:
+		return unbounded
+	}
+
+	return a + b
+}
+
+// minLen returns the minimum length matched by n.
+func (l *lengths) minLen(n node) int {
+	switch n := n.(type) {
+	case *choiceNode:
+		m := never
+		for _, alt := range n.alts {
+			m = min(m, l.minLen(alt))
+		}
+
+		return m
+	case *seqNode:
+		m := 0
+		for _, item := range n.items {
+			m = addLen(m, l.minLen(item))
+		}
+
+		return m
+	case *repeatNode:
+		lo, _ := n.bounds()
+		if lo == 0 {
+			return 0
+		}
+		m := l.minLen(n.expr)
+		if m == never {
+			return never
+		}
+
+		return lo * m
+	case *recoveryNode:
+		return min(l.minLen(n.expr), l.minLen(n.recover))
+	case *refNode:
+		if m, ok := l.min[n.name]; ok {
+			return m
+		}
+
+		return never
+	case *litNode:
+		return utf8.RuneCountInString(n.value)
+	case *classNode, *anyNode:
+		return 1
+	case *throwNode:
+		return never
+	}
+
+	// Predicates and state blocks.
+	return 0
+}
+
+// maxLen returns the maximum length matched by n.  Expressions that never
+// succeed have length 0.
+func (l *lengths) maxLen(n node) int {
+	if l.minLen(n) == never {
+		return 0
+	}
+	switch n := n.(type) {
+	case *choiceNode:
+		m := 0
+		for _, alt := range n.alts {
+			if a := l.maxLen(alt); a == unbounded || m == unbounded {
+				m = unbounded
+			} else {
+				m = max(m, a)
+			}
+		}
+
+		return m
+	case *seqNode:
+		m := 0
+		for _, item := range n.items {
+			m = addLen(m, l.maxLen(item))
+		}
+
+		return m
+	case *repeatNode:
+		_, hi := n.bounds()
+		m := l.maxLen(n.expr)
+		switch {
+		case m == 0:
+			return 0
+		case hi < 0 || m == unbounded:
+			return unbounded
+		}
+
+		return hi * m
+	case *recoveryNode:
+		a, b := l.maxLen(n.expr), l.maxLen(n.recover)
+		if a == unbounded || b == unbounded {
+			return unbounded
+		}
+
+		return max(a, b)
+	case *refNode:
+		return l.max[n.name]
+	case *litNode:
+		return utf8.RuneCountInString(n.value)
+	case *classNode, *anyNode:
+		return 1
+	}
+
+	return 0
+}
+
+// ruleProperties returns the properties of each rule of s.
+func ruleProperties(s *syntax) map[string]ruleProps {
+	l := newLengths(s)
+	g := newRefGraph(s)
+	lexical := lexicalRules(s)
+	props := make(map[string]ruleProps)
+	for name := range s.nodes {
+		props[name] = ruleProps{
+			min:       l.min[name],
+			max:       l.max[name],
+			recursive: g.reaches(name, name),
+			lexical:   lexical[name],
+		}
+	}
+
+	return props
+}
+
+// propChange is a rule defined in both grammars whose properties changed.
+type propChange struct {
+	name     string
+	lhs, rhs ruleProps
+}
+
+// diffProperties returns the rules of rgrammar, in order, whose properties
+// differ from the lhs rule with the same name.
+func diffProperties(lgrammar, rgrammar []Rule) []propChange {
+	lprops := ruleProperties(newSyntax(lgrammar))
+	rs := newSyntax(rgrammar)
+	rprops := ruleProperties(rs)
+	var list []propChange
+	seen := make(map[string]bool)
+	for _, rule := range rs.rules {
+		lp, lok := lprops[rule.Name]
+		rp, rok := rprops[rule.Name]
+		if !lok || !rok || seen[rule.Name] || lp == rp {
+			continue
+		}
+		seen[rule.Name] = true
+		list = append(list, propChange{rule.Name, lp, rp})
+	}
+
+	return list
+}
+
+// writeProperties writes the rules whose properties changed.
+func writeProperties(w io.Writer, list []propChange) {
+	for _, c := range list {
+		fmt.Fprintf(w, "! rule %q properties changed\n", c.name)
+		fmt.Fprintf(w, "> %s\n", c.rhs)
+		fmt.Fprintf(w, "< %s\n\n", c.lhs)
+	}
+}
+
+const analyzeUsage = `Usage: pegcmp analyze path...`
+
+// runAnalyze writes the properties of each rule of the grammars and their
+// recursion groups.
+func runAnalyze(args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, analyzeUsage)
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	for i, path := range flags.Args() {
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		s := newSyntax(grammar)
+		props := ruleProperties(s)
+		if i > 0 {
+			fmt.Println()
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		seen := make(map[string]bool)
+		for _, rule := range s.rules {
+			p, ok := props[rule.Name]
+			if !ok || seen[rule.Name] {
+				continue
+			}
+			seen[rule.Name] = true
+			fmt.Fprintf(tw, "%s:\t%s\t%s\n", rule.Pos, rule.Name, p)
+		}
+		tw.Flush()
+		for _, group := range recursionGroups(s) {
+			fmt.Printf("recursion group %s\n", recursionString(group))
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// anySet is the set of all code points.
+var anySet = runeSet{{0, utf8.MaxRune}}
+
+// props computes static properties of expressions, resolving rule references
+// in the grammar.  Recursive references are assumed to have the most
+// conservative value.
+type props struct {
+	s        *syntax
+	visiting map[string]bool
+}
+
+func newProps(s *syntax) *props {
+	return &props{s: s, visiting: make(map[string]bool)}
+}
+
+// resolve calls fn with the expression of the rule referenced by n, guarding
+// against recursion.  It returns false when the rule is undefined or already
+// being visited.
+func (p *props) resolve(n *refNode, fn func(node)) bool {
+	body, ok := p.s.nodes[n.name]
+	if !ok || p.visiting[n.name] {
+		return false
+	}
+	p.visiting[n.name] = true
+	fn(body)
+	delete(p.visiting, n.name)
+
+	return true
+}
+
+// nullable reports whether n can succeed without consuming input.
+func (p *props) nullable(n node) bool {
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			if p.nullable(alt) {
+				return true
+			}
+		}
+
+		return false
+	case *seqNode:
+		for _, item := range n.items {
+			if !p.nullable(item) {
+				return false
+			}
+		}
+
+		return true
+	case *predNode:
+		return true
+	case *repeatNode:
+		min, _ := n.bounds()
+
+		return min == 0 || p.nullable(n.expr)
+	case *recoveryNode:
+		return p.nullable(n.expr) || p.nullable(n.recover)
+	case *stateNode:
+		return true
+	case *refNode:
+		v := false
+		p.resolve(n, func(body node) {
+			v = p.nullable(body)
+		})
+
+		return v
+	case *litNode:
+		return n.value == ""
+	}
+
+	return false
+}
+
+// first returns the set of code points that can start an input matched by n.
+func (p *props) first(n node) runeSet {
+	var set runeSet
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			set = append(set, p.first(alt)...)
+		}
+	case *seqNode:
+		for _, item := range n.items {
+			set = append(set, p.first(item)...)
+			if !p.nullable(item) {
+				break
+			}
+		}
+	case *predNode:
+		// Predicates do not consume input.
+	case *repeatNode:
+		set = p.first(n.expr)
+	case *recoveryNode:
+		set = append(p.first(n.expr), p.first(n.recover)...)
+	case *refNode:
+		p.resolve(n, func(body node) {
+			set = p.first(body)
+		})
+	case *litNode:
+		if r, size := utf8.DecodeRuneInString(n.value); size > 0 {
+			set = runeSet{{r, r}}
+		}
+	case *classNode:
+		set = n.set
+	case *anyNode:
+		set = anySet
+	}
+
+	return set.normalize()
+}
+
+// alwaysSucceeds reports whether n succeeds on any input.
+func (p *props) alwaysSucceeds(n node) bool {
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			if p.alwaysSucceeds(alt) {
+				return true
+			}
+		}
+	case *seqNode:
+		for _, item := range n.items {
+			if !p.alwaysSucceeds(item) {
+				return false
+			}
+		}
+
+		return true
+	case *predNode:
+		return n.op == '&' && p.alwaysSucceeds(n.expr)
+	case *repeatNode:
+		min, _ := n.bounds()
+
+		return min == 0 || p.alwaysSucceeds(n.expr)
+	case *recoveryNode:
+		return p.alwaysSucceeds(n.expr)
+	case *stateNode:
+		return true
+	case *refNode:
+		v := false
+		p.resolve(n, func(body node) {
+			v = p.alwaysSucceeds(body)
+		})
+
+		return v
+	case *litNode:
+		return n.value == ""
+	}
+
+	return false
+}
+
+// literal returns the string matched by n, when n is a literal, a class with
+// a single code point or a reference to a rule matching a literal.
+func (p *props) literal(n node) (string, bool) {
+	switch n := n.(type) {
+	case *litNode:
+		return n.value, true
+	case *classNode:
+		if len(n.set) == 1 && n.set[0].lo == n.set[0].hi {
+			return string(n.set[0].lo), true
+		}
+	case *refNode:
+		var s string
+		ok := false
+		p.resolve(n, func(body node) {
+			s, ok = p.literal(body)
+		})
+
+		return s, ok
+	}
+
+	return "", false
+}
+
+// mustPrefix returns a string s such that n succeeds on any input starting
+// with s, if any.
+func (p *props) mustPrefix(n node) (string, bool) {
+	switch n := n.(type) {
+	case *seqNode:
+		var b strings.Builder
+		for i, item := range n.items {
+			if s, ok := p.literal(item); ok {
+				b.WriteString(s)
+
+				continue
+			}
+			for _, item := range n.items[i:] {
+				if !p.alwaysSucceeds(item) {
+					return "", false
+				}
+			}
+
+			break
+		}
+
+		return b.String(), true
+	case *refNode:
+		var s string
+		ok := false
+		p.resolve(n, func(body node) {
+			s, ok = p.mustPrefix(body)
+		})
+
+		return s, ok
+	}
+	if s, ok := p.literal(n); ok {
+		return s, true
+	}
+	if p.alwaysSucceeds(n) {
+		return "", true
+	}
+
+	return "", false
+}
+
+// mustFirst returns a set of code points such that n succeeds on any input
+// starting with one of them, if any.
+func (p *props) mustFirst(n node) (runeSet, bool) {
+	switch n := n.(type) {
+	case *seqNode:
+		set, ok := p.mustFirst(n.items[0])
+		if !ok {
+			return nil, false
+		}
+		for _, item := range n.items[1:] {
+			if !p.alwaysSucceeds(item) {
+				return nil, false
+			}
+		}
+
+		return set, true
+	case *refNode:
+		var set runeSet
+		ok := false
+		p.resolve(n, func(body node) {
+			set, ok = p.mustFirst(body)
+		})
+
+		return set, ok
+	case *classNode:
+		return n.set, true
+	case *anyNode:
+		return anySet, true
+	case *repeatNode:
+		if min, _ := n.bounds(); min > 0 {
+			return p.mustFirst(n.expr)
+		}
+	}
+
+	return nil, false
+}
+
+// startsWith returns the longest string that starts every input matched by
+// n.
+func (p *props) startsWith(n node) string {
+	switch n := n.(type) {
+	case *choiceNode:
+		prefix := p.startsWith(n.alts[0])
+		for _, alt := range n.alts[1:] {
+			prefix = commonPrefix(prefix, p.startsWith(alt))
+		}
+
+		return prefix
+	case *seqNode:
+		var b strings.Builder
+		for _, item := range n.items {
+			if s, ok := p.literal(item); ok {
+				b.WriteString(s)
+
+				continue
+			}
+			b.WriteString(p.startsWith(item))
+
+			break
+		}
+
+		return b.String()
+	case *repeatNode:
+		if min, _ := n.bounds(); min > 0 {
+			return p.startsWith(n.expr)
+		}
+	case *refNode:
+		var s string
+		p.resolve(n, func(body node) {
+			s = p.startsWith(body)
+		})
+
+		return s
+	}
+	s, _ := p.literal(n)
+
+	return s
+}
+
+// commonPrefix returns the longest common prefix of a and b.
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:i]
+}
@@ -0,0 +1,318 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The messages of proto/pegcmp.proto are encoded in the protocol buffers
+// binary format by hand, for the few messages of the service.
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoMessage is a message that can be encoded.
+type protoMessage interface {
+	appendProto(b []byte) []byte
+}
+
+// protoRequest is a message that can be decoded.
+type protoRequest interface {
+	unmarshalProto(b []byte) error
+}
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// appendString appends the string field, omitted when empty.
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+
+	return append(b, s...)
+}
+
+// appendInt32 appends the int32 field, omitted when 0.  Negative numbers are
+// sign extended to 64 bits.
+func appendInt32(b []byte, field int, n int) []byte {
+	if n == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+
+	return binary.AppendUvarint(b, uint64(int64(int32(n))))
+}
+
+// appendBool appends the bool field, omitted when false.
+func appendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+
+	return append(b, 1)
+}
+
+// appendMessage appends the embedded message field m.
+func appendMessage(b []byte, field int, m protoMessage) []byte {
+	data := m.appendProto(nil)
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+
+	return append(b, data...)
+}
+
+// protoField is a decoded field: its value for the varint and fixed wire
+// types, and its data for the length delimited wire type.
+type protoField struct {
+	num   int
+	wire  int
+	value uint64
+	data  []byte
+}
+
+var errProtoTruncated = errors.New("invalid message: truncated")
+
+// readFields calls fn with each field of the encoded message b.
+func readFields(b []byte, fn func(f protoField) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		b = b[n:]
+		f := protoField{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.value, n = binary.Uvarint(b); n <= 0 {
+				return errProtoTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errProtoTruncated
+			}
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errProtoTruncated
+			}
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errProtoTruncated
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return fmt.Errorf("invalid message: unsupported wire type %d", f.wire)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stringField returns the value of the string field f.
+func stringField(f protoField) (string, error) {
+	if f.wire != wireBytes {
+		return "", fmt.Errorf("invalid message: field %d is not a string", f.num)
+	}
+
+	return string(f.data), nil
+}
+
+// grammarField returns the value of the Grammar field f.
+func grammarField(f protoField) (*jsonGrammar, error) {
+	if f.wire != wireBytes {
+		return nil, fmt.Errorf("invalid message: field %d is not a message", f.num)
+	}
+	g := new(jsonGrammar)
+	err := readFields(f.data, func(f protoField) error {
+		var err error
+		switch f.num {
+		case 1:
+			g.Name, err = stringField(f)
+		case 2:
+			g.Content, err = stringField(f)
+		}
+
+		return err
+	})
+
+	return g, err
+}
+
+func (p Pos) appendProto(b []byte) []byte {
+	b = appendString(b, 1, p.Filename)
+	b = appendInt32(b, 2, p.Line)
+	b = appendInt32(b, 3, p.Col)
+
+	return appendInt32(b, 4, p.Offset)
+}
+
+func (r *parseRequest) unmarshalProto(b []byte) error {
+	return readFields(b, func(f protoField) error {
+		var err error
+		if f.num == 1 {
+			r.Grammar, err = grammarField(f)
+		}
+
+		return err
+	})
+}
+
+func (r *lintRequest) unmarshalProto(b []byte) error {
+	return (*parseRequest)(r).unmarshalProto(b)
+}
+
+func (r *digestRequest) unmarshalProto(b []byte) error {
+	return (*parseRequest)(r).unmarshalProto(b)
+}
+
+func (r *compareRequest) unmarshalProto(b []byte) error {
+	return readFields(b, func(f protoField) error {
+		var err error
+		switch f.num {
+		case 1:
+			r.LHS, err = grammarField(f)
+		case 2:
+			r.RHS, err = grammarField(f)
+		case 3:
+			r.UnicodeNormalize, err = stringField(f)
+		}
+
+		return err
+	})
+}
+
+func (r jsonParsedRule) appendProto(b []byte) []byte {
+	b = appendString(b, 1, r.Name)
+	b = appendString(b, 2, r.Expr)
+
+	return appendMessage(b, 3, r.Pos)
+}
+
+func (r parseResponse) appendProto(b []byte) []byte {
+	for _, rule := range r.Rules {
+		b = appendMessage(b, 1, rule)
+	}
+
+	return b
+}
+
+func (d *jsonDef) appendProto(b []byte) []byte {
+	b = appendString(b, 1, d.Expr)
+
+	return appendMessage(b, 2, d.Pos)
+}
+
+func (a jsonAlternative) appendProto(b []byte) []byte {
+	b = appendString(b, 1, a.Status)
+	b = appendBool(b, 2, a.Moved)
+	b = appendInt32(b, 3, a.LHSIndex)
+	b = appendInt32(b, 4, a.RHSIndex)
+	b = appendString(b, 5, a.LHS)
+
+	return appendString(b, 6, a.RHS)
+}
+
+func (c jsonClass) appendProto(b []byte) []byte {
+	b = appendString(b, 1, c.LHS)
+	b = appendString(b, 2, c.RHS)
+	b = appendString(b, 3, c.Relation)
+	for _, s := range c.Added {
+		b = appendTag(b, 4, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	for _, s := range c.Removed {
+		b = appendTag(b, 5, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+
+	return b
+}
+
+func (l jsonLiteral) appendProto(b []byte) []byte {
+	b = appendString(b, 1, l.LHS)
+	b = appendString(b, 2, l.RHS)
+	b = appendString(b, 3, l.LHSForm)
+
+	return appendString(b, 4, l.RHSForm)
+}
+
+// appendProto appends the RuleChange message.  The fields of the json format
+// not in the message are omitted.
+func (r *jsonRule) appendProto(b []byte) []byte {
+	b = appendString(b, 1, r.Name)
+	b = appendString(b, 2, r.Status)
+	b = appendBool(b, 3, r.Moved)
+	b = appendString(b, 4, r.CopyOf)
+	if r.LHS != nil {
+		b = appendMessage(b, 5, r.LHS)
+	}
+	if r.RHS != nil {
+		b = appendMessage(b, 6, r.RHS)
+	}
+	for _, a := range r.Alternatives {
+		b = appendMessage(b, 7, a)
+	}
+	for _, c := range r.Classes {
+		b = appendMessage(b, 8, c)
+	}
+	for _, l := range r.Literals {
+		b = appendMessage(b, 9, l)
+	}
+
+	return b
+}
+
+func (f *jsonFinding) appendProto(b []byte) []byte {
+	b = appendString(b, 1, f.Analyzer)
+	b = appendString(b, 2, f.Severity)
+	b = appendString(b, 3, f.Rule)
+	b = appendMessage(b, 4, f.Pos)
+
+	return appendString(b, 5, f.Message)
+}
+
+func (r compareResponse) appendProto(b []byte) []byte {
+	switch {
+	case r.Rule != nil:
+		b = appendMessage(b, 1, r.Rule)
+	case r.Finding != nil:
+		b = appendMessage(b, 2, r.Finding)
+	}
+
+	return b
+}
+
+func (r lintResponse) appendProto(b []byte) []byte {
+	for i := range r.Findings {
+		b = appendMessage(b, 1, &r.Findings[i])
+	}
+
+	return b
+}
+
+func (r digestResponse) appendProto(b []byte) []byte {
+	return appendString(b, 1, r.Digest)
+}
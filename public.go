@@ -0,0 +1,74 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+)
+
+// publicDirective marks a rule as part of the public surface of a grammar.
+const publicDirective = "pegcmp:public"
+
+// publicRules returns the names of the public rules in grammar: the rules
+// with the public directive and, when re is not nil, the rules whose name
+// matches re.
+func publicRules(grammar []Rule, re *regexp.Regexp) map[string]bool {
+	public := make(map[string]bool)
+	for i := range grammar {
+		rule := &grammar[i]
+		if rule.hasDirective(publicDirective) || re != nil && re.MatchString(rule.Name) {
+			public[rule.Name] = true
+		}
+	}
+
+	return public
+}
+
+// surface returns the names of the public rules of s and of the rules
+// reachable from them.
+func surface(s *syntax, public map[string]bool) map[string]bool {
+	graph := newRefGraph(s)
+	seen := make(map[string]bool)
+	var stack []string
+	for name := range public {
+		stack = append(stack, name)
+	}
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		stack = append(stack, graph[name]...)
+	}
+
+	return seen
+}
+
+// filterSurface removes from r the changes and findings of the rules that
+// are neither public nor reachable from a public rule, in either grammar.
+func filterSurface(r *report) {
+	lsurf := surface(newSyntax(r.lgrammar), r.public)
+	rsurf := surface(newSyntax(r.rgrammar), r.public)
+	inSurface := func(name string) bool {
+		return lsurf[name] || rsurf[name]
+	}
+
+	changes := r.changes[:0]
+	for _, c := range r.changes {
+		if inSurface(changeName(c)) {
+			changes = append(changes, c)
+		}
+	}
+	r.changes = changes
+	findings := r.findings[:0]
+	for _, f := range r.findings {
+		if inSurface(f.rule.Name) {
+			findings = append(findings, f)
+		}
+	}
+	r.findings = findings
+}
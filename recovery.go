@@ -0,0 +1,82 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// stripRecovery returns n without the error recovery constructs: each
+// recovery expression is replaced by the expression it guards, and the
+// alternatives of a choice that only throw a labeled failure are removed.
+// The result is false when n is unchanged.
+func stripRecovery(n node) (node, bool) {
+	switch n := n.(type) {
+	case *recoveryNode:
+		expr, _ := stripRecovery(n.expr)
+
+		return expr, true
+	case *choiceNode:
+		changed := false
+		var list []node
+		for _, alt := range n.alts {
+			if _, ok := alt.(*throwNode); ok {
+				changed = true
+
+				continue
+			}
+			alt, ok := stripRecovery(alt)
+			changed = changed || ok
+			list = append(list, alt)
+		}
+		if !changed {
+			return n, false
+		}
+		if len(list) == 0 {
+			// Keep the failure.
+			return n.alts[0], true
+		}
+
+		return newChoice(list), true
+	case *seqNode:
+		changed := false
+		list := make([]node, len(n.items))
+		for i, item := range n.items {
+			var ok bool
+			list[i], ok = stripRecovery(item)
+			changed = changed || ok
+		}
+		if !changed {
+			return n, false
+		}
+
+		return &seqNode{items: list}, true
+	case *predNode:
+		if expr, ok := stripRecovery(n.expr); ok {
+			return &predNode{op: n.op, expr: expr}, true
+		}
+	case *repeatNode:
+		if expr, ok := stripRecovery(n.expr); ok {
+			r := *n
+			r.expr = expr
+
+			return &r, true
+		}
+	}
+
+	return n, false
+}
+
+// stripRecoveryRules returns a copy of grammar with the error recovery
+// constructs removed from the rule expressions, in canonical form.
+func stripRecoveryRules(grammar []Rule) []Rule {
+	list := make([]Rule, len(grammar))
+	for i, rule := range grammar {
+		if n, err := parseExpr(rule.Expr); err == nil {
+			if stripped, ok := stripRecovery(n); ok {
+				rule.Expr = exprString(stripped)
+			}
+		}
+		list[i] = rule
+	}
+
+	return list
+}
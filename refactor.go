@@ -0,0 +1,72 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const refactorUsage = `Usage: pegcmp refactor left-factor|left-recursion [-w] path...`
+
+// refactorTransforms are the transforms of the refactor subcommand, by name.
+// Each returns the edits of a grammar source.
+var refactorTransforms = map[string]func(src *source) ([]sourceEdit, error){
+	"left-factor":    leftFactorSource,
+	"left-recursion": leftRecursionSource,
+}
+
+// runRefactor applies a transform to each grammar file, writing the result to
+// stdout or, with -w, to the file.  Only the transformed expressions are
+// rewritten, in canonical form.
+func runRefactor(args []string) {
+	if len(args) == 0 || refactorTransforms[args[0]] == nil {
+		fmt.Fprintln(os.Stderr, refactorUsage)
+
+		os.Exit(2)
+	}
+	transform := refactorTransforms[args[0]]
+	flags := flag.NewFlagSet("refactor "+args[0], flag.ExitOnError)
+	write := flags.Bool("w", false, "write the grammar to the file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, refactorUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	paths := parseInterspersed(flags, args[1:])
+	if len(paths) == 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	for _, path := range paths {
+		data, err := readFile(cliFS, cliFS.name(path))
+		if err != nil {
+			fatal(err)
+		}
+		src, err := newSource(path, data)
+		if err != nil {
+			fatal(err)
+		}
+		edits, err := transform(src)
+		if err != nil {
+			fatal(err)
+		}
+		out := src.apply(edits)
+
+		if *write {
+			if len(edits) == 0 {
+				continue
+			}
+			if err := os.WriteFile(path, out, 0o666); err != nil {
+				fatal(err)
+			}
+		} else {
+			os.Stdout.Write(out)
+		}
+	}
+}
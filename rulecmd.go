@@ -0,0 +1,58 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ruleCompareInput is the input of an external rule comparator.
+type ruleCompareInput struct {
+	Rule string `json:"rule"`
+	LHS  string `json:"lhs"`
+	RHS  string `json:"rhs"`
+}
+
+// externalEqual reports whether the external comparator command, a program
+// followed by its arguments separated by spaces, considers the expressions
+// of lrule and rrule equal.  The command reads a JSON object with the rule
+// name and both expressions on stdin, with the rule name also in the
+// PEGCMP_RULE environment variable, and exits with status 0 when they are
+// equal and 1 when they differ.  Any other failure is logged, and the rules
+// are considered different.
+func externalEqual(command string, lrule, rrule *Rule) bool {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return false
+	}
+	data, err := json.Marshal(&ruleCompareInput{rrule.Name, lrule.Expr, rrule.Expr})
+	if err != nil {
+		return false
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "PEGCMP_RULE="+rrule.Name)
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &exit) && exit.ExitCode() == 1:
+		return false
+	}
+	slog.Warn("rule comparator failed", "rule", rrule.Name, "command", args[0], "err", err,
+		"stderr", string(bytes.TrimSpace(stderr.Bytes())))
+
+	return false
+}
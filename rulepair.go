@@ -0,0 +1,80 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const ruleUsage = `Usage: pegcmp rule lhs-path:rule rhs-path:rule`
+
+// parseRuleArg parses an argument path:rule.  The path is split at the last
+// colon, so that it may be an URL.
+func parseRuleArg(arg string) (string, string, error) {
+	i := strings.LastIndexByte(arg, ':')
+	if i <= 0 || !isIdent(arg[i+1:]) {
+		return "", "", fmt.Errorf("invalid rule %q, want path:rule", arg)
+	}
+
+	return arg[:i], arg[i+1:], nil
+}
+
+// loadRule returns the first definition of the rule name in the grammar at
+// the operating system path or URL p, after normalization.
+func loadRule(p, name string, opts *options) (*Rule, error) {
+	grammar, err := parse(p)
+	if err != nil {
+		return nil, err
+	}
+	grammar = opts.normalizer.Normalize(grammar)
+	for i := range grammar {
+		if grammar[i].Name == name {
+			return &grammar[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: rule %q not defined", p, name)
+}
+
+// runRule compares a single rule of each grammar, possibly with different
+// names, writing the report of the pair in the format specified on the
+// command line.
+func runRule(args []string) {
+	flags := flag.NewFlagSet("rule", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, ruleUsage)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	opts := compareOptions()
+	var rules [2]*Rule
+	for i, arg := range flags.Args() {
+		path, name, err := parseRuleArg(arg)
+		if err != nil {
+			fatal(err)
+		}
+		if rules[i], err = loadRule(path, name, opts); err != nil {
+			fatal(err)
+		}
+	}
+
+	lrule, rrule := rules[0], rules[1]
+	r := &report{
+		lpath:    lrule.Pos.Filename,
+		rpath:    rrule.Pos.Filename,
+		lgrammar: []Rule{*lrule},
+		rgrammar: []Rule{*rrule},
+		changes:  []change{diffRule(lrule, rrule, opts)},
+		context:  -1,
+	}
+	writeReport(r)
+}
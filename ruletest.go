@@ -0,0 +1,176 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ruleTest is a test of a rule, annotated as a comment before the rule, as
+//
+//	# test accept: "foo"
+//	# test reject: 'bar'
+//
+// with the input as a PEG literal, matched with the rule as entry point.
+type ruleTest struct {
+	rule   *Rule
+	accept bool
+	input  string
+}
+
+func (t ruleTest) String() string {
+	kind := "reject"
+	if t.accept {
+		kind = "accept"
+	}
+
+	return fmt.Sprintf("test %s %s", kind, strconv.Quote(t.input))
+}
+
+// ruleTests returns the tests annotated on the rules of grammar, in order.
+// Invalid annotations are logged and ignored.
+func ruleTests(grammar []Rule) []ruleTest {
+	var list []ruleTest
+	for i := range grammar {
+		rule := &grammar[i]
+		for _, comment := range rule.Comments {
+			kind, lit, ok := strings.Cut(comment, ":")
+			accept := kind == "test accept"
+			if !ok || !accept && kind != "test reject" {
+				continue
+			}
+			lit = strings.TrimSpace(lit)
+			if len(lit) < 2 || lit[0] != '"' && lit[0] != '\'' || lit[len(lit)-1] != lit[0] {
+				slog.Warn("invalid rule test", "pos", rule.Pos, "rule", rule.Name, "test", comment)
+
+				continue
+			}
+			list = append(list, ruleTest{rule, accept, unquote(lit[1 : len(lit)-1])})
+		}
+	}
+
+	return list
+}
+
+// runTest matches the input of t with the rule of t in s, returning whether
+// the test passes and the outcome.
+func runTest(s *syntax, t ruleTest, opts *corpusOptions) (bool, string) {
+	var out outcome
+	var err error
+	out.end, out.ok, err = newCorpusMachine(s, t.input, newProfile(), opts).run(t.rule.Name)
+	out.size = len(t.input)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	return out.accepted() == t.accept, out.String()
+}
+
+// ruleTestDiff is a rule test passing in one grammar but not in the other.
+type ruleTestDiff struct {
+	test     ruleTest // with the rhs rule, if defined
+	lhsPass  bool
+	lhs, rhs string // outcomes
+}
+
+// diffRuleTests runs the tests annotated in either grammar with the rules
+// defined in both, returning the tests with different results.
+func diffRuleTests(lgrammar, rgrammar []Rule, opts *corpusOptions) []ruleTestDiff {
+	lsyn, rsyn := newSyntax(lgrammar), newSyntax(rgrammar)
+	rrules := make(map[string]*Rule)
+	for i := range rgrammar {
+		if _, ok := rrules[rgrammar[i].Name]; !ok {
+			rrules[rgrammar[i].Name] = &rgrammar[i]
+		}
+	}
+	type key struct {
+		name   string
+		accept bool
+		input  string
+	}
+	seen := make(map[key]bool)
+	var list []ruleTestDiff
+	for _, t := range append(ruleTests(rgrammar), ruleTests(lgrammar)...) {
+		k := key{t.rule.Name, t.accept, t.input}
+		_, lok := lsyn.nodes[t.rule.Name]
+		_, rok := rsyn.nodes[t.rule.Name]
+		if seen[k] || !lok || !rok {
+			continue
+		}
+		seen[k] = true
+		t.rule = rrules[t.rule.Name]
+		lpass, lout := runTest(lsyn, t, opts)
+		rpass, rout := runTest(rsyn, t, opts)
+		if lpass != rpass {
+			list = append(list, ruleTestDiff{t, lpass, lout, rout})
+		}
+	}
+
+	return list
+}
+
+// writeRuleTests writes the rule tests with different results.
+func writeRuleTests(w io.Writer, list []ruleTestDiff) {
+	for _, d := range list {
+		result := "passes in lhs, fails in rhs"
+		if !d.lhsPass {
+			result = "fails in lhs, passes in rhs"
+		}
+		fmt.Fprintf(w, "! rule %q: %s %s\n", d.test.rule.Name, d.test, result)
+		fmt.Fprintf(w, "> %s: %s\n", d.test.rule.Pos, d.rhs)
+		fmt.Fprintf(w, "< %s\n\n", d.lhs)
+	}
+}
+
+const testUsage = `Usage: pegcmp test path...`
+
+// runRuleTests runs the rule tests annotated in each grammar, writing the
+// failed tests, and exits with status 1 when a test fails.
+func runRuleTests(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, testUsage)
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	opts := &corpusOptions{
+		memo:     *memoFlag,
+		strict:   *noLeftRecursionFlag,
+		timeout:  *timeoutFlag,
+		maxSteps: *maxStepsFlag,
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		s := newSyntax(grammar)
+		tests := ruleTests(grammar)
+		failed := 0
+		for _, t := range tests {
+			if pass, out := runTest(s, t, opts); !pass {
+				fmt.Printf("%s: rule %q: %s failed: %s\n", t.rule.Pos, t.rule.Name, t, out)
+				failed++
+			}
+		}
+		fmt.Printf("%s: %d of %d tests passed\n", path, len(tests)-failed, len(tests))
+		if failed > 0 {
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,274 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// components returns the strongly connected components of the rule reference
+// graph g, visiting the rules in order.  A component follows the components
+// it references.
+func components(g refGraph, order []string) [][]string {
+	// Tarjan's algorithm.
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var list [][]string
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, to := range g[name] {
+			if _, ok := g[to]; !ok {
+				continue
+			}
+			if _, ok := index[to]; !ok {
+				visit(to)
+				low[name] = min(low[name], low[to])
+			} else if onStack[to] {
+				low[name] = min(low[name], index[to])
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+		var c []string
+		for {
+			n := len(stack) - 1
+			top := stack[n]
+			stack = stack[:n]
+			onStack[top] = false
+			c = append(c, top)
+			if top == name {
+				break
+			}
+		}
+		list = append(list, c)
+	}
+	for _, name := range order {
+		if _, ok := index[name]; !ok {
+			visit(name)
+		}
+	}
+
+	return list
+}
+
+// ruleOrder returns the names of the rules of s with an expression, in
+// definition order.
+func ruleOrder(s *syntax) []string {
+	var order []string
+	seen := make(map[string]bool)
+	for _, rule := range s.rules {
+		if _, ok := s.nodes[rule.Name]; ok && !seen[rule.Name] {
+			seen[rule.Name] = true
+			order = append(order, rule.Name)
+		}
+	}
+
+	return order
+}
+
+// recursionGroups returns the strongly connected components of the rule
+// reference graph of s that are recursive: the groups of mutually recursive
+// rules and the rules referencing themselves.  The rules of a group are in
+// definition order, and the groups in order of their first rule.
+func recursionGroups(s *syntax) [][]string {
+	g := newRefGraph(s)
+	order := ruleOrder(s)
+	pos := make(map[string]int)
+	for i, name := range order {
+		pos[name] = i
+	}
+	var groups [][]string
+	for _, c := range components(g, order) {
+		if len(c) > 1 || slices.Contains(g[c[0]], c[0]) {
+			slices.SortFunc(c, func(a, b string) int { return pos[a] - pos[b] })
+			groups = append(groups, c)
+		}
+	}
+	slices.SortFunc(groups, func(a, b []string) int { return pos[a[0]] - pos[b[0]] })
+
+	return groups
+}
+
+// recursionDiff is the difference between the recursion groups of two
+// grammars.
+type recursionDiff struct {
+	lhs, rhs [][]string
+	changes  []recursionChange
+}
+
+// recursionChange is a change of the recursion groups: the lhs groups sharing
+// rules with the rhs groups, transitively.  The kind is added, removed,
+// changed, merged, split or regrouped, when several lhs groups became several
+// rhs groups.
+type recursionChange struct {
+	kind     string
+	lhs, rhs [][]string
+}
+
+// notes returns the rules joining and leaving the groups.
+func (c recursionChange) notes() []string {
+	members := func(groups [][]string) []string {
+		var list []string
+		for _, g := range groups {
+			list = append(list, g...)
+		}
+
+		return list
+	}
+	lhs, rhs := members(c.lhs), members(c.rhs)
+	var list []string
+	for _, name := range rhs {
+		if !slices.Contains(lhs, name) {
+			list = append(list, fmt.Sprintf("rule %q is now recursive", name))
+		}
+	}
+	for _, name := range lhs {
+		if !slices.Contains(rhs, name) {
+			list = append(list, fmt.Sprintf("rule %q is no longer recursive", name))
+		}
+	}
+
+	return list
+}
+
+// diffRecursion returns the difference between the recursion groups of
+// lgrammar and rgrammar, with the changes in order of their first rhs group
+// followed by the removed groups.
+func diffRecursion(lgrammar, rgrammar []Rule) *recursionDiff {
+	d := &recursionDiff{
+		lhs: recursionGroups(newSyntax(lgrammar)),
+		rhs: recursionGroups(newSyntax(rgrammar)),
+	}
+	overlaps := func(a, b []string) bool {
+		for _, name := range a {
+			if slices.Contains(b, name) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Each change is a connected component of the groups, linked when they
+	// share a rule.
+	lseen := make([]bool, len(d.lhs))
+	rseen := make([]bool, len(d.rhs))
+	component := func(li, ri []int) (recursionChange, bool) {
+		for l, r := 0, 0; l < len(li) || r < len(ri); {
+			if l < len(li) {
+				for j, g := range d.rhs {
+					if !rseen[j] && overlaps(d.lhs[li[l]], g) {
+						rseen[j] = true
+						ri = append(ri, j)
+					}
+				}
+				l++
+			}
+			if r < len(ri) {
+				for i, g := range d.lhs {
+					if !lseen[i] && overlaps(d.rhs[ri[r]], g) {
+						lseen[i] = true
+						li = append(li, i)
+					}
+				}
+				r++
+			}
+		}
+		slices.Sort(li)
+		slices.Sort(ri)
+		var c recursionChange
+		for _, i := range li {
+			c.lhs = append(c.lhs, d.lhs[i])
+		}
+		for _, j := range ri {
+			c.rhs = append(c.rhs, d.rhs[j])
+		}
+		switch {
+		case len(c.lhs) == 0:
+			c.kind = "added"
+		case len(c.rhs) == 0:
+			c.kind = "removed"
+		case len(c.lhs) == 1 && len(c.rhs) == 1:
+			if slices.Equal(sortedCopy(c.lhs[0]), sortedCopy(c.rhs[0])) {
+				return c, false
+			}
+			c.kind = "changed"
+		case len(c.rhs) == 1:
+			c.kind = "merged"
+		case len(c.lhs) == 1:
+			c.kind = "split"
+		default:
+			c.kind = "regrouped"
+		}
+
+		return c, true
+	}
+	for j := range d.rhs {
+		if !rseen[j] {
+			rseen[j] = true
+			if c, ok := component(nil, []int{j}); ok {
+				d.changes = append(d.changes, c)
+			}
+		}
+	}
+	for i := range d.lhs {
+		if !lseen[i] {
+			lseen[i] = true
+			if c, ok := component([]int{i}, nil); ok {
+				d.changes = append(d.changes, c)
+			}
+		}
+	}
+
+	return d
+}
+
+// sortedCopy returns a sorted copy of list.
+func sortedCopy(list []string) []string {
+	list = slices.Clone(list)
+	slices.Sort(list)
+
+	return list
+}
+
+// recursionString returns the rules of a recursion group, in braces.
+func recursionString(group []string) string {
+	return "{" + strings.Join(group, ", ") + "}"
+}
+
+// writeRecursion writes the changes of the recursion groups.
+func writeRecursion(w io.Writer, d *recursionDiff) {
+	if d == nil {
+		return
+	}
+	for _, c := range d.changes {
+		switch c.kind {
+		case "merged", "regrouped":
+			fmt.Fprintf(w, "! recursion groups %s\n", c.kind)
+		default:
+			fmt.Fprintf(w, "! recursion group %s\n", c.kind)
+		}
+		for _, g := range c.rhs {
+			fmt.Fprintf(w, "> %s\n", recursionString(g))
+		}
+		for _, g := range c.lhs {
+			fmt.Fprintf(w, "< %s\n", recursionString(g))
+		}
+		for _, note := range c.notes() {
+			fmt.Fprintf(w, "~ %s\n", note)
+		}
+		fmt.Fprintln(w)
+	}
+}
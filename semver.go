@@ -0,0 +1,171 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const semverUsage = `Usage: pegcmp semver old-path new-path`
+
+// semverLevel is the semantic version component to increment for a change.
+type semverLevel int
+
+const (
+	semverNone  semverLevel = iota // the grammars are equal
+	semverPatch                    // formatting or internal changes
+	semverMinor                    // additive changes
+	semverMajor                    // incompatible changes
+)
+
+var semverNames = [...]string{
+	semverNone:  "none",
+	semverPatch: "patch",
+	semverMinor: "minor",
+	semverMajor: "major",
+}
+
+func (l semverLevel) String() string {
+	return semverNames[l]
+}
+
+// semverReason is a change that requires a version increment.
+type semverReason struct {
+	level semverLevel
+	rule  *Rule
+	msg   string
+}
+
+// classify returns the version increment required by the changes from
+// lgrammar to rgrammar, with the changes that require a minor or major
+// increment.  When the grammars define public rules, only the public rules
+// and the rules reachable from them are considered.
+func classify(lgrammar, rgrammar []Rule, opts *options) (semverLevel, []semverReason) {
+	level := semverNone
+	for _, c := range compare(lgrammar, rgrammar, opts) {
+		if c.kind != ruleEqual || c.moved {
+			level = semverPatch
+
+			break
+		}
+	}
+
+	// Compare the canonical forms, so that formatting changes are patches.
+	r := newReport("", "", normalizeRules(lgrammar), normalizeRules(rgrammar), opts)
+	if r.public != nil && !opts.publicOnly {
+		filterSurface(r)
+	}
+	lprops := newProps(newSyntax(r.lgrammar))
+	rprops := newProps(newSyntax(r.rgrammar))
+
+	var list []semverReason
+	report := func(l semverLevel, rule *Rule, format string, args ...interface{}) {
+		list = append(list, semverReason{l, rule, fmt.Sprintf(format, args...)})
+		if l > level {
+			level = l
+		}
+	}
+	for _, c := range r.changes {
+		switch c.kind {
+		case ruleAdded:
+			report(semverMinor, c.rhs, "rule added")
+		case ruleRemoved:
+			report(semverMajor, c.lhs, "rule removed")
+		case ruleModified:
+			classifyRule(c, report)
+		}
+		if c.lhs == nil || c.rhs == nil || r.public != nil && !r.public[c.rhs.Name] {
+			continue
+		}
+		lnode, lok := lprops.s.nodes[c.lhs.Name]
+		rnode, rok := rprops.s.nodes[c.rhs.Name]
+		if !lok || !rok {
+			continue
+		}
+		lset, rset := lprops.first(lnode), rprops.first(rnode)
+		if removed := lset.minus(rset); len(removed) > 0 {
+			report(semverMajor, c.rhs, "FIRST set narrowed, removes %s", removed)
+		} else if added := rset.minus(lset); len(added) > 0 {
+			report(semverMinor, c.rhs, "FIRST set widened, adds %s", added)
+		}
+	}
+
+	return level, list
+}
+
+// classifyRule reports the version increment required by the modified rule
+// of c, from its changed alternatives and character classes.  Other changes
+// to the expression are incompatible.
+func classifyRule(c change, report func(semverLevel, *Rule, string, ...interface{})) {
+	detailed := false
+	for _, a := range c.alts {
+		detailed = true
+		switch {
+		case a.kind == ruleAdded:
+			report(semverMinor, c.rhs, "alternative %d added", a.ri)
+		case a.kind == ruleRemoved:
+			report(semverMajor, c.rhs, "alternative %d removed", a.li)
+		case a.kind == ruleModified:
+			report(semverMajor, c.rhs, "alternative %d modified", a.ri)
+		case a.moved:
+			report(semverMajor, c.rhs, "alternative %d moved to %d", a.li, a.ri)
+		}
+	}
+	if len(c.alts) > 0 {
+		return
+	}
+	for _, cl := range c.classes {
+		detailed = true
+		switch cl.relation() {
+		case "equal":
+		case "superset":
+			report(semverMinor, c.rhs, "class %s widened", cl.rhs)
+		default:
+			report(semverMajor, c.rhs, "class %s narrows %s", cl.rhs, cl.lhs)
+		}
+	}
+	if !detailed {
+		report(semverMajor, c.rhs, "expression changed")
+	}
+}
+
+// writeReasons writes each reason in the file:line:col: format.
+func writeReasons(w io.Writer, list []semverReason) {
+	for _, r := range list {
+		fmt.Fprintf(w, "%s: %s: rule %q: %s\n", r.rule.Pos, r.level, r.rule.Name, r.msg)
+	}
+}
+
+// runSemver writes the semantic version increment required by the changes
+// from the old to the new grammar to stdout, and the changes that require it
+// to stderr.
+func runSemver(args []string) {
+	flags := flag.NewFlagSet("semver", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, semverUsage)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	opts := compareOptions()
+	lgrammar, err := parse(flags.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar, err := parse(flags.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	level, list := classify(lgrammar, rgrammar, opts)
+	writeReasons(os.Stderr, list)
+	fmt.Println(level)
+}
@@ -0,0 +1,373 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const serveUsage = `Usage: pegcmp serve [-addr address] [-grpc] [-max-request-size bytes]`
+
+// The service defined in proto/pegcmp.proto is served over HTTP, with the
+// JSON representation of the messages.  Each method is a POST to
+// /pegcmp.v1.Pegcmp/Method; the streamed responses of Compare are written
+// as newline delimited JSON, and an error after the first response is
+// written as a last {"error": message} object.  With serve -grpc, the same
+// paths also serve the gRPC protocol over HTTP/2.
+const servicePath = "/pegcmp.v1.Pegcmp/"
+
+// errorResponse is the last response of a JSON stream that failed.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// stream sends the response messages of a method in the format of the
+// transport.
+type stream interface {
+	send(msg protoMessage) error
+}
+
+// jsonStream is the stream of the JSON transport, with the content type of
+// the responses.
+type jsonStream struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (s *jsonStream) send(msg protoMessage) error {
+	if !s.started {
+		s.w.Header().Set("Content-Type", s.contentType)
+		s.started = true
+	}
+	if err := json.NewEncoder(s.w).Encode(msg); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// jsonGrammar is the JSON representation of a grammar file.
+type jsonGrammar struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// parse parses the grammar, without resolving the include directives,
+// counting the invalid grammars in the metrics.
+func (g *jsonGrammar) parse(ctx context.Context) ([]Rule, error) {
+	if g == nil {
+		return nil, fmt.Errorf("missing grammar")
+	}
+
+	rules, err := ParseGrammarContext(ctx, g.Name, []byte(g.Content))
+	if err != nil {
+		serveStats.parseFailed()
+	}
+
+	return rules, err
+}
+
+type (
+	parseRequest struct {
+		Grammar *jsonGrammar `json:"grammar"`
+	}
+	parseResponse struct {
+		Rules []jsonParsedRule `json:"rules"`
+	}
+	jsonParsedRule struct {
+		Name string `json:"name"`
+		Expr string `json:"expr"`
+		Pos  Pos    `json:"pos"`
+	}
+
+	compareRequest struct {
+		LHS              *jsonGrammar `json:"lhs"`
+		RHS              *jsonGrammar `json:"rhs"`
+		UnicodeNormalize string       `json:"unicode_normalize"`
+	}
+	compareResponse struct {
+		Rule    *jsonRule    `json:"rule,omitempty"`
+		Finding *jsonFinding `json:"finding,omitempty"`
+	}
+
+	lintRequest struct {
+		Grammar *jsonGrammar `json:"grammar"`
+	}
+	lintResponse struct {
+		Findings []jsonFinding `json:"findings"`
+	}
+
+	digestRequest struct {
+		Grammar *jsonGrammar `json:"grammar"`
+	}
+	digestResponse struct {
+		Digest string `json:"digest"`
+	}
+)
+
+// digest returns the hex encoded SHA-256 digest of the rules in grammar, in
+// order.
+func digest(grammar []Rule) string {
+	h := sha256.New()
+	for _, rule := range grammar {
+		fmt.Fprintf(h, "%s <- %s\n", rule.Name, rule.Expr)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newServeMux returns the handler of the service, caching the Compare
+// responses in cache and notifying the changes of category of the
+// comparisons, and of its metrics.  The request messages are limited to
+// maxSize bytes.
+func newServeMux(cache *resultCache, notify *notifier, maxSize int64) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc(servicePath+"Parse", method("application/json", maxSize, serveParse))
+	mux.HandleFunc(servicePath+"Compare", method("application/x-ndjson", maxSize, func(ctx context.Context, req *compareRequest, s stream) error {
+		return serveCompare(ctx, req, s, cache, notify)
+	}))
+	mux.HandleFunc(servicePath+"Lint", method("application/json", maxSize, serveLint))
+	mux.HandleFunc(servicePath+"Digest", method("application/json", maxSize, serveDigest))
+	mux.HandleFunc(metricsPath, serveMetricsHandler(cache))
+
+	return mux
+}
+
+// method returns a handler that decodes the request message, of at most
+// maxSize bytes, and invokes fn with the context of the request, canceled
+// when the client goes away, and the stream of the responses, written with
+// contentType by the JSON transport.  When fn returns an error the handler
+// replies with a bad request status or, when the responses were already
+// started, with an error response.  The request is counted in the metrics.
+func method[T any, P interface {
+	*T
+	protoRequest
+}](contentType string, maxSize int64, fn func(ctx context.Context, req P, s stream) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		name := strings.TrimPrefix(r.URL.Path, servicePath)
+		if isGRPC(r) {
+			serveStats.request(name, serveGRPC(w, r, maxSize, P(new(T)), func(req protoRequest, s stream) error {
+				return fn(r.Context(), req.(P), s)
+			}))
+
+			return
+		}
+
+		req := P(new(T))
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			status := http.StatusBadRequest
+			if errors.As(err, new(*http.MaxBytesError)) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			serveStats.request(name, err)
+
+			return
+		}
+		s := &jsonStream{w: w, contentType: contentType}
+		err := fn(r.Context(), req, s)
+		switch {
+		case err == nil:
+		case s.started:
+			json.NewEncoder(w).Encode(errorResponse{err.Error()})
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		serveStats.request(name, err)
+	}
+}
+
+func serveParse(ctx context.Context, req *parseRequest, s stream) error {
+	grammar, err := req.Grammar.parse(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp := parseResponse{Rules: []jsonParsedRule{}}
+	for _, rule := range grammar {
+		resp.Rules = append(resp.Rules, jsonParsedRule{rule.Name, rule.Expr, rule.Pos})
+	}
+
+	return s.send(resp)
+}
+
+// serveCompare streams the comparison of the grammars.  An unchanged pair of
+// grammars compared with the same options is replied from the cache, without
+// notifying it again.
+func serveCompare(ctx context.Context, req *compareRequest, s stream, cache *resultCache, notify *notifier) error {
+	lgrammar, err := req.LHS.parse(ctx)
+	if err != nil {
+		return err
+	}
+	rgrammar, err := req.RHS.parse(ctx)
+	if err != nil {
+		return err
+	}
+	opts := &options{normalize: req.UnicodeNormalize}
+	switch opts.normalize {
+	case "":
+		opts.normalize = "none"
+	case "NFC", "NFD", "none":
+	default:
+		return fmt.Errorf("unknown normalization form %q", opts.normalize)
+	}
+
+	key := cacheKey(lgrammar, rgrammar, opts)
+	if data, ok := cache.get(key); ok {
+		for _, resp := range decodeResponses(data) {
+			if err := s.send(resp); err != nil {
+				return err
+			}
+		}
+		serveStats.comparedCached(len(rgrammar), data)
+
+		return nil
+	}
+
+	// The responses are cached as newline delimited JSON.
+	var buf bytes.Buffer
+	var responses []compareResponse
+	enc := json.NewEncoder(&buf)
+	send := func(resp compareResponse) error {
+		if err := s.send(resp); err != nil {
+			return err
+		}
+		responses = append(responses, resp)
+
+		return enc.Encode(resp)
+	}
+	var changes []change
+	for c := range compareSeq(lgrammar, rgrammar, opts) {
+		changes = append(changes, c)
+		if c.kind == ruleEqual && !c.moved {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rule := newJSONRule(c)
+		if err := send(compareResponse{Rule: &rule}); err != nil {
+			return err
+		}
+	}
+	lfindings := analyze(newSyntax(lgrammar))
+	rfindings := analyze(newSyntax(rgrammar))
+	findings := newFindings(lfindings, rfindings)
+	for _, f := range findings {
+		finding := newJSONFinding(f)
+		if err := send(compareResponse{Finding: &finding}); err != nil {
+			return err
+		}
+	}
+	cache.put(key, buf.Bytes())
+	serveStats.compared(len(rgrammar), responses)
+	if notify != nil {
+		s := newNotifySummary(req.LHS.Name, req.RHS.Name, lgrammar, rgrammar, changes, len(findings), opts)
+		if err := notify.notify(ctx, s); err != nil {
+			logError(err)
+		}
+	}
+
+	return nil
+}
+
+// decodeResponses returns the newline delimited Compare responses in data.
+func decodeResponses(data []byte) []compareResponse {
+	var responses []compareResponse
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		var resp compareResponse
+		if json.Unmarshal(sc.Bytes(), &resp) == nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	return responses
+}
+
+func serveLint(ctx context.Context, req *lintRequest, s stream) error {
+	grammar, err := req.Grammar.parse(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp := lintResponse{Findings: []jsonFinding{}}
+	for _, f := range analyze(newSyntax(grammar)) {
+		resp.Findings = append(resp.Findings, newJSONFinding(f))
+	}
+
+	return s.send(resp)
+}
+
+func serveDigest(ctx context.Context, req *digestRequest, s stream) error {
+	grammar, err := req.Grammar.parse(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.send(digestResponse{digest(grammar)})
+}
+
+// runServe serves the comparison engine, with its metrics at /metrics.
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	grpc := flags.Bool("grpc", false, "also serve the gRPC protocol, over HTTP/2 without TLS")
+	maxSize := flags.Int64("max-request-size", 64<<20, "maximum size in bytes of the request messages")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, serveUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	cache := newResultCache("")
+	serveStats = newServeMetrics()
+	handler := http.Handler(newServeMux(cache, flagNotifier(""), *maxSize))
+	if *cacheStatsFlag {
+		// Report the statistics after each request.
+		mux := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mux.ServeHTTP(w, r)
+			cache.writeStats(os.Stderr)
+		})
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	if *grpc {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	slog.Info("serving", "addr", *addr, "grpc", *grpc)
+	fatal(srv.ListenAndServe())
+}
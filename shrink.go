@@ -0,0 +1,124 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxShrinkTests is the maximum number of candidate inputs matched while
+// shrinking an input.
+const maxShrinkTests = 2000
+
+// shrunkInput is the minimal input found where the grammars still disagree.
+type shrunkInput struct {
+	input    string
+	lhs, rhs outcome
+}
+
+// shrinker reduces an input where the lhs and rhs grammars disagree.
+type shrinker struct {
+	lsyn, rsyn     *syntax
+	lstart, rstart string
+	opts           *corpusOptions
+
+	// accept is true when the grammars disagree on accepting the input,
+	// rather than only on the matched length, so that the property is
+	// kept while shrinking.
+	accept bool
+	tests  int
+}
+
+// match returns the outcome of matching input with the lhs and rhs grammars,
+// and whether the grammars disagree as on the original input.  A run over
+// budget never disagrees.
+func (sh *shrinker) match(input string) (lout, rout outcome, ok bool) {
+	if sh.tests >= maxShrinkTests {
+		return lout, rout, false
+	}
+	sh.tests++
+	var lerr, rerr error
+	lout.end, lout.ok, lerr = newCorpusMachine(sh.lsyn, input, newProfile(), sh.opts).run(sh.lstart)
+	rout.end, rout.ok, rerr = newCorpusMachine(sh.rsyn, input, newProfile(), sh.opts).run(sh.rstart)
+	lout.size, rout.size = len(input), len(input)
+	if lerr != nil || rerr != nil {
+		return lout, rout, false
+	}
+	if sh.accept {
+		return lout, rout, lout.accepted() != rout.accepted()
+	}
+
+	return lout, rout, lout != rout
+}
+
+func (sh *shrinker) disagree(units []string) bool {
+	_, _, ok := sh.match(strings.Join(units, ""))
+
+	return ok
+}
+
+// shrink returns the minimal input, found with the ddmin algorithm first
+// over the lines of input and then over its characters, where the grammars
+// disagree as on d, or nil when input cannot be reduced.
+func (sh *shrinker) shrink(input string, d inputDiff) *shrunkInput {
+	sh.accept = d.lhs.accepted() != d.rhs.accepted()
+	units := ddmin(strings.SplitAfter(input, "\n"), sh.disagree)
+	units = ddmin(splitChars(strings.Join(units, "")), sh.disagree)
+	small := strings.Join(units, "")
+	if len(small) == len(input) {
+		return nil
+	}
+	sh.tests = 0
+	lout, rout, _ := sh.match(small)
+
+	return &shrunkInput{small, lout, rout}
+}
+
+// splitChars returns the UTF-8 encoded characters of s.
+func splitChars(s string) []string {
+	list := make([]string, 0, utf8.RuneCountInString(s))
+	for i, w := 0, 0; i < len(s); i += w {
+		_, w = utf8.DecodeRuneInString(s[i:])
+		list = append(list, s[i:i+w])
+	}
+
+	return list
+}
+
+// ddmin returns a 1-minimal subsequence of units for which test is true,
+// assuming it is true for units, using the delta debugging algorithm
+// described in "Simplifying and Isolating Failure-Inducing Input" by Andreas
+// Zeller and Ralf Hildebrandt.
+func ddmin(units []string, test func([]string) bool) []string {
+	for n := 2; len(units) >= 2; {
+		size := (len(units) + n - 1) / n
+		reduced := false
+		for i := 0; i < len(units) && !reduced; i += size {
+			subset := units[i:min(i+size, len(units))]
+			if test(subset) {
+				units, n, reduced = subset, 2, true
+			}
+		}
+		for i := 0; i < len(units) && !reduced; i += size {
+			complement := append(units[:i:i], units[min(i+size, len(units)):]...)
+			if test(complement) {
+				units, n, reduced = complement, max(n-1, 2), true
+			}
+		}
+		switch {
+		case reduced:
+		case n >= len(units):
+			return units
+		default:
+			n = min(2*n, len(units))
+		}
+	}
+	if len(units) == 1 && test(nil) {
+		return nil
+	}
+
+	return units
+}
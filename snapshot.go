@@ -0,0 +1,242 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const snapshotUsage = `Usage: pegcmp snapshot save [-dir path] [-label label] path
+       pegcmp snapshot diff [-dir path] [-label label] path
+       pegcmp snapshot list [-dir path] path`
+
+// snapshotLayout is the layout of the default snapshot label.
+const snapshotLayout = "20060102T150405"
+
+// snapshot is a normalized copy of a grammar, saved at a point in time.
+type snapshot struct {
+	Grammar string         `json:"grammar"`
+	Label   string         `json:"label"`
+	Time    time.Time      `json:"time"`
+	Rules   []snapshotRule `json:"rules"`
+}
+
+// snapshotRule is a rule of a snapshot, with its expression in canonical
+// form.
+type snapshotRule struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+	Pos  Pos    `json:"pos"`
+}
+
+// normalizeRules returns a copy of grammar with the rule expressions in
+// canonical form, so that formatting changes are ignored.  Rules with an
+// invalid expression keep the expression without comments.
+func normalizeRules(grammar []Rule) []Rule {
+	list := make([]Rule, len(grammar))
+	for i, rule := range grammar {
+		if n, err := parseExpr(rule.Expr); err == nil {
+			rule.Expr = exprString(n)
+		} else {
+			rule.Expr = strip(rule.Expr)
+		}
+		list[i] = rule
+	}
+
+	return list
+}
+
+// snapshotDir returns the directory in root with the snapshots of the
+// grammar at path.
+func snapshotDir(root, path string) string {
+	key := filepath.Base(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && filepath.IsLocal(rel) {
+				key = rel
+			}
+		}
+	}
+
+	return filepath.Join(root, key)
+}
+
+// validLabel reports whether label can be used as a snapshot file name.
+func validLabel(label string) bool {
+	return label != "" && label != "." && label != ".." && !strings.ContainsAny(label, `/\`)
+}
+
+// saveSnapshot saves grammar, parsed from path, in root with the specified
+// label.  An existing snapshot is not overwritten.
+func saveSnapshot(root, path, label string, grammar []Rule) (*snapshot, error) {
+	snap := &snapshot{
+		Grammar: path,
+		Label:   label,
+		Time:    time.Now().UTC().Truncate(time.Second),
+	}
+	for _, rule := range normalizeRules(grammar) {
+		snap.Rules = append(snap.Rules, snapshotRule{rule.Name, rule.Expr, rule.Pos})
+	}
+	data, err := json.MarshalIndent(snap, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	dir := snapshotDir(root, path)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, label+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("snapshot %q of %s already exists", label, path)
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return snap, f.Close()
+}
+
+// readSnapshots returns the snapshots in root of the grammar at path, from
+// the oldest to the newest.
+func readSnapshots(root, path string) ([]*snapshot, error) {
+	dir := snapshotDir(root, path)
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*snapshot
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		snap := new(snapshot)
+		if err := json.Unmarshal(data, snap); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		list = append(list, snap)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	return list, nil
+}
+
+// grammar returns the rules of the snapshot.
+func (s *snapshot) grammar() []Rule {
+	list := make([]Rule, len(s.Rules))
+	for i, rule := range s.Rules {
+		list[i] = Rule{Name: rule.Name, Expr: rule.Expr, Text: rule.Name + " <- " + rule.Expr, Pos: rule.Pos}
+	}
+
+	return list
+}
+
+// runSnapshot saves the normalized rules of a grammar as a labeled snapshot,
+// compares the grammar against a snapshot or lists the snapshots.
+func runSnapshot(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+
+		os.Exit(2)
+	}
+	cmd := args[0]
+	flags := flag.NewFlagSet("snapshot "+cmd, flag.ExitOnError)
+	dir := flags.String("dir", filepath.Join(".pegcmp", "snapshots"), "directory of the snapshots")
+	var label *string
+	switch cmd {
+	case "save":
+		label = flags.String("label", "", "label of the snapshot (default the current time)")
+	case "diff":
+		label = flags.String("label", "", "label of the snapshot (default the newest)")
+	case "list":
+	default:
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+
+		os.Exit(2)
+	}
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	switch cmd {
+	case "save":
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		if *label == "" {
+			*label = time.Now().UTC().Format(snapshotLayout)
+		}
+		if !validLabel(*label) {
+			fatalf("invalid snapshot label %q", *label)
+		}
+		snap, err := saveSnapshot(*dir, path, *label, grammar)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("%s\t%s\t%d rules\n", snap.Label, snap.Time.Format(time.RFC3339), len(snap.Rules))
+	case "diff":
+		if _, ok := formatters[*formatFlag]; !ok {
+			fatalf("unknown format %q", *formatFlag)
+		}
+		opts := compareOptions()
+		list, err := readSnapshots(*dir, path)
+		if err != nil {
+			fatal(err)
+		}
+		var snap *snapshot
+		for _, s := range list {
+			if *label == "" || s.Label == *label {
+				snap = s
+			}
+		}
+		switch {
+		case snap == nil && *label != "":
+			fatalf("no snapshot %q of %s", *label, path)
+		case snap == nil:
+			fatalf("no snapshots of %s", path)
+		}
+		grammar, err := parse(path)
+		if err != nil {
+			fatal(err)
+		}
+		lpath := snap.Grammar + "@" + snap.Label
+		writeReport(newReport(lpath, path, snap.grammar(), normalizeRules(grammar), opts))
+	case "list":
+		list, err := readSnapshots(*dir, path)
+		if err != nil {
+			fatal(err)
+		}
+		for _, snap := range list {
+			fmt.Printf("%s\t%s\t%d rules\n", snap.Label, snap.Time.Format(time.RFC3339), len(snap.Rules))
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const sortUsage = `Usage: pegcmp sort [-order topological|alphabetical] [-check | -w] path...`
+
+// ruleOrders are the supported orders of the rule definitions, by name.
+var ruleOrders = map[string]func(s *syntax) []int{
+	"topological":  topologicalOrder,
+	"alphabetical": alphabeticalOrder,
+}
+
+// topologicalOrder returns the indices of the rules of s in depth first
+// order of their references, starting from the first rule, so that each
+// rule is defined after the first rule that references it.  Rules that are
+// not reachable start a new traversal, in definition order.
+func topologicalOrder(s *syntax) []int {
+	graph := newRefGraph(s)
+	index := make(map[string]int)
+	for i, rule := range s.rules {
+		if _, ok := index[rule.Name]; !ok {
+			index[rule.Name] = i
+		}
+	}
+
+	var list []int
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		i, ok := index[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		list = append(list, i)
+		for _, ref := range graph[name] {
+			visit(ref)
+		}
+	}
+	for i, rule := range s.rules {
+		if seen[rule.Name] {
+			// Keep the duplicate definitions after the first.
+			if index[rule.Name] != i {
+				list = append(list, i)
+			}
+
+			continue
+		}
+		visit(rule.Name)
+	}
+
+	return list
+}
+
+// alphabeticalOrder returns the indices of the rules of s sorted by name,
+// keeping the first rule, the start rule, first.
+func alphabeticalOrder(s *syntax) []int {
+	list := make([]int, len(s.rules))
+	for i := range list {
+		list[i] = i
+	}
+	if len(list) > 1 {
+		rest := list[1:]
+		sort.SliceStable(rest, func(i, j int) bool {
+			return s.rules[rest[i]].Name < s.rules[rest[j]].Name
+		})
+	}
+
+	return list
+}
+
+// runSort checks or rewrites the order of the rule definitions in each
+// grammar file, preserving the comments and the formatting of each rule.
+// Included grammars are not followed.  With -check, the rules out of order
+// are reported and the exit status is 1 when there are any.
+func runSort(args []string) {
+	flags := flag.NewFlagSet("sort", flag.ExitOnError)
+	order := flags.String("order", "topological", "order of the rules: topological or alphabetical")
+	check := flags.Bool("check", false, "report the rules out of order instead of sorting them")
+	write := flags.Bool("w", false, "write the sorted grammar to the file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, sortUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 || *check && *write {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	sortRules, ok := ruleOrders[*order]
+	if !ok {
+		fatalf("unknown rule order %q", *order)
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		data, err := readFile(cliFS, cliFS.name(path))
+		if err != nil {
+			fatal(err)
+		}
+		src, err := newSource(path, data)
+		if err != nil {
+			fatal(err)
+		}
+		grammar := src.grammar()
+		perm := sortRules(newSyntax(grammar))
+
+		if *check {
+			names := make([]string, len(perm))
+			for i, j := range perm {
+				names[i] = grammar[j].Name
+			}
+			want := make([]string, len(grammar))
+			for i, rule := range grammar {
+				want[i] = rule.Name
+			}
+			for _, e := range myers(want, names) {
+				if e.op == opDelete {
+					rule := grammar[e.i]
+					fmt.Printf("%s: rule %q out of %s order\n", rule.Pos, rule.Name, *order)
+					status = 1
+				}
+			}
+
+			continue
+		}
+
+		out := src.reorder(perm)
+		if *write {
+			if err := os.WriteFile(path, out, 0o666); err != nil {
+				fatal(err)
+			}
+		} else {
+			os.Stdout.Write(out)
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// source is a grammar file with the byte offsets of each rule and of its
+// trivia: the comments, blank lines and original spacing.  Transforms edit
+// or reorder the source, so that the text they do not touch is regenerated
+// byte for byte.
+type source struct {
+	path  string
+	data  []byte
+	head  int // end of the text before the first rule and its comments
+	rules []*sourceRule
+}
+
+// sourceRule is a rule in a source.  The rule text spans from start to end,
+// and includes the comments before the rule and the trivia after it, up to
+// the comments of the next rule.
+type sourceRule struct {
+	rule       Rule
+	start, end int
+	expr       int // offset of the expression
+	exprEnd    int // end of the expression, before its trailing trivia
+}
+
+// newSource parses the grammar file at path with content data.
+func newSource(path string, data []byte) (*source, error) {
+	grammar, err := parseFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+	src := &source{path: path, data: data}
+	for _, rule := range grammar {
+		start := rule.Pos.Offset
+		for range rule.Comments {
+			start = bytes.LastIndexByte(data[:start-1], '\n') + 1
+		}
+		arrow := rule.Pos.Offset + strings.Index(rule.Text, "<-")
+		sr := &sourceRule{rule: rule, start: start, expr: arrow + 2}
+
+		// Skip the spacing around the expression.
+		off := sr.expr
+		for _, tok := range tokenize(rule.Text[arrow+2-rule.Pos.Offset:]) {
+			if isSpaceToken(tok) || isCommentToken(tok) {
+				if sr.exprEnd == 0 {
+					sr.expr += len(tok)
+				}
+			} else {
+				sr.exprEnd = off + len(tok)
+			}
+			off += len(tok)
+		}
+		if sr.exprEnd == 0 {
+			sr.exprEnd = sr.expr
+		}
+		src.rules = append(src.rules, sr)
+	}
+	if len(src.rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules", path)
+	}
+	for i, sr := range src.rules {
+		sr.end = len(data)
+		if i+1 < len(src.rules) {
+			sr.end = src.rules[i+1].start
+		}
+	}
+	src.head = src.rules[0].start
+
+	return src, nil
+}
+
+// rule returns the first definition of the named rule, or nil.
+func (src *source) rule(name string) *sourceRule {
+	for _, sr := range src.rules {
+		if sr.rule.Name == name {
+			return sr
+		}
+	}
+
+	return nil
+}
+
+// exprText returns the source text of the expression of sr, with the
+// comments and original spacing.
+func (src *source) exprText(sr *sourceRule) string {
+	return string(src.data[sr.expr:sr.exprEnd])
+}
+
+// parseExpr parses the source text of the expression of sr.  The spans of
+// the nodes are relative to the start of the expression in the source.
+func (src *source) parseExpr(sr *sourceRule) (node, error) {
+	n, err := parseExpr(src.exprText(sr))
+	if err != nil {
+		return nil, fmt.Errorf("%s: rule %q: %v", sr.rule.Pos, sr.rule.Name, err)
+	}
+
+	return n, nil
+}
+
+// text returns the source text of sr, ending with a newline.
+func (src *source) text(sr *sourceRule) []byte {
+	text := src.data[sr.start:sr.end]
+	if len(text) > 0 && text[len(text)-1] != '\n' {
+		text = append(text[:len(text):len(text)], '\n')
+	}
+
+	return text
+}
+
+// reorder returns the source with the rules in the order of the indices in
+// perm.
+func (src *source) reorder(perm []int) []byte {
+	var b bytes.Buffer
+	b.Write(src.data[:src.head])
+	for _, i := range perm {
+		b.Write(src.text(src.rules[i]))
+	}
+
+	return b.Bytes()
+}
+
+// sourceEdit replaces the source bytes from pos to end with text.
+type sourceEdit struct {
+	pos, end int
+	text     string
+}
+
+// apply returns the source with the edits applied.  The edits must not
+// overlap; insertions at the same offset are applied in order.
+func (src *source) apply(edits []sourceEdit) []byte {
+	edits = append([]sourceEdit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].pos < edits[j].pos
+	})
+
+	var b bytes.Buffer
+	off := 0
+	for _, e := range edits {
+		b.Write(src.data[off:e.pos])
+		b.WriteString(e.text)
+		off = e.end
+	}
+	b.Write(src.data[off:])
+
+	return b.Bytes()
+}
+
+// insertRule returns an edit adding a rule on the line after the end of the
+// expression of sr.
+func (src *source) insertRule(sr *sourceRule, name, expr string) sourceEdit {
+	text := fmt.Sprintf("%s <- %s\n", name, expr)
+	pos := len(src.data)
+	if i := bytes.IndexByte(src.data[sr.exprEnd:], '\n'); i >= 0 {
+		pos = sr.exprEnd + i + 1
+	} else {
+		text = "\n" + text
+	}
+
+	return sourceEdit{pos, pos, text}
+}
+
+// grammar returns the rules of the source.
+func (src *source) grammar() []Rule {
+	list := make([]Rule, len(src.rules))
+	for i, sr := range src.rules {
+		list[i] = sr.rule
+	}
+
+	return list
+}
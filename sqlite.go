@@ -0,0 +1,704 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The sqlite format writes the report as a SQLite database, with a run of
+// pegcmp in each row of the runs table, so that the runs appended to the
+// same database can be queried as a time series.  The rules of each grammar
+// have the status of their change, with the removed rules in the lhs grammar
+// and the other changes in the rhs grammar.  The metrics are the number of
+// rules of each grammar and of each status, of findings and of corpus inputs
+// and differences.
+//
+// The database is written without a SQLite library: it has only the tables
+// of sqliteTables, without indexes, and appending to it rewrites the whole
+// file, keeping the rows of the previous runs as they are.
+
+// sqliteTables are the tables of the database, with the statement creating
+// them.  An INTEGER PRIMARY KEY column is the rowid of the table.
+var sqliteTables = []struct {
+	name, sql string
+}{
+	{"runs", "CREATE TABLE runs (id INTEGER PRIMARY KEY, time TEXT NOT NULL, version TEXT NOT NULL)"},
+	{"grammars", "CREATE TABLE grammars (id INTEGER PRIMARY KEY, run INTEGER NOT NULL REFERENCES runs, side TEXT NOT NULL, path TEXT NOT NULL, digest TEXT NOT NULL)"},
+	{"rules", "CREATE TABLE rules (id INTEGER PRIMARY KEY, grammar INTEGER NOT NULL REFERENCES grammars, name TEXT NOT NULL, line INTEGER NOT NULL, expr TEXT NOT NULL, fingerprint TEXT NOT NULL, status TEXT)"},
+	{"findings", "CREATE TABLE findings (id INTEGER PRIMARY KEY, run INTEGER NOT NULL REFERENCES runs, rule INTEGER REFERENCES rules, analyzer TEXT NOT NULL, severity TEXT NOT NULL, message TEXT NOT NULL)"},
+	{"metrics", "CREATE TABLE metrics (run INTEGER NOT NULL REFERENCES runs, name TEXT NOT NULL, value INTEGER NOT NULL)"},
+}
+
+// sqlitePageSize is the page size of the written databases.
+const sqlitePageSize = 4096
+
+// sqliteRow is a row of a table, as its rowid and its record.
+type sqliteRow struct {
+	rowid  int64
+	record []byte
+}
+
+// sqliteDB is the content of a database written by pegcmp: the rows of each
+// table of sqliteTables.
+type sqliteDB struct {
+	tables  map[string][]sqliteRow
+	counter uint32 // file change counter
+}
+
+// insert appends a row with values to table, returning its rowid.  The
+// value of an INTEGER PRIMARY KEY column must be nil.
+func (db *sqliteDB) insert(table string, values ...any) int64 {
+	rows := db.tables[table]
+	rowid := int64(1)
+	if n := len(rows); n > 0 {
+		rowid = rows[n-1].rowid + 1
+	}
+	db.tables[table] = append(rows, sqliteRow{rowid, sqliteRecord(values...)})
+
+	return rowid
+}
+
+// addReport inserts a run with the grammars, the rules, the findings and the
+// metrics of r.
+func (db *sqliteDB) addReport(r *report, now time.Time) {
+	run := db.insert("runs", nil, now.UTC().Format(time.RFC3339), readBuildInfo().version)
+
+	status := make(map[*Rule]string)
+	counts := make(map[string]int)
+	for _, c := range r.changes {
+		name := statusNames[c.kind]
+		counts[name]++
+		if c.rhs != nil {
+			status[c.rhs] = name
+		} else {
+			status[c.lhs] = name
+		}
+	}
+	ids := make(map[*Rule]int64)
+	names := make(map[string]map[string]int64)
+	for _, side := range []struct {
+		name    string
+		path    string
+		grammar []Rule
+	}{
+		{"lhs", r.lpath, r.lgrammar},
+		{"rhs", r.rpath, r.rgrammar},
+	} {
+		grammar := db.insert("grammars", nil, run, side.name, side.path, digest(side.grammar))
+		names[side.name] = make(map[string]int64)
+		for i := range side.grammar {
+			rule := &side.grammar[i]
+			var st any
+			if s, ok := status[rule]; ok {
+				st = s
+			}
+			id := db.insert("rules", nil, grammar, rule.Name, rule.Pos.Line, rule.Expr, rule.Fingerprint(), st)
+			ids[rule] = id
+			if _, ok := names[side.name][rule.Name]; !ok {
+				names[side.name][rule.Name] = id
+			}
+		}
+	}
+
+	// ruleID returns the rowid of the rule of a finding, matching it by
+	// name in the grammar of side when it is a copy.
+	ruleID := func(rule *Rule, side string) any {
+		if rule == nil {
+			return nil
+		}
+		if id, ok := ids[rule]; ok {
+			return id
+		}
+		if id, ok := names[side][rule.Name]; ok {
+			return id
+		}
+
+		return nil
+	}
+	for _, f := range r.findings {
+		db.insert("findings", nil, run, ruleID(f.rule, "rhs"), f.analyzer, f.severity.String(), f.msg)
+	}
+	for _, f := range r.lhsIssues {
+		db.insert("findings", nil, run, ruleID(f.rule, "lhs"), f.analyzer, f.severity.String(), f.msg)
+	}
+
+	metric := func(name string, value int) {
+		db.insert("metrics", run, name, value)
+	}
+	metric("lhs-rules", len(r.lgrammar))
+	metric("rhs-rules", len(r.rgrammar))
+	for _, name := range statusNames {
+		metric(name, counts[name])
+	}
+	metric("findings", len(r.findings))
+	metric("lhs-issues", len(r.lhsIssues))
+	if r.corpus != nil {
+		metric("corpus-inputs", r.corpus.inputs)
+		metric("corpus-diffs", len(r.corpus.diffs))
+	}
+}
+
+// formatSQLite writes r as a new SQLite database.
+func formatSQLite(w io.Writer, r *report) error {
+	db := &sqliteDB{tables: make(map[string][]sqliteRow)}
+	db.addReport(r, time.Now())
+	data, err := db.encode()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+
+	return err
+}
+
+// appendSQLite appends r to the SQLite database at path, creating it when
+// it does not exist.  The database is replaced with a rename, so that a
+// reader never sees a partial file.
+func appendSQLite(path string, r *report) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	db, err := decodeSQLite(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	db.addReport(r, time.Now())
+	if data, err = db.encode(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".pegcmp-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	mode := fs.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// sqliteRecord returns the record of values: nil, an integer or a string.
+func sqliteRecord(values ...any) []byte {
+	var header, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			header = appendVarint(header, 0)
+		case int:
+			header, body = appendInteger(header, body, int64(v))
+		case int64:
+			header, body = appendInteger(header, body, v)
+		case string:
+			header = appendVarint(header, uint64(2*len(v)+13))
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("sqliteRecord: unsupported value %T", v))
+		}
+	}
+	// The header size includes its own varint.
+	n := len(header) + 1
+	for len(header)+len(appendVarint(nil, uint64(n))) > n {
+		n++
+	}
+	record := appendVarint(nil, uint64(n))
+
+	return append(append(record, header...), body...)
+}
+
+// appendInteger appends the serial type of v to header and its value to
+// body, with the smallest size.
+func appendInteger(header, body []byte, v int64) ([]byte, []byte) {
+	switch {
+	case v == 0:
+		return appendVarint(header, 8), body
+	case v == 1:
+		return appendVarint(header, 9), body
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	for _, t := range []struct {
+		serial uint64
+		size   int
+	}{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 6}} {
+		if bits := 8*t.size - 1; v >= -1<<bits && v < 1<<bits {
+			return appendVarint(header, t.serial), append(body, buf[8-t.size:]...)
+		}
+	}
+
+	return appendVarint(header, 6), append(body, buf[:]...)
+}
+
+// appendVarint appends the SQLite varint encoding of v to b: big endian,
+// with 7 bits in each byte with the high bit set when another byte follows,
+// and all the bits of the ninth byte.
+func appendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+
+	return append(b, buf[i:]...)
+}
+
+// varint decodes the SQLite varint at the start of b, returning its value
+// and length, or a length of 0 when b is too short.
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i == len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+
+	return v, 9
+}
+
+// localPayload returns the number of bytes of a payload of size p stored in
+// a table leaf cell, with usable bytes in each page; the rest is stored in
+// overflow pages.
+func localPayload(p, usable int) int {
+	x := usable - 35
+	if p <= x {
+		return p
+	}
+	m := (usable-12)*32/255 - 23
+	if k := m + (p-m)%(usable-4); k <= x {
+		return k
+	}
+
+	return m
+}
+
+// sqliteWriter allocates the pages of a database.
+type sqliteWriter struct {
+	pages [][]byte
+}
+
+// alloc returns the number and the content of a new page.
+func (w *sqliteWriter) alloc() (uint32, []byte) {
+	page := make([]byte, sqlitePageSize)
+	w.pages = append(w.pages, page)
+
+	return uint32(len(w.pages)), page
+}
+
+// leafCell returns the table leaf cell of row, storing the payload that
+// does not fit in overflow pages.
+func (w *sqliteWriter) leafCell(row sqliteRow) []byte {
+	p := len(row.record)
+	cell := appendVarint(nil, uint64(p))
+	cell = appendVarint(cell, uint64(row.rowid))
+	local := localPayload(p, sqlitePageSize)
+	cell = append(cell, row.record[:local]...)
+	if local == p {
+		return cell
+	}
+	n, page := w.alloc()
+	cell = binary.BigEndian.AppendUint32(cell, n)
+	for rest := row.record[local:]; ; {
+		rest = rest[copy(page[4:], rest):]
+		if len(rest) == 0 {
+			break
+		}
+		next, np := w.alloc()
+		binary.BigEndian.PutUint32(page, next)
+		page = np
+	}
+
+	return cell
+}
+
+// writePage writes a b-tree page of type typ with cells, and the right
+// child of an interior page, with the header at offset hdr.
+func writePage(page []byte, hdr int, typ byte, cells [][]byte, right uint32) {
+	page[hdr] = typ
+	binary.BigEndian.PutUint16(page[hdr+3:], uint16(len(cells)))
+	ptr := hdr + 8
+	if typ == sqliteInterior {
+		binary.BigEndian.PutUint32(page[hdr+8:], right)
+		ptr += 4
+	}
+	off := len(page)
+	for _, cell := range cells {
+		off -= len(cell)
+		copy(page[off:], cell)
+		binary.BigEndian.PutUint16(page[ptr:], uint16(off))
+		ptr += 2
+	}
+	binary.BigEndian.PutUint16(page[hdr+5:], uint16(off))
+}
+
+// The types of the table b-tree pages.
+const (
+	sqliteInterior = 0x05
+	sqliteLeaf     = 0x0d
+)
+
+// table writes the b-tree of a table with rows, in rowid order, returning
+// its root page.
+func (w *sqliteWriter) table(rows []sqliteRow) uint32 {
+	type child struct {
+		page uint32
+		key  int64 // largest rowid
+	}
+	page := func(typ byte, cells [][]byte, right uint32) uint32 {
+		n, page := w.alloc()
+		writePage(page, 0, typ, cells, right)
+
+		return n
+	}
+
+	var level []child
+	var cells [][]byte
+	size := 8
+	var key int64
+	for _, row := range rows {
+		cell := w.leafCell(row)
+		if len(cells) > 0 && size+len(cell)+2 > sqlitePageSize {
+			level = append(level, child{page(sqliteLeaf, cells, 0), key})
+			cells, size = nil, 8
+		}
+		cells = append(cells, cell)
+		size += len(cell) + 2
+		key = row.rowid
+	}
+	level = append(level, child{page(sqliteLeaf, cells, 0), key})
+
+	// An interior cell has a 4 bytes page number and a varint of at most 9
+	// bytes, and a page has at least two children.
+	const perPage = (sqlitePageSize-12)/(4+9+2) + 1
+	for len(level) > 1 {
+		var next []child
+		for len(level) > 0 {
+			n := min(perPage, len(level))
+			if len(level)-n == 1 {
+				n--
+			}
+			group := level[:n]
+			level = level[n:]
+			var cells [][]byte
+			for _, c := range group[:n-1] {
+				cells = append(cells, appendVarint(binary.BigEndian.AppendUint32(nil, c.page), uint64(c.key)))
+			}
+			last := group[n-1]
+			next = append(next, child{page(sqliteInterior, cells, last.page), last.key})
+		}
+		level = next
+	}
+
+	return level[0].page
+}
+
+// encode returns the database file.  The schema table is in the first
+// page, after the file header.
+func (db *sqliteDB) encode() ([]byte, error) {
+	w := new(sqliteWriter)
+	_, first := w.alloc()
+	var schema [][]byte
+	size := 100 + 8
+	for i, t := range sqliteTables {
+		root := w.table(db.tables[t.name])
+		rec := sqliteRecord("table", t.name, t.name, int64(root), t.sql)
+		cell := w.leafCell(sqliteRow{int64(i + 1), rec})
+		size += len(cell) + 2
+		schema = append(schema, cell)
+	}
+	if size > sqlitePageSize {
+		return nil, errors.New("sqlite: schema does not fit in the first page")
+	}
+	writePage(first, 100, sqliteLeaf, schema, 0)
+
+	h := first[:100]
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], sqlitePageSize)
+	h[18], h[19] = 1, 1 // legacy file format, without WAL
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], db.counter+1)
+	binary.BigEndian.PutUint32(h[28:], uint32(len(w.pages)))
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[92:], db.counter+1)
+	binary.BigEndian.PutUint32(h[96:], 3040001) // SQLite version written
+
+	return bytes.Join(w.pages, nil), nil
+}
+
+// sqliteFile is a database file being read.
+type sqliteFile struct {
+	data             []byte
+	pageSize, usable int
+}
+
+// page returns page n.
+func (f *sqliteFile) page(n uint32) ([]byte, error) {
+	off := (int64(n) - 1) * int64(f.pageSize)
+	if n == 0 || off+int64(f.pageSize) > int64(len(f.data)) {
+		return nil, fmt.Errorf("invalid page %d", n)
+	}
+
+	return f.data[off : off+int64(f.pageSize)], nil
+}
+
+// rows returns the rows of the table b-tree at page n, in rowid order.
+// depth limits the height of the tree, since the file may be corrupt.
+func (f *sqliteFile) rows(n uint32, depth int) ([]sqliteRow, error) {
+	errCorrupt := fmt.Errorf("corrupt page %d", n)
+	if depth > 20 {
+		return nil, errCorrupt
+	}
+	page, err := f.page(n)
+	if err != nil {
+		return nil, err
+	}
+	hdr := 0
+	if n == 1 {
+		hdr = 100
+	}
+	typ := page[hdr]
+	ncells := int(binary.BigEndian.Uint16(page[hdr+3:]))
+	ptr := hdr + 8
+	if typ == sqliteInterior {
+		ptr += 4
+	} else if typ != sqliteLeaf {
+		return nil, errCorrupt
+	}
+	if ptr+2*ncells > len(page) {
+		return nil, errCorrupt
+	}
+
+	var list []sqliteRow
+	for i := 0; i < ncells; i++ {
+		off := int(binary.BigEndian.Uint16(page[ptr+2*i:]))
+		if off >= f.usable {
+			return nil, errCorrupt
+		}
+		cell := page[off:f.usable]
+		if typ == sqliteInterior {
+			if len(cell) < 4 {
+				return nil, errCorrupt
+			}
+			rows, err := f.rows(binary.BigEndian.Uint32(cell), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, rows...)
+
+			continue
+		}
+		row, err := f.leafRow(cell)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", n, err)
+		}
+		list = append(list, row)
+	}
+	if typ == sqliteInterior {
+		rows, err := f.rows(binary.BigEndian.Uint32(page[hdr+8:]), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, rows...)
+	}
+
+	return list, nil
+}
+
+// leafRow returns the row of a table leaf cell, reading the overflow pages.
+func (f *sqliteFile) leafRow(cell []byte) (sqliteRow, error) {
+	errCorrupt := errors.New("corrupt cell")
+	p, n := varint(cell)
+	if n == 0 || p > uint64(len(f.data)) {
+		return sqliteRow{}, errCorrupt
+	}
+	cell = cell[n:]
+	rowid, n := varint(cell)
+	if n == 0 {
+		return sqliteRow{}, errCorrupt
+	}
+	cell = cell[n:]
+	local := localPayload(int(p), f.usable)
+	if local > len(cell) || local < int(p) && local+4 > len(cell) {
+		return sqliteRow{}, errCorrupt
+	}
+	record := append([]byte(nil), cell[:local]...)
+	if local < int(p) {
+		next := binary.BigEndian.Uint32(cell[local:])
+		for len(record) < int(p) {
+			page, err := f.page(next)
+			if err != nil {
+				return sqliteRow{}, err
+			}
+			k := min(int(p)-len(record), f.usable-4)
+			record = append(record, page[4:4+k]...)
+			next = binary.BigEndian.Uint32(page)
+		}
+	}
+
+	return sqliteRow{int64(rowid), record}, nil
+}
+
+// sqliteValues returns the values of a record: nil, int64, float64, string
+// or []byte.
+func sqliteValues(record []byte) ([]any, error) {
+	errCorrupt := errors.New("corrupt record")
+	size, n := varint(record)
+	if n == 0 || size > uint64(len(record)) {
+		return nil, errCorrupt
+	}
+	header, body := record[n:size], record[size:]
+	var values []any
+	for len(header) > 0 {
+		t, n := varint(header)
+		if n == 0 {
+			return nil, errCorrupt
+		}
+		header = header[n:]
+		var size int
+		switch {
+		case t >= 1 && t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = int(t-12) / 2
+		}
+		if size > len(body) {
+			return nil, errCorrupt
+		}
+		b := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t <= 6:
+			v := int64(int8(b[0]))
+			for _, c := range b[1:] {
+				v = v<<8 | int64(c)
+			}
+			values = append(values, v)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(b)))
+		case t == 8 || t == 9:
+			values = append(values, int64(t-8))
+		case t >= 12 && t%2 == 0:
+			values = append(values, append([]byte(nil), b...))
+		case t >= 13:
+			values = append(values, string(b))
+		default:
+			return nil, errCorrupt
+		}
+	}
+
+	return values, nil
+}
+
+// decodeSQLite returns the content of a database written by pegcmp, or of
+// an empty one when data is empty.  A database with other schema objects,
+// or with tables of another schema, is rejected, since rewriting it would
+// lose them.
+func decodeSQLite(data []byte) (*sqliteDB, error) {
+	db := &sqliteDB{tables: make(map[string][]sqliteRow)}
+	if len(data) == 0 {
+		return db, nil
+	}
+	if len(data) < 100 || string(data[:16]) != "SQLite format 3\x00" {
+		return nil, errors.New("not a SQLite database")
+	}
+	f := &sqliteFile{data: data, pageSize: int(binary.BigEndian.Uint16(data[16:]))}
+	if f.pageSize == 1 {
+		f.pageSize = 65536
+	}
+	f.usable = f.pageSize - int(data[20])
+	switch {
+	case f.pageSize < 512 || f.pageSize&(f.pageSize-1) != 0 || f.usable < 480:
+		return nil, errors.New("invalid SQLite page size")
+	case data[18] != 1 || data[19] != 1:
+		return nil, errors.New("SQLite database in WAL mode, checkpoint it with PRAGMA journal_mode=DELETE")
+	case binary.BigEndian.Uint32(data[56:]) != 1:
+		return nil, errors.New("SQLite database not encoded in UTF-8")
+	}
+	db.counter = binary.BigEndian.Uint32(data[24:])
+
+	schema, err := f.rows(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	sql := make(map[string]string)
+	for _, t := range sqliteTables {
+		sql[t.name] = t.sql
+	}
+	for _, row := range schema {
+		values, err := sqliteValues(row.record)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 5 {
+			return nil, errors.New("invalid SQLite schema")
+		}
+		typ, _ := values[0].(string)
+		name, _ := values[1].(string)
+		root, _ := values[3].(int64)
+		def, _ := values[4].(string)
+		switch {
+		case typ != "table" || sql[name] == "":
+			return nil, fmt.Errorf("unknown %s %q, the database must be written only by pegcmp", typ, name)
+		case def != sql[name]:
+			return nil, fmt.Errorf("table %s has a different schema", name)
+		}
+		if db.tables[name], err = f.rows(uint32(root), 0); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+	}
+
+	return db, nil
+}
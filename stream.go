@@ -0,0 +1,263 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// ruleStarts returns the offsets in src of the names of the rule
+// definitions, found as an identifier followed by "<-".
+func ruleStarts(src string) []int {
+	var list []int
+	name := -1 // offset of the last identifier, if the last token
+	for i := 0; i < len(src); {
+		n := tokenLen(src[i:])
+		switch tok := src[i : i+n]; {
+		case isSpaceToken(tok) || isCommentToken(tok):
+		case tok == "<-":
+			if name >= 0 {
+				list = append(list, name)
+			}
+			name = -1
+		case identLen(tok) > 0:
+			name = i
+		default:
+			name = -1
+		}
+		i += n
+	}
+
+	return list
+}
+
+// parseRules parses the grammar at path with content data, as parseFile,
+// calling fn with each rule in order.  Each rule definition is parsed on its
+// own, so that the memory used is proportional to the size of the largest
+// rule instead of the size of the file.
+func parseRules(path string, data []byte, fn func(rule Rule) error) error {
+	return parseRulesRecover(path, data, fn, nil)
+}
+
+// parseRulesRecover parses the grammar as parseRules but, when onError is
+// not nil, calls it with the syntax error of each rule definition that does
+// not parse, named as the rule, and continues with the next definition.
+func parseRulesRecover(path string, data []byte, fn func(rule Rule) error, onError func(name string, err *ParseError)) error {
+	if p := dialectPlugin(path); p != nil {
+		rules, err := p.read(path, data)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if err := fn(rule); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	src := importComments(data)
+	starts := ruleStarts(string(src))
+	if len(starts) == 0 {
+		// Report the error of the parser.
+		_, err := parseChunk(path, src)
+
+		return err
+	}
+	first := starts[0]
+	starts[0] = 0
+	line, col, last := 1, 1, 0
+	count := 0
+	for i, start := range starts {
+		end := len(src)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		// Position of the start of the chunk.
+		chunk := src[last:start]
+		if nl := bytes.Count(chunk, []byte("\n")); nl > 0 {
+			line += nl
+			col = 1 + utf8.RuneCount(chunk[bytes.LastIndexByte(chunk, '\n')+1:])
+		} else {
+			col += utf8.RuneCount(chunk)
+		}
+		last = start
+		adjust := func(pos *Pos) {
+			if pos.Line == 1 {
+				pos.Col += col - 1
+			}
+			pos.Line += line - 1
+			pos.Offset += start
+			pos.Filename = path
+		}
+
+		rules, err := parseChunk(path, src[start:end])
+		var perr *ParseError
+		if onError != nil && errors.As(err, &perr) {
+			adjust(&perr.Pos)
+			name := start
+			if i == 0 {
+				name = first
+			}
+			onError(string(src[name:name+tokenLen(string(src[name:end]))]), perr)
+
+			continue
+		}
+		if err != nil || len(rules) != 1 {
+			// Report the error with its position in the file.
+			if _, ferr := parseChunk(path, src); ferr != nil {
+				return ferr
+			}
+			if err == nil {
+				err = fmt.Errorf("%s: unexpected rule definitions at offset %d", path, start)
+			}
+
+			return err
+		}
+		rule := rules[0]
+		adjust(&rule.Pos)
+		rule.Comments = precedingComments(data, rule.Pos.Offset)
+		if err := fn(rule); err != nil {
+			return err
+		}
+		count++
+	}
+	slog.Debug("parsed grammar", "path", path, "rules", count)
+
+	return nil
+}
+
+// parseChunk parses the rule definitions in src.
+func parseChunk(path string, src []byte) ([]Rule, error) {
+	pn, err := Parse(path, src)
+	if err != nil {
+		return nil, parseError(path, err)
+	}
+
+	// Convert interface to concrete type.
+	slice, ok := pn.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: unexpected parser result %T", path, pn)
+	}
+	rules := make([]Rule, len(slice))
+	for i, ent := range slice {
+		if rules[i], ok = ent.(Rule); !ok {
+			return nil, fmt.Errorf("%s: unexpected parser result %T", path, ent)
+		}
+	}
+
+	return rules, nil
+}
+
+// ParseGrammar parses the grammar at path with content data, without
+// resolving the include directives.  It never panics: a failure of the
+// parser on malformed input is returned as an error.
+func ParseGrammar(path string, data []byte) ([]Rule, error) {
+	return ParseGrammarContext(context.Background(), path, data)
+}
+
+// ParseGrammarContext parses the grammar as ParseGrammar, returning the
+// error of ctx when it is done before all the rules are parsed.
+func ParseGrammarContext(ctx context.Context, path string, data []byte) (rules []Rule, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			rules, err = nil, fmt.Errorf("%s: internal parser error: %v", path, v)
+		}
+	}()
+	err = parseRules(path, data, func(rule Rule) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Grammar is a grammar file whose rules are parsed as they are iterated,
+// without resolving the include directives.
+type Grammar struct {
+	path string
+	data []byte
+	err  error
+}
+
+// NewGrammar returns the grammar at path with content data.
+func NewGrammar(path string, data []byte) *Grammar {
+	return &Grammar{path: path, data: data}
+}
+
+// errStopRules stops the parsing of the rules of a grammar when the
+// iteration is stopped.
+var errStopRules = errors.New("stop")
+
+// Rules returns an iterator over the rules of g, in order, each parsed when
+// it is yielded.  The iteration stops at the first rule definition that does
+// not parse; the error is then returned by Err.
+func (g *Grammar) Rules() iter.Seq[Rule] {
+	return func(yield func(Rule) bool) {
+		g.err = nil
+		yielding := false
+		defer func() {
+			if v := recover(); v != nil {
+				if yielding {
+					panic(v)
+				}
+				g.err = fmt.Errorf("%s: internal parser error: %v", g.path, v)
+			}
+		}()
+		err := parseRules(g.path, g.data, func(rule Rule) error {
+			yielding = true
+			more := yield(rule)
+			yielding = false
+			if !more {
+				return errStopRules
+			}
+
+			return nil
+		})
+		if err != nil && err != errStopRules {
+			g.err = err
+		}
+	}
+}
+
+// Err returns the error that stopped the last iteration of the rules of g,
+// if any.
+func (g *Grammar) Err() error {
+	return g.err
+}
+
+// runDigest prints the digest of the rules of each grammar, as computed by
+// the Digest method of the service, followed by its path.  The text of the
+// rules is not retained.
+func runDigest(args []string) {
+	for _, p := range args {
+		fsys, name, err := grammarFS(p)
+		if err != nil {
+			fatal(err)
+		}
+		inc := newIncluder(fsys)
+		inc.dropText = true
+		grammar, err := inc.load(name)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("%s  %s\n", digest(grammar), p)
+	}
+}
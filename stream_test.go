@@ -0,0 +1,135 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// grammarSeeds are the seed grammars of the fuzz targets.
+var grammarSeeds = []string{
+	"",
+	"A <- 'a'\n",
+	"A <- 'a' B* / !C 'c' / D\nB <- 'x' ('y' / 'z')+\n",
+	"# comment\nA <- [a-z0-9_]+ . &'x' 'b'?\n",
+	"Expr <- Expr '+' Term / Term\nTerm <- [0-9]{1,3}\n",
+	"A <- #{ state } 'a' %{label}\nB <- 'b' //{label} 'recover'\n",
+	"A <- \"a\\n\" 'b\\'' [\\]\\-]\n",
+	"A <- (\n",
+	"A <- 'a'\nA <- 'b'\n",
+}
+
+// FuzzParseGrammar checks that ParseGrammar never panics, and that the
+// rules it returns can be parsed again.
+func FuzzParseGrammar(f *testing.F) {
+	for _, seed := range grammarSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		grammar, err := ParseGrammar("fuzz.peg", []byte(src))
+		if err != nil {
+			return
+		}
+		for _, rule := range grammar {
+			if _, err := parseExprArg("fuzz.peg", rule.Expr); err != nil {
+				t.Errorf("rule %s: expression %q does not parse: %v", rule.Name, rule.Expr, err)
+			}
+		}
+	})
+}
+
+// TestParseGrammarBound checks that ParseGrammar reports the invalid
+// repetition bounds at the position of the bound.
+func TestParseGrammarBound(t *testing.T) {
+	for _, src := range []string{
+		"A <- 'a'{}\n",
+		"A <- 'a'{5,2} B\nB <- 'b'\n",
+		"A <- 'a'{99999999999999999999}\n",
+		"A <- 'a'{1,99999999999999999999}\n",
+	} {
+		_, err := ParseGrammar("bound.peg", []byte(src))
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: got error %v, want a ParseError", src, err)
+
+			continue
+		}
+		if perr.Pos.Line != 1 || perr.Pos.Col != 9 || !strings.Contains(perr.Msg, "invalid repetition bound") {
+			t.Errorf("%q: got error %v, want an invalid bound at 1:9", src, err)
+		}
+	}
+	for _, src := range []string{
+		"A <- 'a'{2}\n",
+		"A <- 'a'{2,}\n",
+		"A <- 'a'{,2}\n",
+		"A <- 'a'{2,2} # {5,2}\n",
+	} {
+		if _, err := ParseGrammar("bound.peg", []byte(src)); err != nil {
+			t.Errorf("%q: unexpected error %v", src, err)
+		}
+	}
+}
+
+// largeGrammar returns a generated grammar of n rules, each with a comment,
+// a few alternatives, literals, classes and references to the next rules.
+func largeGrammar(n int) []byte {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "# Rule R%d.\n", i)
+		fmt.Fprintf(&b, "R%d <- 'k%d' R%d* / [a-z0-9_]+ R%d? / \"s\\n\" (R%d / !'x' .)+\n",
+			i, i, (i+1)%n, (i+2)%n, (i+3)%n)
+	}
+
+	return []byte(b.String())
+}
+
+func benchmarkParse(b *testing.B, parse func(data []byte) error) {
+	for _, n := range []int{100, 10000} {
+		data := largeGrammar(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := parse(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParseRules(b *testing.B) {
+	benchmarkParse(b, func(data []byte) error {
+		return parseRules("large.peg", data, func(rule Rule) error {
+			return nil
+		})
+	})
+}
+
+// BenchmarkParseWhole is the baseline of BenchmarkParseRules: the whole
+// grammar is parsed at once by the generated parser and converted to a
+// slice of rules, as before the rules were parsed one at a time.
+func BenchmarkParseWhole(b *testing.B) {
+	benchmarkParse(b, func(data []byte) error {
+		rules, err := parseChunk("large.peg", importComments(data))
+		for i := range rules {
+			rules[i].Pos.Filename = "large.peg"
+			rules[i].Comments = precedingComments(data, rules[i].Pos.Offset)
+		}
+
+		return err
+	})
+}
+
+func BenchmarkParseFile(b *testing.B) {
+	benchmarkParse(b, func(data []byte) error {
+		_, err := parseFile("large.peg", data)
+
+		return err
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// minRuleSimilarity is the minimum similarity for two rules with unrelated
+// names to be paired by structure.
+const minRuleSimilarity = 0.6
+
+// structureString returns the expression expr in canonical form, with the
+// references renamed by fn, or its significant tokens when expr does not
+// parse.
+func structureString(expr string, fn func(string) string) string {
+	toks := renameIdents(tokenize(expr), fn)
+	n, err := parseExpr(strings.Join(toks, ""))
+	if err != nil {
+		return strings.Join(significant(toks), " ")
+	}
+
+	return exprString(n)
+}
+
+// pairByStructure pairs the lhs rules with the name keys lnames that match
+// no rhs rule with the rhs rules with the name keys rnames that match no lhs
+// rule.  Rules are paired greedily, first when their expressions have the
+// same structure, with the references to the rules already paired renamed,
+// until no more rules are paired, and then by similarity.  It returns the rhs
+// name key paired with each lhs name key.
+func pairByStructure(lgrammar, rgrammar []Rule, lnames, rnames []string, opts *options) map[string]string {
+	lset := make(map[string]bool)
+	for _, name := range lnames {
+		lset[name] = true
+	}
+	rset := make(map[string]bool)
+	for _, name := range rnames {
+		rset[name] = true
+	}
+	var lfree, rfree []int
+	for i, name := range lnames {
+		if !rset[name] {
+			lfree = append(lfree, i)
+		}
+	}
+	for j, name := range rnames {
+		if !lset[name] {
+			rfree = append(rfree, j)
+		}
+	}
+
+	pairs := make(map[string]string)
+	paired := make(map[string]bool) // rhs name keys
+	popts := *opts
+	popts.pairs = pairs
+	rexprs := make(map[int]string)
+	for _, j := range rfree {
+		rexprs[j] = structureString(rgrammar[j].Expr, opts.name)
+	}
+
+	// Pair the rules with the same structure.
+	for changed := true; changed; {
+		changed = false
+		index := make(map[string]int) // lhs rule of each expression
+		for _, i := range lfree {
+			if _, ok := pairs[lnames[i]]; ok {
+				continue
+			}
+			expr := structureString(lgrammar[i].Expr, popts.lhsName)
+			if _, ok := index[expr]; !ok {
+				index[expr] = i
+			}
+		}
+		for _, j := range rfree {
+			i, ok := index[rexprs[j]]
+			if !ok || paired[rnames[j]] {
+				continue
+			}
+			pairs[lnames[i]] = rnames[j]
+			paired[rnames[j]] = true
+			delete(index, rexprs[j])
+			changed = true
+		}
+	}
+
+	// Pair the most similar remaining rules.
+	type candidate struct {
+		i, j  int
+		score float64
+	}
+	var list []candidate
+	for _, j := range rfree {
+		if paired[rnames[j]] {
+			continue
+		}
+		for _, i := range lfree {
+			if _, ok := pairs[lnames[i]]; ok {
+				continue
+			}
+			if s := similarity(structureString(lgrammar[i].Expr, popts.lhsName), rexprs[j]); s >= minRuleSimilarity {
+				list = append(list, candidate{i, j, s})
+			}
+		}
+	}
+	sort.SliceStable(list, func(a, b int) bool {
+		return list[a].score > list[b].score
+	})
+	for _, c := range list {
+		if _, ok := pairs[lnames[c.i]]; ok || paired[rnames[c.j]] {
+			continue
+		}
+		pairs[lnames[c.i]] = rnames[c.j]
+		paired[rnames[c.j]] = true
+	}
+
+	return pairs
+}
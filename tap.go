@@ -0,0 +1,76 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// formatTAP writes a Test Anything Protocol stream, with a test point for
+// each rule, failing when the rule changed, and a failing test point for
+// each finding introduced by rhs and each issue of the lhs reference
+// grammar.  The diagnostics are in YAML blocks.
+func formatTAP(w io.Writer, r *report) error {
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", len(r.changes)+len(r.findings)+len(r.lhsIssues))
+
+	n := 0
+	for _, c := range r.changes {
+		n++
+		rule := c.rhs
+		if rule == nil {
+			rule = c.lhs
+		}
+		desc := rule.Name
+		if c.moved {
+			desc += " (moved)"
+		}
+		if c.kind == ruleEqual {
+			fmt.Fprintf(w, "ok %d - %s\n", n, desc)
+
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s\n", n, desc)
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintf(w, "  status: %s\n", statusNames[c.kind])
+		if c.copyOf != nil {
+			fmt.Fprintf(w, "  copy_of: %s\n", strconv.Quote(c.copyOf.Name))
+		}
+		if c.lhs != nil {
+			fmt.Fprintf(w, "  lhs: %s\n", strconv.Quote(c.lhs.Expr))
+			fmt.Fprintf(w, "  lhs_at: %s\n", strconv.Quote(c.lhs.Pos.String()))
+		}
+		if c.rhs != nil {
+			fmt.Fprintf(w, "  rhs: %s\n", strconv.Quote(c.rhs.Expr))
+			fmt.Fprintf(w, "  rhs_at: %s\n", strconv.Quote(c.rhs.Pos.String()))
+		}
+		fmt.Fprintln(w, "  ...")
+	}
+
+	for _, f := range r.findings {
+		n++
+		fmt.Fprintf(w, "not ok %d - %s: %s\n", n, f.rule.Name, f.analyzer)
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintf(w, "  message: %s\n", strconv.Quote(f.msg))
+		fmt.Fprintf(w, "  severity: %s\n", f.severity)
+		fmt.Fprintf(w, "  at: %s\n", strconv.Quote(f.rule.Pos.String()))
+		fmt.Fprintln(w, "  ...")
+	}
+
+	for _, f := range r.lhsIssues {
+		n++
+		fmt.Fprintf(w, "not ok %d - lhs %s: %s\n", n, f.rule.Name, f.analyzer)
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintf(w, "  message: %s\n", strconv.Quote(f.msg))
+		fmt.Fprintf(w, "  severity: %s\n", f.severity)
+		fmt.Fprintf(w, "  at: %s\n", strconv.Quote(f.rule.Pos.String()))
+		fmt.Fprintln(w, "  ...")
+	}
+
+	return nil
+}
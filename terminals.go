@@ -0,0 +1,110 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// terminalDiff is the difference between the terminals of two grammars,
+// independent of the rules using them.
+type terminalDiff struct {
+	// Literals used by only one grammar, sorted.
+	lhsOnly, rhsOnly []string
+
+	// Code points matched by the character classes of only one grammar.
+	lhsPoints, rhsPoints runeSet
+}
+
+// terminals returns the values of the non empty literals of s, sorted, and
+// the code points matched by its character classes.  The any expression is
+// ignored, since it matches all code points.
+func terminals(s *syntax) ([]string, runeSet) {
+	seen := make(map[string]bool)
+	var lits []string
+	var set runeSet
+	for i := range s.rules {
+		n, ok := s.nodes[s.rules[i].Name]
+		if !ok {
+			continue
+		}
+		walk(n, func(n node) {
+			switch n := n.(type) {
+			case *litNode:
+				if n.value != "" && !seen[n.value] {
+					seen[n.value] = true
+					lits = append(lits, n.value)
+				}
+			case *classNode:
+				set = append(set, n.set...)
+			}
+		})
+	}
+	sort.Strings(lits)
+
+	return lits, set.normalize()
+}
+
+// diffTerminals returns the terminals used by only one of lgrammar and
+// rgrammar, or nil when they use the same terminals.
+func diffTerminals(lgrammar, rgrammar []Rule) *terminalDiff {
+	llits, lset := terminals(newSyntax(lgrammar))
+	rlits, rset := terminals(newSyntax(rgrammar))
+	d := &terminalDiff{
+		lhsOnly:   stringsMinus(llits, rlits),
+		rhsOnly:   stringsMinus(rlits, llits),
+		lhsPoints: lset.minus(rset),
+		rhsPoints: rset.minus(lset),
+	}
+	if len(d.lhsOnly) == 0 && len(d.rhsOnly) == 0 && len(d.lhsPoints) == 0 && len(d.rhsPoints) == 0 {
+		return nil
+	}
+
+	return d
+}
+
+// stringsMinus returns the strings of the sorted list a that are not in the
+// sorted list b.
+func stringsMinus(a, b []string) []string {
+	var list []string
+	for _, s := range a {
+		if i := sort.SearchStrings(b, s); i == len(b) || b[i] != s {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+// quoteLiterals returns the literals quoted and separated by commas.
+func quoteLiterals(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// writeTerminals writes the terminals used by only one grammar.
+func writeTerminals(w io.Writer, d *terminalDiff) {
+	if len(d.lhsOnly) > 0 {
+		fmt.Fprintf(w, "! literals only in lhs: %s\n", quoteLiterals(d.lhsOnly))
+	}
+	if len(d.rhsOnly) > 0 {
+		fmt.Fprintf(w, "! literals only in rhs: %s\n", quoteLiterals(d.rhsOnly))
+	}
+	if len(d.lhsPoints) > 0 {
+		fmt.Fprintf(w, "! code points only in lhs classes: %s\n", d.lhsPoints)
+	}
+	if len(d.rhsPoints) > 0 {
+		fmt.Fprintf(w, "! code points only in rhs classes: %s\n", d.rhsPoints)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenize splits a rule expression into identifiers, literals, character
+// classes, operators and runs of white space.  White space is kept, so that
+// the concatenation of the tokens is always equal to expr.
+func tokenize(expr string) []string {
+	var toks []string
+	for i := 0; i < len(expr); {
+		n := tokenLen(expr[i:])
+		toks = append(toks, expr[i:i+n])
+		i += n
+	}
+
+	return toks
+}
+
+// tokenLen returns the length of the token at the start of s.
+func tokenLen(s string) int {
+	switch c := s[0]; {
+	case isSpace(c):
+		n := 1
+		for n < len(s) && isSpace(s[n]) {
+			n++
+		}
+
+		return n
+	case identLen(s) > 0:
+		return identLen(s)
+	case c == '\'' || c == '"':
+		return quotedLen(s, c)
+	case c == '[':
+		return quotedLen(s, ']')
+	case c == '{':
+		return quotedLen(s, '}')
+	case strings.HasPrefix(s, "#{"):
+		return 1 + codeLen(s[1:])
+	case c == '#':
+		if n := strings.IndexByte(s, '\n'); n >= 0 {
+			return n + 1
+		}
+
+		return len(s)
+	case strings.HasPrefix(s, "<-"):
+		return 2
+	case strings.HasPrefix(s, "//{"):
+		return 2 + quotedLen(s[2:], '}')
+	case strings.HasPrefix(s, "%{"):
+		return 1 + quotedLen(s[1:], '}')
+	}
+	_, n := utf8.DecodeRuneInString(s)
+
+	return n
+}
+
+// quotedLen returns the length of the literal or character class at the
+// start of s, terminated by the unescaped delimiter end.  An unterminated
+// literal extends to the end of s.
+func quotedLen(s string, end byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case end:
+			return i + 1
+		}
+	}
+
+	return len(s)
+}
+
+// codeLen returns the length of the code block, with balanced braces, at the
+// start of s.  An unterminated block extends to the end of s.
+func codeLen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(s)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isIdentStart and isIdentCont match the identifiers of pigeon: a Unicode
+// letter or underscore, followed by letters, underscores and decimal digits.
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdentCont(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
+
+// identLen returns the length of the identifier at the start of s, or 0.
+func identLen(s string) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !isIdentCont(r) || n == 0 && !isIdentStart(r) {
+			break
+		}
+		n += size
+	}
+
+	return n
+}
+
+// isCommentToken reports whether tok is a comment.
+func isCommentToken(tok string) bool {
+	return tok[0] == '#' && !strings.HasPrefix(tok, "#{")
+}
+
+// isSpaceToken reports whether tok is a run of white space.
+func isSpaceToken(tok string) bool {
+	return tok != "" && isSpace(tok[0])
+}
+
+// normalizeCode collapses the white space in the code blocks of toks, so that
+// reformatted code compares equal.
+func normalizeCode(toks []string) []string {
+	var list []string
+	for i, tok := range toks {
+		if !strings.HasPrefix(tok, "#{") || !strings.HasSuffix(tok, "}") {
+			continue
+		}
+		if code := "#{" + codeString(tok[2:len(tok)-1]) + "}"; code != tok {
+			if list == nil {
+				list = append([]string(nil), toks...)
+			}
+			list[i] = code
+		}
+	}
+	if list == nil {
+		return toks
+	}
+
+	return list
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlTables are the tables of a TOML document, by name, with the keys
+// before the first table in the table with the empty name.  Values are
+// strings, booleans, integers or arrays of strings.
+type tomlTables map[string]map[string]interface{}
+
+// parseTOML parses the subset of TOML used by the configuration files:
+// tables, comments and, on a single line, key value pairs with a basic or
+// literal string, boolean, integer or array of strings value.
+func parseTOML(name string, data []byte) (tomlTables, error) {
+	doc := tomlTables{"": {}}
+	table := ""
+	for n, line := range strings.Split(string(data), "\n") {
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", name, n+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 || !isComment(line[end+1:]) {
+				return nil, errorf("invalid table header")
+			}
+			table = strings.TrimSpace(line[1:end])
+			if _, ok := doc[table]; ok && table != "" {
+				return nil, errorf("duplicate table %q", table)
+			}
+			doc[table] = make(map[string]interface{})
+
+			continue
+		}
+
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errorf("missing = after key")
+		}
+		key = strings.TrimSpace(key)
+		if k, err := strconv.Unquote(key); err == nil {
+			key = k
+		}
+		if _, ok := doc[table][key]; ok {
+			return nil, errorf("duplicate key %q", key)
+		}
+		v, rest, err := parseTOMLValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		if !isComment(rest) {
+			return nil, errorf("unexpected %s", strings.TrimSpace(rest))
+		}
+		doc[table][key] = v
+	}
+
+	return doc, nil
+}
+
+// isComment reports whether s is empty or only contains a comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+
+	return s == "" || s[0] == '#'
+}
+
+// parseTOMLValue parses the value at the start of s, returning the rest of s.
+func parseTOMLValue(s string) (interface{}, string, error) {
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		// Find the closing quote, skipping escapes.
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid string %s", s[:i+1])
+				}
+
+				return v, s[i+1:], nil
+			}
+		}
+
+		return nil, "", fmt.Errorf("unterminated string")
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+
+		return s[1 : end+1], s[end+2:], nil
+	case s[0] == '[':
+		list := []string{}
+		s = strings.TrimSpace(s[1:])
+		for {
+			if s != "" && s[0] == ']' {
+				return list, s[1:], nil
+			}
+			v, rest, err := parseTOMLValue(s)
+			if err != nil {
+				return nil, "", err
+			}
+			str, ok := v.(string)
+			if !ok {
+				return nil, "", fmt.Errorf("array items must be strings")
+			}
+			list = append(list, str)
+			s = strings.TrimSpace(rest)
+			if s != "" && s[0] == ',' {
+				s = strings.TrimSpace(s[1:])
+			} else if s == "" || s[0] != ']' {
+				return nil, "", fmt.Errorf("missing ] after array")
+			}
+		}
+	}
+
+	end := strings.IndexAny(s, " \t#,]")
+	if end < 0 {
+		end = len(s)
+	}
+	word := s[:end]
+	switch word {
+	case "true":
+		return true, s[end:], nil
+	case "false":
+		return false, s[end:], nil
+	}
+	if v, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 0, 64); err == nil {
+		return v, s[end:], nil
+	}
+
+	return nil, "", fmt.Errorf("invalid value %s", word)
+}
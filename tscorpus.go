@@ -0,0 +1,114 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "strings"
+
+// corpusInput is an input of a corpus.
+type corpusInput struct {
+	name  string
+	input string
+}
+
+// corpusInputs returns the inputs of the corpus file name with content data:
+// the test cases of a tree-sitter corpus file, named after the file and the
+// test, or else the whole content.
+func corpusInputs(name string, data []byte) []corpusInput {
+	tests, ok := parseTreeSitterCorpus(string(data))
+	if !ok {
+		return []corpusInput{{name, string(data)}}
+	}
+	list := make([]corpusInput, len(tests))
+	for i, t := range tests {
+		list[i] = corpusInput{name + ": " + t.name, t.input}
+	}
+
+	return list
+}
+
+// corpusDelimiter returns the suffix of the delimiter line, made of at
+// least three c characters followed by an optional suffix.
+func corpusDelimiter(line string, c byte) (string, bool) {
+	n := 0
+	for n < len(line) && line[n] == c {
+		n++
+	}
+	if n < 3 {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[n:]), true
+}
+
+// parseTreeSitterCorpus returns the test cases of the tree-sitter corpus
+// file with content src, reporting whether src is a corpus file, starting
+// with a header.  A test case is
+//
+//	==================
+//	Name
+//	==================
+//
+//	input
+//
+//	---
+//
+//	(expected tree)
+//
+// where the delimiters may have a suffix, as ==========||| and ---|||, and
+// the name may be followed by attributes, as :skip.  The expected trees are
+// ignored, since only the acceptance of the inputs is compared.
+func parseTreeSitterCorpus(src string) ([]corpusInput, bool) {
+	lines := strings.SplitAfter(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start == len(lines) {
+		return nil, false
+	}
+	suffix, ok := corpusDelimiter(strings.TrimSpace(lines[start]), '=')
+	if !ok {
+		return nil, false
+	}
+
+	var list []corpusInput
+	for i := start; i < len(lines); {
+		// Header.
+		if s, ok := corpusDelimiter(strings.TrimSpace(lines[i]), '='); !ok || s != suffix || i+1 == len(lines) {
+			return nil, false
+		}
+		name := strings.TrimSpace(lines[i+1])
+		i += 2
+		for i < len(lines) && strings.HasPrefix(lines[i], ":") {
+			i++ // attributes
+		}
+		if i == len(lines) {
+			return nil, false
+		}
+		if s, ok := corpusDelimiter(strings.TrimSpace(lines[i]), '='); !ok || s != suffix {
+			return nil, false
+		}
+		i++
+
+		// Input, up to the divider.
+		var input strings.Builder
+		for ; i < len(lines); i++ {
+			if s, ok := corpusDelimiter(strings.TrimSpace(lines[i]), '-'); ok && s == suffix {
+				break
+			}
+			input.WriteString(lines[i])
+		}
+		list = append(list, corpusInput{name, strings.Trim(input.String(), "\n")})
+
+		// Expected tree, up to the next header.
+		for i++; i < len(lines); i++ {
+			if s, ok := corpusDelimiter(strings.TrimSpace(lines[i]), '='); ok && s == suffix {
+				break
+			}
+		}
+	}
+
+	return list, true
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+const unionUsage = `Usage: pegcmp union [-o path] [-prefer lhs|rhs] lhs-path rhs-path`
+
+// unionEntry is a rule of the union of two grammars.  When the grammars
+// define the rule differently, both lhs and rhs are set.
+type unionEntry struct {
+	name     string
+	lhs, rhs *Rule
+}
+
+// union returns the rules of lgrammar and rgrammar sorted by name, keeping
+// the first definition of each rule.
+func union(lgrammar, rgrammar []Rule) []unionEntry {
+	index := make(map[string]int)
+	var list []unionEntry
+	for i := range lgrammar {
+		rule := &lgrammar[i]
+		if _, ok := index[rule.Name]; !ok {
+			index[rule.Name] = len(list)
+			list = append(list, unionEntry{name: rule.Name, lhs: rule})
+		}
+	}
+	for i := range rgrammar {
+		rule := &rgrammar[i]
+		j, ok := index[rule.Name]
+		if !ok {
+			index[rule.Name] = len(list)
+			list = append(list, unionEntry{name: rule.Name, rhs: rule})
+
+			continue
+		}
+		if e := &list[j]; e.rhs == nil && e.lhs.Expr != rule.Expr {
+			e.rhs = rule
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+
+	return list
+}
+
+// writeRule writes rule with its preceding comments.
+func writeRule(w io.Writer, rule *Rule) {
+	for _, comment := range rule.Comments {
+		fmt.Fprintf(w, "# %s\n", comment)
+	}
+	fmt.Fprintf(w, "%s <- %s\n", rule.Name, rule.Expr)
+}
+
+// writeUnion writes the union of the grammars, resolving the conflicts as
+// specified by prefer or with conflict markers when prefer is empty.  It
+// returns the number of conflicts.
+func writeUnion(w io.Writer, list []unionEntry, lpath, rpath, prefer string) int {
+	conflicts := 0
+	for i, e := range list {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		switch {
+		case e.rhs == nil:
+			writeRule(w, e.lhs)
+		case e.lhs == nil:
+			writeRule(w, e.rhs)
+		case prefer == "lhs":
+			writeRule(w, e.lhs)
+		case prefer == "rhs":
+			writeRule(w, e.rhs)
+		default:
+			conflicts++
+			fmt.Fprintf(w, "<<<<<<< %s\n", lpath)
+			writeRule(w, e.lhs)
+			fmt.Fprintln(w, "=======")
+			writeRule(w, e.rhs)
+			fmt.Fprintf(w, ">>>>>>> %s\n", rpath)
+		}
+	}
+
+	return conflicts
+}
+
+// runUnion writes a grammar with the rules of both grammars.  The exit
+// status is 1 when there are unresolved conflicts.
+func runUnion(args []string) {
+	flags := flag.NewFlagSet("union", flag.ExitOnError)
+	output := flags.String("o", "", "write the merged grammar to the specified file instead of stdout")
+	prefer := flags.String("prefer", "",
+		"resolve conflicts with the lhs or rhs rule, instead of conflict markers")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, unionUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	paths := parseInterspersed(flags, args)
+	if len(paths) != 2 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+	switch *prefer {
+	case "", "lhs", "rhs":
+	default:
+		fatalf("unknown side %q", *prefer)
+	}
+	lpath, rpath := paths[0], paths[1]
+
+	lgrammar, err := parse(lpath)
+	if err != nil {
+		fatal(err)
+	}
+	rgrammar, err := parse(rpath)
+	if err != nil {
+		fatal(err)
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			fatal(err)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	conflicts := writeUnion(bw, union(lgrammar, rgrammar), lpath, rpath, *prefer)
+	if err := bw.Flush(); err != nil {
+		fatal(err)
+	}
+	if *output != "" {
+		if err := w.Close(); err != nil {
+			fatal(err)
+		}
+	}
+	if conflicts > 0 {
+		slog.Warn("unresolved conflicts", "rules", conflicts)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// equivalence is the evidence, found while comparing two grammars, that they
+// are equivalent.
+type equivalence struct {
+	// The rules have the same names and expressions, in the same order,
+	// before normalization.
+	bytes bool
+
+	// Each rule matches a rule with an expression with the same structure,
+	// and the start rules match.
+	structural bool
+
+	// The grammars were normalized before comparing them.
+	normalized bool
+
+	// The fraction, in the range [0, 1], of the rules of both grammars that
+	// were added, removed or changed structure.
+	distance float64
+}
+
+// maxLikelyDistance is the maximum structural distance of two grammars that
+// agree on a corpus for them to be likely equivalent.  A corpus rarely
+// exercises the whole of two grammars that differ this much.
+const maxLikelyDistance = 0.25
+
+// newEquivalence returns the equivalence of the grammars rawl and rawr, with
+// the normalized grammars lgrammar and rgrammar and the changes between them.
+func newEquivalence(rawl, rawr, lgrammar, rgrammar []Rule, changes []change, opts *options) *equivalence {
+	eq := &equivalence{
+		bytes:      sameRules(rawl, rawr),
+		structural: len(lgrammar) > 0 && len(rgrammar) > 0,
+		normalized: len(opts.normalizer) > 0 || opts.normalize != "" && opts.normalize != "none",
+	}
+	total, changed := len(lgrammar), 0
+	for _, c := range changes {
+		switch {
+		case c.lhs == nil || c.rhs == nil:
+			eq.structural = false
+			changed++
+			if c.lhs == nil {
+				total++
+			}
+		case c.kind == ruleModified && structureString(c.lhs.Expr, opts.name) != structureString(c.rhs.Expr, opts.name):
+			eq.structural = false
+			changed++
+		case c.rhs == &rgrammar[0] && c.lhs != &lgrammar[0]:
+			eq.structural = false
+		}
+	}
+	if total > 0 {
+		eq.distance = float64(changed) / float64(total)
+	}
+
+	return eq
+}
+
+// sameRules reports whether a and b have the same rules in the same order,
+// ignoring their positions.
+func sameRules(a, b []Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Expr != b[i].Expr {
+			return false
+		}
+	}
+
+	return true
+}
+
+// verdict is the equivalence of two grammars combining all the analyses.
+type verdict struct {
+	equivalent bool
+	confidence string   // byte, structural, likely or undetermined
+	evidence   []string // for a likely or undetermined equivalence
+}
+
+// newVerdict returns the verdict of r, that must have its equivalence.  The
+// grammars are likely equivalent when they have the same structure after
+// normalization or they agree on a corpus, and different when they disagree
+// on a corpus.  The equivalence is undetermined when the only evidence is
+// the agreement on a corpus, but the structural distance is greater than
+// maxLikelyDistance.
+func newVerdict(r *report) verdict {
+	agree := r.corpus != nil && r.corpus.inputs > 0 && len(r.corpus.diffs) == 0
+	switch {
+	case r.corpus != nil && len(r.corpus.diffs) > 0:
+		return verdict{}
+	case r.equiv.bytes:
+		return verdict{equivalent: true, confidence: "byte"}
+	case r.equiv.structural && !r.equiv.normalized:
+		return verdict{equivalent: true, confidence: "structural"}
+	}
+	var evidence []string
+	if r.equiv.structural {
+		evidence = append(evidence, "semantic normalization")
+	}
+	if agree {
+		evidence = append(evidence, fmt.Sprintf("corpus agreement on %d inputs", r.corpus.inputs))
+	}
+	if len(evidence) == 0 {
+		return verdict{}
+	}
+	if !r.equiv.structural && r.equiv.distance > maxLikelyDistance {
+		evidence = append(evidence, fmt.Sprintf("structural distance %.0f%%", 100*r.equiv.distance))
+
+		return verdict{confidence: "undetermined", evidence: evidence}
+	}
+
+	return verdict{equivalent: true, confidence: "likely", evidence: evidence}
+}
+
+// String returns the verdict as in "equivalent (byte)" or "different".
+func (v verdict) String() string {
+	switch {
+	case v.confidence == "undetermined":
+		return "undetermined (" + strings.Join(v.evidence, ", ") + ")"
+	case !v.equivalent:
+		return "different"
+	case v.confidence == "likely":
+		return "likely equivalent (" + strings.Join(v.evidence, " + ") + ")"
+	}
+
+	return "equivalent (" + v.confidence + ")"
+}
+
+// writeVerdict writes the verdict of r.
+func writeVerdict(w io.Writer, r *report) {
+	fmt.Fprintf(w, "~ verdict: %s\n", newVerdict(r))
+}
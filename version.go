@@ -0,0 +1,379 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release download from GitHub.  Each release has a binary for each platform,
+// named for example pegcmp_linux_amd64 or pegcmp_windows_amd64.exe, and the
+// SHA-256 checksums of the binaries in the sha256sum format.
+//
+// The checksums are downloaded from the same release as the binary, so they
+// only detect a corrupted download; they do not authenticate the release.
+const (
+	releaseURL       = "https://api.github.com/repos/perillo/pegcmp/releases/latest"
+	releaseChecksums = "SHA256SUMS"
+)
+
+// buildInfo is the version and the version control metadata of the binary.
+type buildInfo struct {
+	version   string // module version, or (devel)
+	revision  string
+	time      string
+	modified  bool
+	goVersion string
+}
+
+// readBuildInfo returns the build metadata embedded in the binary.
+func readBuildInfo() buildInfo {
+	info := buildInfo{version: "(devel)", goVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if v := bi.Main.Version; v != "" {
+		info.version = v
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.revision = s.Value
+		case "vcs.time":
+			info.time = s.Value
+		case "vcs.modified":
+			info.modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
+
+const versionUsage = `Usage: pegcmp version`
+
+// runVersion writes the version and build metadata, the supported grammar
+// dialects and the versions of the formats, for bug reports.  The plugins
+// specified on the command line are listed with their dialects.
+func runVersion(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, versionUsage)
+
+		os.Exit(2)
+	}
+	writeVersion(os.Stdout, readBuildInfo())
+}
+
+// writeVersion writes the version report with the build metadata info.
+func writeVersion(w io.Writer, info buildInfo) {
+	fmt.Fprintf(w, "pegcmp %s\n", info.version)
+	if info.revision != "" {
+		commit := info.revision
+		if info.time != "" {
+			commit += " " + info.time
+		}
+		if info.modified {
+			commit += " (modified)"
+		}
+		fmt.Fprintf(w, "commit: %s\n", commit)
+	}
+	fmt.Fprintf(w, "go: %s %s/%s\n", info.goVersion, runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintln(w, "dialects:")
+	fmt.Fprintln(w, "  peg .peg (built-in)")
+	for _, p := range plugins {
+		fmt.Fprintf(w, "  %s %s (plugin %s)\n", p.name, strings.Join(p.extensions, " "), strings.Join(p.command, " "))
+	}
+	fmt.Fprintln(w, "formats:")
+	fmt.Fprintf(w, "  json report %s (%s)\n", jsonVersion, jsonSchemaURL)
+	fmt.Fprintf(w, "  service %s\n", strings.Trim(servicePath, "/"))
+}
+
+// release is the latest release, as returned by the GitHub API.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns the download URL of the asset named name.
+func (r *release) asset(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+
+	return "", false
+}
+
+// releaseClient is the client of the release downloads, with a timeout long
+// enough for a binary on a slow connection.
+var releaseClient = &http.Client{Timeout: 5 * time.Minute}
+
+// download returns the content of the resource at u.
+func download(u string) ([]byte, error) {
+	resp, err := releaseClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// checksum returns the SHA-256 checksum of the file name in sums, in the
+// sha256sum format.
+func checksum(sums []byte, name string) (string, bool) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+
+	return "", false
+}
+
+// semver is a semantic version, as in v1.2.3-rc.1+build.
+type semver struct {
+	major, minor, patch int
+	pre                 []string // prerelease identifiers
+}
+
+// parseSemver parses the semantic version v, with the leading v.  The build
+// metadata is ignored.
+func parseSemver(v string) (semver, bool) {
+	var sv semver
+	rest, ok := strings.CutPrefix(v, "v")
+	if !ok {
+		return sv, false
+	}
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, pre, hasPre := strings.Cut(rest, "-")
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return sv, false
+	}
+	nums := []*int{&sv.major, &sv.minor, &sv.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return sv, false
+		}
+		*nums[i] = n
+	}
+	if hasPre {
+		sv.pre = strings.Split(pre, ".")
+		for _, id := range sv.pre {
+			if id == "" {
+				return sv, false
+			}
+		}
+	}
+
+	return sv, true
+}
+
+// compareSemver returns -1, 0 or 1 as a is less than, equal to or greater
+// than b, by the semantic versioning precedence.
+func compareSemver(a, b semver) int {
+	for _, d := range []int{a.major - b.major, a.minor - b.minor, a.patch - b.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1 // a release follows its prereleases
+	case len(b.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		x, y := a.pre[i], b.pre[i]
+		if x == y {
+			continue
+		}
+		m, errx := strconv.Atoi(x)
+		n, erry := strconv.Atoi(y)
+		switch {
+		case errx == nil && erry == nil:
+			return sign(m - n)
+		case errx == nil:
+			return -1 // numeric identifiers precede the others
+		case erry == nil:
+			return 1
+		}
+
+		return strings.Compare(x, y)
+	}
+
+	return sign(len(a.pre) - len(b.pre))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+
+	return 0
+}
+
+const selfUpdateUsage = `Usage: pegcmp self-update [-check] [-force]`
+
+// runSelfUpdate replaces the running binary with the binary of the latest
+// release for the platform, after verifying its checksum, when the release
+// is newer.  A development build, with no version, is only replaced with
+// -force.  With -check, it only reports whether an update is available.
+func runSelfUpdate(args []string) {
+	flags := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := flags.Bool("check", false, "only report whether an update is available")
+	force := flags.Bool("force", false, "replace a development build with the latest release")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, selfUpdateUsage)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+
+		os.Exit(2)
+	}
+
+	data, err := download(releaseURL)
+	if err != nil {
+		fatal(err)
+	}
+	var rel release
+	if err := json.Unmarshal(data, &rel); err != nil {
+		fatalf("invalid release: %v", err)
+	}
+	latest, ok := parseSemver(rel.Tag)
+	if !ok {
+		fatalf("invalid release version %q", rel.Tag)
+	}
+	current := readBuildInfo().version
+	if sv, ok := parseSemver(current); !ok {
+		if *check || !*force {
+			fmt.Printf("pegcmp %s is a development build, the latest release is %s\n", current, rel.Tag)
+			if !*check {
+				fmt.Println("use -force to replace it")
+			}
+
+			return
+		}
+	} else if compareSemver(sv, latest) >= 0 {
+		fmt.Printf("pegcmp %s is up to date, the latest release is %s\n", current, rel.Tag)
+
+		return
+	}
+	if *check {
+		fmt.Printf("pegcmp %s is available, current version %s\n", rel.Tag, current)
+
+		return
+	}
+
+	name := "pegcmp_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	binURL, ok := rel.asset(name)
+	if !ok {
+		fatalf("release %s has no binary for %s/%s", rel.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	sumsURL, ok := rel.asset(releaseChecksums)
+	if !ok {
+		fatalf("release %s has no %s file", rel.Tag, releaseChecksums)
+	}
+	sums, err := download(sumsURL)
+	if err != nil {
+		fatal(err)
+	}
+	want, ok := checksum(sums, name)
+	if !ok {
+		fatalf("release %s has no checksum for %s", rel.Tag, name)
+	}
+	bin, err := download(binURL)
+	if err != nil {
+		fatal(err)
+	}
+	sum := sha256.Sum256(bin)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		fatalf("%s: checksum mismatch: got %s, want %s", name, got, want)
+	}
+
+	if err := replaceExecutable(bin); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("pegcmp updated from %s to %s\n", current, rel.Tag)
+}
+
+// replaceExecutable replaces the running binary with bin, writing it to a
+// temporary file in the same directory and renaming it.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(exe), ".pegcmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(bin); err != nil {
+		f.Close()
+
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// A running binary cannot be replaced, but it can be renamed.
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(f.Name(), exe)
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+)
+
+// The WebAssembly build registers a global pegcmp object, instead of running
+// the command line interface:
+//
+//	pegcmp.parse(name, content)
+//	pegcmp.lint(name, content)
+//	pegcmp.compare(lhsName, lhsContent, rhsName, rhsContent, format, normalize)
+//
+// Each function returns an object with the output property, the JSON
+// document or the formatted report, or with the error property.  Include
+// directives are not resolved.
+func init() {
+	jsMain = func() {
+		js.Global().Set("pegcmp", map[string]interface{}{
+			"parse":   jsFunc(jsParse),
+			"lint":    jsFunc(jsLint),
+			"compare": jsFunc(jsCompare),
+		})
+
+		// Keep the functions alive.
+		select {}
+	}
+}
+
+// jsFunc wraps fn as a JavaScript function taking string arguments.
+func jsFunc(fn func(args []string) (string, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		list := make([]string, len(args))
+		for i, arg := range args {
+			list[i] = arg.String()
+		}
+		out, err := fn(list)
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+
+		return map[string]interface{}{"output": out}
+	})
+}
+
+func jsParse(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("parse: want 2 arguments, got %d", len(args))
+	}
+	grammar, err := ParseGrammar(args[0], []byte(args[1]))
+	if err != nil {
+		return "", err
+	}
+
+	resp := parseResponse{Rules: []jsonParsedRule{}}
+	for _, rule := range grammar {
+		resp.Rules = append(resp.Rules, jsonParsedRule{rule.Name, rule.Expr, rule.Pos})
+	}
+	data, err := json.Marshal(resp)
+
+	return string(data), err
+}
+
+func jsLint(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("lint: want 2 arguments, got %d", len(args))
+	}
+	grammar, err := ParseGrammar(args[0], []byte(args[1]))
+	if err != nil {
+		return "", err
+	}
+
+	resp := lintResponse{Findings: []jsonFinding{}}
+	for _, f := range analyze(newSyntax(grammar)) {
+		resp.Findings = append(resp.Findings, newJSONFinding(f))
+	}
+	data, err := json.Marshal(resp)
+
+	return string(data), err
+}
+
+func jsCompare(args []string) (string, error) {
+	if len(args) < 4 || len(args) > 6 {
+		return "", fmt.Errorf("compare: want 4 to 6 arguments, got %d", len(args))
+	}
+	format, normalize := "text", "none"
+	if len(args) > 4 {
+		format = args[4]
+	}
+	if len(args) > 5 {
+		normalize = args[5]
+	}
+	formatFn, ok := formatters[format]
+	if !ok {
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+
+	lgrammar, err := ParseGrammar(args[0], []byte(args[1]))
+	if err != nil {
+		return "", err
+	}
+	rgrammar, err := ParseGrammar(args[2], []byte(args[3]))
+	if err != nil {
+		return "", err
+	}
+	opts := &options{normalize: normalize}
+	changes := compare(lgrammar, rgrammar, opts)
+	r := &report{
+		lpath:    args[0],
+		rpath:    args[2],
+		lgrammar: lgrammar,
+		rgrammar: rgrammar,
+		changes:  changes,
+		findings: newFindings(analyze(newSyntax(lgrammar)), analyze(newSyntax(rgrammar))),
+		context:  -1,
+		equiv:    newEquivalence(lgrammar, rgrammar, lgrammar, rgrammar, changes, opts),
+	}
+	var b bytes.Buffer
+	err = formatFn(&b, r)
+
+	return b.String(), err
+}
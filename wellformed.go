@@ -0,0 +1,285 @@
+// Copyright 2022 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "strings"
+
+// wellFormedAnalyzer reports the rules that are not well-formed, as defined
+// by Ford in "Parsing Expression Grammars: A Recognition-Based Syntactic
+// Foundation", and may loop forever: repetitions of expressions that succeed
+// without consuming input and recursion without consuming input that never
+// succeeds.  Left recursion with an alternative that succeeds is reported by
+// the left recursion analyzer instead.
+var wellFormedAnalyzer = &analyzer{
+	name: "well-formed",
+	run:  runWellFormed,
+}
+
+// resultSet is a set of the possible results of an expression.
+type resultSet uint8
+
+const (
+	outcomeEmpty   resultSet = 1 << iota // succeeds without consuming input
+	outcomeConsume                       // succeeds consuming input
+	outcomeFail                          // fails
+)
+
+const outcomeSuccess = outcomeEmpty | outcomeConsume
+
+// wellFormed is the termination analysis of a grammar.
+type wellFormed struct {
+	s        *syntax
+	outcomes map[string]resultSet // of each rule
+	wf       map[string]bool      // well-formed rules
+
+	// Outcomes of each rule when a recursive invocation that consumes no
+	// input fails, as with the support for left recursion.
+	seeded map[string]resultSet
+}
+
+// newWellFormed computes the outcomes of the rules of s and the well-formed
+// rules, as the least fixed points of Ford's definitions.
+func newWellFormed(s *syntax) *wellFormed {
+	w := &wellFormed{
+		s:        s,
+		outcomes: make(map[string]resultSet),
+		wf:       make(map[string]bool),
+		seeded:   make(map[string]resultSet),
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, n := range s.nodes {
+			if o := w.outcome(n, w.outcomes); o != w.outcomes[name] {
+				w.outcomes[name] = o
+				changed = true
+			}
+		}
+	}
+
+	// The seeded outcomes only grow, so that the iteration ends even with
+	// the predicates.
+	for name := range s.nodes {
+		w.seeded[name] = outcomeFail
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, n := range s.nodes {
+			if o := w.seeded[name] | w.outcome(n, w.seeded); o != w.seeded[name] {
+				w.seeded[name] = o
+				changed = true
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, n := range s.nodes {
+			if !w.wf[name] && w.wellFormed(n) {
+				w.wf[name] = true
+				changed = true
+			}
+		}
+	}
+
+	return w
+}
+
+// seqOutcome returns the outcome of the sequence e1 e2, where e1 and e2 have
+// outcome a and b.
+func seqOutcome(a, b resultSet) resultSet {
+	var o resultSet
+	if a&outcomeEmpty != 0 {
+		o |= b
+	}
+	if a&outcomeConsume != 0 {
+		if b&outcomeSuccess != 0 {
+			o |= outcomeConsume
+		}
+		o |= b & outcomeFail
+	}
+
+	return o | a&outcomeFail
+}
+
+// starOutcome returns the outcome of e*, where e has outcome a.  A
+// repetition never fails.
+func starOutcome(a resultSet) resultSet {
+	var o resultSet
+	if a&outcomeConsume != 0 {
+		o |= outcomeConsume
+	}
+	if a&outcomeFail != 0 {
+		o |= outcomeEmpty
+	}
+
+	return o
+}
+
+// outcome returns the possible results of n, with the specified outcomes of
+// the rules.
+func (w *wellFormed) outcome(n node, rules map[string]resultSet) resultSet {
+	switch n := n.(type) {
+	case *choiceNode:
+		o := outcomeFail
+		for _, alt := range n.alts {
+			if o&outcomeFail == 0 {
+				break
+			}
+			o = o&outcomeSuccess | w.outcome(alt, rules)
+		}
+
+		return o
+	case *seqNode:
+		o := outcomeEmpty
+		for _, item := range n.items {
+			o = seqOutcome(o, w.outcome(item, rules))
+		}
+
+		return o
+	case *predNode:
+		e := w.outcome(n.expr, rules)
+		var o resultSet
+		succeeds, fails := e&outcomeSuccess != 0, e&outcomeFail != 0
+		if n.op == '!' {
+			succeeds, fails = fails, succeeds
+		}
+		if succeeds {
+			o |= outcomeEmpty
+		}
+		if fails {
+			o |= outcomeFail
+		}
+
+		return o
+	case *repeatNode:
+		e := w.outcome(n.expr, rules)
+		min, max := n.bounds()
+
+		// The outcome of a sequence of repetitions of e does not change
+		// after two of them.
+		o := outcomeEmpty
+		for i := 0; i < min && i < 2; i++ {
+			o = seqOutcome(o, e)
+		}
+		if max < 0 {
+			return seqOutcome(o, starOutcome(e))
+		}
+		opt := e & outcomeSuccess
+		if e&outcomeFail != 0 {
+			opt |= outcomeEmpty
+		}
+		for i := min; i < max && i < min+2; i++ {
+			o = seqOutcome(o, opt)
+		}
+
+		return o
+	case *recoveryNode:
+		o := w.outcome(n.expr, rules)
+		if o&outcomeFail != 0 {
+			o |= w.outcome(n.recover, rules)
+		}
+
+		return o
+	case *stateNode:
+		return outcomeEmpty
+	case *throwNode:
+		return outcomeFail
+	case *refNode:
+		if _, ok := w.s.nodes[n.name]; !ok {
+			return outcomeFail
+		}
+
+		return rules[n.name]
+	case *litNode:
+		if n.value == "" {
+			return outcomeEmpty
+		}
+	}
+
+	return outcomeConsume | outcomeFail
+}
+
+// wellFormed reports whether n is well-formed, with the current well-formed
+// rules.
+func (w *wellFormed) wellFormed(n node) bool {
+	switch n := n.(type) {
+	case *choiceNode:
+		for _, alt := range n.alts {
+			if !w.wellFormed(alt) {
+				return false
+			}
+		}
+	case *seqNode:
+		// The items after one that consumes input are invoked on a
+		// shorter input.
+		for _, item := range n.items {
+			if !w.wellFormed(item) {
+				return false
+			}
+			if w.outcome(item, w.outcomes)&outcomeEmpty == 0 {
+				break
+			}
+		}
+	case *predNode:
+		return w.wellFormed(n.expr)
+	case *repeatNode:
+		if _, max := n.bounds(); max < 0 && w.outcome(n.expr, w.outcomes)&outcomeEmpty != 0 {
+			return false
+		}
+
+		return w.wellFormed(n.expr)
+	case *recoveryNode:
+		return w.wellFormed(n.expr) && w.wellFormed(n.recover)
+	case *refNode:
+		if _, ok := w.s.nodes[n.name]; ok {
+			return w.wf[n.name]
+		}
+	}
+
+	return true
+}
+
+func runWellFormed(s *syntax) []finding {
+	var list []finding
+	w := newWellFormed(s)
+	var graph refGraph
+	for i := range s.rules {
+		rule := &s.rules[i]
+		root, ok := s.nodes[rule.Name]
+		if !ok || w.wf[rule.Name] {
+			continue
+		}
+
+		loops := false
+		walk(root, func(n node) {
+			rep, ok := n.(*repeatNode)
+			if !ok {
+				return
+			}
+			if _, max := rep.bounds(); max < 0 && w.outcome(rep.expr, w.outcomes)&outcomeEmpty != 0 {
+				list = append(list, finding{
+					severity: severityError,
+					rule:     rule,
+					msg:      "repetition " + text(rule, rep) + " of an expression that succeeds without consuming input loops forever",
+				})
+				loops = true
+			}
+		})
+		if loops || w.seeded[rule.Name]&outcomeSuccess != 0 {
+			continue
+		}
+		if graph == nil {
+			graph = newLeftGraph(s)
+		}
+		if path := graph.path(rule.Name, rule.Name); path != nil {
+			list = append(list, finding{
+				severity: severityError,
+				rule:     rule,
+				msg:      "rule recurses without consuming input and never succeeds: " + strings.Join(path, " -> "),
+			})
+		}
+	}
+
+	return list
+}